@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/joho/godotenv"
+
+	"github.com/javajoker/imi-backend/internal/utils"
 )
 
 type Config struct {
@@ -19,6 +21,10 @@ type Config struct {
 	AWS         AWSConfig
 	Blockchain  BlockchainConfig
 	Payment     PaymentConfig
+	Currency    CurrencyConfig
+	License     LicenseConfig
+	Certificate CertificateConfig
+	Scan        ScanConfig
 	Email       EmailConfig
 	I18n        I18nConfig
 	Frontend    FrontendConfig
@@ -29,11 +35,12 @@ type FrontendConfig struct {
 }
 
 type ServerConfig struct {
-	Port         string
-	Host         string
-	ReadTimeout  int
-	WriteTimeout int
-	IdleTimeout  int
+	Port           string
+	Host           string
+	ReadTimeout    int
+	WriteTimeout   int
+	IdleTimeout    int
+	TrustedProxies string // comma-separated IPs or CIDRs whose X-Forwarded-For gives the client IP
 }
 
 type DatabaseConfig struct {
@@ -75,15 +82,46 @@ type BlockchainConfig struct {
 	RPC_URL         string
 	PrivateKey      string
 	ContractAddress string
+	AnchorInterval  int // in seconds
+	AnchorBatchSize int
 }
 
 type PaymentConfig struct {
 	StripeSecretKey      string
 	StripePublishableKey string
+	StripeWebhookSecret  string
 	PayPalClientID       string
 	PayPalClientSecret   string
+	PayPalAPIBase        string
+	DefaultProvider      string // provider for payment methods that do not name one
 	PlatformFeePercent   float64
 	MinimumPayout        float64
+	SettlementHoldDays   int // days sale proceeds stay pending before they can be paid out
+	ReservationTTL       int // minutes a pending purchase holds its inventory
+	PayoutStaleHours     int // hours a processing payout waits for its provider before admins are alerted
+}
+
+type CurrencyConfig struct {
+	Reporting string // currency that balances and revenue reports are totalled in
+	Rates     string // FX rates for reporting, e.g. "EUR=1.08,TWD=0.031": one unit in the reporting currency
+}
+
+type LicenseConfig struct {
+	MaxChainDepth int // licenses between a product and the original IP, inclusive
+}
+
+type CertificateConfig struct {
+	SigningKey string // base64-encoded Ed25519 seed
+	TTLDays    int
+}
+
+type ScanConfig struct {
+	RegionHeader       string // CDN header carrying the client country, e.g. CF-IPCountry
+	TrustedProxies     string // comma-separated IPs or CIDRs allowed to set RegionHeader
+	AnomalyWindow      int    // minutes of scans the detector looks at
+	MaxRegions         int    // distinct regions per code within the window
+	MaxScans           int    // scans per code within the window
+	AlertCooldownHours int
 }
 
 type EmailConfig struct {
@@ -107,11 +145,12 @@ func Load() (*Config, error) {
 	config := &Config{
 		Environment: getEnv("ENVIRONMENT", "development"),
 		Server: ServerConfig{
-			Port:         getEnv("SERVER_PORT", "8080"),
-			Host:         getEnv("SERVER_HOST", "localhost"),
-			ReadTimeout:  getEnvAsInt("SERVER_READ_TIMEOUT", 15),
-			WriteTimeout: getEnvAsInt("SERVER_WRITE_TIMEOUT", 15),
-			IdleTimeout:  getEnvAsInt("SERVER_IDLE_TIMEOUT", 60),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			ReadTimeout:    getEnvAsInt("SERVER_READ_TIMEOUT", 15),
+			WriteTimeout:   getEnvAsInt("SERVER_WRITE_TIMEOUT", 15),
+			IdleTimeout:    getEnvAsInt("SERVER_IDLE_TIMEOUT", 60),
+			TrustedProxies: getEnv("SERVER_TRUSTED_PROXIES", ""),
 		},
 		Database: DatabaseConfig{
 			Host:         getEnv("DB_HOST", "localhost"),
@@ -147,13 +186,41 @@ func Load() (*Config, error) {
 			RPC_URL:         getEnv("BLOCKCHAIN_RPC_URL", ""),
 			PrivateKey:      getEnv("BLOCKCHAIN_PRIVATE_KEY", ""),
 			ContractAddress: getEnv("BLOCKCHAIN_CONTRACT_ADDRESS", ""),
+			AnchorInterval:  getEnvAsInt("BLOCKCHAIN_ANCHOR_INTERVAL", 300),
+			AnchorBatchSize: getEnvAsInt("BLOCKCHAIN_ANCHOR_BATCH_SIZE", 1000),
 		},
 		Payment: PaymentConfig{
 			StripeSecretKey:      getEnv("STRIPE_SECRET_KEY", ""),
 			StripePublishableKey: getEnv("STRIPE_PUBLISHABLE_KEY", ""),
+			StripeWebhookSecret:  getEnv("STRIPE_WEBHOOK_SECRET", ""),
 			PayPalClientID:       getEnv("PAYPAL_CLIENT_ID", ""),
 			PayPalClientSecret:   getEnv("PAYPAL_CLIENT_SECRET", ""),
+			PayPalAPIBase:        getEnv("PAYPAL_API_BASE", "https://api-m.sandbox.paypal.com"),
+			DefaultProvider:      getEnv("PAYMENT_DEFAULT_PROVIDER", "stripe"),
 			PlatformFeePercent:   getEnvAsFloat("PLATFORM_FEE_PERCENT", 5.0),
+			MinimumPayout:        getEnvAsFloat("PAYMENT_MINIMUM_PAYOUT", 10.0),
+			SettlementHoldDays:   getEnvAsInt("PAYMENT_SETTLEMENT_HOLD_DAYS", 7),
+			ReservationTTL:       getEnvAsInt("PAYMENT_RESERVATION_TTL", 30),
+			PayoutStaleHours:     getEnvAsInt("PAYMENT_PAYOUT_STALE_HOURS", 72),
+		},
+		Currency: CurrencyConfig{
+			Reporting: getEnv("REPORTING_CURRENCY", "USD"),
+			Rates:     getEnv("FX_RATES", ""),
+		},
+		License: LicenseConfig{
+			MaxChainDepth: getEnvAsInt("LICENSE_MAX_CHAIN_DEPTH", 3),
+		},
+		Certificate: CertificateConfig{
+			SigningKey: getEnv("CERTIFICATE_SIGNING_KEY", ""),
+			TTLDays:    getEnvAsInt("CERTIFICATE_TTL_DAYS", 365),
+		},
+		Scan: ScanConfig{
+			RegionHeader:       getEnv("SCAN_REGION_HEADER", "CF-IPCountry"),
+			TrustedProxies:     getEnv("SCAN_TRUSTED_PROXIES", ""),
+			AnomalyWindow:      getEnvAsInt("SCAN_ANOMALY_WINDOW", 60),
+			MaxRegions:         getEnvAsInt("SCAN_MAX_REGIONS", 5),
+			MaxScans:           getEnvAsInt("SCAN_MAX_SCANS", 100),
+			AlertCooldownHours: getEnvAsInt("SCAN_ALERT_COOLDOWN_HOURS", 24),
 		},
 		Email: EmailConfig{
 			SMTPHost:     getEnv("SMTP_HOST", "smtp.gmail.com"),
@@ -167,6 +234,9 @@ func Load() (*Config, error) {
 			DefaultLocale: getEnv("DEFAULT_LOCALE", "en"),
 			LocalesPath:   getEnv("LOCALES_PATH", "./internal/i18n/locales"),
 		},
+		Frontend: FrontendConfig{
+			BaseURL: getEnv("FRONTEND_BASE_URL", "http://localhost:3000"),
+		},
 	}
 
 	return config, config.Validate()
@@ -181,6 +251,24 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database password is required in production")
 	}
 
+	if c.Certificate.SigningKey == "" && c.Environment == "production" {
+		return fmt.Errorf("certificate signing key is required in production")
+	}
+
+	if c.Certificate.SigningKey != "" {
+		if _, err := utils.ParseEd25519PrivateKey(c.Certificate.SigningKey); err != nil {
+			return fmt.Errorf("invalid certificate signing key: %w", err)
+		}
+	}
+
+	if _, err := utils.ParseNetworks(c.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid server trusted proxies: %w", err)
+	}
+
+	if _, err := utils.ParseNetworks(c.Scan.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid scan trusted proxies: %w", err)
+	}
+
 	return nil
 }
 
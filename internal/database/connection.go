@@ -85,14 +85,31 @@ func RunMigrations(db *gorm.DB) error {
 		&models.IPAsset{},
 		&models.LicenseTerms{},
 		&models.LicenseApplication{},
+		&models.LicenseAgreement{},
 		&models.Product{},
 		&models.Transaction{},
+		&models.Refund{},
+		&models.CartItem{},
+		&models.Order{},
+		&models.OrderItem{},
 		&models.AuthorizationChain{},
+		&models.ProductUnit{},
+		&models.InventoryReservation{},
+		&models.VerificationScan{},
+		&models.Account{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.Payout{},
+		&models.WebhookEvent{},
 		&models.AdminSettings{},
 		&models.AuditLog{},
 		&models.AdminNotification{},
 		&models.ContentReport{},
 		&models.PlatformAnalytics{},
+		&models.LedgerEntry{},
+		&models.LedgerAnchor{},
+		&models.LedgerBatch{},
+		&models.LedgerProof{},
 	)
 
 	if err != nil {
@@ -104,6 +121,16 @@ func RunMigrations(db *gorm.DB) error {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
+	// Make the provenance ledger append-only
+	if err := createLedgerGuards(db); err != nil {
+		return fmt.Errorf("failed to create ledger guards: %w", err)
+	}
+
+	// Repair existing data once
+	if err := runDataMigrations(db); err != nil {
+		return fmt.Errorf("failed to run data migrations: %w", err)
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
@@ -166,6 +193,87 @@ func createIndexes(db *gorm.DB) error {
 	return nil
 }
 
+// createLedgerGuards rejects UPDATE and DELETE on ledger_entries at the
+// database level, so rewriting provenance history requires dropping the trigger.
+func createLedgerGuards(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'ledger_entries is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS trg_ledger_entries_append_only ON ledger_entries",
+		`CREATE TRIGGER trg_ledger_entries_append_only
+		BEFORE UPDATE OR DELETE ON ledger_entries
+		FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only()`,
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dataMigration is a one-off repair of existing rows. Each one runs once and
+// is recorded by name in data_migrations.
+type dataMigration struct {
+	name string
+	run  func(tx *gorm.DB) error
+}
+
+var dataMigrations = []dataMigration{
+	{
+		// Revenue shares used to carry the buyer of their sale
+		name: "detach_revenue_shares_from_buyers",
+		run: func(tx *gorm.DB) error {
+			return tx.Model(&models.Transaction{}).
+				Where("transaction_type = ? AND buyer_id IS NOT NULL", models.TransactionTypeRevenueShare).
+				UpdateColumn("buyer_id", nil).Error
+		},
+	},
+}
+
+// runDataMigrations applies the data migrations that have not run yet. The
+// advisory lock keeps two instances starting together from both applying one.
+func runDataMigrations(db *gorm.DB) error {
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS data_migrations (
+		name VARCHAR(100) PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`).Error; err != nil {
+		return err
+	}
+
+	for _, migration := range dataMigrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "data_migration:"+migration.name).Error; err != nil {
+				return err
+			}
+
+			var applied int64
+			if err := tx.Table("data_migrations").Where("name = ?", migration.name).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+
+			if err := migration.run(tx); err != nil {
+				return err
+			}
+			log.Printf("Applied data migration %s", migration.name)
+			return tx.Exec("INSERT INTO data_migrations (name) VALUES (?)", migration.name).Error
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", migration.name, err)
+		}
+	}
+
+	return nil
+}
+
 // Seed initial data
 func SeedInitialData(db *gorm.DB) error {
 	log.Println("Seeding initial data...")
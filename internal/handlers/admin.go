@@ -509,14 +509,12 @@ func (h *AdminHandler) ProcessRefund(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Reason string `json:"reason" validate:"required"`
-	}
-
+	var req services.RefundRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
 		return
 	}
+	req.TransactionID = transactionID
 
 	// Validate request
 	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
@@ -525,21 +523,19 @@ func (h *AdminHandler) ProcessRefund(c *gin.Context) {
 	}
 
 	// Process refund
-	if err := h.adminService.ProcessRefund(transactionID, adminID, req.Reason); err != nil {
+	refund, err := h.adminService.ProcessRefund(&req, adminID)
+	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			utils.NotFoundResponse(c, "Transaction not found")
 			return
 		}
-		if strings.Contains(err.Error(), "can only refund") {
-			utils.BadRequestResponse(c, err.Error(), nil)
-			return
-		}
 		utils.BadRequestResponse(c, err.Error(), nil)
 		return
 	}
 
 	utils.SuccessResponse(c, gin.H{
 		"message": i18n.T(lang, i18n.KeyPaymentRefunded),
+		"refund":  refund,
 	})
 }
 
@@ -0,0 +1,109 @@
+// internal/handlers/label.go
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/javajoker/imi-backend/internal/i18n"
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+type LabelHandler struct {
+	labelService *services.LabelService
+}
+
+func NewLabelHandler(labelService *services.LabelService) *LabelHandler {
+	return &LabelHandler{
+		labelService: labelService,
+	}
+}
+
+// GET /products/:id/qr
+func (h *LabelHandler) GetProductQRCode(c *gin.Context) {
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	idStr := c.Param("id")
+	productID, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid product ID", nil)
+		return
+	}
+
+	size, _ := strconv.Atoi(c.Query("size"))
+	format := c.DefaultQuery("format", "png")
+
+	image, contentType, err := h.labelService.RenderQRCode(productID, userID, format, size)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyProductNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="product-%s.%s"`, productID, strings.ToLower(format)))
+	c.Data(http.StatusOK, contentType, image)
+}
+
+// POST /products/labels
+func (h *LabelHandler) GetLabelSheet(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	var req services.LabelSheetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	sheet, err := h.labelService.RenderLabelSheet(userID, &req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="verification-labels.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", sheet)
+}
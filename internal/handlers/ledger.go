@@ -0,0 +1,105 @@
+// internal/handlers/ledger.go
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+type LedgerHandler struct {
+	blockchainService *services.BlockchainService
+}
+
+func NewLedgerHandler(blockchainService *services.BlockchainService) *LedgerHandler {
+	return &LedgerHandler{
+		blockchainService: blockchainService,
+	}
+}
+
+// GET /admin/ledger
+func (h *LedgerHandler) GetLedgerEntries(c *gin.Context) {
+	params := utils.GetPaginationParams(c)
+
+	var resourceID *uuid.UUID
+	if resourceIDStr := c.Query("resource_id"); resourceIDStr != "" {
+		id, err := uuid.Parse(resourceIDStr)
+		if err != nil {
+			utils.BadRequestResponse(c, "Invalid resource ID", nil)
+			return
+		}
+		resourceID = &id
+	}
+
+	entries, total, err := h.blockchainService.GetLedgerEntries(resourceID, params)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	result := utils.CreatePaginationResult(entries, total, params)
+	utils.PaginatedResponse(c, result)
+}
+
+// GET /admin/ledger/verify
+func (h *LedgerHandler) VerifyLedger(c *gin.Context) {
+	result, err := h.blockchainService.VerifyLedger()
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"verification": result,
+	})
+}
+
+// GET /admin/ledger/anchors/:hash
+func (h *LedgerHandler) GetAnchor(c *gin.Context) {
+	hash := c.Param("hash")
+	if hash == "" {
+		utils.BadRequestResponse(c, "Hash is required", nil)
+		return
+	}
+
+	anchor, err := h.blockchainService.GetAnchor(hash)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, "Anchor not found")
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"anchor": anchor,
+	})
+}
+
+// GET /verify/preimage/:hash
+func (h *LedgerHandler) GetPreimage(c *gin.Context) {
+	hash := c.Param("hash")
+	if hash == "" {
+		utils.BadRequestResponse(c, "Hash is required", nil)
+		return
+	}
+
+	preimage, err := h.blockchainService.GetPreimage(hash)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, "Ledger record not found")
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"preimage": preimage,
+	})
+}
@@ -2,6 +2,9 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -51,12 +54,21 @@ func (h *LicenseHandler) ApplyForLicense(c *gin.Context) {
 	}
 
 	// Apply for license
-	application, err := h.licenseService.ApplyForLicense(applicantID, &req)
+	application, payment, err := h.licenseService.ApplyForLicense(applicantID, &req)
 	if err != nil {
 		utils.BadRequestResponse(c, err.Error(), nil)
 		return
 	}
 
+	if application.Status == models.ApplicationStatusAwaitingPayment {
+		utils.CreatedResponse(c, gin.H{
+			"message":     i18n.T(lang, i18n.KeyLicenseAwaitingPayment),
+			"application": application,
+			"payment":     payment,
+		})
+		return
+	}
+
 	utils.CreatedResponse(c, gin.H{
 		"message":     i18n.T(lang, i18n.KeyLicenseApplied),
 		"application": application,
@@ -196,12 +208,275 @@ func (h *LicenseHandler) ApproveLicense(c *gin.Context) {
 		return
 	}
 
+	message := i18n.T(lang, i18n.KeyLicenseApproved)
+	if application.Status == models.ApplicationStatusAwaitingPayment {
+		message = i18n.T(lang, i18n.KeyLicenseAwaitingPayment)
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message":     message,
+		"application": application,
+	})
+}
+
+// POST /licenses/:id/pay
+func (h *LicenseHandler) PayLicenseFee(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid license application ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	applicantID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	var req services.PayLicenseFeeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	payment, err := h.licenseService.PayLicenseFee(applicationID, applicantID, &req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyLicenseNotFound)
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	utils.SuccessResponse(c, payment)
+}
+
+// POST /licenses/:id/renew
+func (h *LicenseHandler) RenewLicense(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid license application ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	applicantID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	var req services.RenewLicenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	application, payment, err := h.licenseService.RenewLicense(applicationID, applicantID, &req)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyLicenseNotFound)
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	// Paid renewals extend the license once the payment succeeds
+	if payment != nil {
+		utils.SuccessResponse(c, gin.H{
+			"application": application,
+			"payment":     payment,
+		})
+		return
+	}
+
 	utils.SuccessResponse(c, gin.H{
-		"message":     i18n.T(lang, i18n.KeyLicenseApproved),
+		"message":     i18n.T(lang, i18n.KeyLicenseRenewed),
 		"application": application,
 	})
 }
 
+// GET /licenses/:id/agreement?format=html|pdf
+func (h *LicenseHandler) GetLicenseAgreement(c *gin.Context) {
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid license application ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	document, _, err := h.licenseService.GetLicenseAgreement(applicationID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyLicenseNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	hash, err := document.Hash()
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+	c.Header("X-Document-Hash", hash)
+
+	switch strings.ToLower(c.DefaultQuery("format", "html")) {
+	case "html":
+		html, err := document.HTML()
+		if err != nil {
+			utils.InternalErrorResponse(c, err.Error())
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+	case "pdf":
+		pdf, err := document.PDF(nil)
+		if err != nil {
+			utils.InternalErrorResponse(c, err.Error())
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="license-agreement-%s.pdf"`, applicationID))
+		c.Data(http.StatusOK, "application/pdf", pdf)
+	default:
+		utils.BadRequestResponse(c, "format must be html or pdf", nil)
+	}
+}
+
+// POST /licenses/:id/agreement/sign
+func (h *LicenseHandler) SignLicenseAgreement(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid license application ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	signerID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	var req services.SignLicenseAgreementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	agreement, err := h.licenseService.SignLicenseAgreement(applicationID, signerID, &req, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, services.ErrAgreementChanged) {
+			utils.ConflictResponse(c, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyLicenseNotFound)
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	utils.CreatedResponse(c, gin.H{
+		"message":   i18n.T(lang, i18n.KeyLicenseAgreementSigned),
+		"agreement": agreement,
+	})
+}
+
+// GET /licenses/:id/agreement/signed
+func (h *LicenseHandler) GetSignedLicenseAgreement(c *gin.Context) {
+	applicationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid license application ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	application, err := h.licenseService.GetLicenseApplication(applicationID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, i18n.KeyLicenseNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	if application.Agreement == nil {
+		utils.NotFoundResponse(c, i18n.KeyLicenseAgreementNotFound)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"agreement":    application.Agreement,
+		"download_url": h.licenseService.SignedAgreementURL(application.Agreement),
+	})
+}
+
 // PUT /licenses/:id/reject
 func (h *LicenseHandler) RejectLicense(c *gin.Context) {
 	lang := utils.GetLangFromContext(c)
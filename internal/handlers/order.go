@@ -0,0 +1,260 @@
+// internal/handlers/order.go
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/javajoker/imi-backend/internal/i18n"
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+type OrderHandler struct {
+	orderService *services.OrderService
+}
+
+func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+	return &OrderHandler{
+		orderService: orderService,
+	}
+}
+
+// GET /cart
+func (h *OrderHandler) GetCart(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	cart, err := h.orderService.GetCart(userID)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"cart": cart,
+	})
+}
+
+// POST /cart/items
+func (h *OrderHandler) AddToCart(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.AddToCartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	cart, err := h.orderService.AddToCart(userID, &req)
+	if err != nil {
+		h.cartError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"cart": cart,
+	})
+}
+
+// PUT /cart/items/:product_id
+func (h *OrderHandler) UpdateCartItem(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	productID, err := uuid.Parse(c.Param("product_id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid product ID", nil)
+		return
+	}
+
+	var req services.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	cart, err := h.orderService.UpdateCartItem(userID, productID, &req)
+	if err != nil {
+		h.cartError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"cart": cart,
+	})
+}
+
+// DELETE /cart/items/:product_id
+func (h *OrderHandler) RemoveFromCart(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	productID, err := uuid.Parse(c.Param("product_id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid product ID", nil)
+		return
+	}
+
+	cart, err := h.orderService.RemoveFromCart(userID, productID)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"cart": cart,
+	})
+}
+
+// DELETE /cart
+func (h *OrderHandler) ClearCart(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.orderService.ClearCart(userID); err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"message": "Cart cleared",
+	})
+}
+
+// POST /cart/checkout
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req services.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	order, payment, err := h.orderService.Checkout(userID, &req)
+	if err != nil {
+		h.cartError(c, err)
+		return
+	}
+
+	utils.CreatedResponse(c, gin.H{
+		"message": "Order placed, awaiting payment",
+		"order":   order,
+		"payment": payment,
+	})
+}
+
+// GET /orders
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	params := utils.GetPaginationParams(c)
+
+	orders, total, err := h.orderService.GetOrders(userID, params)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	result := utils.CreatePaginationResult(orders, total, params)
+	utils.PaginatedResponse(c, result)
+}
+
+// GET /orders/:id
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid order ID", nil)
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	order, err := h.orderService.GetOrder(orderID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, "Order not found")
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"order": order,
+	})
+}
+
+func (h *OrderHandler) cartError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInsufficientInventory):
+		utils.ConflictResponse(c, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		utils.NotFoundResponse(c, err.Error())
+	default:
+		utils.BadRequestResponse(c, err.Error(), nil)
+	}
+}
+
+// currentUserID reads the authenticated user's ID, responding with an error
+// when it is missing or malformed
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
@@ -2,6 +2,8 @@
 package handlers
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
@@ -146,13 +148,19 @@ func (h *PaymentHandler) ProcessRefund(c *gin.Context) {
 	}
 
 	// Process refund
-	if err := h.paymentService.ProcessRefund(&req, &adminID); err != nil {
+	refund, err := h.paymentService.ProcessRefund(&req, &adminID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, "Transaction not found")
+			return
+		}
 		utils.BadRequestResponse(c, err.Error(), nil)
 		return
 	}
 
 	utils.SuccessResponse(c, gin.H{
 		"message": i18n.T(lang, i18n.KeyPaymentRefunded),
+		"refund":  refund,
 	})
 }
 
@@ -182,9 +190,8 @@ func (h *PaymentHandler) GetUserBalance(c *gin.Context) {
 	})
 }
 
-// POST /payments/payout
-func (h *PaymentHandler) RequestPayout(c *gin.Context) {
-	lang := utils.GetLangFromContext(c)
+// GET /payments/statement
+func (h *PaymentHandler) GetStatement(c *gin.Context) {
 	userIDStr, exists := utils.GetUserIDFromContext(c)
 	if !exists {
 		utils.UnauthorizedResponse(c, "")
@@ -197,25 +204,14 @@ func (h *PaymentHandler) RequestPayout(c *gin.Context) {
 		return
 	}
 
-	var req services.PayoutRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
-		return
-	}
-
-	// Validate request
-	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
-		utils.ValidationErrorResponse(c, validationErrors)
-		return
-	}
+	params := utils.GetPaginationParams(c)
 
-	// Request payout
-	if err := h.paymentService.RequestPayout(userID, &req); err != nil {
-		utils.BadRequestResponse(c, err.Error(), nil)
+	lines, total, err := h.paymentService.GetStatement(userID, params)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
 		return
 	}
 
-	utils.SuccessResponse(c, gin.H{
-		"message": "Payout request submitted successfully",
-	})
+	result := utils.CreatePaginationResult(lines, total, params)
+	utils.PaginatedResponse(c, result)
 }
@@ -0,0 +1,284 @@
+// internal/handlers/payout.go
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/javajoker/imi-backend/internal/i18n"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+type PayoutHandler struct {
+	payoutService *services.PayoutService
+}
+
+func NewPayoutHandler(payoutService *services.PayoutService) *PayoutHandler {
+	return &PayoutHandler{
+		payoutService: payoutService,
+	}
+}
+
+// POST /payments/payout
+func (h *PayoutHandler) RequestPayout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	var req services.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	// Request payout
+	payout, err := h.payoutService.RequestPayout(userID, &req)
+	if err != nil {
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	utils.CreatedResponse(c, gin.H{
+		"message": "Payout request submitted successfully",
+		"payout":  payout,
+	})
+}
+
+// GET /payments/payouts
+func (h *PayoutHandler) GetPayouts(c *gin.Context) {
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	params := utils.GetPaginationParams(c)
+
+	payouts, total, err := h.payoutService.GetUserPayouts(userID, params)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	result := utils.CreatePaginationResult(payouts, total, params)
+	utils.PaginatedResponse(c, result)
+}
+
+// GET /payments/payouts/:id
+func (h *PayoutHandler) GetPayout(c *gin.Context) {
+	payoutID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid payout ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	payout, err := h.payoutService.GetPayout(payoutID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			utils.NotFoundResponse(c, "Payout not found")
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"payout": payout,
+	})
+}
+
+// GET /admin/payouts
+func (h *PayoutHandler) GetPayoutQueue(c *gin.Context) {
+	params := utils.GetPaginationParams(c)
+
+	payouts, total, err := h.payoutService.GetPayoutQueue(models.PayoutStatus(c.Query("status")), params)
+	if err != nil {
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	result := utils.CreatePaginationResult(payouts, total, params)
+	utils.PaginatedResponse(c, result)
+}
+
+// PUT /admin/payouts/:id/approve
+func (h *PayoutHandler) ApprovePayout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	payoutID, adminID, ok := h.reviewParams(c)
+	if !ok {
+		return
+	}
+
+	// Notes are optional, so an empty body is fine
+	var req services.PayoutReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	payout, err := h.payoutService.ApprovePayout(payoutID, adminID, req.Notes)
+	if err != nil {
+		h.reviewError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"payout": payout,
+	})
+}
+
+// PUT /admin/payouts/:id/reject
+func (h *PayoutHandler) RejectPayout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	payoutID, adminID, ok := h.reviewParams(c)
+	if !ok {
+		return
+	}
+
+	var req services.PayoutRejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	payout, err := h.payoutService.RejectPayout(payoutID, adminID, req.Reason)
+	if err != nil {
+		h.reviewError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"payout": payout,
+	})
+}
+
+// PUT /admin/payouts/:id/complete
+func (h *PayoutHandler) CompletePayout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	payoutID, _, ok := h.reviewParams(c)
+	if !ok {
+		return
+	}
+
+	var req services.PayoutCompleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	payout, err := h.payoutService.CompletePayout(payoutID, req.Reference)
+	if err != nil {
+		h.reviewError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"payout": payout,
+	})
+}
+
+// PUT /admin/payouts/:id/fail
+func (h *PayoutHandler) FailPayout(c *gin.Context) {
+	lang := utils.GetLangFromContext(c)
+	payoutID, _, ok := h.reviewParams(c)
+	if !ok {
+		return
+	}
+
+	var req services.PayoutFailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequestResponse(c, i18n.T(lang, i18n.KeyValidationInvalid, "input"), err.Error())
+		return
+	}
+
+	// Validate request
+	if validationErrors := utils.GetValidationErrors(utils.ValidateStruct(&req)); len(validationErrors) > 0 {
+		utils.ValidationErrorResponse(c, validationErrors)
+		return
+	}
+
+	payout, err := h.payoutService.FailPayout(payoutID, req.Reason)
+	if err != nil {
+		h.reviewError(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, gin.H{
+		"payout": payout,
+	})
+}
+
+func (h *PayoutHandler) reviewParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	payoutID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid payout ID", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	adminIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	adminID, err := uuid.Parse(adminIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid admin ID", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return payoutID, adminID, true
+}
+
+func (h *PayoutHandler) reviewError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "not found") {
+		utils.NotFoundResponse(c, "Payout not found")
+		return
+	}
+	utils.BadRequestResponse(c, err.Error(), nil)
+}
@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 
@@ -120,7 +121,7 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	// Create product
 	product, err := h.productService.CreateProduct(creatorID, &req)
 	if err != nil {
-		utils.BadRequestResponse(c, err.Error(), nil)
+		utils.BadRequestResponse(c, err.Error(), policyViolation(err))
 		return
 	}
 
@@ -200,6 +201,10 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	// Update product
 	product, err := h.productService.UpdateProduct(id, creatorID, &req)
 	if err != nil {
+		if violation := policyViolation(err); violation != nil {
+			utils.BadRequestResponse(c, err.Error(), violation)
+			return
+		}
 		if strings.Contains(err.Error(), "unauthorized") {
 			utils.ForbiddenResponse(c, err.Error())
 			return
@@ -294,7 +299,7 @@ func (h *ProductHandler) PurchaseProduct(c *gin.Context) {
 	}
 
 	// Purchase product
-	transaction, err := h.productService.PurchaseProduct(productID, buyerID, &req)
+	transaction, payment, err := h.productService.PurchaseProduct(productID, buyerID, &req)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			utils.NotFoundResponse(c, i18n.KeyProductNotFound)
@@ -311,6 +316,7 @@ func (h *ProductHandler) PurchaseProduct(c *gin.Context) {
 	utils.CreatedResponse(c, gin.H{
 		"message":     i18n.T(lang, i18n.KeyProductPurchased),
 		"transaction": transaction,
+		"payment":     payment,
 	})
 }
 
@@ -334,9 +340,16 @@ func (h *ProductHandler) VerifyProduct(c *gin.Context) {
 		return
 	}
 
+	// Where the product may be sold, as every license in its chain allows
+	var territory *models.TerritorySet
+	if authorized, err := h.productService.AuthorizedTerritory(authChain.LicenseID); err == nil {
+		territory = &authorized
+	}
+
 	utils.SuccessResponse(c, gin.H{
-		"verified":            true,
-		"authorization_chain": authChain,
+		"verified":             true,
+		"authorization_chain":  authChain,
+		"authorized_territory": territory,
 	})
 }
 
@@ -472,3 +485,50 @@ func (h *ProductHandler) GetProductStatistics(c *gin.Context) {
 		"statistics": stats,
 	})
 }
+
+// GET /products/:id/units
+func (h *ProductHandler) GetProductUnits(c *gin.Context) {
+	idStr := c.Param("id")
+	productID, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid product ID", nil)
+		return
+	}
+
+	userIDStr, exists := utils.GetUserIDFromContext(c)
+	if !exists {
+		utils.UnauthorizedResponse(c, "")
+		return
+	}
+
+	creatorID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.BadRequestResponse(c, "Invalid user ID", nil)
+		return
+	}
+
+	params := utils.GetPaginationParams(c)
+
+	units, total, err := h.productService.GetProductUnits(productID, creatorID, c.Query("status"), params)
+	if err != nil {
+		if strings.Contains(err.Error(), "unauthorized") {
+			utils.ForbiddenResponse(c, err.Error())
+			return
+		}
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	result := utils.CreatePaginationResult(units, total, params)
+	utils.PaginatedResponse(c, result)
+}
+
+// policyViolation is the license policy rule err reports, if any, to return
+// in the error details
+func policyViolation(err error) interface{} {
+	var violation *models.PolicyViolation
+	if errors.As(err, &violation) {
+		return violation
+	}
+	return nil
+}
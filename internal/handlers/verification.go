@@ -2,20 +2,26 @@
 package handlers
 
 import (
+	"log"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"github.com/javajoker/imi-backend/internal/models"
 	"github.com/javajoker/imi-backend/internal/services"
 	"github.com/javajoker/imi-backend/internal/utils"
 )
 
 type VerificationHandler struct {
 	authorizationService *services.AuthorizationService
+	scanService          *services.ScanService
 }
 
-func NewVerificationHandler(authorizationService *services.AuthorizationService) *VerificationHandler {
+func NewVerificationHandler(authorizationService *services.AuthorizationService, scanService *services.ScanService) *VerificationHandler {
 	return &VerificationHandler{
 		authorizationService: authorizationService,
+		scanService:          scanService,
 	}
 }
 
@@ -27,22 +33,91 @@ func (h *VerificationHandler) VerifyProductByCode(c *gin.Context) {
 		return
 	}
 
-	// Verify product by code
-	authChain, err := h.authorizationService.VerifyProductByCode(code)
+	// Verify product by code, recording the scan for unit serial codes
+	authChain, unitScan, err := h.authorizationService.ScanProductCode(code)
+
+	event := h.newScanEvent(c, code)
+	if err != nil {
+		event.Result = models.ScanResultFailed
+		if err.Error() == "invalid verification code" {
+			event.Result = models.ScanResultInvalid
+		}
+		event.FailureReason = err.Error()
+		go h.recordScan(event)
+
+		utils.BadRequestResponse(c, err.Error(), nil)
+		return
+	}
+
+	event.Result = models.ScanResultVerified
+	event.ProductID = &authChain.ProductID
+	if unitScan != nil {
+		event.UnitID = &unitScan.Unit.ID
+		event.UnsoldUnit = unitScan.Unsold
+	}
+	go h.recordScan(event)
+
+	// A missing proof does not invalidate the chain, it is reported as absent
+	provenance, _ := h.authorizationService.GetProvenanceProof(authChain)
+
+	// Where the product may be sold, as every license in its chain allows
+	var territory *models.TerritorySet
+	if authorized, err := h.authorizationService.AuthorizedTerritory(authChain.LicenseID); err == nil {
+		territory = &authorized
+	}
+
+	response := gin.H{
+		"verified":             true,
+		"product":              authChain.Product,
+		"ip_asset":             authChain.IPAsset,
+		"license":              authChain.License,
+		"authorization_chain":  authChain,
+		"authorized_territory": territory,
+		"provenance":           provenance,
+		"unit":                 unitScan,
+	}
+
+	// The product is genuine, but this unit never left the seller
+	if unitScan != nil {
+		response["unit_status"] = unitScan.Unit.Status
+		if unitScan.Unsold {
+			response["warning"] = "This unit has not been sold. Its code may have been copied onto goods that are not genuine."
+		}
+	}
+
+	utils.SuccessResponse(c, response)
+}
+
+// GET /verify/:code/certificate
+func (h *VerificationHandler) GetProductCertificate(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		utils.BadRequestResponse(c, "Verification code is required", nil)
+		return
+	}
+
+	certificate, claims, err := h.authorizationService.IssueCertificate(code)
 	if err != nil {
 		utils.BadRequestResponse(c, err.Error(), nil)
 		return
 	}
 
 	utils.SuccessResponse(c, gin.H{
-		"verified":            true,
-		"product":             authChain.Product,
-		"ip_asset":            authChain.IPAsset,
-		"license":             authChain.License,
-		"authorization_chain": authChain,
+		"certificate": certificate,
+		"format":      "jws",
+		"algorithm":   "EdDSA",
+		"claims":      claims,
+		"jwks_url":    "/.well-known/jwks.json",
 	})
 }
 
+// GET /.well-known/jwks.json
+func (h *VerificationHandler) GetJWKS(c *gin.Context) {
+	// Served without the response envelope so standard JOSE libraries can consume it
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, h.authorizationService.GetJWKS())
+}
+
 // GET /verify/chain/:id
 func (h *VerificationHandler) VerifyAuthorizationChain(c *gin.Context) {
 	idStr := c.Param("id")
@@ -84,3 +159,21 @@ func (h *VerificationHandler) GetAuthorizationChainHistory(c *gin.Context) {
 		"authorization_chains": chains,
 	})
 }
+
+func (h *VerificationHandler) newScanEvent(c *gin.Context, code string) *services.ScanEvent {
+	event := &services.ScanEvent{
+		VerificationCode: code,
+		IPAddress:        c.ClientIP(),
+		UserAgent:        c.Request.UserAgent(),
+	}
+	if header := h.scanService.RegionHeader(c.RemoteIP()); header != "" {
+		event.Country = c.GetHeader(header)
+	}
+	return event
+}
+
+func (h *VerificationHandler) recordScan(event *services.ScanEvent) {
+	if err := h.scanService.RecordScan(event); err != nil {
+		log.Printf("Failed to record verification scan: %v", err)
+	}
+}
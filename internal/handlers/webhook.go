@@ -0,0 +1,55 @@
+// internal/handlers/webhook.go
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// maxWebhookBodyBytes bounds webhook payloads; Stripe events are well below it
+const maxWebhookBodyBytes = 65536
+
+type WebhookHandler struct {
+	paymentService *services.PaymentService
+}
+
+func NewWebhookHandler(paymentService *services.PaymentService) *WebhookHandler {
+	return &WebhookHandler{
+		paymentService: paymentService,
+	}
+}
+
+// POST /webhooks/stripe
+func (h *WebhookHandler) Stripe(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodyBytes+1))
+	if err != nil || len(payload) > maxWebhookBodyBytes {
+		utils.BadRequestResponse(c, "Invalid webhook payload", nil)
+		return
+	}
+
+	event, err := h.paymentService.ConstructStripeEvent(payload, c.GetHeader("Stripe-Signature"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidWebhookSignature) {
+			utils.BadRequestResponse(c, "Invalid webhook signature", nil)
+			return
+		}
+		utils.InternalErrorResponse(c, err.Error())
+		return
+	}
+
+	// A failed event is answered with an error so Stripe delivers it again
+	if err := h.paymentService.HandleStripeWebhook(event); err != nil {
+		log.Printf("Failed to process Stripe event %s: %v", event.ID, err)
+		utils.InternalErrorResponse(c, "Failed to process webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
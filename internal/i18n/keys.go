@@ -39,13 +39,17 @@ const (
 	KeyIPAssetVerificationPending = "ip_asset.verification_pending"
 
 	// Licenses
-	KeyLicenseApplied  = "license.applied"
-	KeyLicenseApproved = "license.approved"
-	KeyLicenseRejected = "license.rejected"
-	KeyLicenseRevoked  = "license.revoked"
-	KeyLicenseNotFound = "license.not_found"
-	KeyLicenseExpired  = "license.expired"
-	KeyLicenseInvalid  = "license.invalid"
+	KeyLicenseApplied           = "license.applied"
+	KeyLicenseApproved          = "license.approved"
+	KeyLicenseAwaitingPayment   = "license.awaiting_payment"
+	KeyLicenseRejected          = "license.rejected"
+	KeyLicenseRevoked           = "license.revoked"
+	KeyLicenseRenewed           = "license.renewed"
+	KeyLicenseAgreementSigned   = "license.agreement_signed"
+	KeyLicenseNotFound          = "license.not_found"
+	KeyLicenseAgreementNotFound = "license_agreement.not_found"
+	KeyLicenseExpired           = "license.expired"
+	KeyLicenseInvalid           = "license.invalid"
 
 	// Products
 	KeyProductCreated    = "product.created"
@@ -0,0 +1,75 @@
+// internal/models/accounting.go
+package models
+
+import (
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AccountKind identifies what an account holds. User accounts are liabilities
+// of the platform towards the user; platform accounts are owned by uuid.Nil.
+type AccountKind string
+
+const (
+	AccountPlatformCash    AccountKind = "platform_cash"    // funds held with payment processors
+	AccountPlatformRevenue AccountKind = "platform_revenue" // platform fees earned
+	AccountUserPending     AccountKind = "user_pending"     // earned, within the settlement hold
+	AccountUserAvailable   AccountKind = "user_available"   // settled, can be paid out
+	AccountUserReserved    AccountKind = "user_reserved"    // held for a requested payout
+)
+
+// JournalEntryType is the business event a journal entry records
+type JournalEntryType string
+
+const (
+	JournalEntrySale           JournalEntryType = "sale"
+	JournalEntrySettlement     JournalEntryType = "settlement"
+	JournalEntryRefund         JournalEntryType = "refund"
+	JournalEntryPayoutReserve  JournalEntryType = "payout_reserve"
+	JournalEntryPayoutRelease  JournalEntryType = "payout_release"
+	JournalEntryPayoutComplete JournalEntryType = "payout_complete"
+)
+
+// Account is one balance in the double-entry ledger. Its balance is never
+// stored; it is the sum of its journal lines.
+type Account struct {
+	BaseModel
+	OwnerID  uuid.UUID   `json:"owner_id" gorm:"type:uuid;not null;uniqueIndex:idx_accounts_owner_kind"`
+	Kind     AccountKind `json:"kind" gorm:"type:varchar(30);not null;uniqueIndex:idx_accounts_owner_kind"`
+	Currency string      `json:"currency" gorm:"size:3;not null;default:'USD';uniqueIndex:idx_accounts_owner_kind"`
+}
+
+// DebitNormal reports whether debits increase the account's balance
+func (a *Account) DebitNormal() bool {
+	return a.Kind == AccountPlatformCash
+}
+
+// JournalEntry groups balanced journal lines for one business event. The
+// idempotency key makes re-posting the same event a no-op. All lines of an
+// entry are in its currency.
+type JournalEntry struct {
+	BaseModel
+	EntryType      JournalEntryType `json:"entry_type" gorm:"type:varchar(30);not null;index"`
+	IdempotencyKey string           `json:"idempotency_key" gorm:"size:150;not null;uniqueIndex"`
+	ReferenceType  string           `json:"reference_type" gorm:"size:50;index:idx_journal_entries_reference"`
+	ReferenceID    *uuid.UUID       `json:"reference_id" gorm:"type:uuid;index:idx_journal_entries_reference"`
+	Description    string           `json:"description" gorm:"type:text"`
+	Currency       string           `json:"currency" gorm:"size:3;not null;default:'USD'"`
+
+	// Relationships
+	Lines []JournalLine `json:"lines,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
+
+// JournalLine moves money into or out of one account. Exactly one of Debit
+// and Credit is non-zero.
+type JournalLine struct {
+	BaseModel
+	JournalEntryID uuid.UUID       `json:"journal_entry_id" gorm:"type:uuid;not null;index"`
+	AccountID      uuid.UUID       `json:"account_id" gorm:"type:uuid;not null;index"`
+	Debit          decimal.Decimal `json:"debit" gorm:"type:decimal(19,4);not null;default:0"`
+	Credit         decimal.Decimal `json:"credit" gorm:"type:decimal(19,4);not null;default:0"`
+
+	// Relationships
+	Account      *Account      `json:"account,omitempty" gorm:"foreignKey:AccountID"`
+	JournalEntry *JournalEntry `json:"journal_entry,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
@@ -35,6 +35,13 @@ type AuditLog struct {
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// Admin notification types raised by the platform itself
+const (
+	AdminNotificationSuspectedCounterfeit = "suspected_counterfeit"
+	AdminNotificationOversold             = "oversold"     // paid after the stock was gone
+	AdminNotificationStalePayout          = "stale_payout" // processing past the stale limit
+)
+
 type AdminNotification struct {
 	BaseModel
 	Type                string     `json:"type" gorm:"type:varchar(50);not null;index"`
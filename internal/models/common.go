@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 )
 
@@ -28,6 +29,42 @@ func (j JSONB) Value() (driver.Value, error) {
 	return json.Marshal(j)
 }
 
+// MarshalJSON writes the decimals held in the map as JSON numbers, like Money
+func (j JSONB) MarshalJSON() ([]byte, error) {
+	if j == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(decimalsAsNumbers(map[string]interface{}(j)))
+}
+
+func decimalsAsNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		return DecimalNumber(v)
+	case JSONB:
+		return decimalsAsNumbers(map[string]interface{}(v))
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = decimalsAsNumbers(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = decimalsAsNumbers(item)
+		}
+		return converted
+	case []map[string]interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = decimalsAsNumbers(item)
+		}
+		return converted
+	}
+	return value
+}
+
 func (j *JSONB) Scan(value interface{}) error {
 	if value == nil {
 		*j = nil
@@ -87,10 +124,13 @@ const (
 type ApplicationStatus string
 
 const (
-	ApplicationStatusPending  ApplicationStatus = "pending"
-	ApplicationStatusApproved ApplicationStatus = "approved"
-	ApplicationStatusRejected ApplicationStatus = "rejected"
-	ApplicationStatusRevoked  ApplicationStatus = "revoked"
+	ApplicationStatusPending         ApplicationStatus = "pending"
+	ApplicationStatusAwaitingPayment ApplicationStatus = "awaiting_payment" // approved, license fee not yet paid
+	ApplicationStatusApproved        ApplicationStatus = "approved"
+	ApplicationStatusRejected        ApplicationStatus = "rejected"
+	ApplicationStatusRevoked         ApplicationStatus = "revoked"
+	ApplicationStatusExpired         ApplicationStatus = "expired"
+	ApplicationStatusCancelled       ApplicationStatus = "cancelled" // approved, license fee never paid
 )
 
 type ProductStatus string
@@ -102,6 +142,41 @@ const (
 	ProductStatusSuspended ProductStatus = "suspended"
 )
 
+type PayoutStatus string
+
+const (
+	PayoutStatusRequested  PayoutStatus = "requested"
+	PayoutStatusApproved   PayoutStatus = "approved"
+	PayoutStatusProcessing PayoutStatus = "processing"
+	PayoutStatusPaid       PayoutStatus = "paid"
+	PayoutStatusFailed     PayoutStatus = "failed"
+	PayoutStatusRejected   PayoutStatus = "rejected"
+)
+
+type UnitStatus string
+
+const (
+	UnitStatusUnclaimed UnitStatus = "unclaimed"
+	UnitStatusSold      UnitStatus = "sold"
+	UnitStatusScanned   UnitStatus = "scanned"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationStatusHeld      ReservationStatus = "held"      // waiting for payment
+	ReservationStatusCommitted ReservationStatus = "committed" // paid, the units are sold
+	ReservationStatusReleased  ReservationStatus = "released"  // returned to stock
+)
+
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending"   // sent to the payment provider, not yet recorded
+	RefundStatusCompleted RefundStatus = "completed" // refunded and posted to the ledger
+	RefundStatusFailed    RefundStatus = "failed"    // the provider refused it, nothing was posted
+)
+
 type TransactionType string
 
 const (
@@ -4,6 +4,7 @@ package models
 import (
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 type IPAsset struct {
@@ -19,6 +20,7 @@ type IPAsset struct {
 	BlockchainHash     string             `json:"blockchain_hash,omitempty" gorm:"size:66"`
 	Status             ProductStatus      `json:"status" gorm:"type:varchar(20);default:'active';index"`
 	Tags               pq.StringArray     `json:"tags" gorm:"type:text[]"`
+	ParentLicenseID    *uuid.UUID         `json:"parent_license_id,omitempty" gorm:"type:uuid;index"` // set for derivative works
 	ViewCount          int64              `json:"view_count" gorm:"default:0"`
 	LikeCount          int64              `json:"like_count" gorm:"default:0"`
 
@@ -30,17 +32,20 @@ type IPAsset struct {
 
 type LicenseTerms struct {
 	BaseModel
-	IPAssetID              uuid.UUID   `json:"ip_asset_id" gorm:"type:uuid;not null;index"`
-	LicenseType            LicenseType `json:"license_type" gorm:"type:varchar(20);not null"`
-	RevenueSharePercentage float64     `json:"revenue_share_percentage" gorm:"type:decimal(5,2);not null"`
-	BaseFee                float64     `json:"base_fee" gorm:"type:decimal(10,2);default:0"`
-	Territory              string      `json:"territory" gorm:"size:100;default:'global'"`
-	Duration               string      `json:"duration" gorm:"size:50;default:'perpetual'"`
-	Requirements           string      `json:"requirements" gorm:"type:text"`
-	Restrictions           string      `json:"restrictions" gorm:"type:text"`
-	AutoApprove            bool        `json:"auto_approve" gorm:"default:false"`
-	MaxLicenses            int         `json:"max_licenses" gorm:"default:0"` // 0 = unlimited
-	IsActive               bool        `json:"is_active" gorm:"default:true"`
+	IPAssetID              uuid.UUID       `json:"ip_asset_id" gorm:"type:uuid;not null;index"`
+	LicenseType            LicenseType     `json:"license_type" gorm:"type:varchar(20);not null"`
+	RevenueSharePercentage decimal.Decimal `json:"revenue_share_percentage" gorm:"type:decimal(5,2);not null"`
+	BaseFee                decimal.Decimal `json:"base_fee" gorm:"type:decimal(19,4);default:0"`
+	Currency               string          `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	Territory              TerritorySet    `json:"territory" gorm:"type:varchar(500);default:'global'"`
+	Duration               string          `json:"duration" gorm:"size:50;default:'perpetual'"`
+	Requirements           string          `json:"requirements" gorm:"type:text"`
+	Restrictions           string          `json:"restrictions" gorm:"type:text"`
+	Policy                 LicensePolicy   `json:"policy" gorm:"type:jsonb;default:'{}'"`
+	AutoApprove            bool            `json:"auto_approve" gorm:"default:false"`
+	MaxLicenses            int             `json:"max_licenses" gorm:"default:0"` // 0 = unlimited
+	AllowSublicensing      bool            `json:"allow_sublicensing" gorm:"default:false"`
+	IsActive               bool            `json:"is_active" gorm:"default:true"`
 
 	// Relationships
 	IPAsset      IPAsset              `json:"ip_asset,omitempty" gorm:"foreignKey:IPAssetID"`
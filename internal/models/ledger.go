@@ -0,0 +1,121 @@
+// internal/models/ledger.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// LedgerGenesisHash is the previous hash of the first ledger entry
+const LedgerGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// LedgerEntry is an append-only, hash-linked provenance record. Entries are
+// never updated or soft-deleted, so it deliberately does not embed BaseModel.
+type LedgerEntry struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Sequence     int64     `json:"sequence" gorm:"not null;uniqueIndex"`
+	RecordType   string    `json:"record_type" gorm:"size:50;not null;index"`
+	ResourceType string    `json:"resource_type" gorm:"size:50;not null"`
+	ResourceID   uuid.UUID `json:"resource_id" gorm:"type:uuid;not null;index"`
+	Payload      string    `json:"payload" gorm:"type:text;not null"`
+	HashVersion  int       `json:"hash_version" gorm:"not null;default:1"`
+	Hash         string    `json:"hash" gorm:"size:64;not null;uniqueIndex"`
+	PreviousHash string    `json:"previous_hash" gorm:"size:64;not null;uniqueIndex"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Ledger hash versions. Every version hashes hex(SHA-256(previous_hash ||
+// payload)); they differ in how record data is encoded into the payload.
+// Entries keep the version they were written with so they stay verifiable.
+const (
+	// LedgerHashV1 payloads are encoding/json output with sorted keys
+	LedgerHashV1 = 1
+	// LedgerHashV2 payloads are RFC 8785 (JCS) canonical JSON
+	LedgerHashV2 = 2
+
+	LedgerHashCurrent = LedgerHashV2
+)
+
+// Ledger record types
+const (
+	LedgerRecordIPCreation       = "ip_creation"
+	LedgerRecordLicenseGrant     = "license_grant"
+	LedgerRecordLicenseAgreement = "license_agreement"
+	LedgerRecordProductCreation  = "product_creation"
+)
+
+type AnchorStatus string
+
+const (
+	AnchorStatusSubmitted AnchorStatus = "submitted"
+	AnchorStatusConfirmed AnchorStatus = "confirmed"
+	AnchorStatusFailed    AnchorStatus = "failed"
+)
+
+// LedgerAnchor records where a ledger hash was anchored by a LedgerBackend
+type LedgerAnchor struct {
+	BaseModel
+	Hash        string       `json:"hash" gorm:"size:64;not null;uniqueIndex"`
+	Backend     string       `json:"backend" gorm:"size:50;not null;index"`
+	Reference   string       `json:"reference" gorm:"size:100"`
+	BlockNumber *uint64      `json:"block_number"`
+	Status      AnchorStatus `json:"status" gorm:"type:varchar(20);default:'submitted';index"`
+	Error       string       `json:"error,omitempty" gorm:"type:text"`
+	Attempts    int          `json:"attempts" gorm:"default:1"`
+	AnchoredAt  *time.Time   `json:"anchored_at"`
+}
+
+// LedgerBatch is a Merkle tree over a contiguous run of ledger entries.
+// Only the root is anchored by the LedgerBackend.
+type LedgerBatch struct {
+	BaseModel
+	MerkleRoot    string `json:"merkle_root" gorm:"size:64;not null;uniqueIndex"`
+	Algorithm     string `json:"algorithm" gorm:"size:50;not null"`
+	LeafCount     int    `json:"leaf_count" gorm:"not null"`
+	FirstSequence int64  `json:"first_sequence" gorm:"not null;index"`
+	LastSequence  int64  `json:"last_sequence" gorm:"not null;index"`
+
+	// Relationships
+	Anchor *LedgerAnchor `json:"anchor,omitempty" gorm:"foreignKey:Hash;references:MerkleRoot"`
+}
+
+// LedgerProof is the inclusion proof of one ledger entry in its batch
+type LedgerProof struct {
+	BaseModel
+	EntryHash string      `json:"entry_hash" gorm:"size:64;not null;uniqueIndex"`
+	BatchID   uuid.UUID   `json:"batch_id" gorm:"type:uuid;not null;index"`
+	LeafIndex int         `json:"leaf_index" gorm:"not null"`
+	Proof     MerkleProof `json:"proof" gorm:"type:jsonb;not null"`
+
+	// Relationships
+	Batch LedgerBatch `json:"batch,omitempty" gorm:"foreignKey:BatchID"`
+}
+
+// MerkleProof stores the sibling path of a leaf as JSONB
+type MerkleProof []utils.MerkleProofStep
+
+func (p MerkleProof) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+	return json.Marshal(p)
+}
+
+func (p *MerkleProof) Scan(value interface{}) error {
+	if value == nil {
+		*p = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+
+	return json.Unmarshal(bytes, p)
+}
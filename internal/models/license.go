@@ -18,12 +18,68 @@ type LicenseApplication struct {
 	ApprovedBy      *uuid.UUID        `json:"approved_by" gorm:"type:uuid"`
 	RejectionReason string            `json:"rejection_reason,omitempty" gorm:"type:text"`
 	ExpiresAt       *time.Time        `json:"expires_at"`
+	BlockchainHash  string            `json:"blockchain_hash,omitempty" gorm:"size:66"`
 	IsActive        bool              `json:"is_active" gorm:"default:true"`
 
+	// Licenses applied for before agreements were introduced predate them
+	// and may be used without one
+	AgreementRequired bool `json:"agreement_required" gorm:"not null;default:false"`
+
+	// Renewals extend ExpiresAt by the terms' duration
+	RenewedAt    *time.Time `json:"renewed_at,omitempty"`
+	RenewalCount int        `json:"renewal_count" gorm:"default:0"`
+
+	// Days before expiry of the last expiry reminder sent, reset on renewal
+	ExpiryReminderDays int `json:"-" gorm:"default:0"`
+
 	// Relationships
-	IPAsset      IPAsset      `json:"ip_asset,omitempty" gorm:"foreignKey:IPAssetID"`
-	Applicant    User         `json:"applicant,omitempty" gorm:"foreignKey:ApplicantID"`
-	LicenseTerms LicenseTerms `json:"license_terms,omitempty" gorm:"foreignKey:LicenseTermsID"`
-	Approver     *User        `json:"approver,omitempty" gorm:"foreignKey:ApprovedBy"`
-	Products     []Product    `json:"products,omitempty" gorm:"foreignKey:LicenseID"`
+	IPAsset      IPAsset           `json:"ip_asset,omitempty" gorm:"foreignKey:IPAssetID"`
+	Applicant    User              `json:"applicant,omitempty" gorm:"foreignKey:ApplicantID"`
+	LicenseTerms LicenseTerms      `json:"license_terms,omitempty" gorm:"foreignKey:LicenseTermsID"`
+	Approver     *User             `json:"approver,omitempty" gorm:"foreignKey:ApprovedBy"`
+	Products     []Product         `json:"products,omitempty" gorm:"foreignKey:LicenseID"`
+	Agreement    *LicenseAgreement `json:"agreement,omitempty" gorm:"foreignKey:LicenseApplicationID"`
+}
+
+// LicensePaymentWindow is how long an approved license waits for its fee
+// before it is cancelled
+const LicensePaymentWindow = 7 * 24 * time.Hour
+
+// LicenseRenewalGracePeriod is how long after it expires a license may still
+// be renewed, bringing back the products made under it
+const LicenseRenewalGracePeriod = 30 * 24 * time.Hour
+
+// InRenewalGrace reports whether an expired license may still be renewed at t
+func (a *LicenseApplication) InRenewalGrace(t time.Time) bool {
+	return a.Status == ApplicationStatusExpired && a.ExpiresAt != nil &&
+		t.Before(a.ExpiresAt.Add(LicenseRenewalGracePeriod))
+}
+
+// PaymentDueBy is when the fee of a license awaiting payment must be paid
+// by, or nil if the license is not awaiting payment
+func (a *LicenseApplication) PaymentDueBy() *time.Time {
+	if a.Status != ApplicationStatusAwaitingPayment || a.ApprovedAt == nil {
+		return nil
+	}
+	due := a.ApprovedAt.Add(LicensePaymentWindow)
+	return &due
+}
+
+// LicenseAgreement is the e-signature of a license agreement: the applicant
+// accepted the agreement whose HTML hashes to DocumentHash, and the PDF
+// stamped with this signature is kept in storage.
+type LicenseAgreement struct {
+	BaseModel
+	LicenseApplicationID uuid.UUID `json:"license_application_id" gorm:"type:uuid;not null;uniqueIndex"`
+	SignerID             uuid.UUID `json:"signer_id" gorm:"type:uuid;not null;index"`
+	DocumentHash         string    `json:"document_hash" gorm:"size:64;not null"` // SHA-256 of the agreement HTML
+	SignedAt             time.Time `json:"signed_at" gorm:"not null"`
+	SignerIP             string    `json:"signer_ip" gorm:"size:45"`
+	SignerUserAgent      string    `json:"signer_user_agent,omitempty" gorm:"size:500"`
+
+	// The signed PDF and its SHA-256, which is anchored in the ledger
+	StorageKey         string `json:"-" gorm:"size:500"`
+	DocumentURL        string `json:"document_url" gorm:"size:500"`
+	SignedDocumentHash string `json:"signed_document_hash" gorm:"size:64"`
+	BlockchainHash     string `json:"blockchain_hash,omitempty" gorm:"size:66"`
 }
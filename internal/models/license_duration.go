@@ -0,0 +1,80 @@
+// internal/models/license_duration.go
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PerpetualDuration is the duration of license terms that never expire
+const PerpetualDuration = "perpetual"
+
+// LicenseDuration is how long a license lasts once granted, in calendar units
+type LicenseDuration struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+var licenseDurationPart = regexp.MustCompile(`^(\d+)\s*([a-z]+)`)
+
+// ParseLicenseDuration reads durations such as "1y", "6m", "2w", "90d",
+// "1y6m" or "18 months". "perpetual" and empty durations never expire.
+func ParseLicenseDuration(spec string) (LicenseDuration, error) {
+	var duration LicenseDuration
+
+	rest := strings.ToLower(strings.TrimSpace(spec))
+	if rest == "" || rest == PerpetualDuration {
+		return duration, nil
+	}
+
+	for rest != "" {
+		match := licenseDurationPart.FindStringSubmatch(rest)
+		if match == nil {
+			return LicenseDuration{}, fmt.Errorf("invalid license duration %q", spec)
+		}
+
+		count, err := strconv.Atoi(match[1])
+		if err != nil || count > 1000 {
+			return LicenseDuration{}, fmt.Errorf("invalid license duration %q", spec)
+		}
+
+		switch match[2] {
+		case "d", "day", "days":
+			duration.Days += count
+		case "w", "week", "weeks":
+			duration.Days += 7 * count
+		case "m", "mo", "month", "months":
+			duration.Months += count
+		case "y", "yr", "year", "years":
+			duration.Years += count
+		default:
+			return LicenseDuration{}, fmt.Errorf("invalid license duration %q: unknown unit %q", spec, match[2])
+		}
+
+		rest = strings.TrimLeft(rest[len(match[0]):], " ,")
+	}
+
+	if duration.IsPerpetual() {
+		return LicenseDuration{}, fmt.Errorf("invalid license duration %q: must be longer than zero", spec)
+	}
+
+	return duration, nil
+}
+
+// IsPerpetual reports whether licenses of this duration never expire
+func (d LicenseDuration) IsPerpetual() bool {
+	return d == LicenseDuration{}
+}
+
+// ExpiresAt is when a license granted at start ends, or nil if it never does
+func (d LicenseDuration) ExpiresAt(start time.Time) *time.Time {
+	if d.IsPerpetual() {
+		return nil
+	}
+	end := start.AddDate(d.Years, d.Months, d.Days)
+	return &end
+}
@@ -0,0 +1,177 @@
+// internal/models/license_policy.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// License policy rules, named in violations
+const (
+	PolicyRuleAllowedCategories   = "allowed_categories"
+	PolicyRuleMaxUnits            = "max_units"
+	PolicyRulePriceFloor          = "price_floor"
+	PolicyRuleRequiredAttribution = "required_attribution"
+	PolicyRuleForbiddenTags       = "forbidden_tags"
+)
+
+// LicensePolicy is the machine-readable part of license terms, checked
+// against every product made under the license. Empty fields allow anything;
+// Requirements and Restrictions stay as the human-readable text.
+type LicensePolicy struct {
+	AllowedCategories []string `json:"allowed_categories,omitempty"`
+	// MaxUnits caps the units stocked or sold across all products under one
+	// license. 0 = unlimited.
+	MaxUnits int `json:"max_units,omitempty"`
+	// PriceFloor is the lowest unit price; products must be priced in its
+	// currency
+	PriceFloor *Money `json:"price_floor,omitempty"`
+	// RequiredAttribution must appear in every product description
+	RequiredAttribution string   `json:"required_attribution,omitempty"`
+	ForbiddenTags       []string `json:"forbidden_tags,omitempty"`
+}
+
+// PolicyViolation names the license policy rule a product breaks
+type PolicyViolation struct {
+	Rule      string    `json:"rule"`
+	Message   string    `json:"message"`
+	LicenseID uuid.UUID `json:"license_id"`
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("license policy %s: %s", v.Rule, v.Message)
+}
+
+func violation(rule, format string, args ...interface{}) *PolicyViolation {
+	return &PolicyViolation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// IsEmpty reports whether the policy restricts nothing
+func (p LicensePolicy) IsEmpty() bool {
+	return len(p.AllowedCategories) == 0 && p.MaxUnits == 0 && p.PriceFloor == nil &&
+		p.RequiredAttribution == "" && len(p.ForbiddenTags) == 0
+}
+
+// Normalize trims values, lower-cases tags and removes duplicates
+func (p LicensePolicy) Normalize() LicensePolicy {
+	p.AllowedCategories = normalizePolicyValues(p.AllowedCategories, false)
+	p.ForbiddenTags = normalizePolicyValues(p.ForbiddenTags, true)
+	p.RequiredAttribution = strings.TrimSpace(p.RequiredAttribution)
+	if p.PriceFloor != nil {
+		floor := NewMoney(p.PriceFloor.Amount, p.PriceFloor.Currency)
+		p.PriceFloor = &floor
+	}
+	return p
+}
+
+func normalizePolicyValues(values []string, lower bool) []string {
+	seen := make(map[string]bool, len(values))
+	var normalized []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lower {
+			value = strings.ToLower(value)
+		}
+		if value == "" || seen[strings.ToLower(value)] {
+			continue
+		}
+		seen[strings.ToLower(value)] = true
+		normalized = append(normalized, value)
+	}
+	return normalized
+}
+
+// Validate rejects policies no product could meet
+func (p LicensePolicy) Validate() error {
+	if p.MaxUnits < 0 {
+		return errors.New("policy max_units cannot be negative")
+	}
+	if p.PriceFloor != nil {
+		if !p.PriceFloor.IsPositive() {
+			return errors.New("policy price_floor must be positive")
+		}
+		if len(p.PriceFloor.Currency) != 3 {
+			return fmt.Errorf("policy price_floor has an invalid currency %q", p.PriceFloor.Currency)
+		}
+		if !p.PriceFloor.Amount.Equal(p.PriceFloor.Round().Amount) {
+			return fmt.Errorf("policy price_floor has more decimal places than %s allows", p.PriceFloor.Currency)
+		}
+	}
+	return nil
+}
+
+// CheckProduct checks a product's category, price, description and tags. It
+// returns a *PolicyViolation naming the first rule broken.
+func (p LicensePolicy) CheckProduct(product *Product) error {
+	if len(p.AllowedCategories) > 0 {
+		allowed := false
+		for _, category := range p.AllowedCategories {
+			if strings.EqualFold(category, strings.TrimSpace(product.Category)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return violation(PolicyRuleAllowedCategories, "category %q is not allowed; use one of %s",
+				product.Category, strings.Join(p.AllowedCategories, ", "))
+		}
+	}
+
+	if p.PriceFloor != nil {
+		price := product.PriceMoney()
+		if price.Currency != p.PriceFloor.Currency {
+			return violation(PolicyRulePriceFloor, "the price floor is %s, so products must be priced in %s",
+				p.PriceFloor, p.PriceFloor.Currency)
+		}
+		if price.Amount.LessThan(p.PriceFloor.Amount) {
+			return violation(PolicyRulePriceFloor, "price %s is below the floor of %s", price, p.PriceFloor)
+		}
+	}
+
+	if p.RequiredAttribution != "" &&
+		!strings.Contains(strings.ToLower(product.Description), strings.ToLower(p.RequiredAttribution)) {
+		return violation(PolicyRuleRequiredAttribution, "the description must credit %q", p.RequiredAttribution)
+	}
+
+	for _, tag := range product.Tags {
+		for _, forbidden := range p.ForbiddenTags {
+			if strings.EqualFold(strings.TrimSpace(tag), forbidden) {
+				return violation(PolicyRuleForbiddenTags, "tag %q is forbidden", tag)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckUnits checks the units stocked or sold across all products under the
+// license. It returns a *PolicyViolation if there are too many.
+func (p LicensePolicy) CheckUnits(units int) error {
+	if p.MaxUnits > 0 && units > p.MaxUnits {
+		return violation(PolicyRuleMaxUnits, "%d units exceed the license limit of %d", units, p.MaxUnits)
+	}
+	return nil
+}
+
+func (p LicensePolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *LicensePolicy) Scan(value interface{}) error {
+	*p = LicensePolicy{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case []byte:
+		return json.Unmarshal(v, p)
+	default:
+		return fmt.Errorf("cannot scan %T into a license policy", value)
+	}
+}
@@ -0,0 +1,269 @@
+// internal/models/money.go
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultCurrency is the currency of amounts that do not name one
+const DefaultCurrency = "USD"
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are
+// combined without conversion
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyExponents lists the ISO 4217 currencies whose minor unit is not a
+// hundredth. Every other currency has two decimal places.
+var currencyExponents = map[string]int32{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// NormalizeCurrency upper-cases a currency code, defaulting empty codes
+func NormalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DefaultCurrency
+	}
+	return code
+}
+
+// CurrencyExponent is the number of decimal places of a currency's minor unit
+func CurrencyExponent(code string) int32 {
+	if exponent, ok := currencyExponents[NormalizeCurrency(code)]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// DecimalNumber is a decimal written to JSON as a number. Amounts are exact
+// decimals but stay JSON numbers, as they were; the decimal package would
+// write them as strings.
+type DecimalNumber decimal.Decimal
+
+func (d DecimalNumber) MarshalJSON() ([]byte, error) {
+	return []byte(decimal.Decimal(d).String()), nil
+}
+
+// Money is an exact amount in one currency
+type Money struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	type money Money
+	return json.Marshal(struct {
+		money
+		Amount DecimalNumber `json:"amount"`
+	}{money(m), DecimalNumber(m.Amount)})
+}
+
+func NewMoney(amount decimal.Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: NormalizeCurrency(currency)}
+}
+
+// MoneyFromMinorUnits builds an amount from the integer minor units payment
+// processors work in, e.g. cents
+func MoneyFromMinorUnits(units int64, currency string) Money {
+	currency = NormalizeCurrency(currency)
+	return Money{Amount: decimal.New(units, -CurrencyExponent(currency)), Currency: currency}
+}
+
+// ZeroMoney is nothing in a currency
+func ZeroMoney(currency string) Money {
+	return NewMoney(decimal.Zero, currency)
+}
+
+// Round rounds to the currency's minor unit, halves away from zero
+func (m Money) Round() Money {
+	return Money{Amount: m.Amount.Round(CurrencyExponent(m.Currency)), Currency: m.Currency}
+}
+
+// MinorUnits is the amount in the currency's minor unit, rounded
+func (m Money) MinorUnits() int64 {
+	return m.Amount.Shift(CurrencyExponent(m.Currency)).Round(0).IntPart()
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount.Add(other.Amount), Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount.Sub(other.Amount), Currency: m.Currency}, nil
+}
+
+// Mul multiplies by a quantity
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount.Mul(decimal.NewFromInt(quantity)), Currency: m.Currency}
+}
+
+// Percent is percent of the amount, rounded to the minor unit
+func (m Money) Percent(percent decimal.Decimal) Money {
+	return Money{Amount: m.Amount.Mul(percent).Div(decimal.NewFromInt(100)), Currency: m.Currency}.Round()
+}
+
+// Equal reports whether both amounts are the same in the same currency
+func (m Money) Equal(other Money) bool {
+	return m.Currency == other.Currency && m.Amount.Equal(other.Amount)
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount.IsPositive()
+}
+
+// StringFixed formats the amount with the currency's decimal places
+func (m Money) StringFixed() string {
+	return m.Amount.StringFixed(CurrencyExponent(m.Currency))
+}
+
+func (m Money) String() string {
+	return m.StringFixed() + " " + m.Currency
+}
+
+// PriceMoney is the product's unit price in its currency
+func (p *Product) PriceMoney() Money {
+	return NewMoney(p.Price, p.Currency)
+}
+
+// Total is the amount the buyer paid for the transaction
+func (t *Transaction) Total() Money {
+	return NewMoney(t.Amount, t.Currency)
+}
+
+// Refundable is what is left to refund of the transaction
+func (t *Transaction) Refundable() Money {
+	return NewMoney(t.Amount.Sub(t.RefundedAmount), t.Currency)
+}
+
+// AddRefund adds a refund to the transaction's refunded amount and marks
+// the transaction refunded once nothing is left to refund. It reports
+// whether the transaction is now fully refunded.
+func (t *Transaction) AddRefund(amount decimal.Decimal, reason string, at time.Time) bool {
+	t.RefundedAmount = t.RefundedAmount.Add(amount)
+	t.RefundedAt = &at
+	if reason != "" {
+		t.RefundReason = reason
+	}
+
+	if t.Refundable().IsPositive() {
+		return false
+	}
+	t.Status = TransactionStatusRefunded
+	return true
+}
+
+// Fee is the platform's cut of the transaction
+func (t *Transaction) Fee() Money {
+	return NewMoney(t.PlatformFee, t.Currency)
+}
+
+// Total is the amount the buyer pays for the order
+func (o *Order) Total() Money {
+	return NewMoney(o.Amount, o.Currency)
+}
+
+// Total is the amount paid out
+func (p *Payout) Total() Money {
+	return NewMoney(p.Amount, p.Currency)
+}
+
+// Total is the amount returned to the buyer
+func (r *Refund) Total() Money {
+	return NewMoney(r.Amount, r.Currency)
+}
+
+// BaseFeeMoney is the fee a licensee pays for the license
+func (t *LicenseTerms) BaseFeeMoney() Money {
+	return NewMoney(t.BaseFee, t.Currency)
+}
+
+// The models below write their amounts as JSON numbers, like Money
+
+func (p Product) MarshalJSON() ([]byte, error) {
+	type product Product
+	return json.Marshal(struct {
+		product
+		Price DecimalNumber `json:"price"`
+	}{product(p), DecimalNumber(p.Price)})
+}
+
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type transaction Transaction
+	return json.Marshal(struct {
+		transaction
+		Amount         DecimalNumber `json:"amount"`
+		PlatformFee    DecimalNumber `json:"platform_fee"`
+		RefundedAmount DecimalNumber `json:"refunded_amount"`
+	}{transaction(t), DecimalNumber(t.Amount), DecimalNumber(t.PlatformFee), DecimalNumber(t.RefundedAmount)})
+}
+
+func (r Refund) MarshalJSON() ([]byte, error) {
+	type refund Refund
+	return json.Marshal(struct {
+		refund
+		Amount DecimalNumber `json:"amount"`
+	}{refund(r), DecimalNumber(r.Amount)})
+}
+
+func (o Order) MarshalJSON() ([]byte, error) {
+	type order Order
+	return json.Marshal(struct {
+		order
+		Amount      DecimalNumber `json:"amount"`
+		PlatformFee DecimalNumber `json:"platform_fee"`
+	}{order(o), DecimalNumber(o.Amount), DecimalNumber(o.PlatformFee)})
+}
+
+func (i OrderItem) MarshalJSON() ([]byte, error) {
+	type orderItem OrderItem
+	return json.Marshal(struct {
+		orderItem
+		UnitPrice DecimalNumber `json:"unit_price"`
+		Amount    DecimalNumber `json:"amount"`
+	}{orderItem(i), DecimalNumber(i.UnitPrice), DecimalNumber(i.Amount)})
+}
+
+func (p Payout) MarshalJSON() ([]byte, error) {
+	type payout Payout
+	return json.Marshal(struct {
+		payout
+		Amount DecimalNumber `json:"amount"`
+	}{payout(p), DecimalNumber(p.Amount)})
+}
+
+func (l JournalLine) MarshalJSON() ([]byte, error) {
+	type journalLine JournalLine
+	return json.Marshal(struct {
+		journalLine
+		Debit  DecimalNumber `json:"debit"`
+		Credit DecimalNumber `json:"credit"`
+	}{journalLine(l), DecimalNumber(l.Debit), DecimalNumber(l.Credit)})
+}
+
+func (t LicenseTerms) MarshalJSON() ([]byte, error) {
+	type licenseTerms LicenseTerms
+	return json.Marshal(struct {
+		licenseTerms
+		RevenueSharePercentage DecimalNumber `json:"revenue_share_percentage"`
+		BaseFee                DecimalNumber `json:"base_fee"`
+	}{licenseTerms(t), DecimalNumber(t.RevenueSharePercentage), DecimalNumber(t.BaseFee)})
+}
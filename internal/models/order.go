@@ -0,0 +1,57 @@
+// internal/models/order.go
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// CartItem is a product a buyer has put in their cart
+type CartItem struct {
+	BaseModel
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_cart_items_user_product,priority:1"`
+	ProductID uuid.UUID `json:"product_id" gorm:"type:uuid;not null;uniqueIndex:idx_cart_items_user_product,priority:2"`
+	Quantity  int       `json:"quantity" gorm:"not null"`
+
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
+
+// Order is one checkout of a cart. It is paid with a single payment and
+// split into one product_sale transaction per seller, each distributing its
+// own revenue shares.
+type Order struct {
+	BaseModel
+	BuyerID          uuid.UUID         `json:"buyer_id" gorm:"type:uuid;not null;index"`
+	Amount           decimal.Decimal   `json:"amount" gorm:"type:decimal(19,4);not null"`
+	PlatformFee      decimal.Decimal   `json:"platform_fee" gorm:"type:decimal(19,4);not null"`
+	Currency         string            `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	PaymentMethod    string            `json:"payment_method" gorm:"size:50"`
+	PaymentIntentID  string            `json:"payment_intent_id,omitempty" gorm:"size:255;index"`
+	PaymentReference string            `json:"payment_reference" gorm:"size:255"`
+	Status           TransactionStatus `json:"status" gorm:"type:varchar(20);default:'pending';index"`
+	ShippingInfo     JSONB             `json:"shipping_info" gorm:"type:jsonb"`
+	Notes            string            `json:"notes,omitempty" gorm:"type:text"`
+	PaidAt           *time.Time        `json:"paid_at"`
+
+	// Relationships
+	Buyer        User          `json:"buyer,omitempty" gorm:"foreignKey:BuyerID"`
+	Items        []OrderItem   `json:"items,omitempty" gorm:"foreignKey:OrderID"`
+	Transactions []Transaction `json:"transactions,omitempty" gorm:"foreignKey:OrderID"`
+}
+
+// OrderItem is one product line of an order, sold in its seller's transaction
+type OrderItem struct {
+	BaseModel
+	OrderID       uuid.UUID       `json:"order_id" gorm:"type:uuid;not null;index"`
+	TransactionID uuid.UUID       `json:"transaction_id" gorm:"type:uuid;not null;index"`
+	ProductID     uuid.UUID       `json:"product_id" gorm:"type:uuid;not null;index"`
+	Quantity      int             `json:"quantity" gorm:"not null"`
+	UnitPrice     decimal.Decimal `json:"unit_price" gorm:"type:decimal(19,4);not null"`
+	Amount        decimal.Decimal `json:"amount" gorm:"type:decimal(19,4);not null"`
+
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
@@ -0,0 +1,34 @@
+// internal/models/payout.go
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Payout moves a user's available balance to an external account. The
+// amount is reserved in the ledger from request until it is paid, rejected
+// or fails.
+type Payout struct {
+	BaseModel
+	UserID            uuid.UUID       `json:"user_id" gorm:"type:uuid;not null;index"`
+	Amount            decimal.Decimal `json:"amount" gorm:"type:decimal(19,4);not null"`
+	Currency          string          `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	Method            string          `json:"method" gorm:"size:50;not null"`
+	AccountInfo       JSONB           `json:"account_info,omitempty" gorm:"type:jsonb"`
+	Status            PayoutStatus    `json:"status" gorm:"type:varchar(20);default:'requested';index"`
+	ProviderReference string          `json:"provider_reference,omitempty" gorm:"size:255;index"`
+	FailureReason     string          `json:"failure_reason,omitempty" gorm:"type:text"`
+	Attempts          int             `json:"attempts" gorm:"default:0"`
+	ReviewedBy        *uuid.UUID      `json:"reviewed_by" gorm:"type:uuid"`
+	ReviewedAt        *time.Time      `json:"reviewed_at"`
+	ReviewNotes       string          `json:"review_notes,omitempty" gorm:"type:text"`
+	ProcessedAt       *time.Time      `json:"processed_at"`
+	PaidAt            *time.Time      `json:"paid_at"`
+
+	// Relationships
+	User     User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Reviewer *User `json:"reviewer,omitempty" gorm:"foreignKey:ReviewedBy"`
+}
@@ -2,28 +2,32 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 type Product struct {
 	BaseModel
-	CreatorID            uuid.UUID      `json:"creator_id" gorm:"type:uuid;not null;index"`
-	LicenseID            uuid.UUID      `json:"license_id" gorm:"type:uuid;not null;index"`
-	Title                string         `json:"title" gorm:"size:255;not null"`
-	Description          string         `json:"description" gorm:"type:text"`
-	Category             string         `json:"category" gorm:"size:100;index"`
-	Price                float64        `json:"price" gorm:"type:decimal(10,2);not null"`
-	InventoryCount       int            `json:"inventory_count" gorm:"default:0"`
-	Images               pq.StringArray `json:"images" gorm:"type:text[]"`
-	Specifications       JSONB          `json:"specifications" gorm:"type:jsonb"`
-	Status               ProductStatus  `json:"status" gorm:"type:varchar(20);default:'draft';index"`
-	AuthenticityVerified bool           `json:"authenticity_verified" gorm:"default:true"`
-	Tags                 pq.StringArray `json:"tags" gorm:"type:text[]"`
-	ViewCount            int64          `json:"view_count" gorm:"default:0"`
-	SalesCount           int64          `json:"sales_count" gorm:"default:0"`
-	Rating               float64        `json:"rating" gorm:"type:decimal(3,2);default:0"`
-	ReviewCount          int64          `json:"review_count" gorm:"default:0"`
+	CreatorID            uuid.UUID       `json:"creator_id" gorm:"type:uuid;not null;index"`
+	LicenseID            uuid.UUID       `json:"license_id" gorm:"type:uuid;not null;index"`
+	Title                string          `json:"title" gorm:"size:255;not null"`
+	Description          string          `json:"description" gorm:"type:text"`
+	Category             string          `json:"category" gorm:"size:100;index"`
+	Price                decimal.Decimal `json:"price" gorm:"type:decimal(19,4);not null"`
+	Currency             string          `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	InventoryCount       int             `json:"inventory_count" gorm:"default:0"`
+	Images               pq.StringArray  `json:"images" gorm:"type:text[]"`
+	Specifications       JSONB           `json:"specifications" gorm:"type:jsonb"`
+	Status               ProductStatus   `json:"status" gorm:"type:varchar(20);default:'draft';index"`
+	AuthenticityVerified bool            `json:"authenticity_verified" gorm:"default:true"`
+	Tags                 pq.StringArray  `json:"tags" gorm:"type:text[]"`
+	ViewCount            int64           `json:"view_count" gorm:"default:0"`
+	SalesCount           int64           `json:"sales_count" gorm:"default:0"`
+	Rating               float64         `json:"rating" gorm:"type:decimal(3,2);default:0"`
+	ReviewCount          int64           `json:"review_count" gorm:"default:0"`
 
 	// Relationships
 	Creator      User                 `json:"creator,omitempty" gorm:"foreignKey:CreatorID"`
@@ -31,3 +35,63 @@ type Product struct {
 	Transactions []Transaction        `json:"transactions,omitempty" gorm:"foreignKey:ProductID"`
 	AuthChain    []AuthorizationChain `json:"auth_chain,omitempty" gorm:"foreignKey:ProductID"`
 }
+
+// ProductUnit is one physical unit of a product with its own serial
+// verification code, so a copied code can be traced to a single item.
+type ProductUnit struct {
+	BaseModel
+	ProductID        uuid.UUID  `json:"product_id" gorm:"type:uuid;not null;uniqueIndex:idx_product_units_serial"`
+	SerialNumber     int        `json:"serial_number" gorm:"not null;uniqueIndex:idx_product_units_serial"`
+	VerificationCode string     `json:"verification_code" gorm:"size:32;uniqueIndex"`
+	Status           UnitStatus `json:"status" gorm:"type:varchar(20);default:'unclaimed';index"`
+	TransactionID    *uuid.UUID `json:"transaction_id,omitempty" gorm:"type:uuid;index"`
+	SoldAt           *time.Time `json:"sold_at"`
+	ScanCount        int64      `json:"scan_count" gorm:"default:0"`
+	FirstScannedAt   *time.Time `json:"first_scanned_at"`
+	LastScannedAt    *time.Time `json:"last_scanned_at"`
+
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
+
+// InventoryReservation holds units of a product for a pending transaction
+// until its payment settles or the reservation expires. A transaction of a
+// multi-item order has one reservation per product.
+type InventoryReservation struct {
+	BaseModel
+	ProductID     uuid.UUID         `json:"product_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_inventory_reservations_line,priority:2"`
+	TransactionID uuid.UUID         `json:"transaction_id" gorm:"type:uuid;not null;uniqueIndex:idx_inventory_reservations_line,priority:1"`
+	Quantity      int               `json:"quantity" gorm:"not null"`
+	Status        ReservationStatus `json:"status" gorm:"type:varchar(20);default:'held';index:idx_inventory_reservations_due,priority:1"`
+	ExpiresAt     time.Time         `json:"expires_at" gorm:"not null;index:idx_inventory_reservations_due,priority:2"`
+	CommittedAt   *time.Time        `json:"committed_at"`
+	ReleasedAt    *time.Time        `json:"released_at"`
+
+	// Units of a committed reservation returned to stock by refunds
+	RestockedQuantity int `json:"restocked_quantity" gorm:"default:0"`
+
+	// Relationships
+	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+}
+
+type ScanResult string
+
+const (
+	ScanResultVerified ScanResult = "verified"
+	ScanResultInvalid  ScanResult = "invalid"
+	ScanResultFailed   ScanResult = "failed"
+)
+
+// VerificationScan is one lookup of a verification code
+type VerificationScan struct {
+	BaseModel
+	VerificationCode string     `json:"verification_code" gorm:"size:64;not null;index:idx_verification_scans_code_time,priority:1"`
+	ProductID        *uuid.UUID `json:"product_id" gorm:"type:uuid;index"`
+	UnitID           *uuid.UUID `json:"unit_id" gorm:"type:uuid;index"`
+	Result           ScanResult `json:"result" gorm:"type:varchar(20);not null;index"`
+	FailureReason    string     `json:"failure_reason,omitempty" gorm:"size:255"`
+	IPAddress        string     `json:"ip_address" gorm:"size:45"`
+	Region           string     `json:"region" gorm:"size:64;index"`
+	UserAgent        string     `json:"user_agent" gorm:"type:text"`
+	ScannedAt        time.Time  `json:"scanned_at" gorm:"not null;index:idx_verification_scans_code_time,priority:2"`
+}
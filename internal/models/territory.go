@@ -0,0 +1,288 @@
+// internal/models/territory.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TerritoryGlobal is the region covering every country
+const TerritoryGlobal = "GLOBAL"
+
+// isoCountryCodes are the ISO 3166-1 alpha-2 country codes
+var isoCountryCodes = strings.Fields(`
+	AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ
+	BL BM BN BO BQ BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR
+	CU CV CW CX CY CZ DE DJ DK DM DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR
+	GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY HK HM HN HR HT HU
+	ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN KP KR KW KY KZ
+	LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ
+	MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF
+	PG PH PK PL PM PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI
+	SJ SK SL SM SN SO SR SS ST SV SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR
+	TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI VN VU WF WS YE YT ZA ZM ZW`)
+
+var isoCountries = func() map[string]bool {
+	countries := make(map[string]bool, len(isoCountryCodes))
+	for _, code := range isoCountryCodes {
+		countries[code] = true
+	}
+	return countries
+}()
+
+var euCountries = strings.Fields("AT BE BG CY CZ DE DK EE ES FI FR GR HR HU IE IT LT LU LV MT NL PL PT RO SE SI SK")
+
+// territoryRegions are the named regions territory sets can use besides
+// country codes
+var territoryRegions = map[string][]string{
+	"EU":            euCountries,
+	"EEA":           append(strings.Fields("IS LI NO"), euCountries...),
+	"NORTH_AMERICA": strings.Fields("CA MX US"),
+	"DACH":          strings.Fields("AT CH DE"),
+	"BENELUX":       strings.Fields("BE LU NL"),
+	"NORDICS":       strings.Fields("DK FI IS NO SE"),
+	"ANZ":           strings.Fields("AU NZ"),
+	"ASEAN":         strings.Fields("BN ID KH LA MM MY PH SG TH VN"),
+	"GCC":           strings.Fields("AE BH KW OM QA SA"),
+}
+
+// territoryAliases are other names accepted for territories
+var territoryAliases = map[string]string{
+	"WORLDWIDE":      TerritoryGlobal,
+	"WORLD":          TerritoryGlobal,
+	"ALL":            TerritoryGlobal,
+	"UK":             "GB",
+	"EUROPEAN_UNION": "EU",
+}
+
+// TerritoryRegions lists the named regions, sorted
+func TerritoryRegions() []string {
+	regions := []string{TerritoryGlobal}
+	for region := range territoryRegions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// TerritorySet is where a license lets products be sold: ISO 3166-1 alpha-2
+// country codes and named regions, less those excluded. It is stored as text
+// such as "EU,US,-HU" and defaults to worldwide.
+type TerritorySet struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// GlobalTerritory is the set covering every country
+func GlobalTerritory() TerritorySet {
+	return TerritorySet{Include: []string{TerritoryGlobal}}
+}
+
+// ParseTerritorySet reads comma-separated country codes and regions, with a
+// "-" before those excluded, e.g. "EU,US,-HU". Empty is worldwide.
+func ParseTerritorySet(spec string) (TerritorySet, error) {
+	set := parseTerritorySet(spec)
+	return set, set.Validate()
+}
+
+func parseTerritorySet(spec string) TerritorySet {
+	var set TerritorySet
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(token, "-"); ok {
+			set.Exclude = append(set.Exclude, excluded)
+		} else {
+			set.Include = append(set.Include, token)
+		}
+	}
+	return set.Normalize()
+}
+
+func normalizeTerritory(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.NewReplacer(" ", "_", "-", "_").Replace(code)
+	if alias, ok := territoryAliases[code]; ok {
+		return alias
+	}
+	return code
+}
+
+func normalizeTerritories(codes []string) []string {
+	seen := make(map[string]bool, len(codes))
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		code = normalizeTerritory(code)
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		normalized = append(normalized, code)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Normalize upper-cases, resolves aliases, sorts and removes duplicates. A
+// set that includes nothing becomes worldwide.
+func (t TerritorySet) Normalize() TerritorySet {
+	include := normalizeTerritories(t.Include)
+	if len(include) == 0 {
+		include = []string{TerritoryGlobal}
+	}
+	exclude := normalizeTerritories(t.Exclude)
+	if len(exclude) == 0 {
+		exclude = nil
+	}
+	return TerritorySet{Include: include, Exclude: exclude}
+}
+
+// Validate rejects unknown codes and sets that cover no country
+func (t TerritorySet) Validate() error {
+	for _, codes := range [][]string{t.Include, t.Exclude} {
+		for _, code := range codes {
+			if expandTerritory(code) == nil {
+				return fmt.Errorf("unknown territory %q: use ISO 3166-1 country codes or one of %s",
+					code, strings.Join(TerritoryRegions(), ", "))
+			}
+		}
+	}
+	if len(t.Countries()) == 0 {
+		return fmt.Errorf("territory %q covers no country", t.String())
+	}
+	return nil
+}
+
+// expandTerritory lists the countries of a country code or region, or nil if
+// the code is unknown
+func expandTerritory(code string) []string {
+	if code == TerritoryGlobal {
+		return isoCountryCodes
+	}
+	if countries, ok := territoryRegions[code]; ok {
+		return countries
+	}
+	if isoCountries[code] {
+		return []string{code}
+	}
+	return nil
+}
+
+// Countries lists every country the set covers, sorted
+func (t TerritorySet) Countries() []string {
+	covered := make(map[string]bool)
+	for _, code := range t.Include {
+		for _, country := range expandTerritory(code) {
+			covered[country] = true
+		}
+	}
+	for _, code := range t.Exclude {
+		for _, country := range expandTerritory(code) {
+			delete(covered, country)
+		}
+	}
+
+	countries := make([]string, 0, len(covered))
+	for country := range covered {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// IsGlobal reports whether the set covers every country
+func (t TerritorySet) IsGlobal() bool {
+	return len(t.Countries()) == len(isoCountryCodes)
+}
+
+// Covers reports whether a country, by its ISO 3166-1 alpha-2 code, is in
+// the set
+func (t TerritorySet) Covers(country string) bool {
+	country = normalizeTerritory(country)
+	if !isoCountries[country] {
+		return false
+	}
+
+	in := func(codes []string) bool {
+		for _, code := range codes {
+			for _, member := range expandTerritory(code) {
+				if member == country {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return in(t.Include) && !in(t.Exclude)
+}
+
+// Intersect is the territory covered by both sets
+func (t TerritorySet) Intersect(other TerritorySet) TerritorySet {
+	if other.IsGlobal() {
+		return t
+	}
+	if t.IsGlobal() {
+		return other
+	}
+
+	include := []string{}
+	for _, country := range t.Countries() {
+		if other.Covers(country) {
+			include = append(include, country)
+		}
+	}
+	return TerritorySet{Include: include}
+}
+
+func (t TerritorySet) String() string {
+	codes := append([]string{}, t.Include...)
+	for _, code := range t.Exclude {
+		codes = append(codes, "-"+code)
+	}
+	return strings.Join(codes, ",")
+}
+
+func (t TerritorySet) Value() (driver.Value, error) {
+	return t.Normalize().String(), nil
+}
+
+// Scan reads a stored set. Codes it does not know are kept but cover no
+// country, so a territory written by hand never widens a license.
+func (t *TerritorySet) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*t = GlobalTerritory()
+	case string:
+		*t = parseTerritorySet(v)
+	case []byte:
+		*t = parseTerritorySet(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into a territory", value)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts the {"include": [...], "exclude": [...]} form or a
+// string such as "EU,US,-HU"
+func (t *TerritorySet) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err == nil {
+		*t = parseTerritorySet(spec)
+		return nil
+	}
+
+	var set struct {
+		Include []string `json:"include"`
+		Exclude []string `json:"exclude"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid territory: %w", err)
+	}
+	*t = TerritorySet{Include: set.Include, Exclude: set.Exclude}.Normalize()
+	return nil
+}
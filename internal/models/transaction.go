@@ -5,28 +5,67 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type Transaction struct {
 	BaseModel
 	TransactionType  TransactionType   `json:"transaction_type" gorm:"type:varchar(20);not null;index"`
-	BuyerID          uuid.UUID         `json:"buyer_id" gorm:"type:uuid;not null;index"`
+	BuyerID          *uuid.UUID        `json:"buyer_id" gorm:"type:uuid;index"` // nil on revenue shares
 	SellerID         uuid.UUID         `json:"seller_id" gorm:"type:uuid;not null;index"`
 	ProductID        *uuid.UUID        `json:"product_id" gorm:"type:uuid;index"`
-	Amount           float64           `json:"amount" gorm:"type:decimal(10,2);not null"`
-	PlatformFee      float64           `json:"platform_fee" gorm:"type:decimal(10,2);not null"`
+	Quantity         int               `json:"quantity" gorm:"default:1"`
+	Amount           decimal.Decimal   `json:"amount" gorm:"type:decimal(19,4);not null"`
+	PlatformFee      decimal.Decimal   `json:"platform_fee" gorm:"type:decimal(19,4);not null"`
+	Currency         string            `json:"currency" gorm:"size:3;not null;default:'USD'"`
 	RevenueShares    JSONB             `json:"revenue_shares" gorm:"type:jsonb"`
 	PaymentMethod    string            `json:"payment_method" gorm:"size:50"`
+	PaymentIntentID  string            `json:"payment_intent_id,omitempty" gorm:"size:255;index"`
 	PaymentReference string            `json:"payment_reference" gorm:"size:255"`
 	Status           TransactionStatus `json:"status" gorm:"type:varchar(20);default:'pending';index"`
 	ProcessedAt      *time.Time        `json:"processed_at"`
 	RefundedAt       *time.Time        `json:"refunded_at"`
 	RefundReason     string            `json:"refund_reason,omitempty" gorm:"type:text"`
 
+	// Total of the transaction's refunds so far. A partly refunded
+	// transaction stays completed until the whole amount is refunded.
+	RefundedAmount decimal.Decimal `json:"refunded_amount" gorm:"type:decimal(19,4);not null;default:0"`
+
+	// Set on revenue_share transactions to the sale they were paid from
+	ParentTransactionID *uuid.UUID `json:"parent_transaction_id,omitempty" gorm:"type:uuid;index"`
+
+	// Set on the per-seller sales of a multi-item order
+	OrderID *uuid.UUID `json:"order_id,omitempty" gorm:"type:uuid;index"`
+
+	// Set on license_fee transactions, and their revenue shares, to the license
+	// they pay for
+	LicenseID *uuid.UUID `json:"license_id,omitempty" gorm:"type:uuid;index"`
+
 	// Relationships
-	Buyer   User     `json:"buyer,omitempty" gorm:"foreignKey:BuyerID"`
-	Seller  User     `json:"seller,omitempty" gorm:"foreignKey:SellerID"`
-	Product *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Buyer   User        `json:"buyer,omitempty" gorm:"foreignKey:BuyerID"`
+	Seller  User        `json:"seller,omitempty" gorm:"foreignKey:SellerID"`
+	Product *Product    `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Items   []OrderItem `json:"items,omitempty" gorm:"foreignKey:TransactionID"`
+	Refunds []Refund    `json:"refunds,omitempty" gorm:"foreignKey:TransactionID"`
+}
+
+// Refund is one refund of a transaction. A transaction can be refunded in
+// several parts; each part claws back every revenue share in proportion.
+type Refund struct {
+	BaseModel
+	TransactionID    uuid.UUID       `json:"transaction_id" gorm:"type:uuid;not null;index"`
+	Amount           decimal.Decimal `json:"amount" gorm:"type:decimal(19,4);not null"`
+	Currency         string          `json:"currency" gorm:"size:3;not null;default:'USD'"`
+	Reason           string          `json:"reason" gorm:"type:text"`
+	Source           string          `json:"source" gorm:"size:20"` // marketplace, or the provider that reported it
+	ProviderRefundID string          `json:"provider_refund_id,omitempty" gorm:"size:255"`
+	Status           RefundStatus    `json:"status" gorm:"type:varchar(20);default:'completed';index"`
+	FailureReason    string          `json:"failure_reason,omitempty" gorm:"type:text"`
+	Restock          bool            `json:"restock" gorm:"default:false"`
+	RestockQuantity  int             `json:"restock_quantity,omitempty" gorm:"default:0"` // units asked for; zero means all
+	RestockedUnits   int             `json:"restocked_units" gorm:"default:0"`
+	Clawbacks        JSONB           `json:"clawbacks" gorm:"type:jsonb"`
+	ProcessedBy      *uuid.UUID      `json:"processed_by,omitempty" gorm:"type:uuid"`
 }
 
 type AuthorizationChain struct {
@@ -35,9 +74,13 @@ type AuthorizationChain struct {
 	IPAssetID        uuid.UUID  `json:"ip_asset_id" gorm:"type:uuid;not null;index"`
 	LicenseID        uuid.UUID  `json:"license_id" gorm:"type:uuid;not null;index"`
 	ParentChainID    *uuid.UUID `json:"parent_chain_id" gorm:"type:uuid;index"`
+	Depth            int        `json:"depth" gorm:"default:0;index"` // 0 = the product's own license, ancestors count up
 	BlockchainHash   string     `json:"blockchain_hash" gorm:"size:66"`
 	VerificationCode string     `json:"verification_code" gorm:"size:32;uniqueIndex"`
 	IsActive         bool       `json:"is_active" gorm:"default:true"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevokedBy        *uuid.UUID `json:"revoked_by,omitempty" gorm:"type:uuid"`
+	RevocationReason string     `json:"revocation_reason,omitempty" gorm:"type:text"`
 
 	// Relationships
 	Product     Product              `json:"product,omitempty" gorm:"foreignKey:ProductID"`
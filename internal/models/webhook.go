@@ -0,0 +1,13 @@
+// internal/models/webhook.go
+package models
+
+// WebhookEvent records a provider event that has been handled, so
+// redelivered events are acknowledged without being applied twice
+type WebhookEvent struct {
+	BaseModel
+	Provider  string `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_webhook_events_provider_event"`
+	EventID   string `json:"event_id" gorm:"size:255;not null;uniqueIndex:idx_webhook_events_provider_event"`
+	EventType string `json:"event_type" gorm:"size:100;not null;index"`
+	Status    string `json:"status" gorm:"type:varchar(20);not null"` // processed or ignored
+	Message   string `json:"message,omitempty" gorm:"type:text"`
+}
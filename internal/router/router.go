@@ -2,6 +2,8 @@
 package router
 
 import (
+	"context"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -19,14 +21,55 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	notificationService := services.NewNotificationService(db, cfg)
 	storageService, _ := services.NewStorageService(cfg)
 	blockchainService := services.NewBlockchainService(db, cfg)
-	authorizationService := services.NewAuthorizationService(db, blockchainService)
+	authorizationService := services.NewAuthorizationService(db, cfg, notificationService, blockchainService)
 
+	// Anchor ledger records in Merkle batches
+	go blockchainService.StartAnchorBatcher(context.Background())
+
+	exchangeService := services.NewExchangeService(cfg)
 	authService := services.NewAuthService(db, cfg)
-	ipService := services.NewIPService(db, blockchainService, storageService)
-	licenseService := services.NewLicenseService(db, notificationService)
-	productService := services.NewProductService(db, authorizationService, notificationService)
-	paymentService := services.NewPaymentService(db, cfg)
-	adminService := services.NewAdminService(db, notificationService)
+	ipService := services.NewIPService(db, blockchainService, authorizationService, storageService, exchangeService)
+	accountingService := services.NewAccountingService(db, cfg, exchangeService)
+	inventoryService := services.NewInventoryService(db, cfg)
+	paymentService := services.NewPaymentService(db, cfg, accountingService, notificationService, inventoryService)
+	licenseService := services.NewLicenseService(db, notificationService, blockchainService, authorizationService, paymentService, storageService)
+	paymentService.SetLicenseService(licenseService)
+	productService := services.NewProductService(db, authorizationService, notificationService, accountingService, paymentService, inventoryService)
+	orderService := services.NewOrderService(db, productService, paymentService, inventoryService)
+	adminService := services.NewAdminService(db, notificationService, accountingService, paymentService)
+	labelService := services.NewLabelService(db, cfg)
+
+	// Move sale proceeds out of the settlement hold
+	go accountingService.StartSettlementScheduler(context.Background())
+
+	// Return the stock of unpaid purchases once their reservation expires
+	go paymentService.StartReservationReaper(context.Background())
+
+	// Expire licenses at the end of their term and remind licensees to renew
+	go licenseService.StartExpiryScheduler(context.Background())
+	scanService := services.NewScanService(db, cfg, notificationService)
+	payoutService := services.NewPayoutService(db, cfg, accountingService, notificationService)
+
+	// Payment providers take payments, refund them and pay out to sellers;
+	// each is selected by the payment or payout method
+	var providers []services.PaymentProvider
+	if cfg.Payment.StripeSecretKey != "" {
+		providers = append(providers, services.NewStripePaymentProvider(cfg.Payment.StripeSecretKey))
+	}
+	if cfg.Payment.PayPalClientID != "" {
+		providers = append(providers, services.NewPayPalPaymentProvider(cfg.Payment.PayPalAPIBase,
+			cfg.Payment.PayPalClientID, cfg.Payment.PayPalClientSecret))
+	}
+	if cfg.Environment != "production" {
+		providers = append(providers, services.NewFakePaymentProvider())
+	}
+	for _, provider := range providers {
+		paymentService.RegisterProvider(provider)
+		payoutService.RegisterProvider(provider)
+	}
+
+	// Settle processing payouts with their providers, and fail stale ones
+	go payoutService.StartPayoutReconciler(context.Background())
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
@@ -35,8 +78,13 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	licenseHandler := handlers.NewLicenseHandler(licenseService)
 	productHandler := handlers.NewProductHandler(productService, storageService)
 	paymentHandler := handlers.NewPaymentHandler(paymentService)
-	verificationHandler := handlers.NewVerificationHandler(authorizationService)
+	orderHandler := handlers.NewOrderHandler(orderService)
+	verificationHandler := handlers.NewVerificationHandler(authorizationService, scanService)
 	adminHandler := handlers.NewAdminHandler(adminService)
+	ledgerHandler := handlers.NewLedgerHandler(blockchainService)
+	payoutHandler := handlers.NewPayoutHandler(payoutService)
+	webhookHandler := handlers.NewWebhookHandler(paymentService)
+	labelHandler := handlers.NewLabelHandler(labelService)
 
 	// Set JWT secret
 	utils.SetJWTSecret(cfg.JWT.SecretKey)
@@ -44,6 +92,17 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 	// Initialize Gin router
 	r := gin.New()
 
+	// Client IPs are taken from X-Forwarded-For only when a trusted proxy
+	// sets it, as they are recorded as evidence of signatures and scans
+	proxies, _ := utils.ParseNetworks(cfg.Server.TrustedProxies)
+	trusted := make([]string, len(proxies))
+	for i, network := range proxies {
+		trusted[i] = network.String()
+	}
+	if err := r.SetTrustedProxies(trusted); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
 	// Global middleware
 	r.Use(gin.Recovery())
 	r.Use(middleware.RequestLogger())
@@ -60,6 +119,9 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 		})
 	})
 
+	// Public keys for offline verification of product certificates
+	r.GET("/.well-known/jwks.json", verificationHandler.GetJWKS)
+
 	// API v1 routes
 	v1 := r.Group("/v1")
 	{
@@ -125,6 +187,11 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			licenses.GET("/statistics", licenseHandler.GetLicenseStatistics)
 			licenses.GET("/:id", licenseHandler.GetLicenseApplication)
 			licenses.PUT("/:id/approve", licenseHandler.ApproveLicense)
+			licenses.POST("/:id/pay", licenseHandler.PayLicenseFee)
+			licenses.POST("/:id/renew", licenseHandler.RenewLicense)
+			licenses.GET("/:id/agreement", licenseHandler.GetLicenseAgreement)
+			licenses.POST("/:id/agreement/sign", licenseHandler.SignLicenseAgreement)
+			licenses.GET("/:id/agreement/signed", licenseHandler.GetSignedLicenseAgreement)
 			licenses.PUT("/:id/reject", licenseHandler.RejectLicense)
 			licenses.PUT("/:id/revoke", licenseHandler.RevokeLicense)
 			licenses.GET("/:id/verify", licenseHandler.VerifyLicense)
@@ -148,10 +215,32 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				protected.DELETE("/:id", productHandler.DeleteProduct)
 				protected.POST("/:id/purchase", productHandler.PurchaseProduct)
 				protected.GET("/:id/statistics", productHandler.GetProductStatistics)
+				protected.GET("/:id/units", productHandler.GetProductUnits)
+				protected.GET("/:id/qr", labelHandler.GetProductQRCode)
+				protected.POST("/labels", labelHandler.GetLabelSheet)
 				protected.POST("/upload-images", middleware.UploadRateLimit(), productHandler.UploadProductImages)
 			}
 		}
 
+		// Cart and order routes
+		cart := v1.Group("/cart")
+		cart.Use(middleware.AuthRequired())
+		{
+			cart.GET("", orderHandler.GetCart)
+			cart.DELETE("", orderHandler.ClearCart)
+			cart.POST("/items", orderHandler.AddToCart)
+			cart.PUT("/items/:product_id", orderHandler.UpdateCartItem)
+			cart.DELETE("/items/:product_id", orderHandler.RemoveFromCart)
+			cart.POST("/checkout", orderHandler.Checkout)
+		}
+
+		orders := v1.Group("/orders")
+		orders.Use(middleware.AuthRequired())
+		{
+			orders.GET("", orderHandler.GetOrders)
+			orders.GET("/:id", orderHandler.GetOrder)
+		}
+
 		// Payment routes
 		payments := v1.Group("/payments")
 		payments.Use(middleware.AuthRequired())
@@ -160,16 +249,27 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 			payments.POST("/confirm", paymentHandler.ConfirmPayment)
 			payments.GET("/history", paymentHandler.GetPaymentHistory)
 			payments.GET("/balance", paymentHandler.GetUserBalance)
-			payments.POST("/payout", paymentHandler.RequestPayout)
+			payments.GET("/statement", paymentHandler.GetStatement)
+			payments.POST("/payout", payoutHandler.RequestPayout)
+			payments.GET("/payouts", payoutHandler.GetPayouts)
+			payments.GET("/payouts/:id", payoutHandler.GetPayout)
 			payments.POST("/refund", middleware.AdminRequired(), paymentHandler.ProcessRefund)
 		}
 
+		// Provider webhooks (public, authenticated by signature)
+		webhooks := v1.Group("/webhooks")
+		{
+			webhooks.POST("/stripe", webhookHandler.Stripe)
+		}
+
 		// Verification routes (public)
 		verify := v1.Group("/verify")
 		{
 			verify.GET("/:code", verificationHandler.VerifyProductByCode)
+			verify.GET("/:code/certificate", verificationHandler.GetProductCertificate)
 			verify.GET("/chain/:id", verificationHandler.VerifyAuthorizationChain)
 			verify.GET("/chain/:id/history", verificationHandler.GetAuthorizationChainHistory)
+			verify.GET("/preimage/:hash", ledgerHandler.GetPreimage)
 		}
 
 		// Admin routes
@@ -211,6 +311,16 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				adminTransactions.POST("/:id/refund", adminHandler.ProcessRefund)
 			}
 
+			// Payout review
+			adminPayouts := admin.Group("/payouts")
+			{
+				adminPayouts.GET("", payoutHandler.GetPayoutQueue)
+				adminPayouts.PUT("/:id/approve", payoutHandler.ApprovePayout)
+				adminPayouts.PUT("/:id/reject", payoutHandler.RejectPayout)
+				adminPayouts.PUT("/:id/complete", payoutHandler.CompletePayout)
+				adminPayouts.PUT("/:id/fail", payoutHandler.FailPayout)
+			}
+
 			// Analytics and reporting
 			adminAnalytics := admin.Group("/analytics")
 			{
@@ -224,6 +334,14 @@ func Initialize(db *gorm.DB, cfg *config.Config) *gin.Engine {
 				adminSettings.PUT("", adminHandler.UpdateSettings)
 			}
 
+			// Provenance ledger
+			adminLedger := admin.Group("/ledger")
+			{
+				adminLedger.GET("", ledgerHandler.GetLedgerEntries)
+				adminLedger.GET("/verify", ledgerHandler.VerifyLedger)
+				adminLedger.GET("/anchors/:hash", ledgerHandler.GetAnchor)
+			}
+
 			// Content moderation
 			adminReports := admin.Group("/reports")
 			{
@@ -0,0 +1,819 @@
+// internal/services/accounting_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// AccountingService keeps the platform's double-entry ledger. Every movement
+// of money is a journal entry whose debits equal its credits, and every
+// balance is derived from journal lines. Accounts are kept per currency, so
+// amounts are never converted inside the ledger.
+type AccountingService struct {
+	db              *gorm.DB
+	config          *config.Config
+	exchangeService *ExchangeService
+}
+
+// Posting is one side of a journal entry against an owner's account.
+// Platform accounts use uuid.Nil as owner.
+type Posting struct {
+	OwnerID uuid.UUID          `json:"owner_id"`
+	Kind    models.AccountKind `json:"kind"`
+	Debit   decimal.Decimal    `json:"debit"`
+	Credit  decimal.Decimal    `json:"credit"`
+}
+
+func (p Posting) MarshalJSON() ([]byte, error) {
+	type posting Posting
+	return json.Marshal(struct {
+		posting
+		Debit  models.DecimalNumber `json:"debit"`
+		Credit models.DecimalNumber `json:"credit"`
+	}{posting(p), models.DecimalNumber(p.Debit), models.DecimalNumber(p.Credit)})
+}
+
+// CurrencyBalance is a user's position in one currency
+type CurrencyBalance struct {
+	Currency      string          `json:"currency"`
+	Available     decimal.Decimal `json:"available_balance"`
+	Pending       decimal.Decimal `json:"pending_balance"`
+	Reserved      decimal.Decimal `json:"reserved_balance"`
+	PaidOut       decimal.Decimal `json:"paid_out"`
+	TotalEarnings decimal.Decimal `json:"total_earnings"`
+}
+
+// currencyBalanceJSON is a CurrencyBalance with its amounts as JSON numbers
+type currencyBalanceJSON struct {
+	Currency      string               `json:"currency"`
+	Available     models.DecimalNumber `json:"available_balance"`
+	Pending       models.DecimalNumber `json:"pending_balance"`
+	Reserved      models.DecimalNumber `json:"reserved_balance"`
+	PaidOut       models.DecimalNumber `json:"paid_out"`
+	TotalEarnings models.DecimalNumber `json:"total_earnings"`
+}
+
+func (b CurrencyBalance) toJSON() currencyBalanceJSON {
+	return currencyBalanceJSON{
+		Currency:      b.Currency,
+		Available:     models.DecimalNumber(b.Available),
+		Pending:       models.DecimalNumber(b.Pending),
+		Reserved:      models.DecimalNumber(b.Reserved),
+		PaidOut:       models.DecimalNumber(b.PaidOut),
+		TotalEarnings: models.DecimalNumber(b.TotalEarnings),
+	}
+}
+
+func (b CurrencyBalance) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.toJSON())
+}
+
+// UserBalance is a user's position derived from the ledger. The totals are
+// converted into the reporting currency; Currencies lists what is actually
+// held in each currency.
+type UserBalance struct {
+	CurrencyBalance
+	Currencies []CurrencyBalance `json:"currencies"`
+}
+
+func (b UserBalance) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		currencyBalanceJSON
+		Currencies []CurrencyBalance `json:"currencies"`
+	}{b.CurrencyBalance.toJSON(), b.Currencies})
+}
+
+func NewAccountingService(db *gorm.DB, config *config.Config, exchangeService *ExchangeService) *AccountingService {
+	return &AccountingService{
+		db:              db,
+		config:          config,
+		exchangeService: exchangeService,
+	}
+}
+
+func debit(ownerID uuid.UUID, kind models.AccountKind, amount decimal.Decimal) Posting {
+	return Posting{OwnerID: ownerID, Kind: kind, Debit: amount}
+}
+
+func credit(ownerID uuid.UUID, kind models.AccountKind, amount decimal.Decimal) Posting {
+	return Posting{OwnerID: ownerID, Kind: kind, Credit: amount}
+}
+
+// jsonDecimal reads an amount stored in JSONB, which decodes numbers as
+// float64, or held in memory as a decimal
+func jsonDecimal(value interface{}) decimal.Decimal {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		return v
+	case float64:
+		return decimal.NewFromFloat(v)
+	case string:
+		d, _ := decimal.NewFromString(v)
+		return d
+	case json.Number:
+		d, _ := decimal.NewFromString(v.String())
+		return d
+	}
+	return decimal.Zero
+}
+
+// ValidatePostings checks that postings form a balanced journal entry
+func ValidatePostings(postings []Posting) error {
+	if len(postings) < 2 {
+		return errors.New("journal entry needs at least two postings")
+	}
+
+	debits, credits := decimal.Zero, decimal.Zero
+	for _, posting := range postings {
+		if posting.Debit.IsNegative() || posting.Credit.IsNegative() {
+			return errors.New("posting amounts cannot be negative")
+		}
+		if posting.Debit.IsZero() == posting.Credit.IsZero() {
+			return errors.New("posting must be either a debit or a credit")
+		}
+		debits = debits.Add(posting.Debit)
+		credits = credits.Add(posting.Credit)
+	}
+
+	if !debits.Equal(credits) {
+		return fmt.Errorf("journal entry is unbalanced: debits %s, credits %s", debits, credits)
+	}
+
+	return nil
+}
+
+// SaleRevenueShares reads the licensor shares stored on a sale transaction.
+// Transactions created before cascading shares carry a single IP creator share.
+func SaleRevenueShares(transaction *models.Transaction) ([]RevenueShare, error) {
+	var shares []RevenueShare
+
+	if raw, ok := transaction.RevenueShares["shares"]; ok {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read revenue shares: %w", err)
+		}
+		if err := json.Unmarshal(data, &shares); err != nil {
+			return nil, fmt.Errorf("failed to parse revenue shares: %w", err)
+		}
+		return shares, nil
+	}
+
+	amount := jsonDecimal(transaction.RevenueShares["ip_creator_share"])
+	creator, _ := transaction.RevenueShares["ip_creator_id"].(string)
+	if amount.IsPositive() && creator != "" {
+		recipientID, err := uuid.Parse(creator)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip creator id: %w", err)
+		}
+		shares = append(shares, RevenueShare{RecipientID: recipientID, Amount: amount})
+	}
+
+	return shares, nil
+}
+
+// BuildSalePostings splits a completed sale: the full amount arrives in
+// platform cash, the fee is platform revenue, each licensor's share and the
+// seller's remainder are credited to their pending accounts.
+func BuildSalePostings(transaction *models.Transaction) ([]Posting, error) {
+	shares, err := SaleRevenueShares(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	total := transaction.Amount
+	fee := transaction.PlatformFee
+
+	postings := []Posting{debit(uuid.Nil, models.AccountPlatformCash, total)}
+	if fee.IsPositive() {
+		postings = append(postings, credit(uuid.Nil, models.AccountPlatformRevenue, fee))
+	}
+
+	remainder := total.Sub(fee)
+	for _, share := range shares {
+		if !share.Amount.IsPositive() {
+			continue
+		}
+		postings = append(postings, credit(share.RecipientID, models.AccountUserPending, share.Amount))
+		remainder = remainder.Sub(share.Amount)
+	}
+
+	if remainder.IsNegative() {
+		return nil, errors.New("revenue shares exceed the sale amount")
+	}
+	if remainder.IsPositive() {
+		postings = append(postings, credit(transaction.SellerID, models.AccountUserPending, remainder))
+	}
+
+	return postings, nil
+}
+
+// BuildRefundPostings reverses refundAmount of a sale in proportion to how
+// the sale was split, after refunded has already been refunded. Once the
+// sale has settled, recipients are debited from their available balance
+// instead of pending, which may take it below zero.
+func BuildRefundPostings(transaction *models.Transaction, refundAmount, refunded decimal.Decimal, settled bool) ([]Posting, error) {
+	sale, err := BuildSalePostings(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	total := transaction.Amount
+	refund := refundAmount
+	if !refund.IsPositive() || refund.Add(refunded).GreaterThan(total) {
+		return nil, errors.New("refund amount must be positive and at most what is left of the sale")
+	}
+
+	postings := []Posting{credit(uuid.Nil, models.AccountPlatformCash, refund)}
+
+	// Claw back each credit of the sale in proportion, rounded down to the
+	// currency's minor unit. Shares are scaled on the running total so that
+	// several partial refunds add up to exactly the full reversal; rounding
+	// leftovers go to the seller.
+	places := models.CurrencyExponent(transaction.Currency)
+	share := func(credit, refunded decimal.Decimal) decimal.Decimal {
+		return credit.Mul(refunded).Div(total).Truncate(places)
+	}
+	remainder := refund
+	sellerIndex := -1
+	for _, posting := range sale[1:] {
+		amount := share(posting.Credit, refunded.Add(refund)).Sub(share(posting.Credit, refunded))
+
+		kind := posting.Kind
+		if settled && kind == models.AccountUserPending {
+			kind = models.AccountUserAvailable
+		}
+		if posting.OwnerID == transaction.SellerID && posting.Kind == models.AccountUserPending {
+			sellerIndex = len(postings)
+		}
+
+		postings = append(postings, debit(posting.OwnerID, kind, amount))
+		remainder = remainder.Sub(amount)
+	}
+
+	if sellerIndex < 0 {
+		sellerIndex = len(postings) - 1
+	}
+	postings[sellerIndex].Debit = postings[sellerIndex].Debit.Add(remainder)
+
+	// Drop lines that rounded to nothing
+	filtered := postings[:0]
+	for _, posting := range postings {
+		if posting.Debit.IsPositive() || posting.Credit.IsPositive() {
+			filtered = append(filtered, posting)
+		}
+	}
+
+	return filtered, nil
+}
+
+// PostEntry writes a balanced journal entry inside tx, against the
+// accounts in the entry's currency. An entry whose idempotency key already
+// exists is returned unchanged.
+func (s *AccountingService) PostEntry(tx *gorm.DB, entry *models.JournalEntry, postings []Posting) (*models.JournalEntry, error) {
+	if err := ValidatePostings(postings); err != nil {
+		return nil, err
+	}
+	entry.Currency = models.NormalizeCurrency(entry.Currency)
+
+	var existing models.JournalEntry
+	err := tx.Where("idempotency_key = ?", entry.IdempotencyKey).First(&existing).Error
+	if err == nil {
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to create journal entry: %w", err)
+	}
+
+	lines := make([]models.JournalLine, 0, len(postings))
+	for _, posting := range postings {
+		account, err := s.getAccount(tx, posting.OwnerID, posting.Kind, entry.Currency)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, models.JournalLine{
+			JournalEntryID: entry.ID,
+			AccountID:      account.ID,
+			Debit:          posting.Debit,
+			Credit:         posting.Credit,
+		})
+	}
+
+	if err := tx.Create(&lines).Error; err != nil {
+		return nil, fmt.Errorf("failed to create journal lines: %w", err)
+	}
+
+	entry.Lines = lines
+	return entry, nil
+}
+
+// RecordSale posts a completed sale transaction
+func (s *AccountingService) RecordSale(tx *gorm.DB, transaction *models.Transaction) error {
+	postings, err := BuildSalePostings(transaction)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.PostEntry(tx, &models.JournalEntry{
+		EntryType:      models.JournalEntrySale,
+		IdempotencyKey: "sale:" + transaction.ID.String(),
+		ReferenceType:  "transaction",
+		ReferenceID:    &transaction.ID,
+		Description:    fmt.Sprintf("Sale %s", transaction.ID),
+		Currency:       transaction.Currency,
+	}, postings)
+	return err
+}
+
+// DistributeRevenue creates one completed revenue_share transaction per
+// recipient of a sale: every licensor in the lineage and the seller's own
+// remainder. Running it again for the same sale returns the existing ones.
+func (s *AccountingService) DistributeRevenue(tx *gorm.DB, sale *models.Transaction) ([]models.Transaction, error) {
+	var existing []models.Transaction
+	if err := tx.Where("parent_transaction_id = ? AND transaction_type = ?", sale.ID, models.TransactionTypeRevenueShare).
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if len(existing) > 0 {
+		return existing, nil
+	}
+
+	transactions, err := BuildRevenueShareTransactions(sale)
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return transactions, nil
+	}
+
+	if err := tx.Create(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to create revenue share transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// BuildRevenueShareTransactions drafts the revenue_share transactions of a
+// sale. They have no buyer, so they only show in their recipient's history.
+func BuildRevenueShareTransactions(sale *models.Transaction) ([]models.Transaction, error) {
+	shares, err := SaleRevenueShares(sale)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	newShare := func(recipientID uuid.UUID, amount decimal.Decimal, details models.JSONB) models.Transaction {
+		details["source_transaction_id"] = sale.ID
+		return models.Transaction{
+			TransactionType:     models.TransactionTypeRevenueShare,
+			SellerID:            recipientID,
+			ProductID:           sale.ProductID,
+			LicenseID:           sale.LicenseID,
+			Amount:              amount,
+			Currency:            sale.Currency,
+			RevenueShares:       details,
+			PaymentMethod:       "internal",
+			PaymentReference:    sale.ID.String(),
+			Status:              models.TransactionStatusCompleted,
+			ProcessedAt:         &now,
+			ParentTransactionID: &sale.ID,
+		}
+	}
+
+	remainder := sale.Amount.Sub(sale.PlatformFee)
+	transactions := make([]models.Transaction, 0, len(shares)+1)
+	for _, share := range shares {
+		if !share.Amount.IsPositive() {
+			continue
+		}
+		remainder = remainder.Sub(share.Amount)
+
+		transactions = append(transactions, newShare(share.RecipientID, share.Amount, models.JSONB{
+			"role":        "licensor",
+			"ip_asset_id": share.IPAssetID,
+			"license_id":  share.LicenseID,
+			"depth":       share.Depth,
+			"percent":     share.Percent,
+		}))
+	}
+
+	if remainder.IsNegative() {
+		return nil, errors.New("revenue shares exceed the sale amount")
+	}
+	if remainder.IsPositive() {
+		transactions = append(transactions, newShare(sale.SellerID, remainder, models.JSONB{
+			"role": "seller",
+		}))
+	}
+
+	return transactions, nil
+}
+
+// LockRefunds serialises refunds of one transaction until tx ends, so a
+// refund we initiate and the provider's refund notification cannot both post
+func (s *AccountingService) LockRefunds(tx *gorm.DB, transactionID uuid.UUID) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "refund:"+transactionID.String()).Error; err != nil {
+		return fmt.Errorf("failed to lock refunds: %w", err)
+	}
+	return nil
+}
+
+// RefundedAmount is the total refunded to the buyer of a transaction so far
+func (s *AccountingService) RefundedAmount(tx *gorm.DB, transactionID uuid.UUID) (decimal.Decimal, error) {
+	var refunded struct {
+		Amount decimal.Decimal
+	}
+	if err := tx.Table("journal_lines").
+		Select("COALESCE(SUM(journal_lines.credit), 0) AS amount").
+		Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.journal_entry_id").
+		Where("journal_entries.entry_type = ? AND journal_entries.reference_id = ? AND accounts.kind = ?",
+			models.JournalEntryRefund, transactionID, models.AccountPlatformCash).
+		Where("journal_lines.deleted_at IS NULL").
+		Scan(&refunded).Error; err != nil {
+		return decimal.Zero, fmt.Errorf("failed to calculate refunded amount: %w", err)
+	}
+	return refunded.Amount, nil
+}
+
+// RecordRefund posts a refund of refundAmount against a sale, on top of the
+// refunds already posted, and returns the postings that claw it back. key
+// distinguishes several refunds of the same transaction; callers hold
+// LockRefunds.
+func (s *AccountingService) RecordRefund(tx *gorm.DB, transaction *models.Transaction, refundAmount decimal.Decimal, key string) ([]Posting, error) {
+	var settled int64
+	if err := tx.Model(&models.JournalEntry{}).
+		Where("entry_type = ? AND reference_id = ?", models.JournalEntrySettlement, transaction.ID).
+		Count(&settled).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	refunded, err := s.RefundedAmount(tx, transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	postings, err := BuildRefundPostings(transaction, refundAmount, refunded, settled > 0)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.PostEntry(tx, &models.JournalEntry{
+		EntryType:      models.JournalEntryRefund,
+		IdempotencyKey: "refund:" + key,
+		ReferenceType:  "transaction",
+		ReferenceID:    &transaction.ID,
+		Description:    fmt.Sprintf("Refund of %s for transaction %s", models.NewMoney(refundAmount, transaction.Currency), transaction.ID),
+		Currency:       transaction.Currency,
+	}, postings)
+	if err != nil {
+		return nil, err
+	}
+	return postings, nil
+}
+
+// SettleTransaction moves what is still pending from a sale into the
+// recipients' available balances
+func (s *AccountingService) SettleTransaction(transactionID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var rows []struct {
+			OwnerID  uuid.UUID
+			Currency string
+			Amount   decimal.Decimal
+		}
+		if err := tx.Table("journal_lines").
+			Select("accounts.owner_id AS owner_id, accounts.currency AS currency, SUM(journal_lines.credit - journal_lines.debit) AS amount").
+			Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+			Joins("JOIN journal_entries ON journal_entries.id = journal_lines.journal_entry_id").
+			Where("journal_entries.reference_id = ? AND accounts.kind = ?", transactionID, models.AccountUserPending).
+			Where("journal_lines.deleted_at IS NULL AND journal_entries.deleted_at IS NULL").
+			Group("accounts.owner_id, accounts.currency").
+			Scan(&rows).Error; err != nil {
+			return fmt.Errorf("failed to read pending funds: %w", err)
+		}
+
+		// A transaction's entries are all in its currency
+		var postings []Posting
+		currency := models.DefaultCurrency
+		for _, row := range rows {
+			if !row.Amount.IsPositive() {
+				continue
+			}
+			currency = row.Currency
+			postings = append(postings,
+				debit(row.OwnerID, models.AccountUserPending, row.Amount),
+				credit(row.OwnerID, models.AccountUserAvailable, row.Amount))
+		}
+
+		// Fully refunded before settling; record the settlement without lines
+		if len(postings) == 0 {
+			return tx.Create(&models.JournalEntry{
+				EntryType:      models.JournalEntrySettlement,
+				IdempotencyKey: "settlement:" + transactionID.String(),
+				ReferenceType:  "transaction",
+				ReferenceID:    &transactionID,
+				Description:    "Nothing left to settle",
+			}).Error
+		}
+
+		_, err := s.PostEntry(tx, &models.JournalEntry{
+			EntryType:      models.JournalEntrySettlement,
+			IdempotencyKey: "settlement:" + transactionID.String(),
+			ReferenceType:  "transaction",
+			ReferenceID:    &transactionID,
+			Description:    fmt.Sprintf("Settlement of transaction %s", transactionID),
+			Currency:       currency,
+		}, postings)
+		return err
+	})
+}
+
+// SettleDueTransactions settles sales older than the settlement hold
+func (s *AccountingService) SettleDueTransactions() (int, error) {
+	var transactionIDs []uuid.UUID
+	if err := s.db.Model(&models.JournalEntry{}).
+		Where("entry_type = ? AND created_at < ?", models.JournalEntrySale, time.Now().Add(-s.settlementHold())).
+		Where("NOT EXISTS (SELECT 1 FROM journal_entries s WHERE s.entry_type = ? AND s.reference_id = journal_entries.reference_id)",
+			models.JournalEntrySettlement).
+		Limit(500).
+		Pluck("reference_id", &transactionIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to find due settlements: %w", err)
+	}
+
+	settled := 0
+	for _, transactionID := range transactionIDs {
+		if err := s.SettleTransaction(transactionID); err != nil {
+			log.Printf("Failed to settle transaction %s: %v", transactionID, err)
+			continue
+		}
+		settled++
+	}
+
+	return settled, nil
+}
+
+// StartSettlementScheduler settles due sales every hour until ctx is done
+func (s *AccountingService) StartSettlementScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.SettleDueTransactions(); err != nil {
+				log.Printf("Settlement run failed: %v", err)
+			}
+		}
+	}
+}
+
+// ReserveFunds moves amount from a user's available balance in its currency
+// into reserve for a payout. It fails if the available balance does not
+// cover it.
+func (s *AccountingService) ReserveFunds(tx *gorm.DB, userID uuid.UUID, amount models.Money, payoutID uuid.UUID) error {
+	// Serialise reservations per user so two payouts cannot spend the same funds
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "payout:"+userID.String()).Error; err != nil {
+		return fmt.Errorf("failed to lock balance: %w", err)
+	}
+
+	available, err := s.accountBalance(tx, userID, models.AccountUserAvailable, amount.Currency)
+	if err != nil {
+		return err
+	}
+	if amount.Amount.GreaterThan(available) {
+		return errors.New("insufficient balance for payout")
+	}
+
+	_, err = s.PostEntry(tx, &models.JournalEntry{
+		EntryType:      models.JournalEntryPayoutReserve,
+		IdempotencyKey: "payout_reserve:" + payoutID.String(),
+		ReferenceType:  "payout",
+		ReferenceID:    &payoutID,
+		Description:    fmt.Sprintf("Funds reserved for payout %s", payoutID),
+		Currency:       amount.Currency,
+	}, []Posting{
+		debit(userID, models.AccountUserAvailable, amount.Amount),
+		credit(userID, models.AccountUserReserved, amount.Amount),
+	})
+	return err
+}
+
+// ReleaseFunds returns reserved funds of a rejected or failed payout
+func (s *AccountingService) ReleaseFunds(tx *gorm.DB, userID uuid.UUID, amount models.Money, payoutID uuid.UUID, attempt string) error {
+	_, err := s.PostEntry(tx, &models.JournalEntry{
+		EntryType:      models.JournalEntryPayoutRelease,
+		IdempotencyKey: fmt.Sprintf("payout_release:%s:%s", payoutID, attempt),
+		ReferenceType:  "payout",
+		ReferenceID:    &payoutID,
+		Description:    fmt.Sprintf("Funds released from payout %s", payoutID),
+		Currency:       amount.Currency,
+	}, []Posting{
+		debit(userID, models.AccountUserReserved, amount.Amount),
+		credit(userID, models.AccountUserAvailable, amount.Amount),
+	})
+	return err
+}
+
+// CompletePayout records reserved funds leaving the platform
+func (s *AccountingService) CompletePayout(tx *gorm.DB, userID uuid.UUID, amount models.Money, payoutID uuid.UUID) error {
+	_, err := s.PostEntry(tx, &models.JournalEntry{
+		EntryType:      models.JournalEntryPayoutComplete,
+		IdempotencyKey: "payout_complete:" + payoutID.String(),
+		ReferenceType:  "payout",
+		ReferenceID:    &payoutID,
+		Description:    fmt.Sprintf("Payout %s paid", payoutID),
+		Currency:       amount.Currency,
+	}, []Posting{
+		debit(userID, models.AccountUserReserved, amount.Amount),
+		credit(uuid.Nil, models.AccountPlatformCash, amount.Amount),
+	})
+	return err
+}
+
+// GetUserBalance derives a user's balances from their journal lines, per
+// currency and in total in the reporting currency. Currencies without an
+// exchange rate are left out of the totals.
+func (s *AccountingService) GetUserBalance(userID uuid.UUID) (*UserBalance, error) {
+	var rows []struct {
+		Kind     models.AccountKind
+		Currency string
+		Amount   decimal.Decimal
+	}
+	if err := s.db.Table("journal_lines").
+		Select("accounts.kind AS kind, accounts.currency AS currency, SUM(journal_lines.credit - journal_lines.debit) AS amount").
+		Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+		Where("accounts.owner_id = ? AND journal_lines.deleted_at IS NULL", userID).
+		Group("accounts.kind, accounts.currency").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate balance: %w", err)
+	}
+
+	var paidOut []CurrencyAmount
+	if err := s.db.Table("journal_lines").
+		Select("accounts.currency AS currency, SUM(journal_lines.debit) AS amount").
+		Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+		Joins("JOIN journal_entries ON journal_entries.id = journal_lines.journal_entry_id").
+		Where("accounts.owner_id = ? AND accounts.kind = ? AND journal_entries.entry_type = ?",
+			userID, models.AccountUserReserved, models.JournalEntryPayoutComplete).
+		Where("journal_lines.deleted_at IS NULL").
+		Group("accounts.currency").
+		Scan(&paidOut).Error; err != nil {
+		return nil, fmt.Errorf("failed to calculate payouts: %w", err)
+	}
+
+	var currencies []string
+	byCurrency := make(map[string]*CurrencyBalance)
+	balanceIn := func(currency string) *CurrencyBalance {
+		if balance, ok := byCurrency[currency]; ok {
+			return balance
+		}
+		balance := &CurrencyBalance{Currency: currency}
+		byCurrency[currency] = balance
+		currencies = append(currencies, currency)
+		return balance
+	}
+
+	for _, row := range rows {
+		balance := balanceIn(row.Currency)
+		switch row.Kind {
+		case models.AccountUserAvailable:
+			balance.Available = row.Amount
+		case models.AccountUserPending:
+			balance.Pending = row.Amount
+		case models.AccountUserReserved:
+			balance.Reserved = row.Amount
+		}
+	}
+	for _, row := range paidOut {
+		balanceIn(row.Currency).PaidOut = row.Amount
+	}
+
+	exchange := s.exchange()
+	total := &UserBalance{CurrencyBalance: CurrencyBalance{Currency: exchange.ReportingCurrency()}}
+	total.Currencies = make([]CurrencyBalance, 0, len(currencies))
+	for _, currency := range currencies {
+		balance := byCurrency[currency]
+		balance.TotalEarnings = balance.Available.Add(balance.Pending).Add(balance.Reserved).Add(balance.PaidOut)
+		total.Currencies = append(total.Currencies, *balance)
+
+		converted, err := convertBalance(exchange, balance)
+		if err != nil {
+			log.Printf("Leaving %s out of the balance of user %s: %v", currency, userID, err)
+			continue
+		}
+		total.Available = total.Available.Add(converted.Available)
+		total.Pending = total.Pending.Add(converted.Pending)
+		total.Reserved = total.Reserved.Add(converted.Reserved)
+		total.PaidOut = total.PaidOut.Add(converted.PaidOut)
+		total.TotalEarnings = total.TotalEarnings.Add(converted.TotalEarnings)
+	}
+
+	return total, nil
+}
+
+func convertBalance(exchange *ExchangeService, balance *CurrencyBalance) (*CurrencyBalance, error) {
+	converted := &CurrencyBalance{Currency: exchange.ReportingCurrency()}
+	for _, field := range []struct {
+		from decimal.Decimal
+		to   *decimal.Decimal
+	}{
+		{balance.Available, &converted.Available},
+		{balance.Pending, &converted.Pending},
+		{balance.Reserved, &converted.Reserved},
+		{balance.PaidOut, &converted.PaidOut},
+		{balance.TotalEarnings, &converted.TotalEarnings},
+	} {
+		amount, err := exchange.ToReporting(models.NewMoney(field.from, balance.Currency))
+		if err != nil {
+			return nil, err
+		}
+		*field.to = amount.Amount
+	}
+	return converted, nil
+}
+
+// GetStatement lists the journal lines of a user's accounts, newest first
+func (s *AccountingService) GetStatement(userID uuid.UUID, params utils.PaginationParams) ([]models.JournalLine, int64, error) {
+	query := s.db.Model(&models.JournalLine{}).
+		Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+		Where("accounts.owner_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count journal lines: %w", err)
+	}
+
+	var lines []models.JournalLine
+	if err := utils.ApplyPagination(query.Preload("Account").Preload("JournalEntry").
+		Order("journal_lines.created_at DESC"), params).
+		Find(&lines).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch journal lines: %w", err)
+	}
+
+	return lines, total, nil
+}
+
+func (s *AccountingService) accountBalance(tx *gorm.DB, ownerID uuid.UUID, kind models.AccountKind, currency string) (decimal.Decimal, error) {
+	var balance struct {
+		Amount decimal.Decimal
+	}
+	if err := tx.Table("journal_lines").
+		Select("COALESCE(SUM(journal_lines.credit - journal_lines.debit), 0) AS amount").
+		Joins("JOIN accounts ON accounts.id = journal_lines.account_id").
+		Where("accounts.owner_id = ? AND accounts.kind = ? AND accounts.currency = ? AND journal_lines.deleted_at IS NULL",
+			ownerID, kind, models.NormalizeCurrency(currency)).
+		Scan(&balance).Error; err != nil {
+		return decimal.Zero, fmt.Errorf("failed to calculate balance: %w", err)
+	}
+	return balance.Amount, nil
+}
+
+func (s *AccountingService) getAccount(tx *gorm.DB, ownerID uuid.UUID, kind models.AccountKind, currency string) (*models.Account, error) {
+	var account models.Account
+	err := tx.Where("owner_id = ? AND kind = ? AND currency = ?", ownerID, kind, currency).First(&account).Error
+	if err == nil {
+		return &account, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	account = models.Account{OwnerID: ownerID, Kind: kind, Currency: currency}
+	if err := tx.Create(&account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create account: %w", err)
+	}
+	return &account, nil
+}
+
+func (s *AccountingService) exchange() *ExchangeService {
+	if s.exchangeService == nil {
+		return NewExchangeService(s.config)
+	}
+	return s.exchangeService
+}
+
+func (s *AccountingService) settlementHold() time.Duration {
+	if s.config == nil || s.config.Payment.SettlementHoldDays < 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(s.config.Payment.SettlementHoldDays) * 24 * time.Hour
+}
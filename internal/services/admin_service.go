@@ -2,11 +2,14 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/javajoker/imi-backend/internal/models"
@@ -16,22 +19,34 @@ import (
 type AdminService struct {
 	db                  *gorm.DB
 	notificationService *NotificationService
+	accountingService   *AccountingService
+	paymentService      *PaymentService
 }
 
 type AdminDashboardStats struct {
-	TotalUsers            int64   `json:"total_users"`
-	ActiveUsers           int64   `json:"active_users"`
-	NewUsersThisMonth     int64   `json:"new_users_this_month"`
-	TotalRevenue          float64 `json:"total_revenue"`
-	MonthlyRevenue        float64 `json:"monthly_revenue"`
-	TotalIPs              int64   `json:"total_ips"`
-	PendingIPVerification int64   `json:"pending_ip_verification"`
-	TotalProducts         int64   `json:"total_products"`
-	ActiveLicenses        int64   `json:"active_licenses"`
-	PendingLicenses       int64   `json:"pending_licenses"`
-	TotalTransactions     int64   `json:"total_transactions"`
-	UserGrowth            float64 `json:"user_growth"`
-	RevenueGrowth         float64 `json:"revenue_growth"`
+	TotalUsers            int64           `json:"total_users"`
+	ActiveUsers           int64           `json:"active_users"`
+	NewUsersThisMonth     int64           `json:"new_users_this_month"`
+	TotalRevenue          decimal.Decimal `json:"total_revenue"`
+	MonthlyRevenue        decimal.Decimal `json:"monthly_revenue"`
+	RevenueCurrency       string          `json:"revenue_currency"`
+	TotalIPs              int64           `json:"total_ips"`
+	PendingIPVerification int64           `json:"pending_ip_verification"`
+	TotalProducts         int64           `json:"total_products"`
+	ActiveLicenses        int64           `json:"active_licenses"`
+	PendingLicenses       int64           `json:"pending_licenses"`
+	TotalTransactions     int64           `json:"total_transactions"`
+	UserGrowth            float64         `json:"user_growth"`
+	RevenueGrowth         float64         `json:"revenue_growth"`
+}
+
+func (s AdminDashboardStats) MarshalJSON() ([]byte, error) {
+	type adminDashboardStats AdminDashboardStats
+	return json.Marshal(struct {
+		adminDashboardStats
+		TotalRevenue   models.DecimalNumber `json:"total_revenue"`
+		MonthlyRevenue models.DecimalNumber `json:"monthly_revenue"`
+	}{adminDashboardStats(s), models.DecimalNumber(s.TotalRevenue), models.DecimalNumber(s.MonthlyRevenue)})
 }
 
 type AdminUserFilter struct {
@@ -74,10 +89,12 @@ type AdminTransactionFilter struct {
 	CreatedBefore   *time.Time                `json:"created_before,omitempty"`
 }
 
-func NewAdminService(db *gorm.DB, notificationService *NotificationService) *AdminService {
+func NewAdminService(db *gorm.DB, notificationService *NotificationService, accountingService *AccountingService, paymentService *PaymentService) *AdminService {
 	return &AdminService{
 		db:                  db,
 		notificationService: notificationService,
+		accountingService:   accountingService,
+		paymentService:      paymentService,
 	}
 }
 
@@ -94,13 +111,14 @@ func (s *AdminService) GetDashboardStats() (*AdminDashboardStats, error) {
 	s.db.Model(&models.User{}).Where("created_at >= ?", monthStart).Count(&stats.NewUsersThisMonth)
 
 	// Revenue statistics
-	s.db.Model(&models.Transaction{}).
-		Where("status = ?", models.TransactionStatusCompleted).
-		Select("COALESCE(SUM(amount), 0)").Scan(&stats.TotalRevenue)
+	// Revenue share transactions redistribute sales and are not counted again
+	stats.RevenueCurrency = s.accountingService.exchange().ReportingCurrency()
+	stats.TotalRevenue = s.revenue(s.db.Model(&models.Transaction{}).
+		Where("status = ? AND transaction_type <> ?", models.TransactionStatusCompleted, models.TransactionTypeRevenueShare))
 
-	s.db.Model(&models.Transaction{}).
-		Where("status = ? AND created_at >= ?", models.TransactionStatusCompleted, monthStart).
-		Select("COALESCE(SUM(amount), 0)").Scan(&stats.MonthlyRevenue)
+	stats.MonthlyRevenue = s.revenue(s.db.Model(&models.Transaction{}).
+		Where("status = ? AND transaction_type <> ? AND created_at >= ?",
+			models.TransactionStatusCompleted, models.TransactionTypeRevenueShare, monthStart))
 
 	// IP and Product statistics
 	s.db.Model(&models.IPAsset{}).Where("status = ?", models.ProductStatusActive).Count(&stats.TotalIPs)
@@ -126,18 +144,17 @@ func (s *AdminService) GetDashboardStats() (*AdminDashboardStats, error) {
 		Where("created_at >= ? AND created_at < ?", lastMonthStart, monthStart).
 		Count(&lastMonthUsers)
 
-	var lastMonthRevenueAmount float64
-	s.db.Model(&models.Transaction{}).
-		Where("status = ? AND created_at >= ? AND created_at < ?",
-			models.TransactionStatusCompleted, lastMonthStart, monthStart).
-		Select("COALESCE(SUM(amount), 0)").Scan(&lastMonthRevenueAmount)
+	lastMonthRevenueAmount := s.revenue(s.db.Model(&models.Transaction{}).
+		Where("status = ? AND transaction_type <> ? AND created_at >= ? AND created_at < ?",
+			models.TransactionStatusCompleted, models.TransactionTypeRevenueShare, lastMonthStart, monthStart))
 
 	if lastMonthUsers > 0 {
 		stats.UserGrowth = float64(stats.NewUsersThisMonth-lastMonthUsers) / float64(lastMonthUsers) * 100
 	}
 
-	if lastMonthRevenueAmount > 0 {
-		stats.RevenueGrowth = (stats.MonthlyRevenue - lastMonthRevenueAmount) / lastMonthRevenueAmount * 100
+	if lastMonthRevenueAmount.IsPositive() {
+		stats.RevenueGrowth = stats.MonthlyRevenue.Sub(lastMonthRevenueAmount).
+			Div(lastMonthRevenueAmount).Mul(decimal.NewFromInt(100)).InexactFloat64()
 	}
 
 	return stats, nil
@@ -433,7 +450,7 @@ func (s *AdminService) GetLicenseApplications(filter AdminLicenseFilter) ([]mode
 
 // Transaction Management
 func (s *AdminService) GetTransactions(filter AdminTransactionFilter) ([]models.Transaction, int64, error) {
-	query := s.db.Model(&models.Transaction{}).Preload("Buyer").Preload("Seller").Preload("Product")
+	query := s.db.Model(&models.Transaction{}).Preload("Buyer").Preload("Seller").Preload("Product").Preload("Refunds")
 
 	// Apply filters
 	if filter.TransactionType != nil {
@@ -481,39 +498,29 @@ func (s *AdminService) GetTransactions(filter AdminTransactionFilter) ([]models.
 	return transactions, total, nil
 }
 
-func (s *AdminService) ProcessRefund(transactionID uuid.UUID, adminID uuid.UUID, reason string) error {
-	// Find transaction
-	var transaction models.Transaction
-	if err := s.db.Preload("Buyer").Preload("Seller").Preload("Product").
-		First(&transaction, transactionID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("transaction not found")
-		}
-		return fmt.Errorf("database error: %w", err)
+// ProcessRefund refunds all or part of a transaction through the payment
+// service and records who did it
+func (s *AdminService) ProcessRefund(req *RefundRequest, adminID uuid.UUID) (*models.Refund, error) {
+	if s.paymentService == nil {
+		return nil, errors.New("payments are not configured")
 	}
 
-	if transaction.Status != models.TransactionStatusCompleted {
-		return errors.New("can only refund completed transactions")
-	}
-
-	// Update transaction status
-	now := time.Now()
-	transaction.Status = models.TransactionStatusRefunded
-	transaction.RefundedAt = &now
-	transaction.RefundReason = reason
-
-	if err := s.db.Save(&transaction).Error; err != nil {
-		return fmt.Errorf("failed to process refund: %w", err)
+	refund, err := s.paymentService.ProcessRefund(req, &adminID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create audit log
-	go s.createAuditLog(adminID, "PROCESS_REFUND", "transaction", &transactionID, nil,
-		map[string]interface{}{"status": models.TransactionStatusRefunded, "reason": reason})
-
-	// Send notifications
-	go s.sendRefundNotification(&transaction, reason)
-
-	return nil
+	go s.createAuditLog(adminID, "PROCESS_REFUND", "transaction", &req.TransactionID, nil,
+		map[string]interface{}{
+			"refund_id":       refund.ID,
+			"amount":          refund.Amount,
+			"currency":        refund.Currency,
+			"restocked_units": refund.RestockedUnits,
+			"reason":          refund.Reason,
+		})
+
+	return refund, nil
 }
 
 // Settings Management
@@ -606,12 +613,10 @@ func (s *AdminService) GetAnalytics(startDate, endDate time.Time, metrics []stri
 			analytics["product_sales"] = count
 
 		case "revenue":
-			var revenue float64
-			s.db.Model(&models.Transaction{}).
-				Where("status = ? AND created_at BETWEEN ? AND ?",
-					models.TransactionStatusCompleted, startDate, endDate).
-				Select("COALESCE(SUM(amount), 0)").Scan(&revenue)
-			analytics["revenue"] = revenue
+			analytics["revenue"] = models.DecimalNumber(s.revenue(s.db.Model(&models.Transaction{}).
+				Where("status = ? AND transaction_type <> ? AND created_at BETWEEN ? AND ?",
+					models.TransactionStatusCompleted, models.TransactionTypeRevenueShare, startDate, endDate)))
+			analytics["revenue_currency"] = s.accountingService.exchange().ReportingCurrency()
 		}
 	}
 
@@ -619,6 +624,30 @@ func (s *AdminService) GetAnalytics(startDate, endDate time.Time, metrics []stri
 }
 
 // Helper methods
+
+// revenue totals the amounts of a transaction query in the reporting
+// currency. Currencies without an exchange rate are left out.
+func (s *AdminService) revenue(query *gorm.DB) decimal.Decimal {
+	var amounts []CurrencyAmount
+	if err := query.Select("currency, COALESCE(SUM(amount), 0) AS amount").
+		Group("currency").Scan(&amounts).Error; err != nil {
+		log.Printf("Failed to total revenue: %v", err)
+		return decimal.Zero
+	}
+
+	exchange := s.accountingService.exchange()
+	total := decimal.Zero
+	for _, amount := range amounts {
+		converted, err := exchange.ToReporting(models.NewMoney(amount.Amount, amount.Currency))
+		if err != nil {
+			log.Printf("Leaving %s out of revenue: %v", amount.Currency, err)
+			continue
+		}
+		total = total.Add(converted.Amount)
+	}
+	return total
+}
+
 func (s *AdminService) createAuditLog(userID uuid.UUID, action, resourceType string, resourceID *uuid.UUID, oldValues, newValues map[string]interface{}) {
 	auditLog := &models.AuditLog{
 		UserID:       &userID,
@@ -656,12 +685,6 @@ func (s *AdminService) sendIPRejectionNotification(ipAsset *models.IPAsset, reas
 	}
 }
 
-func (s *AdminService) sendRefundNotification(transaction *models.Transaction, reason string) {
-	if s.notificationService != nil {
-		s.notificationService.SendRefundNotification(transaction, reason)
-	}
-}
-
 // Content Moderation
 func (s *AdminService) GetContentReports(params utils.PaginationParams) ([]models.ContentReport, int64, error) {
 	query := s.db.Model(&models.ContentReport{}).Preload("Reporter").Preload("Resolver")
@@ -2,107 +2,838 @@
 package services
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/javajoker/imi-backend/internal/config"
 	"github.com/javajoker/imi-backend/internal/models"
 	"github.com/javajoker/imi-backend/internal/utils"
 )
 
 type AuthorizationService struct {
-	db                *gorm.DB
-	blockchainService *BlockchainService
+	db                  *gorm.DB
+	config              *config.Config
+	notificationService *NotificationService
+	blockchainService   *BlockchainService
+
+	// Signs product certificates, published through GetJWKS
+	signingKey ed25519.PrivateKey
+	signingJWK utils.JWK
+}
+
+// ProductCertificateClaims are the contents of a signed product certificate.
+// The certificate is a compact JWS (EdDSA over Ed25519) that can be checked
+// offline against the platform JWKS.
+type ProductCertificateClaims struct {
+	ProductID        string `json:"product_id"`
+	IPAssetID        string `json:"ip_asset_id"`
+	LicenseID        string `json:"license_id"`
+	VerificationCode string `json:"verification_code"`
+	ChainHash        string `json:"chain_hash"`
+	jwt.RegisteredClaims
+}
+
+// RevenueShare is what one licensor in a product's license lineage keeps
+// from a sale, after passing its own licensor's share upstream.
+type RevenueShare struct {
+	RecipientID uuid.UUID       `json:"recipient_id"`
+	IPAssetID   uuid.UUID       `json:"ip_asset_id"`
+	LicenseID   uuid.UUID       `json:"license_id"`
+	Depth       int             `json:"depth"`
+	Percent     decimal.Decimal `json:"percent"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+func (r RevenueShare) MarshalJSON() ([]byte, error) {
+	type revenueShare RevenueShare
+	return json.Marshal(struct {
+		revenueShare
+		Percent models.DecimalNumber `json:"percent"`
+		Amount  models.DecimalNumber `json:"amount"`
+	}{revenueShare(r), models.DecimalNumber(r.Percent), models.DecimalNumber(r.Amount)})
 }
 
-func NewAuthorizationService(db *gorm.DB, blockchainService *BlockchainService) *AuthorizationService {
+// UnitScan is the outcome of scanning a unit serial code. Unsold is set for a
+// unit that was never sold: genuine units reach buyers through a sale, so its
+// code may have been copied onto goods in circulation.
+type UnitScan struct {
+	Unit              models.ProductUnit `json:"unit"`
+	PreviouslyScanned bool               `json:"previously_scanned"`
+	Unsold            bool               `json:"unsold"`
+}
+
+func NewAuthorizationService(db *gorm.DB, config *config.Config, notificationService *NotificationService, blockchainService *BlockchainService) *AuthorizationService {
+	signingKey := loadCertificateSigningKey(config)
+
 	return &AuthorizationService{
-		db:                db,
-		blockchainService: blockchainService,
+		db:                  db,
+		config:              config,
+		notificationService: notificationService,
+		blockchainService:   blockchainService,
+		signingKey:          signingKey,
+		signingJWK:          utils.NewEd25519JWK(signingKey.Public().(ed25519.PublicKey)),
+	}
+}
+
+// loadCertificateSigningKey parses the configured signing key. Outside
+// production a missing key is replaced with a temporary one; certificates
+// signed with it stop verifying after a restart.
+func loadCertificateSigningKey(config *config.Config) ed25519.PrivateKey {
+	if config != nil && config.Certificate.SigningKey != "" {
+		key, err := utils.ParseEd25519PrivateKey(config.Certificate.SigningKey)
+		if err != nil {
+			log.Fatalf("Invalid certificate signing key: %v", err)
+		}
+		return key
+	}
+
+	if config != nil && config.Environment == "production" {
+		log.Fatal("Certificate signing key is required in production")
 	}
+
+	log.Printf("Warning: no certificate signing key configured, using a temporary key")
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	return key
 }
 
+// CreateProductAuthChain creates one chain node per license in the product's
+// lineage, from the original IP asset down to the product's own license, and
+// returns the product's node.
 func (s *AuthorizationService) CreateProductAuthChain(product *models.Product) (*models.AuthorizationChain, error) {
-	// Generate unique verification code
-	verificationCode, err := utils.GenerateRandomString(32)
+	lineage, err := s.GetLicenseLineage(product.LicenseID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate verification code: %w", err)
+		return nil, err
 	}
 
-	// Create authorization chain record
-	authChain := &models.AuthorizationChain{
-		ProductID:        product.ID,
-		IPAssetID:        product.License.IPAssetID,
-		LicenseID:        product.LicenseID,
-		VerificationCode: verificationCode,
-		IsActive:         true,
+	var authChain *models.AuthorizationChain
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for depth := len(lineage) - 1; depth >= 0; depth-- {
+			// Generate unique verification code
+			verificationCode, err := utils.GenerateRandomString(32)
+			if err != nil {
+				return fmt.Errorf("failed to generate verification code: %w", err)
+			}
+
+			node := &models.AuthorizationChain{
+				ProductID:        product.ID,
+				IPAssetID:        lineage[depth].IPAssetID,
+				LicenseID:        lineage[depth].ID,
+				Depth:            depth,
+				VerificationCode: verificationCode,
+				IsActive:         true,
+			}
+
+			parentHash := ""
+			if authChain != nil {
+				node.ParentChainID = &authChain.ID
+				parentHash = authChain.BlockchainHash
+			}
+
+			// Create blockchain record
+			if s.blockchainService != nil {
+				hash, err := s.blockchainService.CreateProductRecord(tx, product.ID, node.LicenseID, parentHash)
+				if err != nil {
+					return fmt.Errorf("failed to record authorization chain on the ledger: %w", err)
+				}
+				node.BlockchainHash = hash
+			}
+
+			if err := tx.Create(node).Error; err != nil {
+				return fmt.Errorf("failed to create authorization chain: %w", err)
+			}
+
+			authChain = node
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Create blockchain record
-	if s.blockchainService != nil {
-		if hash, err := s.blockchainService.CreateProductRecord(product.ID, product.LicenseID); err == nil {
-			authChain.BlockchainHash = hash
+	return authChain, nil
+}
+
+// GetLicenseLineage returns licenseID's license followed by every license it
+// derives from, ending with the license on the original IP asset. IPAsset and
+// LicenseTerms are preloaded on each entry.
+func (s *AuthorizationService) GetLicenseLineage(licenseID uuid.UUID) ([]models.LicenseApplication, error) {
+	maxDepth := s.maxChainDepth()
+	seen := make(map[uuid.UUID]bool)
+
+	var lineage []models.LicenseApplication
+	for next := &licenseID; next != nil; {
+		if seen[*next] {
+			return nil, errors.New("license lineage contains a cycle")
 		}
+		seen[*next] = true
+
+		if len(lineage) == maxDepth {
+			return nil, fmt.Errorf("authorization chain exceeds the maximum depth of %d", maxDepth)
+		}
+
+		var license models.LicenseApplication
+		if err := s.db.Preload("IPAsset").Preload("LicenseTerms").First(&license, *next).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("license not found")
+			}
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+
+		lineage = append(lineage, license)
+		next = license.IPAsset.ParentLicenseID
 	}
 
-	// Save to database
-	if err := s.db.Create(authChain).Error; err != nil {
-		return nil, fmt.Errorf("failed to create authorization chain: %w", err)
+	return lineage, nil
+}
+
+// AuthorizedTerritory is where products under a license may be sold: the
+// territory every license in its lineage covers
+func (s *AuthorizationService) AuthorizedTerritory(licenseID uuid.UUID) (models.TerritorySet, error) {
+	lineage, err := s.GetLicenseLineage(licenseID)
+	if err != nil {
+		return models.TerritorySet{}, err
 	}
 
-	return authChain, nil
+	territory := models.GlobalTerritory()
+	for _, license := range lineage {
+		territory = territory.Intersect(license.LicenseTerms.Territory)
+	}
+	return territory, nil
+}
+
+// ValidateLicenseLineage checks that every license a product would depend on
+// is still approved and active.
+func (s *AuthorizationService) ValidateLicenseLineage(licenseID uuid.UUID) error {
+	lineage, err := s.GetLicenseLineage(licenseID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, license := range lineage[1:] {
+		if license.Status != models.ApplicationStatusApproved || !license.IsActive {
+			return fmt.Errorf("upstream license for %s is not active or approved", license.IPAsset.Title)
+		}
+		if license.ExpiresAt != nil && license.ExpiresAt.Before(now) {
+			return fmt.Errorf("upstream license for %s has expired", license.IPAsset.Title)
+		}
+	}
+
+	return nil
+}
+
+// ValidateDerivativeSource checks that creatorID may register a derivative IP
+// asset under parentLicenseID. Products of the derivative sit one level below
+// the parent license, so that level must still fit in the chain depth.
+func (s *AuthorizationService) ValidateDerivativeSource(creatorID, parentLicenseID uuid.UUID) error {
+	lineage, err := s.GetLicenseLineage(parentLicenseID)
+	if err != nil {
+		return err
+	}
+
+	license := lineage[0]
+	if license.ApplicantID != creatorID {
+		return errors.New("unauthorized to use this license")
+	}
+
+	if license.Status != models.ApplicationStatusApproved || !license.IsActive {
+		return errors.New("license is not active or approved")
+	}
+
+	if license.ExpiresAt != nil && license.ExpiresAt.Before(time.Now()) {
+		return errors.New("license has expired")
+	}
+
+	if !license.LicenseTerms.AllowSublicensing {
+		return errors.New("license terms do not allow derivative works")
+	}
+
+	if err := requireSignedAgreement(s.db, &license); err != nil {
+		return err
+	}
+
+	if maxDepth := s.maxChainDepth(); len(lineage)+1 > maxDepth {
+		return fmt.Errorf("authorization chain exceeds the maximum depth of %d", maxDepth)
+	}
+
+	return s.ValidateLicenseLineage(parentLicenseID)
+}
+
+// CalculateRevenueCascade splits netAmount up a license lineage. The direct
+// licensor receives its share of the sale, and every licensor further up
+// receives its share of what its own licensee received.
+func (s *AuthorizationService) CalculateRevenueCascade(netAmount models.Money, lineage []models.LicenseApplication) []RevenueShare {
+	shares := make([]RevenueShare, len(lineage))
+
+	// Every level's cut is rounded to the minor unit before it is passed on,
+	// so the shares add up exactly to what the first licensor received
+	received := netAmount
+	for depth, license := range lineage {
+		received = received.Percent(license.LicenseTerms.RevenueSharePercentage)
+		shares[depth] = RevenueShare{
+			RecipientID: license.IPAsset.CreatorID,
+			IPAssetID:   license.IPAssetID,
+			LicenseID:   license.ID,
+			Depth:       depth,
+			Percent:     license.LicenseTerms.RevenueSharePercentage,
+			Amount:      received.Amount,
+		}
+	}
+
+	// Each licensor keeps what it received minus what it passes upstream
+	for depth := 0; depth < len(shares)-1; depth++ {
+		shares[depth].Amount = shares[depth].Amount.Sub(shares[depth+1].Amount)
+	}
+
+	return shares
 }
 
+// VerifyChain verifies a chain node and, recursively, all of its ancestors
 func (s *AuthorizationService) VerifyChain(authChainID uuid.UUID) (bool, error) {
 	if s.blockchainService != nil {
 		return s.blockchainService.VerifyChain(authChainID)
 	}
 
 	// Fallback verification without blockchain
-	var authChain models.AuthorizationChain
-	if err := s.db.Preload("IPAsset").Preload("License").Preload("Product").
-		First(&authChain, authChainID).Error; err != nil {
-		return false, fmt.Errorf("authorization chain not found: %w", err)
+	maxDepth := s.maxChainDepth()
+	for next, level := &authChainID, 0; next != nil; level++ {
+		if level == maxDepth {
+			return false, fmt.Errorf("authorization chain exceeds the maximum depth of %d", maxDepth)
+		}
+
+		var authChain models.AuthorizationChain
+		if err := s.db.Preload("IPAsset").Preload("License").Preload("ParentChain").
+			First(&authChain, *next).Error; err != nil {
+			return false, fmt.Errorf("authorization chain not found: %w", err)
+		}
+
+		if err := CheckChainNode(&authChain); err != nil {
+			return false, err
+		}
+
+		next = authChain.ParentChainID
 	}
 
-	return authChain.IsActive, nil
+	return true, nil
 }
 
+// VerifyProductByCode verifies a product chain code or a unit serial code
+// without recording a scan
 func (s *AuthorizationService) VerifyProductByCode(verificationCode string) (*models.AuthorizationChain, error) {
+	authChain, _, err := s.resolveVerificationCode(verificationCode)
+	return authChain, err
+}
+
+// ScanProductCode verifies a code like VerifyProductByCode and, when it is a
+// unit serial code, records the scan against that unit.
+func (s *AuthorizationService) ScanProductCode(verificationCode string) (*models.AuthorizationChain, *UnitScan, error) {
+	authChain, unit, err := s.resolveVerificationCode(verificationCode)
+	if err != nil || unit == nil {
+		return authChain, nil, err
+	}
+
+	scan, err := s.recordUnitScan(unit.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authChain, scan, nil
+}
+
+// resolveVerificationCode returns the product's active chain node for a chain
+// code, or for a unit code together with the unit
+func (s *AuthorizationService) resolveVerificationCode(verificationCode string) (*models.AuthorizationChain, *models.ProductUnit, error) {
 	var authChain models.AuthorizationChain
-	if err := s.db.Where("verification_code = ? AND is_active = ?", verificationCode, true).
+	err := s.db.Where("verification_code = ? AND depth = 0 AND is_active = ?", verificationCode, true).
 		Preload("Product").Preload("IPAsset").Preload("License").
-		First(&authChain).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid verification code")
+		First(&authChain).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var unit *models.ProductUnit
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		unit = &models.ProductUnit{}
+		if err := s.db.Where("verification_code = ?", verificationCode).First(unit).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, errors.New("invalid verification code")
+			}
+			return nil, nil, fmt.Errorf("database error: %w", err)
+		}
+
+		if err := s.db.Where("product_id = ? AND depth = 0 AND is_active = ?", unit.ProductID, true).
+			Preload("Product").Preload("IPAsset").Preload("License").
+			First(&authChain).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, errors.New("authorization chain verification failed")
+			}
+			return nil, nil, fmt.Errorf("database error: %w", err)
 		}
-		return nil, fmt.Errorf("database error: %w", err)
 	}
 
 	// Verify the chain is still valid
 	if valid, err := s.VerifyChain(authChain.ID); err != nil || !valid {
-		return nil, errors.New("authorization chain verification failed")
+		return nil, nil, errors.New("authorization chain verification failed")
+	}
+
+	return &authChain, unit, nil
+}
+
+// recordUnitScan counts a scan of a unit. A sold unit becomes scanned on its
+// first scan; PreviouslyScanned reports whether anyone had scanned it before,
+// and Unsold whether it has been sold at all.
+func (s *AuthorizationService) recordUnitScan(unitID uuid.UUID) (*UnitScan, error) {
+	var scan *UnitScan
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var unit models.ProductUnit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&unit, unitID).Error; err != nil {
+			return fmt.Errorf("failed to load product unit: %w", err)
+		}
+
+		previouslyScanned := unit.ScanCount > 0
+		now := time.Now()
+
+		updates := map[string]interface{}{
+			"scan_count":      gorm.Expr("scan_count + 1"),
+			"last_scanned_at": now,
+		}
+		if unit.FirstScannedAt == nil {
+			updates["first_scanned_at"] = now
+		}
+		if unit.Status == models.UnitStatusSold {
+			updates["status"] = models.UnitStatusScanned
+		}
+
+		if err := tx.Model(&unit).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to record unit scan: %w", err)
+		}
+
+		if err := tx.First(&unit, unitID).Error; err != nil {
+			return fmt.Errorf("failed to load product unit: %w", err)
+		}
+
+		scan = &UnitScan{
+			Unit:              unit,
+			PreviouslyScanned: previouslyScanned,
+			Unsold:            unit.Status == models.UnitStatusUnclaimed,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return scan, nil
+}
+
+// SyncProductUnits keeps one unclaimed unit per item of inventory. Missing
+// units get the next serial numbers; surplus unclaimed units, highest serial
+// first, are removed. Sold and scanned units are never touched.
+func (s *AuthorizationService) SyncProductUnits(productID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("product not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		var unclaimed int64
+		if err := tx.Model(&models.ProductUnit{}).
+			Where("product_id = ? AND status = ?", productID, models.UnitStatusUnclaimed).
+			Count(&unclaimed).Error; err != nil {
+			return fmt.Errorf("failed to count product units: %w", err)
+		}
+
+		missing := int64(product.InventoryCount) - unclaimed
+		if missing < 0 {
+			var surplus []uuid.UUID
+			if err := tx.Model(&models.ProductUnit{}).
+				Where("product_id = ? AND status = ?", productID, models.UnitStatusUnclaimed).
+				Order("serial_number DESC").Limit(int(-missing)).
+				Pluck("id", &surplus).Error; err != nil {
+				return fmt.Errorf("failed to find surplus product units: %w", err)
+			}
+			if err := tx.Where("id IN ?", surplus).Delete(&models.ProductUnit{}).Error; err != nil {
+				return fmt.Errorf("failed to remove surplus product units: %w", err)
+			}
+			return nil
+		}
+		if missing == 0 {
+			return nil
+		}
+
+		// Serials are never reused, including those of removed units
+		var lastSerial int
+		if err := tx.Unscoped().Model(&models.ProductUnit{}).Where("product_id = ?", productID).
+			Select("COALESCE(MAX(serial_number), 0)").Scan(&lastSerial).Error; err != nil {
+			return fmt.Errorf("failed to read product unit serials: %w", err)
+		}
+
+		units := make([]models.ProductUnit, 0, missing)
+		for i := int64(1); i <= missing; i++ {
+			verificationCode, err := utils.GenerateVerificationCode()
+			if err != nil {
+				return fmt.Errorf("failed to generate verification code: %w", err)
+			}
+
+			units = append(units, models.ProductUnit{
+				ProductID:        productID,
+				SerialNumber:     lastSerial + int(i),
+				VerificationCode: verificationCode,
+				Status:           models.UnitStatusUnclaimed,
+			})
+		}
+
+		if err := tx.CreateInBatches(units, 500).Error; err != nil {
+			return fmt.Errorf("failed to create product units: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ClaimProductUnits marks the lowest unclaimed serials of a product as sold
+// to a transaction. It runs inside the purchase transaction.
+func (s *AuthorizationService) ClaimProductUnits(tx *gorm.DB, productID, transactionID uuid.UUID, quantity int) ([]models.ProductUnit, error) {
+	return claimProductUnits(tx, productID, transactionID, quantity)
+}
+
+// GetProductUnits lists the units of a product owned by creatorID
+func (s *AuthorizationService) GetProductUnits(productID, creatorID uuid.UUID, status string, params utils.PaginationParams) ([]models.ProductUnit, int64, error) {
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, 0, errors.New("product not found")
+		}
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+
+	if product.CreatorID != creatorID {
+		return nil, 0, errors.New("unauthorized to view units of this product")
+	}
+
+	query := s.db.Model(&models.ProductUnit{}).Where("product_id = ?", productID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count product units: %w", err)
+	}
+
+	var units []models.ProductUnit
+	if err := utils.ApplyPagination(query.Order("serial_number ASC"), params).Find(&units).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch product units: %w", err)
+	}
+
+	return units, total, nil
+}
+
+// IssueCertificate verifies the product behind a verification code and signs
+// a certificate for it
+func (s *AuthorizationService) IssueCertificate(verificationCode string) (string, *ProductCertificateClaims, error) {
+	authChain, err := s.VerifyProductByCode(verificationCode)
+	if err != nil {
+		return "", nil, err
 	}
 
-	return &authChain, nil
+	return s.SignCertificate(authChain)
 }
 
-func (s *AuthorizationService) RevokeAuthChain(authChainID uuid.UUID, reason string) error {
+// SignCertificate signs a certificate for an authorization chain node
+func (s *AuthorizationService) SignCertificate(authChain *models.AuthorizationChain) (string, *ProductCertificateClaims, error) {
+	ttlDays := 365
+	if s.config != nil && s.config.Certificate.TTLDays > 0 {
+		ttlDays = s.config.Certificate.TTLDays
+	}
+
+	now := time.Now()
+	claims := &ProductCertificateClaims{
+		ProductID:        authChain.ProductID.String(),
+		IPAssetID:        authChain.IPAssetID.String(),
+		LicenseID:        authChain.LicenseID.String(),
+		VerificationCode: authChain.VerificationCode,
+		ChainHash:        authChain.BlockchainHash,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        authChain.ID.String(),
+			Issuer:    "ip-marketplace",
+			Subject:   authChain.ProductID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.AddDate(0, 0, ttlDays)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = s.signingJWK.Kid
+
+	certificate, err := token.SignedString(s.signingKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	return certificate, claims, nil
+}
+
+// VerifyCertificate checks a certificate's signature and validity period
+func (s *AuthorizationService) VerifyCertificate(certificate string) (*ProductCertificateClaims, error) {
+	token, err := jwt.ParseWithClaims(certificate, &ProductCertificateClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		if kid, _ := token.Header["kid"].(string); kid != s.signingJWK.Kid {
+			return nil, errors.New("unknown signing key")
+		}
+		return s.signingKey.Public(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	claims, ok := token.Claims.(*ProductCertificateClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid certificate")
+	}
+
+	return claims, nil
+}
+
+// GetJWKS returns the public keys that product certificates are signed with
+func (s *AuthorizationService) GetJWKS() utils.JWKS {
+	return utils.JWKS{Keys: []utils.JWK{s.signingJWK}}
+}
+
+// GetProvenanceProof returns the ledger inclusion proof for a chain's record
+func (s *AuthorizationService) GetProvenanceProof(authChain *models.AuthorizationChain) (*InclusionProof, error) {
+	if s.blockchainService == nil || authChain.BlockchainHash == "" {
+		return nil, errors.New("no provenance record for authorization chain")
+	}
+
+	return s.blockchainService.GetInclusionProof(authChain.BlockchainHash)
+}
+
+// RevokeAuthChain revokes a chain node and every node that depends on it
+func (s *AuthorizationService) RevokeAuthChain(authChainID, revokerID uuid.UUID, reason string) ([]models.AuthorizationChain, error) {
 	var authChain models.AuthorizationChain
 	if err := s.db.First(&authChain, authChainID).Error; err != nil {
-		return fmt.Errorf("authorization chain not found: %w", err)
+		return nil, fmt.Errorf("authorization chain not found: %w", err)
+	}
+
+	var revoked []models.AuthorizationChain
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = s.revokeChains(tx, []uuid.UUID{authChain.ID}, revokerID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.NotifyRevokedChains(revoked, reason)
+
+	return revoked, nil
+}
+
+// RevokeLicenseChains revokes every chain node issued under a license in tx,
+// so the license and its chains change together. This covers products built
+// directly on the license as well as products of derivative IP assets that
+// were registered under it. Callers pass the result to NotifyRevokedChains
+// once tx has committed.
+func (s *AuthorizationService) RevokeLicenseChains(tx *gorm.DB, licenseID, revokerID uuid.UUID, reason string) ([]models.AuthorizationChain, error) {
+	var chainIDs []uuid.UUID
+	if err := tx.Model(&models.AuthorizationChain{}).
+		Where("license_id = ? AND is_active = ?", licenseID, true).
+		Pluck("id", &chainIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch authorization chains: %w", err)
+	}
+
+	if len(chainIDs) == 0 {
+		return nil, nil
 	}
 
-	// Deactivate the chain
-	authChain.IsActive = false
+	return s.revokeChains(tx, chainIDs, revokerID, reason)
+}
 
-	if err := s.db.Save(&authChain).Error; err != nil {
-		return fmt.Errorf("failed to revoke authorization chain: %w", err)
+// RestoreLicenseChains reactivates, in tx, the chain nodes of a license that
+// were revoked for reason, such as when an expired license is renewed, with
+// the nodes below them that were revoked for the same reason. A node stays
+// revoked while its own license is not active or its parent node is
+// revoked. Products whose chains are all active again are relisted.
+func (s *AuthorizationService) RestoreLicenseChains(tx *gorm.DB, licenseID uuid.UUID, reason string) ([]models.AuthorizationChain, error) {
+	activeLicenses := tx.Model(&models.LicenseApplication{}).Select("id").
+		Where("status = ? AND is_active = ?", models.ApplicationStatusApproved, true)
+	activeChains := tx.Model(&models.AuthorizationChain{}).Select("id").Where("is_active = ?", true)
+	restorable := func() *gorm.DB {
+		return tx.Where("is_active = ? AND revocation_reason = ? AND license_id IN (?)", false, reason, activeLicenses).
+			Where("parent_chain_id IS NULL OR parent_chain_id IN (?)", activeChains)
 	}
 
-	return nil
+	// Walk the tree down one level at a time
+	var restored []models.AuthorizationChain
+	var level []models.AuthorizationChain
+	if err := restorable().Where("license_id = ?", licenseID).Find(&level).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch authorization chains: %w", err)
+	}
+	for len(level) > 0 {
+		ids := make([]uuid.UUID, len(level))
+		for i := range level {
+			ids[i] = level[i].ID
+			level[i].IsActive = true
+			level[i].RevokedAt = nil
+			level[i].RevokedBy = nil
+			level[i].RevocationReason = ""
+		}
+		restored = append(restored, level...)
+
+		if err := tx.Model(&models.AuthorizationChain{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"is_active":         true,
+				"revoked_at":        nil,
+				"revoked_by":        nil,
+				"revocation_reason": "",
+			}).Error; err != nil {
+			return nil, fmt.Errorf("failed to restore authorization chains: %w", err)
+		}
+
+		level = nil
+		if err := restorable().Where("parent_chain_id IN ?", ids).Find(&level).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch child chains: %w", err)
+		}
+	}
+
+	if len(restored) == 0 {
+		return nil, nil
+	}
+
+	seenProducts := make(map[uuid.UUID]bool)
+	var productIDs []uuid.UUID
+	for i := range restored {
+		if !seenProducts[restored[i].ProductID] {
+			seenProducts[restored[i].ProductID] = true
+			productIDs = append(productIDs, restored[i].ProductID)
+		}
+	}
+
+	// Products are listed again once none of their chain is revoked
+	revokedProducts := tx.Model(&models.AuthorizationChain{}).Select("product_id").Where("is_active = ?", false)
+	if err := tx.Model(&models.Product{}).
+		Where("id IN ? AND status = ? AND id NOT IN (?)", productIDs, models.ProductStatusSuspended, revokedProducts).
+		Update("status", models.ProductStatusActive).Error; err != nil {
+		return nil, fmt.Errorf("failed to relist products: %w", err)
+	}
+	for _, productID := range productIDs {
+		if err := syncProductAvailability(tx, productID); err != nil {
+			return nil, err
+		}
+	}
+
+	return restored, nil
+}
+
+// revokeChains deactivates the given nodes and all of their descendants,
+// recording reason and actor on each, and suspends the affected products.
+func (s *AuthorizationService) revokeChains(tx *gorm.DB, chainIDs []uuid.UUID, revokerID uuid.UUID, reason string) ([]models.AuthorizationChain, error) {
+	// Walk the tree down one level at a time
+	seen := make(map[uuid.UUID]bool)
+	var subtree []uuid.UUID
+	for level := chainIDs; len(level) > 0; {
+		for _, id := range level {
+			seen[id] = true
+			subtree = append(subtree, id)
+		}
+
+		var children []uuid.UUID
+		if err := tx.Model(&models.AuthorizationChain{}).
+			Where("parent_chain_id IN ? AND is_active = ?", level, true).
+			Pluck("id", &children).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch child chains: %w", err)
+		}
+
+		var next []uuid.UUID
+		for _, id := range children {
+			if !seen[id] {
+				next = append(next, id)
+			}
+		}
+		level = next
+	}
+
+	var revoked []models.AuthorizationChain
+	if err := tx.Where("id IN ? AND is_active = ?", subtree, true).
+		Find(&revoked).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch authorization chains: %w", err)
+	}
+
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.AuthorizationChain{}).
+		Where("id IN ? AND is_active = ?", subtree, true).
+		Updates(map[string]interface{}{
+			"is_active":         false,
+			"revoked_at":        now,
+			"revoked_by":        revokerID,
+			"revocation_reason": reason,
+		}).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke authorization chains: %w", err)
+	}
+
+	var productIDs []uuid.UUID
+	seenProducts := make(map[uuid.UUID]bool)
+	for i := range revoked {
+		revoked[i].IsActive = false
+		revoked[i].RevokedAt = &now
+		revoked[i].RevokedBy = &revokerID
+		revoked[i].RevocationReason = reason
+
+		if !seenProducts[revoked[i].ProductID] {
+			seenProducts[revoked[i].ProductID] = true
+			productIDs = append(productIDs, revoked[i].ProductID)
+		}
+	}
+
+	// Products without a valid chain can no longer be listed or sold
+	if err := tx.Model(&models.Product{}).
+		Where("id IN ? AND status IN ?", productIDs, []models.ProductStatus{
+			models.ProductStatusDraft, models.ProductStatusActive, models.ProductStatusSoldOut,
+		}).
+		Update("status", models.ProductStatusSuspended).Error; err != nil {
+		return nil, fmt.Errorf("failed to suspend products: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// NotifyRevokedChains tells the creators of the products whose chains were
+// revoked that their products are suspended
+func (s *AuthorizationService) NotifyRevokedChains(revoked []models.AuthorizationChain, reason string) {
+	var productIDs []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, chain := range revoked {
+		if !seen[chain.ProductID] {
+			seen[chain.ProductID] = true
+			productIDs = append(productIDs, chain.ProductID)
+		}
+	}
+
+	s.sendRevocationNotifications(productIDs, reason)
 }
 
 func (s *AuthorizationService) GetAuthChainHistory(productID uuid.UUID) ([]models.AuthorizationChain, error) {
@@ -116,3 +847,25 @@ func (s *AuthorizationService) GetAuthChainHistory(productID uuid.UUID) ([]model
 
 	return chains, nil
 }
+
+func (s *AuthorizationService) sendRevocationNotifications(productIDs []uuid.UUID, reason string) {
+	if s.notificationService == nil || len(productIDs) == 0 {
+		return
+	}
+
+	var products []models.Product
+	if err := s.db.Preload("Creator").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return
+	}
+
+	for i := range products {
+		s.notificationService.SendAuthorizationRevokedNotification(&products[i], reason)
+	}
+}
+
+func (s *AuthorizationService) maxChainDepth() int {
+	if s.config == nil || s.config.License.MaxChainDepth <= 0 {
+		return 3
+	}
+	return s.config.License.MaxChainDepth
+}
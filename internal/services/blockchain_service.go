@@ -2,21 +2,69 @@
 package services
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/javajoker/imi-backend/internal/config"
 	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
 )
 
+// ledgerLockKey serializes ledger appends across processes via pg_advisory_xact_lock
+const ledgerLockKey = 7_340_215_001
+
+// batchLockKey lets only one instance build anchor batches at a time
+const batchLockKey = 7_340_215_002
+
+const ledgerVerifyBatchSize = 500
+
+const anchorTimeout = 30 * time.Second
+
+// anchorRetryLimit caps how many unanchored batches one batcher run retries
+const anchorRetryLimit = 50
+
 type BlockchainService struct {
-	db     *gorm.DB
-	config *config.Config
+	db      *gorm.DB
+	config  *config.Config
+	backend LedgerBackend
+}
+
+// ledgerHashAlgorithm describes one models.LedgerHashVN version
+type ledgerHashAlgorithm struct {
+	Digest       string
+	Encoding     string
+	canonicalize func(data map[string]interface{}) (string, error)
+}
+
+var ledgerHashAlgorithms = map[int]ledgerHashAlgorithm{
+	models.LedgerHashV1: {
+		Digest:   "sha256(previous_hash || payload)",
+		Encoding: "json-sorted-keys",
+		canonicalize: func(data map[string]interface{}) (string, error) {
+			// encoding/json sorts map keys, but escapes HTML characters and
+			// formats numbers its own way, which is why v2 replaced it
+			payload, err := json.Marshal(data)
+			return string(payload), err
+		},
+	},
+	models.LedgerHashV2: {
+		Digest:   "sha256(previous_hash || payload)",
+		Encoding: "rfc8785-jcs",
+		canonicalize: func(data map[string]interface{}) (string, error) {
+			payload, err := utils.CanonicalJSON(data)
+			return string(payload), err
+		},
+	},
 }
 
 type BlockchainRecord struct {
@@ -26,10 +74,60 @@ type BlockchainRecord struct {
 	PreviousHash string                 `json:"previous_hash"`
 }
 
+// InclusionProof carries everything a third party needs to check a ledger
+// record offline: recompute entry_hash from previous_hash and payload, fold
+// the Merkle proof into merkle_root, then look the root up on the anchor.
+type InclusionProof struct {
+	Status        string                  `json:"status"` // pending, batched or anchored
+	HashVersion   int                     `json:"hash_version"`
+	HashAlgorithm string                  `json:"hash_algorithm"`
+	HashEncoding  string                  `json:"hash_encoding"`
+	EntryHash     string                  `json:"entry_hash"`
+	PreviousHash  string                  `json:"previous_hash"`
+	Payload       string                  `json:"payload"`
+	Algorithm     string                  `json:"merkle_algorithm,omitempty"`
+	MerkleRoot    string                  `json:"merkle_root,omitempty"`
+	LeafIndex     int                     `json:"leaf_index"`
+	Proof         []utils.MerkleProofStep `json:"proof,omitempty"`
+	Anchor        *models.LedgerAnchor    `json:"anchor,omitempty"`
+}
+
+// LedgerPreimage is the exact byte string that was hashed into a ledger entry
+type LedgerPreimage struct {
+	Hash          string `json:"hash"`
+	HashVersion   int    `json:"hash_version"`
+	HashAlgorithm string `json:"hash_algorithm"`
+	HashEncoding  string `json:"hash_encoding"`
+	PreviousHash  string `json:"previous_hash"`
+	Payload       string `json:"payload"`
+	Preimage      string `json:"preimage"` // UTF-8, previous_hash followed by payload
+}
+
+type LedgerVerificationResult struct {
+	Valid           bool       `json:"valid"`
+	EntriesChecked  int64      `json:"entries_checked"`
+	HeadHash        string     `json:"head_hash,omitempty"`
+	FirstInvalidID  *uuid.UUID `json:"first_invalid_id,omitempty"`
+	FirstInvalidSeq *int64     `json:"first_invalid_sequence,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+	VerifiedAt      time.Time  `json:"verified_at"`
+}
+
 func NewBlockchainService(db *gorm.DB, config *config.Config) *BlockchainService {
+	backend, err := NewLedgerBackend(db, config)
+	if err != nil {
+		log.Printf("Warning: %v, falling back to local ledger backend", err)
+		backend = NewDatabaseLedgerBackend(db)
+	}
+
+	return NewBlockchainServiceWithBackend(db, config, backend)
+}
+
+func NewBlockchainServiceWithBackend(db *gorm.DB, config *config.Config, backend LedgerBackend) *BlockchainService {
 	return &BlockchainService{
-		db:     db,
-		config: config,
+		db:      db,
+		config:  config,
+		backend: backend,
 	}
 }
 
@@ -42,87 +140,635 @@ func (s *BlockchainService) CreateIPRecord(ipAssetID, creatorID uuid.UUID) (stri
 
 	// Create blockchain record data
 	recordData := map[string]interface{}{
-		"type":       "ip_creation",
+		"type":       models.LedgerRecordIPCreation,
 		"ip_id":      ipAssetID.String(),
 		"creator_id": creatorID.String(),
 		"title":      ipAsset.Title,
 		"category":   ipAsset.Category,
 		"timestamp":  time.Now().Unix(),
 	}
+	if ipAsset.ParentLicenseID != nil {
+		recordData["parent_license_id"] = ipAsset.ParentLicenseID.String()
+	}
 
-	// Generate hash
-	hash := s.generateHash(recordData)
-
-	// TODO: In a real implementation, this would interact with actual blockchain
-	// For now, we'll simulate by storing in database
-	fmt.Printf("Blockchain record created for IP %s: %s\n", ipAssetID, hash)
+	record, err := s.appendRecord(s.db, models.LedgerRecordIPCreation, "ip_asset", ipAssetID, recordData)
+	if err != nil {
+		return "", err
+	}
 
-	return hash, nil
+	return record.Hash, nil
 }
 
-func (s *BlockchainService) CreateLicenseRecord(licenseID, ipAssetID, applicantID uuid.UUID) (string, error) {
+// CreateLicenseRecord records the grant of a license in tx, so the grant and
+// its ledger entry commit together
+func (s *BlockchainService) CreateLicenseRecord(tx *gorm.DB, licenseID, ipAssetID, applicantID uuid.UUID) (string, error) {
 	recordData := map[string]interface{}{
-		"type":         "license_grant",
+		"type":         models.LedgerRecordLicenseGrant,
 		"license_id":   licenseID.String(),
 		"ip_id":        ipAssetID.String(),
 		"applicant_id": applicantID.String(),
 		"timestamp":    time.Now().Unix(),
 	}
 
-	hash := s.generateHash(recordData)
-	fmt.Printf("Blockchain record created for license %s: %s\n", licenseID, hash)
+	record, err := s.appendRecord(tx, models.LedgerRecordLicenseGrant, "license_application", licenseID, recordData)
+	if err != nil {
+		return "", err
+	}
 
-	return hash, nil
+	return record.Hash, nil
 }
 
-func (s *BlockchainService) CreateProductRecord(productID, licenseID uuid.UUID) (string, error) {
+// CreateAgreementRecord records the signature of a license agreement with the
+// hashes of the agreement accepted and of the signed document
+func (s *BlockchainService) CreateAgreementRecord(tx *gorm.DB, agreement *models.LicenseAgreement) (string, error) {
 	recordData := map[string]interface{}{
-		"type":       "product_creation",
+		"type":                 models.LedgerRecordLicenseAgreement,
+		"agreement_id":         agreement.ID.String(),
+		"license_id":           agreement.LicenseApplicationID.String(),
+		"signer_id":            agreement.SignerID.String(),
+		"document_hash":        agreement.DocumentHash,
+		"signed_document_hash": agreement.SignedDocumentHash,
+		"signed_at":            agreement.SignedAt.Unix(),
+		"timestamp":            time.Now().Unix(),
+	}
+
+	record, err := s.appendRecord(tx, models.LedgerRecordLicenseAgreement, "license_agreement", agreement.ID, recordData)
+	if err != nil {
+		return "", err
+	}
+
+	return record.Hash, nil
+}
+
+// CreateProductRecord records one level of a product's authorization chain in
+// tx. parentHash links derivative levels to the record of the level above.
+func (s *BlockchainService) CreateProductRecord(tx *gorm.DB, productID, licenseID uuid.UUID, parentHash string) (string, error) {
+	recordData := map[string]interface{}{
+		"type":       models.LedgerRecordProductCreation,
 		"product_id": productID.String(),
 		"license_id": licenseID.String(),
 		"timestamp":  time.Now().Unix(),
 	}
+	if parentHash != "" {
+		recordData["parent_hash"] = parentHash
+	}
 
-	hash := s.generateHash(recordData)
-	fmt.Printf("Blockchain record created for product %s: %s\n", productID, hash)
+	record, err := s.appendRecord(tx, models.LedgerRecordProductCreation, "product", productID, recordData)
+	if err != nil {
+		return "", err
+	}
 
-	return hash, nil
+	return record.Hash, nil
 }
 
+// VerifyChain verifies a chain node and, recursively, every ancestor node up
+// to the original IP asset.
 func (s *BlockchainService) VerifyChain(authChainID uuid.UUID) (bool, error) {
+	return s.verifyChainNode(authChainID, 0)
+}
+
+func (s *BlockchainService) verifyChainNode(authChainID uuid.UUID, level int) (bool, error) {
+	if maxDepth := s.config.License.MaxChainDepth; maxDepth > 0 && level >= maxDepth {
+		return false, fmt.Errorf("authorization chain exceeds the maximum depth of %d", maxDepth)
+	}
+
 	// Get authorization chain
 	var authChain models.AuthorizationChain
-	if err := s.db.Preload("IPAsset").Preload("License").Preload("Product").
+	if err := s.db.Preload("IPAsset").Preload("License").Preload("Product").Preload("ParentChain").
 		First(&authChain, authChainID).Error; err != nil {
 		return false, fmt.Errorf("authorization chain not found: %w", err)
 	}
 
-	// TODO: In a real implementation, this would verify the blockchain records
-	// For now, we'll do basic validation
 	if authChain.BlockchainHash == "" {
 		return false, fmt.Errorf("no blockchain hash found")
 	}
 
+	// Verify the product record exists in the ledger and has not been altered
+	if _, err := s.GetRecord(authChain.BlockchainHash); err != nil {
+		return false, err
+	}
+
+	if err := CheckChainNode(&authChain); err != nil {
+		return false, err
+	}
+
+	if authChain.ParentChainID != nil {
+		return s.verifyChainNode(*authChain.ParentChainID, level+1)
+	}
+
+	return true, nil
+}
+
+// CheckChainNode checks that one node of an authorization chain still
+// authorizes its product: the node is active, its IP asset approved, its
+// license approved and active, and a derivative IP asset's node hangs off the
+// license it was derived under. IPAsset, License and ParentChain must be
+// loaded.
+func CheckChainNode(authChain *models.AuthorizationChain) error {
 	if !authChain.IsActive {
-		return false, fmt.Errorf("authorization chain is not active")
+		return fmt.Errorf("authorization chain is not active")
 	}
 
 	// Verify IP asset is approved
 	if authChain.IPAsset.VerificationStatus != models.VerificationStatusApproved {
-		return false, fmt.Errorf("IP asset is not approved")
+		return fmt.Errorf("IP asset is not approved")
 	}
 
 	// Verify license is active
 	if authChain.License.Status != models.ApplicationStatusApproved {
-		return false, fmt.Errorf("license is not approved")
+		return fmt.Errorf("license is not approved")
 	}
 
-	return true, nil
+	if !authChain.License.IsActive {
+		return fmt.Errorf("license is not active")
+	}
+
+	// A derivative IP asset is only authorized through the license it was derived under
+	if parentLicenseID := authChain.IPAsset.ParentLicenseID; parentLicenseID != nil {
+		if authChain.ParentChain == nil || authChain.ParentChain.LicenseID != *parentLicenseID {
+			return fmt.Errorf("derivative IP asset is missing its parent authorization")
+		}
+	}
+
+	return nil
+}
+
+// GetRecord looks up a ledger entry by hash and checks that its stored payload
+// still produces that hash.
+func (s *BlockchainService) GetRecord(hash string) (*BlockchainRecord, error) {
+	var entry models.LedgerEntry
+	if err := s.db.Where("hash = ?", hash).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("ledger record not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := s.checkEntry(&entry); err != nil {
+		return nil, fmt.Errorf("ledger record has been tampered with: %w", err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Payload), &data); err != nil {
+		return nil, fmt.Errorf("failed to decode ledger payload: %w", err)
+	}
+
+	return &BlockchainRecord{
+		Hash:         entry.Hash,
+		Timestamp:    entry.CreatedAt,
+		Data:         data,
+		PreviousHash: entry.PreviousHash,
+	}, nil
+}
+
+// VerifyLedger re-walks the whole ledger in sequence order, recomputing every
+// hash and link, and reports the first entry that does not check out.
+func (s *BlockchainService) VerifyLedger() (*LedgerVerificationResult, error) {
+	result := &LedgerVerificationResult{Valid: true}
+	expectedPrevious := models.LedgerGenesisHash
+	expectedSequence := int64(1)
+
+	fail := func(entry *models.LedgerEntry, reason string) (*LedgerVerificationResult, error) {
+		result.Valid = false
+		result.FirstInvalidID = &entry.ID
+		result.FirstInvalidSeq = &entry.Sequence
+		result.Reason = reason
+		result.VerifiedAt = time.Now()
+		return result, nil
+	}
+
+	for {
+		var entries []models.LedgerEntry
+		if err := s.db.Where("sequence >= ?", expectedSequence).
+			Order("sequence ASC").
+			Limit(ledgerVerifyBatchSize).
+			Find(&entries).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch ledger entries: %w", err)
+		}
+
+		for i := range entries {
+			entry := &entries[i]
+			result.EntriesChecked++
+
+			if entry.Sequence != expectedSequence {
+				return fail(entry, fmt.Sprintf("sequence gap: expected %d, found %d", expectedSequence, entry.Sequence))
+			}
+			if entry.PreviousHash != expectedPrevious {
+				return fail(entry, "previous hash does not match the preceding entry")
+			}
+			if err := s.checkEntry(entry); err != nil {
+				return fail(entry, err.Error())
+			}
+
+			expectedPrevious = entry.Hash
+			expectedSequence++
+		}
+
+		if len(entries) < ledgerVerifyBatchSize {
+			break
+		}
+	}
+
+	if result.EntriesChecked > 0 {
+		result.HeadHash = expectedPrevious
+	}
+	result.VerifiedAt = time.Now()
+
+	return result, nil
+}
+
+func (s *BlockchainService) GetLedgerEntries(resourceID *uuid.UUID, params utils.PaginationParams) ([]models.LedgerEntry, int64, error) {
+	query := s.db.Model(&models.LedgerEntry{})
+	if resourceID != nil {
+		query = query.Where("resource_id = ?", *resourceID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count ledger entries: %w", err)
+	}
+
+	// Apply pagination, newest entries first
+	query = utils.ApplyPagination(query.Order("sequence DESC"), params)
+
+	var entries []models.LedgerEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch ledger entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// StartAnchorBatcher periodically anchors pending ledger records, and retries
+// batches whose anchoring failed, until ctx is done
+func (s *BlockchainService) StartAnchorBatcher(ctx context.Context) {
+	interval := time.Duration(s.config.Blockchain.AnchorInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.AnchorPendingRecords(); err != nil {
+				log.Printf("Ledger anchor batch failed: %v", err)
+			}
+			if _, err := s.RetryUnanchoredBatches(); err != nil {
+				log.Printf("Ledger anchor retry failed: %v", err)
+			}
+		}
+	}
+}
+
+// AnchorPendingRecords builds a Merkle tree over ledger entries that are not
+// yet in a batch, stores one inclusion proof per entry and anchors the root.
+func (s *BlockchainService) AnchorPendingRecords() (*models.LedgerBatch, error) {
+	batchSize := s.config.Blockchain.AnchorBatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var batch *models.LedgerBatch
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", batchLockKey).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to lock anchor batcher: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		var entries []models.LedgerEntry
+		if err := tx.Where("hash NOT IN (?)", tx.Model(&models.LedgerProof{}).Select("entry_hash")).
+			Order("sequence ASC").
+			Limit(batchSize).
+			Find(&entries).Error; err != nil {
+			return fmt.Errorf("failed to fetch pending ledger entries: %w", err)
+		}
+
+		if len(entries) == 0 {
+			return nil
+		}
+
+		leaves := make([]string, len(entries))
+		for i, entry := range entries {
+			leaves[i] = entry.Hash
+		}
+
+		root, proofs, err := utils.BuildMerkleTree(leaves)
+		if err != nil {
+			return fmt.Errorf("failed to build merkle tree: %w", err)
+		}
+
+		batch = &models.LedgerBatch{
+			MerkleRoot:    root,
+			Algorithm:     utils.MerkleAlgorithm,
+			LeafCount:     len(entries),
+			FirstSequence: entries[0].Sequence,
+			LastSequence:  entries[len(entries)-1].Sequence,
+		}
+		if err := tx.Create(batch).Error; err != nil {
+			return fmt.Errorf("failed to create ledger batch: %w", err)
+		}
+
+		ledgerProofs := make([]models.LedgerProof, len(entries))
+		for i, entry := range entries {
+			ledgerProofs[i] = models.LedgerProof{
+				EntryHash: entry.Hash,
+				BatchID:   batch.ID,
+				LeafIndex: i,
+				Proof:     models.MerkleProof(proofs[i]),
+			}
+		}
+		if err := tx.CreateInBatches(ledgerProofs, 500).Error; err != nil {
+			return fmt.Errorf("failed to store inclusion proofs: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil || batch == nil {
+		return nil, err
+	}
+
+	if err := s.anchorRecord(batch.MerkleRoot); err != nil {
+		log.Printf("Failed to anchor ledger batch %s: %v", batch.ID, err)
+	}
+
+	return batch, nil
+}
+
+// RetryUnanchoredBatches anchors batches that have no anchor, because the
+// process stopped before it was stored, or whose anchoring failed. It
+// returns the number of batches anchored.
+func (s *BlockchainService) RetryUnanchoredBatches() (int, error) {
+	if s.backend == nil {
+		return 0, nil
+	}
+
+	// Leave batches just built to the run that built them
+	var roots []string
+	if err := s.db.Model(&models.LedgerBatch{}).
+		Joins("LEFT JOIN ledger_anchors ON ledger_anchors.hash = ledger_batches.merkle_root AND ledger_anchors.deleted_at IS NULL").
+		Where("ledger_anchors.id IS NULL OR ledger_anchors.status = ?", models.AnchorStatusFailed).
+		Where("ledger_batches.created_at < ?", time.Now().Add(-anchorTimeout)).
+		Order("ledger_batches.first_sequence ASC").
+		Limit(anchorRetryLimit).
+		Pluck("ledger_batches.merkle_root", &roots).Error; err != nil {
+		return 0, fmt.Errorf("failed to find unanchored batches: %w", err)
+	}
+
+	anchored := 0
+	for _, root := range roots {
+		if err := s.anchorRecord(root); err != nil {
+			log.Printf("Failed to anchor ledger batch %s: %v", root, err)
+			continue
+		}
+		anchored++
+	}
+
+	return anchored, nil
+}
+
+// GetPreimage returns the exact input that was hashed to produce a ledger
+// hash, so that it can be reproduced independently of this service.
+func (s *BlockchainService) GetPreimage(hash string) (*LedgerPreimage, error) {
+	var entry models.LedgerEntry
+	if err := s.db.Where("hash = ?", hash).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("ledger record not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	algorithm, ok := ledgerHashAlgorithms[entry.HashVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash version %d", entry.HashVersion)
+	}
+
+	return &LedgerPreimage{
+		Hash:          entry.Hash,
+		HashVersion:   entry.HashVersion,
+		HashAlgorithm: algorithm.Digest,
+		HashEncoding:  algorithm.Encoding,
+		PreviousHash:  entry.PreviousHash,
+		Payload:       entry.Payload,
+		Preimage:      entry.PreviousHash + entry.Payload,
+	}, nil
+}
+
+// GetInclusionProof returns the ledger record behind hash together with its
+// Merkle inclusion proof and anchor, when the record has been batched.
+func (s *BlockchainService) GetInclusionProof(hash string) (*InclusionProof, error) {
+	var entry models.LedgerEntry
+	if err := s.db.Where("hash = ?", hash).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("ledger record not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	algorithm := ledgerHashAlgorithms[entry.HashVersion]
+	inclusion := &InclusionProof{
+		Status:        "pending",
+		HashVersion:   entry.HashVersion,
+		HashAlgorithm: algorithm.Digest,
+		HashEncoding:  algorithm.Encoding,
+		EntryHash:     entry.Hash,
+		PreviousHash:  entry.PreviousHash,
+		Payload:       entry.Payload,
+	}
+
+	var proof models.LedgerProof
+	if err := s.db.Preload("Batch").Where("entry_hash = ?", hash).First(&proof).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return inclusion, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	inclusion.Status = "batched"
+	inclusion.Algorithm = proof.Batch.Algorithm
+	inclusion.MerkleRoot = proof.Batch.MerkleRoot
+	inclusion.LeafIndex = proof.LeafIndex
+	inclusion.Proof = proof.Proof
+
+	if anchor, err := s.GetAnchor(proof.Batch.MerkleRoot); err == nil {
+		inclusion.Anchor = anchor
+		if anchor.Status == models.AnchorStatusConfirmed {
+			inclusion.Status = "anchored"
+		}
+	}
+
+	return inclusion, nil
+}
+
+// GetAnchor returns where a ledger hash was anchored, refreshing submitted
+// anchors from the backend once they are confirmed.
+func (s *BlockchainService) GetAnchor(hash string) (*models.LedgerAnchor, error) {
+	var anchor models.LedgerAnchor
+	if err := s.db.Where("hash = ?", hash).First(&anchor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("anchor not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if anchor.Status != models.AnchorStatusSubmitted || anchor.Backend != s.backend.Name() {
+		return &anchor, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), anchorTimeout)
+	defer cancel()
+
+	receipt, err := s.backend.Lookup(ctx, hash)
+	if errors.Is(err, ErrNotAnchored) {
+		return &anchor, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up anchor: %w", err)
+	}
+
+	anchor.Status = receipt.Status
+	anchor.BlockNumber = receipt.BlockNumber
+	anchor.AnchoredAt = receipt.AnchoredAt
+	if err := s.db.Save(&anchor).Error; err != nil {
+		return nil, fmt.Errorf("failed to update anchor: %w", err)
+	}
+
+	return &anchor, nil
+}
+
+// anchorRecord submits a Merkle root to the configured backend and stores
+// the outcome on its anchor row, failures included, so the batcher can
+// retry it. A root the backend already holds, because an earlier attempt
+// went through after all, is recorded rather than submitted again.
+func (s *BlockchainService) anchorRecord(hash string) error {
+	if s.backend == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), anchorTimeout)
+	defer cancel()
+
+	anchor := &models.LedgerAnchor{
+		Hash:     hash,
+		Backend:  s.backend.Name(),
+		Attempts: 1,
+	}
+
+	receipt, err := s.backend.Lookup(ctx, hash)
+	if errors.Is(err, ErrNotAnchored) || (err == nil && receipt.Status == models.AnchorStatusFailed) {
+		receipt, err = s.backend.Anchor(ctx, hash)
+	}
+	if err != nil {
+		anchor.Status = models.AnchorStatusFailed
+		anchor.Error = err.Error()
+	} else {
+		anchor.Status = receipt.Status
+		anchor.Reference = receipt.Reference
+		anchor.BlockNumber = receipt.BlockNumber
+		anchor.AnchoredAt = receipt.AnchoredAt
+	}
+
+	// A retry updates the anchor row of the failed attempt
+	updates := clause.AssignmentColumns([]string{"backend", "reference", "block_number", "status", "error", "anchored_at", "updated_at"})
+	updates = append(updates, clause.Assignment{Column: clause.Column{Name: "attempts"}, Value: gorm.Expr("ledger_anchors.attempts + 1")})
+	if dbErr := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: updates,
+	}).Create(anchor).Error; dbErr != nil {
+		return fmt.Errorf("failed to store anchor: %w", dbErr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to anchor on %s: %w", s.backend.Name(), err)
+	}
+	return nil
+}
+
+// appendRecord links a new entry to the current head of the ledger. Appends are
+// serialized with a transaction-scoped advisory lock; the unique index on
+// previous_hash additionally rejects any fork. Given a transaction as db, the
+// entry commits with it.
+func (s *BlockchainService) appendRecord(db *gorm.DB, recordType, resourceType string, resourceID uuid.UUID, data map[string]interface{}) (*models.LedgerEntry, error) {
+	version := models.LedgerHashCurrent
+	payload, err := ledgerHashAlgorithms[version].canonicalize(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ledger payload: %w", err)
+	}
+
+	var entry *models.LedgerEntry
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", ledgerLockKey).Error; err != nil {
+			return fmt.Errorf("failed to lock ledger: %w", err)
+		}
+
+		previousHash := models.LedgerGenesisHash
+		sequence := int64(1)
+
+		var head models.LedgerEntry
+		if err := tx.Order("sequence DESC").First(&head).Error; err == nil {
+			previousHash = head.Hash
+			sequence = head.Sequence + 1
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to read ledger head: %w", err)
+		}
+
+		entry = &models.LedgerEntry{
+			Sequence:     sequence,
+			RecordType:   recordType,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Payload:      payload,
+			HashVersion:  version,
+			Hash:         s.computeEntryHash(previousHash, payload),
+			PreviousHash: previousHash,
+		}
+
+		if err := tx.Create(entry).Error; err != nil {
+			return fmt.Errorf("failed to append ledger entry: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// checkEntry recomputes an entry under the hash version it was written with:
+// the payload must be in that version's canonical form and hash to entry.Hash.
+func (s *BlockchainService) checkEntry(entry *models.LedgerEntry) error {
+	algorithm, ok := ledgerHashAlgorithms[entry.HashVersion]
+	if !ok {
+		return fmt.Errorf("unsupported hash version %d", entry.HashVersion)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Payload), &data); err != nil {
+		return errors.New("payload is not valid JSON")
+	}
+
+	if canonical, err := algorithm.canonicalize(data); err != nil || canonical != entry.Payload {
+		return errors.New("payload is not in canonical form")
+	}
+
+	if s.computeEntryHash(entry.PreviousHash, entry.Payload) != entry.Hash {
+		return errors.New("stored hash does not match payload")
+	}
+
+	return nil
 }
 
-func (s *BlockchainService) generateHash(data map[string]interface{}) string {
-	// Convert data to JSON string for consistent hashing
-	jsonStr := fmt.Sprintf("%+v", data)
-	hash := sha256.Sum256([]byte(jsonStr))
+// computeEntryHash returns hex(SHA-256(previous_hash || payload))
+func (s *BlockchainService) computeEntryHash(previousHash, payload string) string {
+	hash := sha256.Sum256([]byte(previousHash + payload))
 	return hex.EncodeToString(hash[:])
 }
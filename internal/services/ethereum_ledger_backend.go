@@ -0,0 +1,223 @@
+// internal/services/ethereum_ledger_backend.go
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// ProvenanceAnchorABI is the interface of the anchoring contract:
+//
+//	contract ProvenanceAnchor {
+//	    mapping(bytes32 => uint256) public anchoredBlock;
+//	    function anchor(bytes32 hash) external {
+//	        require(anchoredBlock[hash] == 0);
+//	        anchoredBlock[hash] = block.number;
+//	    }
+//	}
+const ProvenanceAnchorABI = `[
+	{"type":"function","name":"anchor","stateMutability":"nonpayable","inputs":[{"name":"hash","type":"bytes32"}],"outputs":[]},
+	{"type":"function","name":"anchoredBlock","stateMutability":"view","inputs":[{"name":"hash","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]}
+]`
+
+// EthereumClient is the subset of the JSON-RPC client used by the backend.
+// Both *ethclient.Client and the in-process simulated backend satisfy it.
+type EthereumClient interface {
+	ChainID(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// EthereumLedgerBackend anchors hashes on an EVM-compatible chain by calling
+// ProvenanceAnchor.anchor(bytes32) from the platform account.
+type EthereumLedgerBackend struct {
+	network  string
+	client   EthereumClient
+	key      *ecdsa.PrivateKey
+	from     common.Address
+	contract common.Address
+	abi      abi.ABI
+
+	// Serializes nonce allocation for the platform account
+	mu sync.Mutex
+}
+
+func DialEthereumLedgerBackend(network string, cfg config.BlockchainConfig) (*EthereumLedgerBackend, error) {
+	if cfg.PrivateKey == "" || cfg.ContractAddress == "" {
+		return nil, errors.New("private key and contract address are required")
+	}
+
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.PrivateKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	if !common.IsHexAddress(cfg.ContractAddress) {
+		return nil, errors.New("invalid contract address")
+	}
+
+	client, err := ethclient.Dial(cfg.RPC_URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RPC endpoint: %w", err)
+	}
+
+	return NewEthereumLedgerBackend(network, client, key, common.HexToAddress(cfg.ContractAddress))
+}
+
+func NewEthereumLedgerBackend(network string, client EthereumClient, key *ecdsa.PrivateKey, contract common.Address) (*EthereumLedgerBackend, error) {
+	parsed, err := abi.JSON(strings.NewReader(ProvenanceAnchorABI))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse anchor contract ABI: %w", err)
+	}
+
+	return &EthereumLedgerBackend{
+		network:  network,
+		client:   client,
+		key:      key,
+		from:     crypto.PubkeyToAddress(key.PublicKey),
+		contract: contract,
+		abi:      parsed,
+	}, nil
+}
+
+func (b *EthereumLedgerBackend) Name() string {
+	return b.network
+}
+
+func (b *EthereumLedgerBackend) Anchor(ctx context.Context, hash string) (*AnchorReceipt, error) {
+	digest, err := hashToBytes32(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := b.abi.Pack("anchor", digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode anchor call: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	chainID, err := b.client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+
+	nonce, err := b.client.PendingNonceAt(ctx, b.from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+
+	gasPrice, err := b.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+
+	gas, err := b.client.EstimateGas(ctx, ethereum.CallMsg{
+		From: b.from,
+		To:   &b.contract,
+		Data: data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      gas,
+		To:       &b.contract,
+		Data:     data,
+	})
+
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), b.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign anchor transaction: %w", err)
+	}
+
+	if err := b.client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, fmt.Errorf("failed to send anchor transaction: %w", err)
+	}
+
+	return &AnchorReceipt{
+		Backend:   b.Name(),
+		Hash:      hash,
+		Reference: signedTx.Hash().Hex(),
+		Status:    models.AnchorStatusSubmitted,
+	}, nil
+}
+
+func (b *EthereumLedgerBackend) Lookup(ctx context.Context, hash string) (*AnchorReceipt, error) {
+	digest, err := hashToBytes32(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := b.abi.Pack("anchoredBlock", digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lookup call: %w", err)
+	}
+
+	output, err := b.client.CallContract(ctx, ethereum.CallMsg{To: &b.contract, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call anchor contract: %w", err)
+	}
+
+	values, err := b.abi.Unpack("anchoredBlock", output)
+	if err != nil || len(values) != 1 {
+		return nil, fmt.Errorf("failed to decode anchor contract response: %w", err)
+	}
+
+	block, ok := values[0].(*big.Int)
+	if !ok || block.Sign() == 0 {
+		return nil, ErrNotAnchored
+	}
+
+	blockNumber := block.Uint64()
+	receipt := &AnchorReceipt{
+		Backend:     b.Name(),
+		Hash:        hash,
+		BlockNumber: &blockNumber,
+		Status:      models.AnchorStatusConfirmed,
+	}
+
+	if header, err := b.client.HeaderByNumber(ctx, block); err == nil {
+		anchoredAt := time.Unix(int64(header.Time), 0)
+		receipt.AnchoredAt = &anchoredAt
+	}
+
+	return receipt, nil
+}
+
+func hashToBytes32(hash string) ([32]byte, error) {
+	var digest [32]byte
+
+	decoded, err := hex.DecodeString(strings.TrimPrefix(hash, "0x"))
+	if err != nil || len(decoded) != len(digest) {
+		return digest, errors.New("hash must be 32 hex-encoded bytes")
+	}
+
+	copy(digest[:], decoded)
+	return digest, nil
+}
@@ -0,0 +1,128 @@
+// internal/services/exchange_service.go
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// ErrNoExchangeRate is returned when a currency has no configured rate
+var ErrNoExchangeRate = errors.New("no exchange rate configured")
+
+// ExchangeService converts amounts for reporting. Rates are configured, not
+// live, and are never used to charge anyone: buyers pay in the product's
+// currency and the ledger keeps every amount in the currency it moved in.
+type ExchangeService struct {
+	reporting string
+	rates     map[string]decimal.Decimal
+}
+
+// CurrencyAmount is a total in one currency, as grouped by a query
+type CurrencyAmount struct {
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+func (c CurrencyAmount) MarshalJSON() ([]byte, error) {
+	type currencyAmount CurrencyAmount
+	return json.Marshal(struct {
+		currencyAmount
+		Amount models.DecimalNumber `json:"amount"`
+	}{currencyAmount(c), models.DecimalNumber(c.Amount)})
+}
+
+func NewExchangeService(config *config.Config) *ExchangeService {
+	reporting := models.DefaultCurrency
+	spec := ""
+	if config != nil {
+		reporting = models.NormalizeCurrency(config.Currency.Reporting)
+		spec = config.Currency.Rates
+	}
+
+	rates, err := ParseExchangeRates(spec)
+	if err != nil {
+		log.Printf("Warning: ignoring FX rates: %v", err)
+		rates = map[string]decimal.Decimal{}
+	}
+	rates[reporting] = decimal.NewFromInt(1)
+
+	return &ExchangeService{
+		reporting: reporting,
+		rates:     rates,
+	}
+}
+
+// ParseExchangeRates reads "CODE=rate" pairs separated by commas
+func ParseExchangeRates(spec string) (map[string]decimal.Decimal, error) {
+	rates := make(map[string]decimal.Decimal)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		code, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q", pair)
+		}
+
+		rate, err := decimal.NewFromString(strings.TrimSpace(value))
+		if err != nil || !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid rate for %s: %q", code, value)
+		}
+		rates[models.NormalizeCurrency(code)] = rate
+	}
+	return rates, nil
+}
+
+// ReportingCurrency is the currency reports are totalled in
+func (s *ExchangeService) ReportingCurrency() string {
+	return s.reporting
+}
+
+// Convert converts an amount into another currency through the reporting
+// currency, rounded to the target's minor unit
+func (s *ExchangeService) Convert(amount models.Money, currency string) (models.Money, error) {
+	currency = models.NormalizeCurrency(currency)
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	from, ok := s.rates[amount.Currency]
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w for %s", ErrNoExchangeRate, amount.Currency)
+	}
+	to, ok := s.rates[currency]
+	if !ok {
+		return models.Money{}, fmt.Errorf("%w for %s", ErrNoExchangeRate, currency)
+	}
+
+	converted := amount.Amount.Mul(from).DivRound(to, 16)
+	return models.NewMoney(converted, currency).Round(), nil
+}
+
+// ToReporting converts an amount into the reporting currency
+func (s *ExchangeService) ToReporting(amount models.Money) (models.Money, error) {
+	return s.Convert(amount, s.reporting)
+}
+
+// TotalInReporting adds up per-currency totals in the reporting currency
+func (s *ExchangeService) TotalInReporting(amounts []CurrencyAmount) (models.Money, error) {
+	total := models.ZeroMoney(s.reporting)
+	for _, amount := range amounts {
+		converted, err := s.ToReporting(models.NewMoney(amount.Amount, amount.Currency))
+		if err != nil {
+			return models.Money{}, err
+		}
+		total, _ = total.Add(converted)
+	}
+	return total, nil
+}
@@ -0,0 +1,355 @@
+// internal/services/inventory.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// ErrInsufficientInventory is returned when a product has fewer units in
+// stock than a purchase asks for
+var ErrInsufficientInventory = errors.New("insufficient inventory")
+
+// InventoryService reserves stock for pending purchases. A reservation takes
+// units out of inventory_count when the purchase is made, and is either
+// committed when the payment succeeds or released back to stock when the
+// payment fails or the reservation expires.
+type InventoryService struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+func NewInventoryService(db *gorm.DB, config *config.Config) *InventoryService {
+	return &InventoryService{
+		db:     db,
+		config: config,
+	}
+}
+
+// ReservationTTL is how long a pending purchase holds its units
+func (s *InventoryService) ReservationTTL() time.Duration {
+	minutes := 30
+	if s.config != nil && s.config.Payment.ReservationTTL > 0 {
+		minutes = s.config.Payment.ReservationTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Hold reserves quantity units of a product for a pending transaction and
+// assigns it the lowest unclaimed serials. Products listed before
+// serialization may have no units, which does not block the hold.
+func (s *InventoryService) Hold(tx *gorm.DB, productID, transactionID uuid.UUID, quantity int) (*models.InventoryReservation, error) {
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND inventory_count >= ?", productID, quantity).
+		UpdateColumn("inventory_count", gorm.Expr("inventory_count - ?", quantity))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update inventory: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInsufficientInventory
+	}
+
+	if _, err := claimProductUnits(tx, productID, transactionID, quantity); err != nil {
+		return nil, err
+	}
+
+	reservation := &models.InventoryReservation{
+		ProductID:     productID,
+		TransactionID: transactionID,
+		Quantity:      quantity,
+		Status:        models.ReservationStatusHeld,
+		ExpiresAt:     time.Now().Add(s.ReservationTTL()),
+	}
+
+	// A transaction paid after its reservation was released takes it again
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "transaction_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":     quantity,
+			"status":       models.ReservationStatusHeld,
+			"expires_at":   reservation.ExpiresAt,
+			"released_at":  nil,
+			"committed_at": nil,
+			"updated_at":   time.Now(),
+		}),
+	}).Create(reservation).Error; err != nil {
+		return nil, fmt.Errorf("failed to reserve inventory: %w", err)
+	}
+
+	if err := syncProductAvailability(tx, productID); err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// Commit marks the reservations of a paid transaction as sold and counts
+// the units towards their products' sales
+func (s *InventoryService) Commit(tx *gorm.DB, transactionID uuid.UUID) error {
+	reservations, err := lockReservations(tx, transactionID, models.ReservationStatusHeld)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, reservation := range reservations {
+		if err := tx.Model(&reservation).Updates(map[string]interface{}{
+			"status":       models.ReservationStatusCommitted,
+			"committed_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to commit inventory reservation: %w", err)
+		}
+
+		if err := tx.Model(&models.Product{}).Where("id = ?", reservation.ProductID).
+			UpdateColumn("sales_count", gorm.Expr("sales_count + ?", reservation.Quantity)).Error; err != nil {
+			return fmt.Errorf("failed to update sales count: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Reclaim reserves again the units a transaction released, for a payment
+// that succeeds after it failed or expired. Products that sold out in the
+// meantime are skipped and returned.
+func (s *InventoryService) Reclaim(tx *gorm.DB, transactionID uuid.UUID) ([]uuid.UUID, error) {
+	reservations, err := lockReservations(tx, transactionID, models.ReservationStatusReleased)
+	if err != nil {
+		return nil, err
+	}
+
+	var soldOut []uuid.UUID
+	for _, reservation := range reservations {
+		if _, err := s.Hold(tx, reservation.ProductID, transactionID, reservation.Quantity); err != nil {
+			if !errors.Is(err, ErrInsufficientInventory) {
+				return nil, err
+			}
+			soldOut = append(soldOut, reservation.ProductID)
+		}
+	}
+
+	return soldOut, nil
+}
+
+// Release returns the units reserved for a transaction to stock and frees
+// their serials for the next buyer. Transactions without held reservations
+// are left alone, so releasing twice has no effect.
+func (s *InventoryService) Release(tx *gorm.DB, transactionID uuid.UUID) error {
+	reservations, err := lockReservations(tx, transactionID, models.ReservationStatusHeld)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, reservation := range reservations {
+		if err := tx.Model(&models.Product{}).Where("id = ?", reservation.ProductID).
+			UpdateColumn("inventory_count", gorm.Expr("inventory_count + ?", reservation.Quantity)).Error; err != nil {
+			return fmt.Errorf("failed to restore inventory: %w", err)
+		}
+
+		if err := tx.Model(&models.ProductUnit{}).
+			Where("product_id = ? AND transaction_id = ? AND status = ?", reservation.ProductID, transactionID, models.UnitStatusSold).
+			Updates(map[string]interface{}{
+				"status":         models.UnitStatusUnclaimed,
+				"transaction_id": nil,
+				"sold_at":        nil,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to release product units: %w", err)
+		}
+
+		if err := tx.Model(&reservation).Updates(map[string]interface{}{
+			"status":      models.ReservationStatusReleased,
+			"released_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to release inventory reservation: %w", err)
+		}
+
+		if err := syncProductAvailability(tx, reservation.ProductID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Restock returns units of a refunded sale to stock: up to quantity units,
+// or every unit not yet returned when quantity is zero. Units are taken
+// product by product, and the sale's most recently assigned serials are
+// freed for the next buyer. It returns the number of units restocked.
+func (s *InventoryService) Restock(tx *gorm.DB, transactionID uuid.UUID, quantity int) (int, error) {
+	reservations, err := lockReservations(tx, transactionID, models.ReservationStatusCommitted)
+	if err != nil {
+		return 0, err
+	}
+
+	restocked := 0
+	for i, units := range RestockSplit(reservations, quantity) {
+		if units == 0 {
+			continue
+		}
+		reservation := reservations[i]
+
+		if err := tx.Model(&models.Product{}).Where("id = ?", reservation.ProductID).
+			Updates(map[string]interface{}{
+				"inventory_count": gorm.Expr("inventory_count + ?", units),
+				"sales_count":     gorm.Expr("GREATEST(sales_count - ?, 0)", units),
+			}).Error; err != nil {
+			return 0, fmt.Errorf("failed to restore inventory: %w", err)
+		}
+
+		var unitIDs []uuid.UUID
+		if err := tx.Model(&models.ProductUnit{}).
+			Where("product_id = ? AND transaction_id = ? AND status = ?", reservation.ProductID, transactionID, models.UnitStatusSold).
+			Order("serial_number DESC").Limit(units).
+			Pluck("id", &unitIDs).Error; err != nil {
+			return 0, fmt.Errorf("failed to load product units: %w", err)
+		}
+		if len(unitIDs) > 0 {
+			if err := tx.Model(&models.ProductUnit{}).Where("id IN ?", unitIDs).
+				Updates(map[string]interface{}{
+					"status":         models.UnitStatusUnclaimed,
+					"transaction_id": nil,
+					"sold_at":        nil,
+				}).Error; err != nil {
+				return 0, fmt.Errorf("failed to release product units: %w", err)
+			}
+		}
+
+		if err := tx.Model(&reservation).
+			UpdateColumn("restocked_quantity", gorm.Expr("restocked_quantity + ?", units)).Error; err != nil {
+			return 0, fmt.Errorf("failed to update inventory reservation: %w", err)
+		}
+
+		if err := syncProductAvailability(tx, reservation.ProductID); err != nil {
+			return 0, err
+		}
+
+		restocked += units
+	}
+
+	return restocked, nil
+}
+
+// RestockSplit spreads quantity units over a sale's reservations in order,
+// never more than a reservation has left to return; zero returns them all
+func RestockSplit(reservations []models.InventoryReservation, quantity int) []int {
+	split := make([]int, len(reservations))
+	restocked := 0
+	for i, reservation := range reservations {
+		units := reservation.Quantity - reservation.RestockedQuantity
+		if quantity > 0 && units > quantity-restocked {
+			units = quantity - restocked
+		}
+		if units <= 0 {
+			continue
+		}
+		split[i] = units
+		restocked += units
+	}
+	return split
+}
+
+// ExpiredReservations lists held reservations that are past their expiry
+func (s *InventoryService) ExpiredReservations(limit int) ([]models.InventoryReservation, error) {
+	var reservations []models.InventoryReservation
+	if err := s.db.Where("status = ? AND expires_at <= ?", models.ReservationStatusHeld, time.Now()).
+		Order("expires_at ASC").Limit(limit).
+		Find(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("failed to load expired reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// SyncAvailability marks active products without stock sold out and sold
+// out products that have stock again active. It returns the number of
+// products whose status changed.
+func (s *InventoryService) SyncAvailability() (int64, error) {
+	soldOut := s.db.Model(&models.Product{}).
+		Where("status = ? AND inventory_count <= 0", models.ProductStatusActive).
+		Update("status", models.ProductStatusSoldOut)
+	if soldOut.Error != nil {
+		return 0, fmt.Errorf("failed to mark products sold out: %w", soldOut.Error)
+	}
+
+	restocked := s.db.Model(&models.Product{}).
+		Where("status = ? AND inventory_count > 0", models.ProductStatusSoldOut).
+		Update("status", models.ProductStatusActive)
+	if restocked.Error != nil {
+		return 0, fmt.Errorf("failed to reactivate products: %w", restocked.Error)
+	}
+
+	return soldOut.RowsAffected + restocked.RowsAffected, nil
+}
+
+func lockReservations(tx *gorm.DB, transactionID uuid.UUID, status models.ReservationStatus) ([]models.InventoryReservation, error) {
+	var reservations []models.InventoryReservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("transaction_id = ? AND status = ?", transactionID, status).
+		Order("product_id").
+		Find(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("failed to load inventory reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+// syncProductAvailability flips one product between active and sold_out to
+// match its stock. Drafts and suspended products keep their status.
+func syncProductAvailability(tx *gorm.DB, productID uuid.UUID) error {
+	if err := tx.Model(&models.Product{}).
+		Where("id = ? AND status = ? AND inventory_count <= 0", productID, models.ProductStatusActive).
+		Update("status", models.ProductStatusSoldOut).Error; err != nil {
+		return fmt.Errorf("failed to update product status: %w", err)
+	}
+
+	if err := tx.Model(&models.Product{}).
+		Where("id = ? AND status = ? AND inventory_count > 0", productID, models.ProductStatusSoldOut).
+		Update("status", models.ProductStatusActive).Error; err != nil {
+		return fmt.Errorf("failed to update product status: %w", err)
+	}
+
+	return nil
+}
+
+func claimProductUnits(tx *gorm.DB, productID, transactionID uuid.UUID, quantity int) ([]models.ProductUnit, error) {
+	var units []models.ProductUnit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND status = ?", productID, models.UnitStatusUnclaimed).
+		Order("serial_number ASC").Limit(quantity).
+		Find(&units).Error; err != nil {
+		return nil, fmt.Errorf("failed to load product units: %w", err)
+	}
+
+	if len(units) == 0 {
+		return units, nil
+	}
+
+	ids := make([]uuid.UUID, len(units))
+	for i := range units {
+		ids[i] = units[i].ID
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.ProductUnit{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":         models.UnitStatusSold,
+		"transaction_id": transactionID,
+		"sold_at":        now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to claim product units: %w", err)
+	}
+
+	for i := range units {
+		units[i].Status = models.UnitStatusSold
+		units[i].TransactionID = &transactionID
+		units[i].SoldAt = &now
+	}
+
+	return units, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/javajoker/imi-backend/internal/models"
@@ -14,9 +15,11 @@ import (
 )
 
 type IPService struct {
-	db                *gorm.DB
-	blockchainService *BlockchainService
-	storageService    *StorageService
+	db                   *gorm.DB
+	blockchainService    *BlockchainService
+	authorizationService *AuthorizationService
+	storageService       *StorageService
+	exchangeService      *ExchangeService
 }
 
 type CreateIPAssetRequest struct {
@@ -26,6 +29,9 @@ type CreateIPAssetRequest struct {
 	ContentType string                 `json:"content_type" validate:"required"`
 	Tags        []string               `json:"tags,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+
+	// License this asset is a derivative work under, if any
+	ParentLicenseID *uuid.UUID `json:"parent_license_id,omitempty"`
 }
 
 type UpdateIPAssetRequest struct {
@@ -37,15 +43,18 @@ type UpdateIPAssetRequest struct {
 }
 
 type CreateLicenseTermsRequest struct {
-	LicenseType            models.LicenseType `json:"license_type" validate:"required"`
-	RevenueSharePercentage float64            `json:"revenue_share_percentage" validate:"required,min=5,max=50"`
-	BaseFee                float64            `json:"base_fee,omitempty" validate:"min=0"`
-	Territory              string             `json:"territory,omitempty"`
-	Duration               string             `json:"duration,omitempty"`
-	Requirements           string             `json:"requirements,omitempty"`
-	Restrictions           string             `json:"restrictions,omitempty"`
-	AutoApprove            bool               `json:"auto_approve,omitempty"`
-	MaxLicenses            int                `json:"max_licenses,omitempty" validate:"min=0"`
+	LicenseType            models.LicenseType   `json:"license_type" validate:"required"`
+	RevenueSharePercentage decimal.Decimal      `json:"revenue_share_percentage" validate:"required,min=5,max=50"`
+	BaseFee                decimal.Decimal      `json:"base_fee,omitempty" validate:"min=0"`
+	Currency               string               `json:"currency,omitempty" validate:"omitempty,iso4217"`
+	Territory              models.TerritorySet  `json:"territory,omitempty"`
+	Duration               string               `json:"duration,omitempty"`
+	Requirements           string               `json:"requirements,omitempty"`
+	Restrictions           string               `json:"restrictions,omitempty"`
+	Policy                 models.LicensePolicy `json:"policy,omitempty"`
+	AutoApprove            bool                 `json:"auto_approve,omitempty"`
+	MaxLicenses            int                  `json:"max_licenses,omitempty" validate:"min=0"`
+	AllowSublicensing      bool                 `json:"allow_sublicensing,omitempty"`
 }
 
 type IPSearchParams struct {
@@ -58,11 +67,13 @@ type IPSearchParams struct {
 	Tags               []string                   `json:"tags,omitempty"`
 }
 
-func NewIPService(db *gorm.DB, blockchainService *BlockchainService, storageService *StorageService) *IPService {
+func NewIPService(db *gorm.DB, blockchainService *BlockchainService, authorizationService *AuthorizationService, storageService *StorageService, exchangeService *ExchangeService) *IPService {
 	return &IPService{
-		db:                db,
-		blockchainService: blockchainService,
-		storageService:    storageService,
+		db:                   db,
+		blockchainService:    blockchainService,
+		authorizationService: authorizationService,
+		storageService:       storageService,
+		exchangeService:      exchangeService,
 	}
 }
 
@@ -82,7 +93,20 @@ func (s *IPService) CreateIPAsset(creatorID uuid.UUID, req *CreateIPAssetRequest
 		return nil, errors.New("creator account is not active")
 	}
 
-	if creator.UserType != models.UserTypeCreator && creator.UserType != models.UserTypeAdmin {
+	if req.ParentLicenseID != nil {
+		// Derivative works are registered by whoever holds the parent license
+		if creator.UserType != models.UserTypeSecondaryCreator && creator.UserType != models.UserTypeCreator {
+			return nil, errors.New("only secondary creators and creators can create derivative IP assets")
+		}
+
+		if s.authorizationService == nil {
+			return nil, errors.New("derivative IP assets are not supported")
+		}
+
+		if err := s.authorizationService.ValidateDerivativeSource(creatorID, *req.ParentLicenseID); err != nil {
+			return nil, err
+		}
+	} else if creator.UserType != models.UserTypeCreator && creator.UserType != models.UserTypeAdmin {
 		return nil, errors.New("only creators can create IP assets")
 	}
 
@@ -98,6 +122,7 @@ func (s *IPService) CreateIPAsset(creatorID uuid.UUID, req *CreateIPAssetRequest
 		Metadata:           models.JSONB(req.Metadata),
 		VerificationStatus: models.VerificationStatusPending,
 		Status:             models.ProductStatusActive,
+		ParentLicenseID:    req.ParentLicenseID,
 	}
 
 	// Save to database
@@ -302,15 +327,27 @@ func (s *IPService) CreateLicenseTerms(ipAssetID uuid.UUID, creatorID uuid.UUID,
 		return nil, errors.New("IP asset must be approved before creating license terms")
 	}
 
+	if err := validatePrice(models.NewMoney(req.BaseFee, req.Currency)); err != nil {
+		return nil, err
+	}
+
 	// Set defaults
-	territory := req.Territory
-	if territory == "" {
-		territory = "global"
+	territory := req.Territory.Normalize()
+	if err := territory.Validate(); err != nil {
+		return nil, err
 	}
 
 	duration := req.Duration
 	if duration == "" {
-		duration = "perpetual"
+		duration = models.PerpetualDuration
+	}
+	if _, err := models.ParseLicenseDuration(duration); err != nil {
+		return nil, err
+	}
+
+	policy := req.Policy.Normalize()
+	if err := policy.Validate(); err != nil {
+		return nil, err
 	}
 
 	// Create license terms
@@ -319,12 +356,15 @@ func (s *IPService) CreateLicenseTerms(ipAssetID uuid.UUID, creatorID uuid.UUID,
 		LicenseType:            req.LicenseType,
 		RevenueSharePercentage: req.RevenueSharePercentage,
 		BaseFee:                req.BaseFee,
+		Currency:               models.NormalizeCurrency(req.Currency),
 		Territory:              territory,
 		Duration:               duration,
 		Requirements:           req.Requirements,
 		Restrictions:           req.Restrictions,
+		Policy:                 policy,
 		AutoApprove:            req.AutoApprove,
 		MaxLicenses:            req.MaxLicenses,
+		AllowSublicensing:      req.AllowSublicensing,
 		IsActive:               true,
 	}
 
@@ -379,16 +419,43 @@ func (s *IPService) UpdateLicenseTerms(id uuid.UUID, creatorID uuid.UUID, req *C
 		return nil, errors.New("cannot update license terms with pending applications")
 	}
 
+	if err := validatePrice(models.NewMoney(req.BaseFee, req.Currency)); err != nil {
+		return nil, err
+	}
+
+	duration := req.Duration
+	if duration == "" {
+		duration = models.PerpetualDuration
+	}
+	if _, err := models.ParseLicenseDuration(duration); err != nil {
+		return nil, err
+	}
+
+	territory := req.Territory.Normalize()
+	if err := territory.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Products already made under the terms are checked against a changed
+	// policy when they are next updated
+	policy := req.Policy.Normalize()
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Update fields
 	licenseTerms.LicenseType = req.LicenseType
 	licenseTerms.RevenueSharePercentage = req.RevenueSharePercentage
 	licenseTerms.BaseFee = req.BaseFee
-	licenseTerms.Territory = req.Territory
-	licenseTerms.Duration = req.Duration
+	licenseTerms.Currency = models.NormalizeCurrency(req.Currency)
+	licenseTerms.Territory = territory
+	licenseTerms.Duration = duration
 	licenseTerms.Requirements = req.Requirements
 	licenseTerms.Restrictions = req.Restrictions
+	licenseTerms.Policy = policy
 	licenseTerms.AutoApprove = req.AutoApprove
 	licenseTerms.MaxLicenses = req.MaxLicenses
+	licenseTerms.AllowSublicensing = req.AllowSublicensing
 
 	if err := s.db.Save(&licenseTerms).Error; err != nil {
 		return nil, fmt.Errorf("failed to update license terms: %w", err)
@@ -505,22 +572,29 @@ func (s *IPService) GetIPAssetStatistics(ipAssetID uuid.UUID, creatorID uuid.UUI
 		Where("ip_asset_id = ? AND status = ?", ipAssetID, models.ApplicationStatusRejected).
 		Count(&licenseStats.RejectedLicenses)
 
-	// Get revenue statistics (placeholder - actual implementation would be more complex)
-	var totalRevenue float64
+	// Revenue is what licensors of this asset received from product sales,
+	// in whatever currencies the products were sold in
+	var revenue []CurrencyAmount
 	s.db.Model(&models.Transaction{}).
-		Joins("JOIN products ON transactions.product_id = products.id").
-		Joins("JOIN license_applications ON products.license_id = license_applications.id").
-		Where("license_applications.ip_asset_id = ? AND transactions.status = ?",
-			ipAssetID, models.TransactionStatusCompleted).
-		Select("COALESCE(SUM(revenue_shares->>'ip_creator'), 0)").
-		Scan(&totalRevenue)
+		Where("transaction_type = ? AND status = ? AND revenue_shares->>'ip_asset_id' = ?",
+			models.TransactionTypeRevenueShare, models.TransactionStatusCompleted, ipAssetID.String()).
+		Select("currency, COALESCE(SUM(amount), 0) AS amount").
+		Group("currency").
+		Scan(&revenue)
+
+	totalRevenue, err := s.exchangeService.TotalInReporting(revenue)
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
-		"view_count":    ipAsset.ViewCount,
-		"like_count":    ipAsset.LikeCount,
-		"license_stats": licenseStats,
-		"total_revenue": totalRevenue,
-		"created_at":    ipAsset.CreatedAt,
-		"updated_at":    ipAsset.UpdatedAt,
+		"view_count":          ipAsset.ViewCount,
+		"like_count":          ipAsset.LikeCount,
+		"license_stats":       licenseStats,
+		"total_revenue":       models.DecimalNumber(totalRevenue.Amount),
+		"currency":            totalRevenue.Currency,
+		"revenue_by_currency": revenue,
+		"created_at":          ipAsset.CreatedAt,
+		"updated_at":          ipAsset.UpdatedAt,
 	}, nil
 }
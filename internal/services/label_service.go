@@ -0,0 +1,208 @@
+// internal/services/label_service.go
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// Label sheet layout, in millimetres on A4 portrait (3 x 8 labels)
+const (
+	labelColumns      = 3
+	labelRows         = 8
+	labelWidth        = 70.0
+	labelHeight       = 37.0
+	labelMarginTop    = 0.5
+	labelQRSize       = 30.0
+	labelQRPixels     = 512
+	defaultQRCodeSize = 256
+	maxQRCodeSize     = 2048
+)
+
+type LabelService struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+type LabelSheetRequest struct {
+	ProductIDs []uuid.UUID `json:"product_ids" validate:"required,min=1,max=100"`
+	Copies     int         `json:"copies,omitempty" validate:"omitempty,min=1,max=50"`
+	// PerUnit prints one label per unclaimed unit serial code instead of
+	// copies of the product code
+	PerUnit bool `json:"per_unit,omitempty"`
+}
+
+func NewLabelService(db *gorm.DB, config *config.Config) *LabelService {
+	return &LabelService{
+		db:     db,
+		config: config,
+	}
+}
+
+// VerificationURL is the public page a scanned label opens
+func (s *LabelService) VerificationURL(verificationCode string) string {
+	return fmt.Sprintf("%s/verify/%s", strings.TrimRight(s.config.Frontend.BaseURL, "/"), verificationCode)
+}
+
+// RenderQRCode renders the verification URL of a product as "png" or "svg"
+// and returns the image with its content type.
+func (s *LabelService) RenderQRCode(productID, creatorID uuid.UUID, format string, size int) ([]byte, string, error) {
+	if size <= 0 {
+		size = defaultQRCodeSize
+	}
+	if size > maxQRCodeSize {
+		return nil, "", fmt.Errorf("size cannot exceed %d pixels", maxQRCodeSize)
+	}
+
+	_, authChain, err := s.getLabelProduct(productID, creatorID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	url := s.VerificationURL(authChain.VerificationCode)
+
+	switch strings.ToLower(format) {
+	case "", "png":
+		image, err := utils.QRCodePNG(url, size)
+		return image, "image/png", err
+	case "svg":
+		image, err := utils.QRCodeSVG(url, size)
+		return image, "image/svg+xml", err
+	default:
+		return nil, "", errors.New("format must be png or svg")
+	}
+}
+
+// RenderLabelSheet renders a printable A4 PDF with one label per product
+// copy, or per unclaimed unit when PerUnit is set. Each label carries the QR
+// code, the product title and the code.
+func (s *LabelService) RenderLabelSheet(creatorID uuid.UUID, req *LabelSheetRequest) ([]byte, error) {
+	// Validate request
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	copies := req.Copies
+	if copies == 0 {
+		copies = 1
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+
+	// Core fonts are Latin-1 only; other characters are replaced
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	marginLeft := (pageWidth - labelColumns*labelWidth) / 2
+
+	slot := 0
+	for _, productID := range req.ProductIDs {
+		product, authChain, err := s.getLabelProduct(productID, creatorID)
+		if err != nil {
+			return nil, fmt.Errorf("product %s: %w", productID, err)
+		}
+
+		codes := make([]string, 0, copies)
+		if req.PerUnit {
+			if err := s.db.Model(&models.ProductUnit{}).
+				Where("product_id = ? AND status = ?", productID, models.UnitStatusUnclaimed).
+				Order("serial_number ASC").
+				Pluck("verification_code", &codes).Error; err != nil {
+				return nil, fmt.Errorf("failed to load product units: %w", err)
+			}
+		} else {
+			for i := 0; i < copies; i++ {
+				codes = append(codes, authChain.VerificationCode)
+			}
+		}
+
+		for _, code := range codes {
+			imageName := "qr-" + code
+			if info := pdf.GetImageInfo(imageName); info == nil {
+				image, err := utils.QRCodePNG(s.VerificationURL(code), labelQRPixels)
+				if err != nil {
+					return nil, err
+				}
+				pdf.RegisterImageOptionsReader(imageName, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(image))
+			}
+
+			if slot%(labelColumns*labelRows) == 0 {
+				pdf.AddPage()
+			}
+
+			column := slot % labelColumns
+			row := (slot / labelColumns) % labelRows
+			x := marginLeft + float64(column)*labelWidth
+			y := labelMarginTop + float64(row)*labelHeight
+
+			pdf.ImageOptions(imageName, x+2, y+(labelHeight-labelQRSize)/2, labelQRSize, labelQRSize,
+				false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+			textX := x + labelQRSize + 4
+			textWidth := labelWidth - labelQRSize - 6
+
+			pdf.SetFont("Helvetica", "B", 9)
+			pdf.SetXY(textX, y+6)
+			pdf.MultiCell(textWidth, 4, translate(product.Title), "", "L", false)
+
+			pdf.SetFont("Helvetica", "", 7)
+			pdf.SetXY(textX, y+labelHeight-16)
+			pdf.CellFormat(textWidth, 3.5, "Scan to verify", "", 2, "L", false, 0, "")
+
+			pdf.SetFont("Courier", "", 6)
+			pdf.SetX(textX)
+			pdf.MultiCell(textWidth, 3, code, "", "L", false)
+
+			slot++
+		}
+	}
+
+	if slot == 0 {
+		return nil, errors.New("no unclaimed units to print")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render label sheet: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// getLabelProduct returns a product owned by creatorID with its active chain
+func (s *LabelService) getLabelProduct(productID, creatorID uuid.UUID) (*models.Product, *models.AuthorizationChain, error) {
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("product not found")
+		}
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if product.CreatorID != creatorID {
+		return nil, nil, errors.New("unauthorized to print labels for this product")
+	}
+
+	var authChain models.AuthorizationChain
+	if err := s.db.Where("product_id = ? AND depth = 0 AND is_active = ?", productID, true).
+		First(&authChain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("product has no active verification code")
+		}
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &product, &authChain, nil
+}
@@ -0,0 +1,113 @@
+// internal/services/ledger_backend.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// LedgerBackend anchors provenance ledger hashes to a store outside the
+// application's control, so a rewritten ledger can be detected.
+type LedgerBackend interface {
+	// Name identifies the backend in stored anchors
+	Name() string
+	// Anchor submits a hex-encoded SHA-256 hash
+	Anchor(ctx context.Context, hash string) (*AnchorReceipt, error)
+	// Lookup reports whether and when a hash was anchored
+	Lookup(ctx context.Context, hash string) (*AnchorReceipt, error)
+}
+
+type AnchorReceipt struct {
+	Backend     string              `json:"backend"`
+	Hash        string              `json:"hash"`
+	Reference   string              `json:"reference,omitempty"`
+	BlockNumber *uint64             `json:"block_number,omitempty"`
+	Status      models.AnchorStatus `json:"status"`
+	AnchoredAt  *time.Time          `json:"anchored_at,omitempty"`
+}
+
+var ErrNotAnchored = errors.New("hash is not anchored")
+
+// Networks served by the local database backend
+var localLedgerNetworks = map[string]bool{
+	"":         true,
+	"local":    true,
+	"database": true,
+}
+
+// NewLedgerBackend selects a backend from BlockchainConfig.Network. Any
+// network other than "local"/"database" is treated as an EVM chain reached
+// through RPC_URL; without an RPC URL the local backend is used.
+func NewLedgerBackend(db *gorm.DB, cfg *config.Config) (LedgerBackend, error) {
+	network := strings.ToLower(cfg.Blockchain.Network)
+	if localLedgerNetworks[network] {
+		return NewDatabaseLedgerBackend(db), nil
+	}
+
+	if cfg.Blockchain.RPC_URL == "" {
+		log.Printf("Blockchain network %q has no RPC URL configured, using local ledger backend", network)
+		return NewDatabaseLedgerBackend(db), nil
+	}
+
+	backend, err := DialEthereumLedgerBackend(network, cfg.Blockchain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s ledger backend: %w", network, err)
+	}
+
+	return backend, nil
+}
+
+// DatabaseLedgerBackend keeps anchors in the local database. It offers no
+// protection against a database administrator, but lets the rest of the
+// system run unchanged when no chain is configured.
+type DatabaseLedgerBackend struct {
+	db *gorm.DB
+}
+
+func NewDatabaseLedgerBackend(db *gorm.DB) *DatabaseLedgerBackend {
+	return &DatabaseLedgerBackend{db: db}
+}
+
+func (b *DatabaseLedgerBackend) Name() string {
+	return "database"
+}
+
+func (b *DatabaseLedgerBackend) Anchor(ctx context.Context, hash string) (*AnchorReceipt, error) {
+	// The anchor row persisted by BlockchainService is the record itself
+	now := time.Now()
+	return &AnchorReceipt{
+		Backend:    b.Name(),
+		Hash:       hash,
+		Status:     models.AnchorStatusConfirmed,
+		AnchoredAt: &now,
+	}, nil
+}
+
+func (b *DatabaseLedgerBackend) Lookup(ctx context.Context, hash string) (*AnchorReceipt, error) {
+	var anchor models.LedgerAnchor
+	if err := b.db.WithContext(ctx).Where("hash = ? AND backend = ?", hash, b.Name()).
+		First(&anchor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotAnchored
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &AnchorReceipt{
+		Backend:     anchor.Backend,
+		Hash:        anchor.Hash,
+		Reference:   anchor.Reference,
+		BlockNumber: anchor.BlockNumber,
+		Status:      anchor.Status,
+		AnchoredAt:  anchor.AnchoredAt,
+	}, nil
+}
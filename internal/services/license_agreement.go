@@ -0,0 +1,408 @@
+// internal/services/license_agreement.go
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// ErrAgreementNotSigned is returned when a license is used before its
+// licensee has signed its agreement
+var ErrAgreementNotSigned = errors.New("license agreement has not been signed")
+
+// ErrAgreementChanged is returned when the agreement an applicant signs is
+// not the one they were shown
+var ErrAgreementChanged = errors.New("license agreement has changed; review it again before signing")
+
+// SignLicenseAgreementRequest accepts a license agreement. DocumentHash is the
+// hash of the agreement the applicant was shown, as returned with it.
+type SignLicenseAgreementRequest struct {
+	DocumentHash string `json:"document_hash" validate:"required"`
+}
+
+// LicenseAgreementDocument is the content of a license agreement, rendered
+// alike as HTML and PDF
+type LicenseAgreementDocument struct {
+	Title    string
+	Number   string
+	Date     string
+	Sections []AgreementSection
+}
+
+type AgreementSection struct {
+	Heading    string
+	Paragraphs []string
+}
+
+// BuildLicenseAgreement drafts the agreement of a license application from
+// its terms, IP asset and parties, which must be preloaded as IPAsset,
+// IPAsset.Creator, Applicant and LicenseTerms. It depends only on stored
+// data, so the same application always gives the same agreement.
+func BuildLicenseAgreement(application *models.LicenseApplication) *LicenseAgreementDocument {
+	terms := &application.LicenseTerms
+	asset := &application.IPAsset
+
+	party := func(user *models.User, id uuid.UUID) string {
+		return fmt.Sprintf("%s (user %s)", user.Username, id)
+	}
+
+	grant := fmt.Sprintf("The Licensor grants the Licensee a %s license to make and sell products based on the Licensed Work through the platform, on the terms of this agreement.",
+		terms.LicenseType)
+	if terms.LicenseType == models.LicenseTypeExclusive {
+		grant += " The license is exclusive."
+	}
+	sublicensing := "The Licensee may not sublicense the Licensed Work."
+	if terms.AllowSublicensing {
+		sublicensing = "The Licensee may register derivative works of the Licensed Work and license them to others, who are bound by this agreement as well."
+	}
+
+	territory := "Products may be sold worldwide."
+	if !terms.Territory.IsGlobal() {
+		territory = "Products may be sold only in " + strings.Join(terms.Territory.Include, ", ")
+		if len(terms.Territory.Exclude) > 0 {
+			territory += ", except " + strings.Join(terms.Territory.Exclude, ", ")
+		}
+		territory += "."
+	}
+
+	term := "The license is perpetual."
+	if duration, err := models.ParseLicenseDuration(terms.Duration); err == nil && !duration.IsPerpetual() {
+		term = fmt.Sprintf("The license runs for %s from the day it is granted and may be renewed before it expires. When it expires, products made under it are no longer verified as licensed.",
+			terms.Duration)
+	}
+
+	fee := "No license fee is payable."
+	if terms.BaseFee.IsPositive() {
+		fee = fmt.Sprintf("The Licensee pays a license fee of %s before the license is granted, and again on each renewal.",
+			terms.BaseFeeMoney().Round())
+	}
+	share := fmt.Sprintf("The Licensor receives %s%% of the sale price of every product sold under the license, paid through the platform.",
+		terms.RevenueSharePercentage.StringFixed(2))
+
+	sections := []AgreementSection{
+		{Heading: "Parties", Paragraphs: []string{
+			"Licensor: " + party(&asset.Creator, asset.CreatorID),
+			"Licensee: " + party(&application.Applicant, application.ApplicantID),
+		}},
+		{Heading: "1. Licensed Work", Paragraphs: []string{
+			fmt.Sprintf("%q, a %s work registered on the platform as IP asset %s.", asset.Title, asset.Category, asset.ID),
+		}},
+		{Heading: "2. Grant", Paragraphs: []string{grant, sublicensing}},
+		{Heading: "3. Territory", Paragraphs: []string{territory}},
+		{Heading: "4. Term", Paragraphs: []string{term}},
+		{Heading: "5. Fees and Revenue Share", Paragraphs: []string{fee, share}},
+	}
+
+	number := len(sections)
+	addSection := func(heading string, paragraphs []string) {
+		sections = append(sections, AgreementSection{
+			Heading:    fmt.Sprintf("%d. %s", number, heading),
+			Paragraphs: paragraphs,
+		})
+		number++
+	}
+
+	if terms.Requirements != "" {
+		addSection("Requirements", splitParagraphs(terms.Requirements))
+	}
+	if terms.Restrictions != "" {
+		addSection("Restrictions", splitParagraphs(terms.Restrictions))
+	}
+	if !terms.Policy.IsEmpty() {
+		addSection("Product Rules", policyParagraphs(terms.Policy))
+	}
+	addSection("Revocation", []string{
+		"The Licensor may revoke the license if the Licensee breaches this agreement. Products made under a revoked license are no longer verified as licensed.",
+	})
+	addSection("Electronic Signature", []string{
+		"The Licensee accepts this agreement by signing it electronically on the platform. The signature records when it was made, the IP address it was made from and the SHA-256 hash of this document, and is recorded in the platform's provenance ledger.",
+	})
+
+	return &LicenseAgreementDocument{
+		Title:    "License Agreement",
+		Number:   application.ID.String(),
+		Date:     application.CreatedAt.UTC().Format("2 January 2006"),
+		Sections: sections,
+	}
+}
+
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// policyParagraphs describes the rules of a license policy
+func policyParagraphs(policy models.LicensePolicy) []string {
+	var rules []string
+	if len(policy.AllowedCategories) > 0 {
+		rules = append(rules, "Products must be in one of these categories: "+strings.Join(policy.AllowedCategories, ", ")+".")
+	}
+	if policy.MaxUnits > 0 {
+		rules = append(rules, fmt.Sprintf("No more than %d units may be stocked or sold in all.", policy.MaxUnits))
+	}
+	if policy.PriceFloor != nil {
+		rules = append(rules, fmt.Sprintf("Products may not be priced below %s.", policy.PriceFloor.Round()))
+	}
+	if policy.RequiredAttribution != "" {
+		rules = append(rules, fmt.Sprintf("Every product description must credit %q.", policy.RequiredAttribution))
+	}
+	if len(policy.ForbiddenTags) > 0 {
+		rules = append(rules, "Products may not be tagged "+strings.Join(policy.ForbiddenTags, ", ")+".")
+	}
+	return rules
+}
+
+var agreementTemplate = template.Must(template.New("agreement").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Number}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Agreement No. {{.Number}}<br>Dated {{.Date}}</p>
+{{range .Sections}}<h2>{{.Heading}}</h2>
+{{range .Paragraphs}}<p>{{.}}</p>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// HTML renders the agreement as a standalone HTML page
+func (d *LicenseAgreementDocument) HTML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := agreementTemplate.Execute(&buf, d); err != nil {
+		return nil, fmt.Errorf("failed to render license agreement: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Hash is the hex SHA-256 of the agreement's HTML, which a signature accepts
+func (d *LicenseAgreementDocument) Hash() (string, error) {
+	html, err := d.HTML()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(html)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// PDF renders the agreement as an A4 PDF, stamped with the signature when
+// one is given
+func (d *LicenseAgreementDocument) PDF(signature *models.LicenseAgreement) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.SetTitle(d.Title+" "+d.Number, true)
+	if signature != nil {
+		// A signed PDF renders the same bytes again, so its hash can be rechecked
+		pdf.SetCatalogSort(true)
+		pdf.SetCreationDate(signature.SignedAt)
+		pdf.SetModificationDate(signature.SignedAt)
+	}
+
+	// Core fonts are Latin-1 only; other characters are replaced
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, translate(d.Title), "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(0, 5, "Agreement No. "+d.Number, "", 1, "C", false, 0, "")
+	pdf.CellFormat(0, 5, "Dated "+d.Date, "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+
+	for _, section := range d.Sections {
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.MultiCell(0, 6, translate(section.Heading), "", "L", false)
+		pdf.Ln(1)
+		pdf.SetFont("Helvetica", "", 10)
+		for _, paragraph := range section.Paragraphs {
+			pdf.MultiCell(0, 5, translate(paragraph), "", "L", false)
+			pdf.Ln(2)
+		}
+		pdf.Ln(2)
+	}
+
+	if signature != nil {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.MultiCell(0, 6, "Signed electronically by the Licensee", "T", "L", false)
+		pdf.SetFont("Courier", "", 9)
+		for _, line := range []string{
+			"Signer:        " + signature.SignerID.String(),
+			"Signed at:     " + signature.SignedAt.UTC().Format(time.RFC3339),
+			"IP address:    " + signature.SignerIP,
+			"Document hash: " + signature.DocumentHash,
+		} {
+			pdf.MultiCell(0, 5, translate(line), "", "L", false)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render license agreement: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GetLicenseAgreement drafts the agreement of a license application for its
+// applicant, its licensor or an admin
+func (s *LicenseService) GetLicenseAgreement(applicationID, userID uuid.UUID) (*LicenseAgreementDocument, *models.LicenseApplication, error) {
+	application, err := s.GetLicenseApplication(applicationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return BuildLicenseAgreement(application), application, nil
+}
+
+// SignLicenseAgreement records the applicant's e-signature of their license
+// agreement. documentHash must match the agreement as it stands, so what is
+// signed is what was shown. The signed PDF is stored, and its hash anchored
+// in the ledger once recorded.
+func (s *LicenseService) SignLicenseAgreement(applicationID, signerID uuid.UUID, req *SignLicenseAgreementRequest, signerIP, userAgent string) (*models.LicenseAgreement, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if s.storageService == nil {
+		return nil, errors.New("storage is not configured")
+	}
+
+	application, err := s.GetLicenseApplication(applicationID, signerID)
+	if err != nil {
+		return nil, err
+	}
+	if application.ApplicantID != signerID {
+		return nil, errors.New("unauthorized to sign this license agreement")
+	}
+	if application.Agreement != nil {
+		return nil, errors.New("license agreement has already been signed")
+	}
+	switch application.Status {
+	case models.ApplicationStatusPending, models.ApplicationStatusAwaitingPayment, models.ApplicationStatusApproved:
+	default:
+		return nil, fmt.Errorf("license agreement cannot be signed while the license is %s", application.Status)
+	}
+
+	document := BuildLicenseAgreement(application)
+	documentHash, err := document.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(strings.TrimSpace(req.DocumentHash), documentHash) {
+		return nil, ErrAgreementChanged
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	agreement := &models.LicenseAgreement{
+		BaseModel:            models.BaseModel{ID: uuid.New()},
+		LicenseApplicationID: application.ID,
+		SignerID:             signerID,
+		DocumentHash:         documentHash,
+		SignedAt:             time.Now().UTC().Truncate(time.Second),
+		SignerIP:             signerIP,
+		SignerUserAgent:      userAgent,
+	}
+
+	signed, err := document.PDF(agreement)
+	if err != nil {
+		return nil, err
+	}
+	signedHash := sha256.Sum256(signed)
+	agreement.SignedDocumentHash = hex.EncodeToString(signedHash[:])
+
+	upload, err := s.storageService.UploadBytes(signed, "agreement.pdf", "application/pdf",
+		s.storageService.GetDefaultUploadOptions("agreements"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store signed agreement: %w", err)
+	}
+	agreement.StorageKey = upload.Key
+	agreement.DocumentURL = upload.URL
+
+	// The signature and its ledger record commit together
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(agreement).Error; err != nil {
+			return fmt.Errorf("failed to record signature: %w", err)
+		}
+		return s.recordAgreement(tx, agreement)
+	})
+	if err != nil {
+		if deleteErr := s.storageService.DeleteFile(upload.Key); deleteErr != nil {
+			log.Printf("Failed to delete signed agreement %s: %v", upload.Key, deleteErr)
+		}
+		return nil, err
+	}
+
+	return agreement, nil
+}
+
+// SignedAgreementURL is where a signed agreement can be downloaded: a
+// short-lived link when storage is private
+func (s *LicenseService) SignedAgreementURL(agreement *models.LicenseAgreement) string {
+	if s.storageService != nil {
+		if url, err := s.storageService.GeneratePresignedURL(agreement.StorageKey, 15*time.Minute); err == nil {
+			return url
+		}
+	}
+	return agreement.DocumentURL
+}
+
+// requireSignedAgreement rejects using a license whose agreement the licensee
+// has not signed. Licenses that predate agreements are exempt.
+func requireSignedAgreement(db *gorm.DB, license *models.LicenseApplication) error {
+	if !license.AgreementRequired {
+		return nil
+	}
+
+	var signed int64
+	if err := db.Model(&models.LicenseAgreement{}).
+		Where("license_application_id = ?", license.ID).
+		Count(&signed).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if signed == 0 {
+		return ErrAgreementNotSigned
+	}
+	return nil
+}
+
+// recordAgreement records the signature of a license agreement on the
+// provenance ledger in tx
+func (s *LicenseService) recordAgreement(tx *gorm.DB, agreement *models.LicenseAgreement) error {
+	if s.blockchainService == nil {
+		return nil
+	}
+
+	hash, err := s.blockchainService.CreateAgreementRecord(tx, agreement)
+	if err != nil {
+		return fmt.Errorf("failed to record signature on the ledger: %w", err)
+	}
+
+	agreement.BlockchainHash = hash
+	if err := tx.Model(agreement).UpdateColumn("blockchain_hash", hash).Error; err != nil {
+		return fmt.Errorf("failed to update license agreement: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+// internal/services/license_expiry.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// licenseExpiryReminderDays are how many days before expiry licensees are
+// reminded to renew, in ascending order
+var licenseExpiryReminderDays = []int{7, 30}
+
+// licenseExpiredReason is recorded on authorization chains that end with
+// their license
+const licenseExpiredReason = "license expired"
+
+// RenewLicenseRequest renews a license for another term. PaymentMethod is how
+// the renewal fee is paid, if the terms have one; it defaults to card.
+type RenewLicenseRequest struct {
+	PaymentMethod string `json:"payment_method,omitempty"`
+}
+
+// RenewLicense extends a license by its terms' duration, counted from its
+// current expiry. Terms with a fee charge it again: the license is extended
+// once the returned payment succeeds. A license that expired within the
+// renewal grace period runs again from now, with its authorization chains
+// restored; after that its holder applies again.
+func (s *LicenseService) RenewLicense(applicationID, applicantID uuid.UUID, req *RenewLicenseRequest) (*models.LicenseApplication, *PaymentIntentResponse, error) {
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("Applicant").Preload("LicenseTerms").
+		First(&application, applicationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("license application not found")
+		}
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if application.ApplicantID != applicantID {
+		return nil, nil, errors.New("unauthorized to renew this license")
+	}
+	if application.Status == models.ApplicationStatusExpired && !application.InRenewalGrace(time.Now()) {
+		return nil, nil, errors.New("license expired too long ago to be renewed; apply again")
+	}
+	if (application.Status != models.ApplicationStatusApproved || !application.IsActive) &&
+		application.Status != models.ApplicationStatusExpired {
+		return nil, nil, errors.New("only active licenses can be renewed")
+	}
+	if application.ExpiresAt == nil {
+		return nil, nil, errors.New("perpetual licenses do not need renewal")
+	}
+	if !application.LicenseTerms.IsActive {
+		return nil, nil, errors.New("license terms are no longer offered")
+	}
+
+	if application.LicenseTerms.BaseFee.IsPositive() {
+		payment, err := s.payRenewal(&application, req.PaymentMethod)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &application, payment, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var locked models.LicenseApplication
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("LicenseTerms").
+			First(&locked, applicationID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if locked.Status != models.ApplicationStatusApproved && !locked.InRenewalGrace(time.Now()) {
+			return errors.New("only active licenses can be renewed")
+		}
+		return s.extendLicense(tx, &locked)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.db.Preload("IPAsset").Preload("Applicant").Preload("LicenseTerms").First(&application, applicationID)
+
+	go s.sendRenewalNotification(&application)
+
+	return &application, nil, nil
+}
+
+// payRenewal opens the payment of a renewal fee, reopening one that is still
+// pending
+func (s *LicenseService) payRenewal(application *models.LicenseApplication, paymentMethod string) (*PaymentIntentResponse, error) {
+	if s.paymentService == nil {
+		return nil, errors.New("payments are not configured")
+	}
+
+	var pending models.Transaction
+	err := s.db.Where("license_id = ? AND transaction_type = ? AND status = ? AND revenue_shares->>'renewal' = 'true'",
+		application.ID, models.TransactionTypeLicenseFee, models.TransactionStatusPending).
+		First(&pending).Error
+	if err == nil {
+		return s.paymentService.CreatePaymentIntent(application.ApplicantID, &CreatePaymentIntentRequest{
+			TransactionID: pending.ID,
+			PaymentMethod: paymentMethod,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if paymentMethod == "" {
+		paymentMethod = "card"
+	}
+	if _, err := s.paymentService.Provider(paymentMethod); err != nil {
+		return nil, err
+	}
+
+	transaction := NewLicenseFeeTransaction(application, &application.LicenseTerms, application.IPAsset.CreatorID, paymentMethod)
+	transaction.RevenueShares["renewal"] = true
+	if err := s.db.Create(transaction).Error; err != nil {
+		return nil, fmt.Errorf("failed to create license fee transaction: %w", err)
+	}
+
+	return s.paymentService.CreateTransactionIntent(transaction)
+}
+
+// isRenewal reports whether a license_fee transaction pays for a renewal
+func isRenewal(transaction *models.Transaction) bool {
+	renewal, _ := transaction.RevenueShares["renewal"].(bool)
+	return renewal
+}
+
+// extendLicense extends a locked, approved license by its terms' duration
+// from its current expiry, or from now if that has passed. An expired license
+// is approved again and the chains revoked when it expired are restored.
+func (s *LicenseService) extendLicense(tx *gorm.DB, application *models.LicenseApplication) error {
+	expired := application.Status == models.ApplicationStatusExpired
+	if (application.Status != models.ApplicationStatusApproved && !expired) || application.ExpiresAt == nil {
+		return fmt.Errorf("license is %s and cannot be renewed", application.Status)
+	}
+
+	duration, err := models.ParseLicenseDuration(application.LicenseTerms.Duration)
+	if err != nil {
+		return err
+	}
+	if duration.IsPerpetual() {
+		return errors.New("perpetual licenses do not need renewal")
+	}
+
+	now := time.Now()
+	from := *application.ExpiresAt
+	if from.Before(now) {
+		from = now
+	}
+
+	application.ExpiresAt = duration.ExpiresAt(from)
+	application.RenewedAt = &now
+	application.RenewalCount++
+	application.ExpiryReminderDays = 0
+
+	updates := map[string]interface{}{
+		"expires_at":           application.ExpiresAt,
+		"renewed_at":           now,
+		"renewal_count":        application.RenewalCount,
+		"expiry_reminder_days": 0,
+	}
+	if expired {
+		application.Status = models.ApplicationStatusApproved
+		application.IsActive = true
+		updates["status"] = application.Status
+		updates["is_active"] = true
+	}
+
+	if err := tx.Model(application).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to renew license: %w", err)
+	}
+
+	if !expired || s.authorizationService == nil {
+		return nil
+	}
+	_, err = s.authorizationService.RestoreLicenseChains(tx, application.ID, licenseExpiredReason)
+	return err
+}
+
+// ExpireLicenses ends approved licenses whose term is over and deactivates
+// the authorization chains of every product depending on them. It returns
+// the number of licenses expired.
+func (s *LicenseService) ExpireLicenses() (int, error) {
+	var licenseIDs []uuid.UUID
+	if err := s.db.Model(&models.LicenseApplication{}).
+		Where("status = ? AND expires_at <= ?", models.ApplicationStatusApproved, time.Now()).
+		Limit(500).
+		Pluck("id", &licenseIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired licenses: %w", err)
+	}
+
+	expired := 0
+	for _, licenseID := range licenseIDs {
+		ok, err := s.expireLicense(licenseID)
+		if err != nil {
+			log.Printf("Failed to expire license %s: %v", licenseID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		s.sendExpiredNotification(licenseID)
+		expired++
+	}
+
+	return expired, nil
+}
+
+// expireLicense expires a license whose term is over together with the
+// authorization chains issued under it, so a failure leaves both for the
+// next run. It reports false if the license was renewed or revoked since it
+// was found.
+func (s *LicenseService) expireLicense(licenseID uuid.UUID) (bool, error) {
+	var expired bool
+	var revoked []models.AuthorizationChain
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.LicenseApplication{}).
+			Where("id = ? AND status = ? AND expires_at <= ?", licenseID, models.ApplicationStatusApproved, time.Now()).
+			Updates(map[string]interface{}{
+				"status":    models.ApplicationStatusExpired,
+				"is_active": false,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to expire license: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		expired = true
+
+		if s.authorizationService == nil {
+			return nil
+		}
+		var err error
+		revoked, err = s.authorizationService.RevokeLicenseChains(tx, licenseID, uuid.Nil, licenseExpiredReason)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if len(revoked) > 0 {
+		go s.authorizationService.NotifyRevokedChains(revoked, licenseExpiredReason)
+	}
+
+	return expired, nil
+}
+
+// CancelUnpaidLicenses cancels licenses whose fee is still unpaid when their
+// payment window closes, so they stop counting against the terms' license
+// limit, and fails their pending fee payments. A payment that succeeds
+// afterwards is refunded. It returns the number of licenses cancelled.
+func (s *LicenseService) CancelUnpaidLicenses() (int, error) {
+	var licenseIDs []uuid.UUID
+	if err := s.db.Model(&models.LicenseApplication{}).
+		Where("status = ? AND approved_at <= ?", models.ApplicationStatusAwaitingPayment, time.Now().Add(-models.LicensePaymentWindow)).
+		Limit(500).
+		Pluck("id", &licenseIDs).Error; err != nil {
+		return 0, fmt.Errorf("failed to find unpaid licenses: %w", err)
+	}
+
+	cancelled := 0
+	for _, licenseID := range licenseIDs {
+		ok, err := s.cancelUnpaidLicense(licenseID)
+		if err != nil {
+			log.Printf("Failed to cancel unpaid license %s: %v", licenseID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		s.sendCancelledNotification(licenseID)
+		cancelled++
+	}
+
+	return cancelled, nil
+}
+
+// cancelUnpaidLicense cancels a license that is still awaiting payment,
+// together with its pending fee payments. It reports false if the license
+// was paid for or otherwise settled meanwhile.
+func (s *LicenseService) cancelUnpaidLicense(licenseID uuid.UUID) (bool, error) {
+	cancelled := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the fee payments before the license, in the order a payment
+		// completing at the same time takes them
+		var feeIDs []uuid.UUID
+		if err := tx.Model(&models.Transaction{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("license_id = ? AND transaction_type = ? AND status = ?",
+				licenseID, models.TransactionTypeLicenseFee, models.TransactionStatusPending).
+			Pluck("id", &feeIDs).Error; err != nil {
+			return fmt.Errorf("failed to lock license fees: %w", err)
+		}
+
+		result := tx.Model(&models.LicenseApplication{}).
+			Where("id = ? AND status = ?", licenseID, models.ApplicationStatusAwaitingPayment).
+			Updates(map[string]interface{}{
+				"status":    models.ApplicationStatusCancelled,
+				"is_active": false,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to cancel license: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		cancelled = true
+
+		if len(feeIDs) == 0 {
+			return nil
+		}
+		if err := tx.Model(&models.Transaction{}).Where("id IN ?", feeIDs).
+			Update("status", models.TransactionStatusFailed).Error; err != nil {
+			return fmt.Errorf("failed to fail license fees: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return cancelled, nil
+}
+
+// SendExpiryReminders reminds licensees to renew licenses that expire within
+// 30 days, and again within 7 days. Each reminder is sent once per term. It
+// returns the number of reminders sent.
+func (s *LicenseService) SendExpiryReminders() (int, error) {
+	sent := 0
+	now := time.Now()
+	for _, days := range licenseExpiryReminderDays {
+		var licenseIDs []uuid.UUID
+		if err := s.db.Model(&models.LicenseApplication{}).
+			Where("status = ? AND expires_at > ? AND expires_at <= ?",
+				models.ApplicationStatusApproved, now, now.AddDate(0, 0, days)).
+			Where("expiry_reminder_days = 0 OR expiry_reminder_days > ?", days).
+			Limit(500).
+			Pluck("id", &licenseIDs).Error; err != nil {
+			return sent, fmt.Errorf("failed to find licenses to remind: %w", err)
+		}
+
+		for _, licenseID := range licenseIDs {
+			// Claim the reminder so it is sent once
+			result := s.db.Model(&models.LicenseApplication{}).
+				Where("id = ? AND (expiry_reminder_days = 0 OR expiry_reminder_days > ?)", licenseID, days).
+				UpdateColumn("expiry_reminder_days", days)
+			if result.Error != nil {
+				log.Printf("Failed to record expiry reminder of license %s: %v", licenseID, result.Error)
+				continue
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			s.sendExpiryReminder(licenseID, days)
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// StartExpiryScheduler expires due licenses, cancels unpaid ones and sends
+// expiry reminders every hour until ctx is done
+func (s *LicenseService) StartExpiryScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireLicenses(); err != nil {
+				log.Printf("License expiry run failed: %v", err)
+			}
+			if _, err := s.CancelUnpaidLicenses(); err != nil {
+				log.Printf("Unpaid license run failed: %v", err)
+			}
+			if _, err := s.SendExpiryReminders(); err != nil {
+				log.Printf("License expiry reminders failed: %v", err)
+			}
+		}
+	}
+}
+
+func (s *LicenseService) sendExpiryReminder(licenseID uuid.UUID, days int) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("Applicant").First(&application, licenseID).Error; err != nil {
+		log.Printf("Failed to load license %s for expiry reminder: %v", licenseID, err)
+		return
+	}
+
+	s.notificationService.SendLicenseExpiryReminderNotification(&application, days)
+}
+
+func (s *LicenseService) sendExpiredNotification(licenseID uuid.UUID) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("Applicant").First(&application, licenseID).Error; err != nil {
+		log.Printf("Failed to load license %s for expiry notification: %v", licenseID, err)
+		return
+	}
+
+	s.notificationService.SendLicenseExpiredNotification(&application)
+}
+
+func (s *LicenseService) sendCancelledNotification(licenseID uuid.UUID) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("Applicant").First(&application, licenseID).Error; err != nil {
+		log.Printf("Failed to load license %s for cancellation notification: %v", licenseID, err)
+		return
+	}
+
+	s.notificationService.SendLicenseCancelledNotification(&application)
+}
+
+func (s *LicenseService) sendRenewalNotification(application *models.LicenseApplication) {
+	if s.notificationService != nil {
+		s.notificationService.SendLicenseRenewedNotification(application)
+	}
+}
@@ -4,25 +4,40 @@ package services
 import (
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/javajoker/imi-backend/internal/models"
 	"github.com/javajoker/imi-backend/internal/utils"
 )
 
 type LicenseService struct {
-	db                  *gorm.DB
-	notificationService *NotificationService
+	db                   *gorm.DB
+	notificationService  *NotificationService
+	blockchainService    *BlockchainService
+	authorizationService *AuthorizationService
+	paymentService       *PaymentService
+	storageService       *StorageService
 }
 
+// ApplyLicenseRequest applies for a license. PaymentMethod is how the license
+// fee will be paid, if the terms have one; it defaults to card.
 type ApplyLicenseRequest struct {
 	IPAssetID       uuid.UUID              `json:"ip_asset_id" validate:"required"`
 	LicenseTermsID  uuid.UUID              `json:"license_terms_id" validate:"required"`
 	ApplicationData map[string]interface{} `json:"application_data,omitempty"`
 	Message         string                 `json:"message,omitempty"`
+	PaymentMethod   string                 `json:"payment_method,omitempty"`
+}
+
+// PayLicenseFeeRequest pays the fee of an approved license. PaymentMethod
+// switches the payment to another provider.
+type PayLicenseFeeRequest struct {
+	PaymentMethod string `json:"payment_method,omitempty"`
 }
 
 type ApproveLicenseRequest struct {
@@ -48,50 +63,57 @@ type LicenseSearchParams struct {
 	LicenseType *models.LicenseType       `json:"license_type,omitempty"`
 }
 
-func NewLicenseService(db *gorm.DB, notificationService *NotificationService) *LicenseService {
+func NewLicenseService(db *gorm.DB, notificationService *NotificationService, blockchainService *BlockchainService, authorizationService *AuthorizationService, paymentService *PaymentService, storageService *StorageService) *LicenseService {
 	return &LicenseService{
-		db:                  db,
-		notificationService: notificationService,
+		db:                   db,
+		notificationService:  notificationService,
+		blockchainService:    blockchainService,
+		authorizationService: authorizationService,
+		paymentService:       paymentService,
+		storageService:       storageService,
 	}
 }
 
-func (s *LicenseService) ApplyForLicense(applicantID uuid.UUID, req *ApplyLicenseRequest) (*models.LicenseApplication, error) {
+// ApplyForLicense applies for a license. Terms that auto-approve grant it at
+// once; when they carry a fee, the license waits for payment instead and the
+// payment to open is returned with the application.
+func (s *LicenseService) ApplyForLicense(applicantID uuid.UUID, req *ApplyLicenseRequest) (*models.LicenseApplication, *PaymentIntentResponse, error) {
 	// Validate request
 	if err := utils.ValidateStruct(req); err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+		return nil, nil, fmt.Errorf("validation failed: %w", err)
 	}
 
 	// Verify applicant exists and is eligible
 	var applicant models.User
 	if err := s.db.First(&applicant, applicantID).Error; err != nil {
-		return nil, fmt.Errorf("applicant not found: %w", err)
+		return nil, nil, fmt.Errorf("applicant not found: %w", err)
 	}
 
 	if applicant.Status != models.UserStatusActive {
-		return nil, errors.New("applicant account is not active")
+		return nil, nil, errors.New("applicant account is not active")
 	}
 
 	if applicant.UserType != models.UserTypeSecondaryCreator && applicant.UserType != models.UserTypeCreator {
-		return nil, errors.New("only secondary creators and creators can apply for licenses")
+		return nil, nil, errors.New("only secondary creators and creators can apply for licenses")
 	}
 
 	// Get IP asset and license terms
 	var ipAsset models.IPAsset
 	if err := s.db.Preload("Creator").First(&ipAsset, req.IPAssetID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("IP asset not found")
+			return nil, nil, errors.New("IP asset not found")
 		}
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, nil, fmt.Errorf("database error: %w", err)
 	}
 
 	// Check if IP asset is approved
 	if ipAsset.VerificationStatus != models.VerificationStatusApproved {
-		return nil, errors.New("IP asset is not approved for licensing")
+		return nil, nil, errors.New("IP asset is not approved for licensing")
 	}
 
 	// Check if applicant is trying to license their own IP
 	if ipAsset.CreatorID == applicantID {
-		return nil, errors.New("cannot apply for license on your own IP asset")
+		return nil, nil, errors.New("cannot apply for license on your own IP asset")
 	}
 
 	// Get license terms
@@ -99,34 +121,30 @@ func (s *LicenseService) ApplyForLicense(applicantID uuid.UUID, req *ApplyLicens
 	if err := s.db.Where("id = ? AND ip_asset_id = ? AND is_active = ?",
 		req.LicenseTermsID, req.IPAssetID, true).First(&licenseTerms).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("license terms not found or inactive")
+			return nil, nil, errors.New("license terms not found or inactive")
 		}
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, nil, fmt.Errorf("database error: %w", err)
 	}
 
 	// Check if applicant already has an active or pending application
 	var existingApp models.LicenseApplication
-	if err := s.db.Where("ip_asset_id = ? AND applicant_id = ? AND status IN (?, ?)",
-		req.IPAssetID, applicantID, models.ApplicationStatusPending, models.ApplicationStatusApproved).
+	if err := s.db.Where("ip_asset_id = ? AND applicant_id = ? AND status IN ?",
+		req.IPAssetID, applicantID, []models.ApplicationStatus{
+			models.ApplicationStatusPending, models.ApplicationStatusAwaitingPayment, models.ApplicationStatusApproved,
+		}).
 		First(&existingApp).Error; err == nil {
-		if existingApp.Status == models.ApplicationStatusApproved {
-			return nil, errors.New("you already have an approved license for this IP asset")
+		switch existingApp.Status {
+		case models.ApplicationStatusApproved:
+			return nil, nil, errors.New("you already have an approved license for this IP asset")
+		case models.ApplicationStatusAwaitingPayment:
+			return nil, nil, errors.New("you already have a license awaiting payment for this IP asset")
 		}
-		return nil, errors.New("you already have a pending application for this IP asset")
+		return nil, nil, errors.New("you already have a pending application for this IP asset")
 	}
 
 	// Check license limit
-	if licenseTerms.MaxLicenses > 0 {
-		var approvedCount int64
-		if err := s.db.Model(&models.LicenseApplication{}).
-			Where("license_terms_id = ? AND status = ?", req.LicenseTermsID, models.ApplicationStatusApproved).
-			Count(&approvedCount).Error; err != nil {
-			return nil, fmt.Errorf("failed to check license count: %w", err)
-		}
-
-		if approvedCount >= int64(licenseTerms.MaxLicenses) {
-			return nil, errors.New("license limit reached for this license terms")
-		}
+	if err := s.checkLicenseLimit(&licenseTerms, uuid.Nil); err != nil {
+		return nil, nil, err
 	}
 
 	// Prepare application data
@@ -137,38 +155,79 @@ func (s *LicenseService) ApplyForLicense(applicantID uuid.UUID, req *ApplyLicens
 	if req.Message != "" {
 		applicationData["message"] = req.Message
 	}
+	if req.PaymentMethod != "" {
+		applicationData["payment_method"] = req.PaymentMethod
+	}
 	applicationData["applied_at"] = time.Now()
 
+	paymentMethod := req.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = "card"
+	}
+
 	// Create license application
 	application := &models.LicenseApplication{
-		IPAssetID:       req.IPAssetID,
-		ApplicantID:     applicantID,
-		LicenseTermsID:  req.LicenseTermsID,
-		ApplicationData: models.JSONB(applicationData),
-		Status:          models.ApplicationStatusPending,
-		IsActive:        true,
-	}
+		BaseModel:         models.BaseModel{ID: uuid.New()},
+		IPAssetID:         req.IPAssetID,
+		ApplicantID:       applicantID,
+		LicenseTermsID:    req.LicenseTermsID,
+		ApplicationData:   models.JSONB(applicationData),
+		Status:            models.ApplicationStatusPending,
+		IsActive:          true,
+		AgreementRequired: true,
+	}
+
+	var feeTransaction *models.Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Auto-approve if enabled
+		if licenseTerms.AutoApprove {
+			var err error
+			// Auto-approved by system
+			feeTransaction, err = s.approve(application, &licenseTerms, ipAsset.CreatorID, ipAsset.CreatorID, paymentMethod)
+			if err != nil {
+				return err
+			}
+		}
 
-	// Auto-approve if enabled
-	if licenseTerms.AutoApprove {
-		application.Status = models.ApplicationStatusApproved
-		now := time.Now()
-		application.ApprovedAt = &now
-		application.ApprovedBy = &ipAsset.CreatorID // Auto-approved by system
-	}
+		// Save application
+		if err := tx.Create(application).Error; err != nil {
+			return fmt.Errorf("failed to create license application: %w", err)
+		}
+
+		if feeTransaction != nil {
+			if err := tx.Create(feeTransaction).Error; err != nil {
+				return fmt.Errorf("failed to create license fee transaction: %w", err)
+			}
+			return nil
+		}
 
-	// Save application
-	if err := s.db.Create(application).Error; err != nil {
-		return nil, fmt.Errorf("failed to create license application: %w", err)
+		// Record the license grant on the provenance ledger
+		if application.Status == models.ApplicationStatusApproved {
+			return s.recordLicenseGrant(tx, application)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Load relationships
 	s.db.Preload("IPAsset").Preload("Applicant").Preload("LicenseTerms").First(application, application.ID)
 
+	if feeTransaction != nil {
+		go s.sendPaymentDueNotification(application, feeTransaction)
+
+		payment, err := s.paymentService.CreateTransactionIntent(feeTransaction)
+		if err != nil {
+			log.Printf("Failed to open license fee payment for %s: %v", application.ID, err)
+		}
+		return application, payment, nil
+	}
+
 	// Send notifications
 	go s.sendApplicationNotifications(application, licenseTerms.AutoApprove)
 
-	return application, nil
+	return application, nil, nil
 }
 
 func (s *LicenseService) ApproveLicense(applicationID uuid.UUID, approverID uuid.UUID, req *ApproveLicenseRequest) (*models.LicenseApplication, error) {
@@ -199,43 +258,275 @@ func (s *LicenseService) ApproveLicense(applicationID uuid.UUID, approverID uuid
 	}
 
 	// Check license limit
-	if application.LicenseTerms.MaxLicenses > 0 {
-		var approvedCount int64
-		if err := s.db.Model(&models.LicenseApplication{}).
-			Where("license_terms_id = ? AND status = ? AND id != ?",
-				application.LicenseTermsID, models.ApplicationStatusApproved, applicationID).
-			Count(&approvedCount).Error; err != nil {
-			return nil, fmt.Errorf("failed to check license count: %w", err)
+	if err := s.checkLicenseLimit(&application.LicenseTerms, applicationID); err != nil {
+		return nil, err
+	}
+
+	paymentMethod, _ := application.ApplicationData["payment_method"].(string)
+	if paymentMethod == "" {
+		paymentMethod = "card"
+	}
+
+	// Update application
+	var feeTransaction *models.Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		feeTransaction, err = s.approve(&application, &application.LicenseTerms, application.IPAsset.CreatorID, approverID, paymentMethod)
+		if err != nil {
+			return err
 		}
 
-		if approvedCount >= int64(application.LicenseTerms.MaxLicenses) {
-			return nil, errors.New("license limit reached")
+		// Update application data with approval message
+		if req.Message != "" {
+			if application.ApplicationData == nil {
+				application.ApplicationData = make(models.JSONB)
+			}
+			application.ApplicationData["approval_message"] = req.Message
+			application.ApplicationData["approved_at"] = application.ApprovedAt
 		}
+
+		if err := tx.Save(&application).Error; err != nil {
+			return fmt.Errorf("failed to update license application: %w", err)
+		}
+
+		if feeTransaction != nil {
+			if err := tx.Create(feeTransaction).Error; err != nil {
+				return fmt.Errorf("failed to create license fee transaction: %w", err)
+			}
+			return nil
+		}
+
+		// Record the license grant on the provenance ledger
+		return s.recordLicenseGrant(tx, &application)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The applicant pays before the license is granted
+	if feeTransaction != nil {
+		if _, err := s.paymentService.CreateTransactionIntent(feeTransaction); err != nil {
+			log.Printf("Failed to open license fee payment for %s: %v", application.ID, err)
+		}
+		go s.sendPaymentDueNotification(&application, feeTransaction)
+		return &application, nil
+	}
+
+	// Send notification to applicant
+	go s.sendApprovalNotification(&application)
+
+	return &application, nil
+}
+
+// checkLicenseLimit fails when the terms' licenses are all taken. Licenses
+// awaiting payment hold their place. excludeID leaves out the application
+// being approved.
+func (s *LicenseService) checkLicenseLimit(terms *models.LicenseTerms, excludeID uuid.UUID) error {
+	if terms.MaxLicenses <= 0 {
+		return nil
+	}
+
+	var grantedCount int64
+	if err := s.db.Model(&models.LicenseApplication{}).
+		Where("license_terms_id = ? AND status IN ? AND id != ?", terms.ID,
+			[]models.ApplicationStatus{models.ApplicationStatusApproved, models.ApplicationStatusAwaitingPayment}, excludeID).
+		Count(&grantedCount).Error; err != nil {
+		return fmt.Errorf("failed to check license count: %w", err)
+	}
+
+	if grantedCount >= int64(terms.MaxLicenses) {
+		return errors.New("license limit reached for this license terms")
+	}
+	return nil
+}
+
+// approve approves an application, which runs for the terms' duration from
+// now. A license with a fee is not granted yet: it waits for payment, and
+// the license_fee transaction that charges the applicant is returned for the
+// caller to save.
+func (s *LicenseService) approve(application *models.LicenseApplication, terms *models.LicenseTerms, creatorID, approverID uuid.UUID, paymentMethod string) (*models.Transaction, error) {
+	duration, err := models.ParseLicenseDuration(terms.Duration)
+	if err != nil {
+		return nil, err
 	}
 
-	// Update application
 	now := time.Now()
-	application.Status = models.ApplicationStatusApproved
 	application.ApprovedAt = &now
 	application.ApprovedBy = &approverID
 
-	// Update application data with approval message
-	if req.Message != "" {
-		if application.ApplicationData == nil {
-			application.ApplicationData = make(models.JSONB)
+	if !terms.BaseFee.IsPositive() {
+		application.Status = models.ApplicationStatusApproved
+		application.ExpiresAt = duration.ExpiresAt(now)
+		return nil, nil
+	}
+
+	if s.paymentService == nil {
+		return nil, errors.New("payments are not configured")
+	}
+
+	application.Status = models.ApplicationStatusAwaitingPayment
+	return NewLicenseFeeTransaction(application, terms, creatorID, paymentMethod), nil
+}
+
+// NewLicenseFeeTransaction charges the applicant the license's base fee. The
+// IP creator is its seller, so once paid the creator is credited the fee
+// minus the platform fee.
+func NewLicenseFeeTransaction(application *models.LicenseApplication, terms *models.LicenseTerms, creatorID uuid.UUID, paymentMethod string) *models.Transaction {
+	amount := terms.BaseFeeMoney()
+	fee := platformFee(amount)
+
+	return &models.Transaction{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		TransactionType: models.TransactionTypeLicenseFee,
+		BuyerID:         &application.ApplicantID,
+		SellerID:        creatorID,
+		LicenseID:       &application.ID,
+		Quantity:        1,
+		Amount:          amount.Amount,
+		PlatformFee:     fee.Amount,
+		Currency:        amount.Currency,
+		RevenueShares: models.JSONB{
+			"total_amount":     amount.Amount,
+			"platform_fee":     fee.Amount,
+			"currency":         amount.Currency,
+			"license_id":       application.ID,
+			"license_terms_id": terms.ID,
+			"ip_asset_id":      application.IPAssetID,
+			"shares":           []RevenueShare{},
+		},
+		PaymentMethod: paymentMethod,
+		Status:        models.TransactionStatusPending,
+	}
+}
+
+// PayLicenseFee opens the payment of a license awaiting its fee, such as
+// when the applicant did not pay right away. A payment that failed is
+// replaced by a new one.
+func (s *LicenseService) PayLicenseFee(applicationID, applicantID uuid.UUID, req *PayLicenseFeeRequest) (*PaymentIntentResponse, error) {
+	if s.paymentService == nil {
+		return nil, errors.New("payments are not configured")
+	}
+
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("LicenseTerms").First(&application, applicationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("license application not found")
 		}
-		application.ApplicationData["approval_message"] = req.Message
-		application.ApplicationData["approved_at"] = now
+		return nil, fmt.Errorf("database error: %w", err)
 	}
 
-	if err := s.db.Save(&application).Error; err != nil {
-		return nil, fmt.Errorf("failed to update license application: %w", err)
+	if application.ApplicantID != applicantID {
+		return nil, errors.New("unauthorized to pay for this license")
+	}
+	if application.Status != models.ApplicationStatusAwaitingPayment {
+		return nil, errors.New("license is not awaiting payment")
 	}
 
-	// Send notification to applicant
-	go s.sendApprovalNotification(&application)
+	var pending models.Transaction
+	err := s.db.Where("license_id = ? AND transaction_type = ? AND status = ?",
+		applicationID, models.TransactionTypeLicenseFee, models.TransactionStatusPending).
+		First(&pending).Error
+	if err == nil {
+		return s.paymentService.CreatePaymentIntent(applicantID, &CreatePaymentIntentRequest{
+			TransactionID: pending.ID,
+			PaymentMethod: req.PaymentMethod,
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
 
-	return &application, nil
+	paymentMethod := req.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = "card"
+	}
+	if _, err := s.paymentService.Provider(paymentMethod); err != nil {
+		return nil, err
+	}
+
+	transaction := NewLicenseFeeTransaction(&application, &application.LicenseTerms, application.IPAsset.CreatorID, paymentMethod)
+	if err := s.db.Create(transaction).Error; err != nil {
+		return nil, fmt.Errorf("failed to create license fee transaction: %w", err)
+	}
+
+	return s.paymentService.CreateTransactionIntent(transaction)
+}
+
+// activatePaidLicense grants the license a completed license_fee transaction
+// paid for, in the same database transaction, running for the terms'
+// duration from now. A paid renewal extends the license instead. A fee paid
+// for a license that is no longer waiting for it, such as one rejected,
+// revoked or cancelled for non-payment meanwhile, is queued for refund.
+func (s *LicenseService) activatePaidLicense(tx *gorm.DB, transaction *models.Transaction) error {
+	if transaction.LicenseID == nil {
+		return errors.New("license fee does not name its license")
+	}
+
+	var application models.LicenseApplication
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("LicenseTerms").
+		First(&application, *transaction.LicenseID).Error; err != nil {
+		return fmt.Errorf("license not found: %w", err)
+	}
+
+	if isRenewal(transaction) {
+		if (application.Status != models.ApplicationStatusApproved && !application.InRenewalGrace(time.Now())) ||
+			application.ExpiresAt == nil {
+			return s.paymentService.queueRefund(tx, transaction,
+				fmt.Sprintf("Renewal paid for a license that is %s", application.Status))
+		}
+		return s.extendLicense(tx, &application)
+	}
+
+	if application.Status != models.ApplicationStatusAwaitingPayment {
+		return s.paymentService.queueRefund(tx, transaction,
+			fmt.Sprintf("License fee paid for a license that is %s", application.Status))
+	}
+
+	duration, err := models.ParseLicenseDuration(application.LicenseTerms.Duration)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&application).Updates(map[string]interface{}{
+		"status":     models.ApplicationStatusApproved,
+		"expires_at": duration.ExpiresAt(time.Now()),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to activate license: %w", err)
+	}
+
+	// Record the license grant on the provenance ledger
+	return s.recordLicenseGrant(tx, &application)
+}
+
+// licenseFeePaid tells the applicant about a license granted by its payment,
+// once the payment has committed
+func (s *LicenseService) licenseFeePaid(transaction *models.Transaction) {
+	var application models.LicenseApplication
+	if err := s.db.Preload("IPAsset").Preload("Applicant").Preload("LicenseTerms").
+		First(&application, *transaction.LicenseID).Error; err != nil {
+		log.Printf("Failed to load paid license %s: %v", *transaction.LicenseID, err)
+		return
+	}
+	if application.Status != models.ApplicationStatusApproved {
+		return
+	}
+
+	// A fee queued for refund granted nothing
+	var refunds int64
+	if err := s.db.Model(&models.Refund{}).Where("transaction_id = ?", transaction.ID).Count(&refunds).Error; err != nil {
+		log.Printf("Failed to check refunds of license fee %s: %v", transaction.ID, err)
+		return
+	}
+	if refunds > 0 {
+		return
+	}
+
+	if isRenewal(transaction) {
+		s.sendRenewalNotification(&application)
+		return
+	}
+
+	s.sendApprovalNotification(&application)
 }
 
 func (s *LicenseService) RejectLicense(applicationID uuid.UUID, rejecterID uuid.UUID, req *RejectLicenseRequest) (*models.LicenseApplication, error) {
@@ -320,39 +611,54 @@ func (s *LicenseService) RevokeLicense(applicationID uuid.UUID, revokerID uuid.U
 		}
 	}
 
-	// Check if license is approved
-	if application.Status != models.ApplicationStatusApproved {
-		return nil, errors.New("can only revoke approved licenses")
-	}
+	// The license and the authorization chains of every product depending
+	// on it are revoked together
+	var revoked []models.AuthorizationChain
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("status", "application_data").First(&application, applicationID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
 
-	// Check if there are active products using this license
-	var productCount int64
-	if err := s.db.Model(&models.Product{}).
-		Where("license_id = ? AND status IN (?, ?)",
-			applicationID, models.ProductStatusActive, models.ProductStatusDraft).
-		Count(&productCount).Error; err != nil {
-		return nil, fmt.Errorf("failed to check active products: %w", err)
-	}
+		// Check if license is approved
+		if application.Status != models.ApplicationStatusApproved {
+			return errors.New("can only revoke approved licenses")
+		}
 
-	if productCount > 0 {
-		return nil, errors.New("cannot revoke license with active products")
-	}
+		// Update application
+		application.Status = models.ApplicationStatusRevoked
+		application.IsActive = false
 
-	// Update application
-	application.Status = models.ApplicationStatusRevoked
-	application.IsActive = false
+		// Update application data with revocation details
+		if application.ApplicationData == nil {
+			application.ApplicationData = make(models.JSONB)
+		}
+		application.ApplicationData["revocation_reason"] = req.Reason
+		application.ApplicationData["revocation_message"] = req.Message
+		application.ApplicationData["revoked_at"] = time.Now()
+		application.ApplicationData["revoked_by"] = revokerID
+
+		if err := tx.Model(&application).Updates(map[string]interface{}{
+			"status":           application.Status,
+			"is_active":        false,
+			"application_data": application.ApplicationData,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update license application: %w", err)
+		}
 
-	// Update application data with revocation details
-	if application.ApplicationData == nil {
-		application.ApplicationData = make(models.JSONB)
+		if s.authorizationService == nil {
+			return nil
+		}
+		var err error
+		revoked, err = s.authorizationService.RevokeLicenseChains(tx, application.ID, revokerID, req.Reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	application.ApplicationData["revocation_reason"] = req.Reason
-	application.ApplicationData["revocation_message"] = req.Message
-	application.ApplicationData["revoked_at"] = time.Now()
-	application.ApplicationData["revoked_by"] = revokerID
 
-	if err := s.db.Save(&application).Error; err != nil {
-		return nil, fmt.Errorf("failed to update license application: %w", err)
+	if len(revoked) > 0 {
+		go s.authorizationService.NotifyRevokedChains(revoked, req.Reason)
 	}
 
 	// Send notification to licensee
@@ -364,7 +670,7 @@ func (s *LicenseService) RevokeLicense(applicationID uuid.UUID, revokerID uuid.U
 func (s *LicenseService) GetLicenseApplication(id uuid.UUID, userID uuid.UUID) (*models.LicenseApplication, error) {
 	var application models.LicenseApplication
 	if err := s.db.Preload("IPAsset").Preload("IPAsset.Creator").Preload("Applicant").
-		Preload("LicenseTerms").Preload("Approver").
+		Preload("LicenseTerms").Preload("Approver").Preload("Agreement").
 		First(&application, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("license application not found")
@@ -495,6 +801,25 @@ func (s *LicenseService) VerifyLicense(licenseID uuid.UUID) (*models.LicenseAppl
 	return &license, nil
 }
 
+// recordLicenseGrant records a granted license on the provenance ledger in
+// tx, so a license is never granted without its record
+func (s *LicenseService) recordLicenseGrant(tx *gorm.DB, application *models.LicenseApplication) error {
+	if s.blockchainService == nil {
+		return nil
+	}
+
+	hash, err := s.blockchainService.CreateLicenseRecord(tx, application.ID, application.IPAssetID, application.ApplicantID)
+	if err != nil {
+		return fmt.Errorf("failed to record license on the ledger: %w", err)
+	}
+
+	application.BlockchainHash = hash
+	if err := tx.Model(application).UpdateColumn("blockchain_hash", hash).Error; err != nil {
+		return fmt.Errorf("failed to update license application: %w", err)
+	}
+	return nil
+}
+
 // Notification methods
 
 func (s *LicenseService) sendApplicationNotifications(application *models.LicenseApplication, autoApproved bool) {
@@ -517,6 +842,12 @@ func (s *LicenseService) sendApprovalNotification(application *models.LicenseApp
 	}
 }
 
+func (s *LicenseService) sendPaymentDueNotification(application *models.LicenseApplication, transaction *models.Transaction) {
+	if s.notificationService != nil {
+		s.notificationService.SendLicensePaymentDueNotification(application, transaction)
+	}
+}
+
 func (s *LicenseService) sendRejectionNotification(application *models.LicenseApplication) {
 	if s.notificationService != nil {
 		s.notificationService.SendLicenseRejectedNotification(application)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/smtp"
+	"strings"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -132,6 +133,113 @@ func (s *NotificationService) SendLicenseApprovedNotification(application *model
 	return s.sendEmail(applicant.Email, subject, body)
 }
 
+// SendLicensePaymentDueNotification asks the applicant of an approved license
+// to pay its fee, which grants the license
+func (s *NotificationService) SendLicensePaymentDueNotification(application *models.LicenseApplication, transaction *models.Transaction) error {
+	applicant := application.Applicant
+
+	data := map[string]interface{}{
+		"ApplicantName": applicant.Username,
+		"IPAssetTitle":  application.IPAsset.Title,
+		"Amount":        transaction.Total().String(),
+		"DueBy":         "",
+		"LicenseURL":    fmt.Sprintf("%s/licenses/%s", s.config.Frontend.BaseURL, application.ID),
+	}
+	if due := application.PaymentDueBy(); due != nil {
+		data["DueBy"] = due.Format("January 2, 2006")
+	}
+
+	subject := "License Fee Due - " + application.IPAsset.Title
+	template := s.getEmailTemplate("license_payment_due")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(applicant.Email, subject, body)
+}
+
+// SendLicenseExpiryReminderNotification reminds a licensee that their
+// license expires in days days
+func (s *NotificationService) SendLicenseExpiryReminderNotification(application *models.LicenseApplication, days int) error {
+	applicant := application.Applicant
+
+	data := map[string]interface{}{
+		"ApplicantName": applicant.Username,
+		"IPAssetTitle":  application.IPAsset.Title,
+		"Days":          days,
+		"ExpiresAt":     application.ExpiresAt.Format("January 2, 2006"),
+		"LicenseURL":    fmt.Sprintf("%s/licenses/%s", s.config.Frontend.BaseURL, application.ID),
+	}
+
+	subject := fmt.Sprintf("License Expires in %d Days - %s", days, application.IPAsset.Title)
+	template := s.getEmailTemplate("license_expiry_reminder")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(applicant.Email, subject, body)
+}
+
+func (s *NotificationService) SendLicenseExpiredNotification(application *models.LicenseApplication) error {
+	applicant := application.Applicant
+
+	data := map[string]interface{}{
+		"ApplicantName": applicant.Username,
+		"IPAssetTitle":  application.IPAsset.Title,
+	}
+
+	subject := "License Expired - " + application.IPAsset.Title
+	template := s.getEmailTemplate("license_expired")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(applicant.Email, subject, body)
+}
+
+// SendLicenseCancelledNotification tells an applicant their approved
+// license was cancelled because its fee was not paid in time
+func (s *NotificationService) SendLicenseCancelledNotification(application *models.LicenseApplication) error {
+	applicant := application.Applicant
+
+	data := map[string]interface{}{
+		"ApplicantName": applicant.Username,
+		"IPAssetTitle":  application.IPAsset.Title,
+	}
+
+	subject := "License Cancelled - " + application.IPAsset.Title
+	template := s.getEmailTemplate("license_cancelled")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(applicant.Email, subject, body)
+}
+
+func (s *NotificationService) SendLicenseRenewedNotification(application *models.LicenseApplication) error {
+	applicant := application.Applicant
+
+	data := map[string]interface{}{
+		"ApplicantName": applicant.Username,
+		"IPAssetTitle":  application.IPAsset.Title,
+		"ExpiresAt":     application.ExpiresAt.Format("January 2, 2006"),
+		"LicenseURL":    fmt.Sprintf("%s/licenses/%s", s.config.Frontend.BaseURL, application.ID),
+	}
+
+	subject := "License Renewed - " + application.IPAsset.Title
+	template := s.getEmailTemplate("license_renewed")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(applicant.Email, subject, body)
+}
+
 func (s *NotificationService) SendLicenseRejectedNotification(application *models.LicenseApplication) error {
 	applicant := application.Applicant
 
@@ -176,13 +284,13 @@ func (s *NotificationService) SendPurchaseConfirmationNotification(transaction *
 
 	data := map[string]interface{}{
 		"BuyerName":       buyer.Username,
-		"ProductTitle":    transaction.Product.Title,
-		"Amount":          transaction.Amount,
+		"ProductTitle":    saleTitle(transaction),
+		"Amount":          transaction.Total().String(),
 		"TransactionID":   transaction.ID,
 		"OrderDetailsURL": fmt.Sprintf("%s/orders/%s", s.config.Frontend.BaseURL, transaction.ID),
 	}
 
-	subject := "Purchase Confirmation - " + transaction.Product.Title
+	subject := "Purchase Confirmation - " + saleTitle(transaction)
 	template := s.getEmailTemplate("purchase_confirmation")
 	body, err := s.renderTemplate(template.Body, data)
 	if err != nil {
@@ -197,13 +305,13 @@ func (s *NotificationService) SendSaleNotification(transaction *models.Transacti
 
 	data := map[string]interface{}{
 		"SellerName":    seller.Username,
-		"ProductTitle":  transaction.Product.Title,
-		"Amount":        transaction.Amount,
+		"ProductTitle":  saleTitle(transaction),
+		"Amount":        transaction.Total().String(),
 		"BuyerName":     transaction.Buyer.Username,
 		"TransactionID": transaction.ID,
 	}
 
-	subject := "Sale Notification - " + transaction.Product.Title
+	subject := "Sale Notification - " + saleTitle(transaction)
 	template := s.getEmailTemplate("sale_notification")
 	body, err := s.renderTemplate(template.Body, data)
 	if err != nil {
@@ -213,7 +321,199 @@ func (s *NotificationService) SendSaleNotification(transaction *models.Transacti
 	return s.sendEmail(seller.Email, subject, body)
 }
 
+// SendOrderConfirmationNotification confirms a paid multi-item order to its buyer
+func (s *NotificationService) SendOrderConfirmationNotification(order *models.Order) error {
+	buyer := order.Buyer
+	title := fmt.Sprintf("Order of %d items", len(order.Items))
+
+	data := map[string]interface{}{
+		"BuyerName":       buyer.Username,
+		"ProductTitle":    title,
+		"Amount":          order.Total().String(),
+		"TransactionID":   order.ID,
+		"OrderDetailsURL": fmt.Sprintf("%s/orders/%s", s.config.Frontend.BaseURL, order.ID),
+	}
+
+	subject := "Purchase Confirmation - " + title
+	template := s.getEmailTemplate("purchase_confirmation")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(buyer.Email, subject, body)
+}
+
+// saleTitle names what a sale was for. A seller's part of an order may
+// cover several products.
+func saleTitle(transaction *models.Transaction) string {
+	if transaction.Product != nil {
+		return transaction.Product.Title
+	}
+	return fmt.Sprintf("%d items", transaction.Quantity)
+}
+
+// SendRevenueShareNotifications tells each recipient about their share of a sale
+func (s *NotificationService) SendRevenueShareNotifications(shares []models.Transaction) {
+	for i := range shares {
+		var share models.Transaction
+		if err := s.db.Preload("Seller").Preload("Product").First(&share, shares[i].ID).Error; err != nil {
+			continue
+		}
+		s.SendRevenueShareNotification(&share)
+	}
+}
+
+func (s *NotificationService) SendRevenueShareNotification(share *models.Transaction) error {
+	recipient := share.Seller
+
+	productTitle := ""
+	if share.Product != nil {
+		productTitle = share.Product.Title
+	}
+
+	// Shares of a license fee are named after the licensed IP
+	ipAssetTitle := ""
+	if share.LicenseID != nil {
+		var license models.LicenseApplication
+		if err := s.db.Preload("IPAsset").First(&license, *share.LicenseID).Error; err == nil {
+			ipAssetTitle = license.IPAsset.Title
+			productTitle = ipAssetTitle
+		}
+	}
+
+	data := map[string]interface{}{
+		"RecipientName": recipient.Username,
+		"ProductTitle":  productTitle,
+		"IPAssetTitle":  ipAssetTitle,
+		"Amount":        share.Total().String(),
+		"TransactionID": share.ID,
+		"BalanceURL":    fmt.Sprintf("%s/dashboard/earnings", s.config.Frontend.BaseURL),
+	}
+
+	subject := "Revenue Share Received - " + productTitle
+	template := s.getEmailTemplate("revenue_share")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(recipient.Email, subject, body)
+}
+
+func (s *NotificationService) SendPayoutStatusNotification(payout *models.Payout) error {
+	user := payout.User
+
+	data := map[string]interface{}{
+		"Username": user.Username,
+		"Amount":   payout.Total().String(),
+		"Status":   payout.Status,
+		"Reason":   payout.FailureReason,
+	}
+
+	subject := fmt.Sprintf("Payout %s", payout.Status)
+	template := s.getEmailTemplate("payout_status")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(user.Email, subject, body)
+}
+
+func (s *NotificationService) SendAuthorizationRevokedNotification(product *models.Product, reason string) error {
+	creator := product.Creator
+
+	data := map[string]interface{}{
+		"CreatorName":  creator.Username,
+		"ProductTitle": product.Title,
+		"Reason":       reason,
+		"ProductURL":   fmt.Sprintf("%s/products/%s", s.config.Frontend.BaseURL, product.ID),
+	}
+
+	subject := "Product Authorization Revoked - " + product.Title
+	template := s.getEmailTemplate("authorization_revoked")
+	body, err := s.renderTemplate(template.Body, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	return s.sendEmail(creator.Email, subject, body)
+}
+
 // Admin notifications
+
+// SendSuspectedCounterfeitNotification flags a scan anomaly to admins, in tx
+// so the alert commits with the check that it is not a duplicate
+func (s *NotificationService) SendSuspectedCounterfeitNotification(tx *gorm.DB, anomaly *ScanAnomaly, resourceType string, resourceID uuid.UUID) error {
+	var product models.Product
+	if err := tx.First(&product, anomaly.ProductID).Error; err != nil {
+		return fmt.Errorf("product not found: %w", err)
+	}
+
+	notification := &models.AdminNotification{
+		Type:  models.AdminNotificationSuspectedCounterfeit,
+		Title: "Suspected Counterfeit",
+		Message: fmt.Sprintf("Verification code %s of product '%s' was %s in the last %s",
+			anomaly.VerificationCode, product.Title, strings.Join(anomaly.Reasons, " and "), anomaly.Window),
+		Priority:            "high",
+		RelatedResourceType: resourceType,
+		RelatedResourceID:   &resourceID,
+	}
+
+	if err := tx.Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return nil
+}
+
+// SendOversoldNotification flags a sale paid after its products sold out to
+// admins, in tx with the sale, so the order can be fulfilled or refunded
+func (s *NotificationService) SendOversoldNotification(tx *gorm.DB, transaction *models.Transaction, productIDs []uuid.UUID) error {
+	var titles []string
+	if err := tx.Model(&models.Product{}).Where("id IN ?", productIDs).Pluck("title", &titles).Error; err != nil {
+		return fmt.Errorf("failed to load products: %w", err)
+	}
+
+	notification := &models.AdminNotification{
+		Type:  models.AdminNotificationOversold,
+		Title: "Sale Paid Without Stock",
+		Message: fmt.Sprintf("Transaction %s was paid after '%s' sold out; restock or refund the buyer",
+			transaction.ID, strings.Join(titles, "', '")),
+		Priority:            "high",
+		RelatedResourceType: "transaction",
+		RelatedResourceID:   &transaction.ID,
+	}
+
+	if err := tx.Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return nil
+}
+
+// SendStalePayoutNotification flags a payout that has not settled by the
+// stale limit to admins, who check it with the provider and complete or
+// fail it by hand
+func (s *NotificationService) SendStalePayoutNotification(tx *gorm.DB, payout *models.Payout, problem string, staleHours int) error {
+	notification := &models.AdminNotification{
+		Type:  models.AdminNotificationStalePayout,
+		Title: "Payout Needs Review",
+		Message: fmt.Sprintf("Payout %s of %s %s after %d hours; check it with the provider before completing or failing it",
+			payout.ID, payout.Total(), problem, staleHours),
+		Priority:            "high",
+		RelatedResourceType: "payout",
+		RelatedResourceID:   &payout.ID,
+	}
+
+	if err := tx.Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return nil
+}
+
 func (s *NotificationService) SendUserStatusChangeNotification(user *models.User, oldStatus models.UserStatus, reason string) error {
 	data := map[string]interface{}{
 		"Username":  user.Username,
@@ -288,18 +588,20 @@ func (s *NotificationService) SendIPRejectionNotification(ipAsset *models.IPAsse
 	return s.sendEmail(creator.Email, subject, body)
 }
 
-func (s *NotificationService) SendRefundNotification(transaction *models.Transaction, reason string) error {
+// SendRefundNotification tells the buyer about one refund of a purchase,
+// which may be part of its amount
+func (s *NotificationService) SendRefundNotification(transaction *models.Transaction, refund *models.Refund) error {
 	buyer := transaction.Buyer
 
 	data := map[string]interface{}{
 		"BuyerName":     buyer.Username,
-		"ProductTitle":  transaction.Product.Title,
-		"Amount":        transaction.Amount,
-		"Reason":        reason,
+		"ProductTitle":  saleTitle(transaction),
+		"Amount":        models.NewMoney(refund.Amount, refund.Currency).String(),
+		"Reason":        refund.Reason,
 		"TransactionID": transaction.ID,
 	}
 
-	subject := "Refund Processed - " + transaction.Product.Title
+	subject := "Refund Processed - " + saleTitle(transaction)
 	template := s.getEmailTemplate("refund_notification")
 	body, err := s.renderTemplate(template.Body, data)
 	if err != nil {
@@ -382,6 +684,79 @@ func (s *NotificationService) getEmailTemplate(templateType string) EmailTemplat
 	<a href="{{.VerificationURL}}">Verify Email</a>
 	<p>Best regards,<br>{{.PlatformName}} Team</p>
 </body>
+</html>`,
+		},
+		"license_payment_due": {
+			Subject: "License Fee Due",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>License Fee Due</h2>
+	<p>Hello {{.ApplicantName}},</p>
+	<p>Your license application for "{{.IPAssetTitle}}" has been approved.</p>
+	<p>Pay the license fee of {{.Amount}} to activate your license.</p>
+	{{if .DueBy}}<p>Unless it is paid by {{.DueBy}}, the license will be cancelled.</p>{{end}}
+	<a href="{{.LicenseURL}}">Pay License Fee</a>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"license_expiry_reminder": {
+			Subject: "License Expiring Soon",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>Your License Expires Soon</h2>
+	<p>Hello {{.ApplicantName}},</p>
+	<p>Your license for "{{.IPAssetTitle}}" expires in {{.Days}} days, on {{.ExpiresAt}}.</p>
+	<p>Renew it to keep selling products made under it. Once it expires, their authorizations stop validating.</p>
+	<a href="{{.LicenseURL}}">Renew License</a>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"license_cancelled": {
+			Subject: "License Cancelled",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>License Cancelled</h2>
+	<p>Hello {{.ApplicantName}},</p>
+	<p>Your approved license for "{{.IPAssetTitle}}" has been cancelled because its fee was not paid within 7 days.</p>
+	<p>You can apply for a new license at any time.</p>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"license_expired": {
+			Subject: "License Expired",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>License Expired</h2>
+	<p>Hello {{.ApplicantName}},</p>
+	<p>Your license for "{{.IPAssetTitle}}" has expired. Products made under it have been suspended and their verification codes no longer validate.</p>
+	<p>You can apply for a new license at any time.</p>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"license_renewed": {
+			Subject: "License Renewed",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>License Renewed</h2>
+	<p>Hello {{.ApplicantName}},</p>
+	<p>Your license for "{{.IPAssetTitle}}" has been renewed and now runs until {{.ExpiresAt}}.</p>
+	<a href="{{.LicenseURL}}">View License Details</a>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
 </html>`,
 		},
 		"license_approved": {
@@ -397,6 +772,65 @@ func (s *NotificationService) getEmailTemplate(templateType string) EmailTemplat
 	<a href="{{.LicenseURL}}">View License Details</a>
 	<p>Best regards,<br>IP Marketplace Team</p>
 </body>
+</html>`,
+		},
+		"authorization_revoked": {
+			Subject: "Product Authorization Revoked",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>Product Authorization Revoked</h2>
+	<p>Hello {{.CreatorName}},</p>
+	<p>A license that "{{.ProductTitle}}" depends on has been revoked, so the product has been suspended and its verification code no longer validates.</p>
+	<p>Reason: {{.Reason}}</p>
+	<a href="{{.ProductURL}}">View Product</a>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"revenue_share": {
+			Subject: "Revenue Share Received",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>You Received a Revenue Share</h2>
+	<p>Hello {{.RecipientName}},</p>
+	{{if .IPAssetTitle}}<p>A license of "{{.IPAssetTitle}}" earned you {{.Amount}}.</p>{{else}}<p>A sale of "{{.ProductTitle}}" earned you {{.Amount}}.</p>{{end}}
+	<p>It will be available for payout once the settlement period ends.</p>
+	<a href="{{.BalanceURL}}">View Earnings</a>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"payout_status": {
+			Subject: "Payout Update",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>Payout Update</h2>
+	<p>Hello {{.Username}},</p>
+	<p>Your payout of {{.Amount}} is now <strong>{{.Status}}</strong>.</p>
+	{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
+</html>`,
+		},
+		"refund_notification": {
+			Subject: "Refund Processed",
+			Body: `
+<!DOCTYPE html>
+<html>
+<body>
+	<h2>Refund Processed</h2>
+	<p>Hello {{.BuyerName}},</p>
+	<p>We have refunded {{.Amount}} of your purchase of "{{.ProductTitle}}".</p>
+	{{if .Reason}}<p>Reason: {{.Reason}}</p>{{end}}
+	<p>It may take a few days to appear on your statement.</p>
+	<p>Best regards,<br>IP Marketplace Team</p>
+</body>
 </html>`,
 		},
 		// Add more templates as needed...
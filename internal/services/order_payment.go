@@ -0,0 +1,220 @@
+// internal/services/order_payment.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// CreateOrderIntent opens one payment for the total of a pending order and
+// stores the intent ID on the order and each of its transactions. Like
+// transaction payments, retries return the same payment, and an order whose
+// payment cannot be opened fails and releases its inventory.
+func (s *PaymentService) CreateOrderIntent(order *models.Order) (*PaymentIntentResponse, error) {
+	provider, err := s.Provider(order.PaymentMethod)
+	if err != nil {
+		s.failOrder(order.ID)
+		return nil, err
+	}
+
+	intent, err := provider.CreateIntent(&IntentRequest{
+		Amount: order.Total(),
+		Metadata: map[string]string{
+			"order_id": order.ID.String(),
+			"user_id":  order.BuyerID.String(),
+		},
+		IdempotencyKey: "intent_order_" + order.ID.String(),
+	})
+	if err != nil {
+		s.failOrder(order.ID)
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).
+			UpdateColumn("payment_intent_id", intent.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Transaction{}).Where("order_id = ?", order.ID).
+			UpdateColumn("payment_intent_id", intent.ID).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store payment intent: %w", err)
+	}
+	order.PaymentIntentID = intent.ID
+
+	if intent.Status == models.TransactionStatusFailed {
+		if err := s.applyOrderPaymentResult(order.ID, intent.ID, intent.Status); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("payment was declined")
+	}
+
+	return &PaymentIntentResponse{
+		OrderID:      &order.ID,
+		ClientSecret: intent.ClientSecret,
+		PaymentID:    intent.ID,
+		Status:       intent.ProviderStatus,
+		Provider:     provider.Name(),
+		ApprovalURL:  intent.ApprovalURL,
+		Amount:       order.Amount,
+		Currency:     order.Total().Currency,
+	}, nil
+}
+
+func (s *PaymentService) reopenOrderIntent(userID, orderID uuid.UUID, paymentMethod string) (*PaymentIntentResponse, error) {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if order.BuyerID != userID {
+		return nil, errors.New("unauthorized to pay for this order")
+	}
+
+	if order.Status != models.TransactionStatusPending {
+		return nil, fmt.Errorf("cannot pay for a %s order", order.Status)
+	}
+
+	if paymentMethod != "" && paymentMethod != order.PaymentMethod {
+		if _, err := s.Provider(paymentMethod); err != nil {
+			return nil, err
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&order).UpdateColumn("payment_method", paymentMethod).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.Transaction{}).Where("order_id = ?", order.ID).
+				UpdateColumn("payment_method", paymentMethod).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update payment method: %w", err)
+		}
+		order.PaymentMethod = paymentMethod
+	}
+
+	return s.CreateOrderIntent(&order)
+}
+
+// failOrder fails an order whose payment could not be opened
+func (s *PaymentService) failOrder(orderID uuid.UUID) {
+	if err := s.applyOrderPaymentResult(orderID, "", models.TransactionStatusFailed); err != nil {
+		log.Printf("Failed to fail order %s: %v", orderID, err)
+	}
+}
+
+func (s *PaymentService) confirmOrderPayment(orderID uuid.UUID, paymentIntentID string) error {
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("order not found: %w", err)
+	}
+
+	provider, err := s.Provider(order.PaymentMethod)
+	if err != nil {
+		return err
+	}
+
+	intent, err := provider.ConfirmIntent(paymentIntentID)
+	if err != nil {
+		return err
+	}
+
+	// The payment must be the one made for this order
+	if order.PaymentIntentID != "" && intent.ID != order.PaymentIntentID {
+		return errors.New("payment does not belong to this order")
+	}
+	if id := intent.Metadata["order_id"]; id != "" && id != order.ID.String() {
+		return errors.New("payment does not belong to this order")
+	}
+	if intent.Status == models.TransactionStatusCompleted && !intent.Amount.Equal(order.Total().Round()) {
+		return errors.New("payment amount does not match the order")
+	}
+
+	return s.applyOrderPaymentResult(order.ID, intent.ID, intent.Status)
+}
+
+// applyOrderPaymentResult moves an order and every seller transaction in it
+// to the outcome of the order's payment, in one database transaction
+func (s *PaymentService) applyOrderPaymentResult(orderID uuid.UUID, reference string, status models.TransactionStatus) error {
+	var completed []uuid.UUID
+	var shares []models.Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return fmt.Errorf("order not found: %w", err)
+		}
+
+		if order.Status == models.TransactionStatusCompleted || order.Status == models.TransactionStatusRefunded {
+			return nil
+		}
+		if order.Status == status {
+			return nil
+		}
+
+		var transactions []models.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ?", orderID).Order("id").
+			Find(&transactions).Error; err != nil {
+			return fmt.Errorf("failed to load order transactions: %w", err)
+		}
+
+		for i := range transactions {
+			done, paid, err := s.settleTransaction(tx, &transactions[i], reference, status)
+			if err != nil {
+				return err
+			}
+			if done {
+				completed = append(completed, transactions[i].ID)
+				shares = append(shares, paid...)
+			}
+		}
+
+		order.Status = status
+		if status == models.TransactionStatusCompleted {
+			now := time.Now()
+			order.PaidAt = &now
+			order.PaymentReference = reference
+		}
+
+		if err := tx.Save(&order).Error; err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(completed) > 0 {
+		go s.sendOrderNotifications(orderID, completed, shares)
+	}
+
+	return nil
+}
+
+func (s *PaymentService) sendOrderNotifications(orderID uuid.UUID, transactionIDs []uuid.UUID, shares []models.Transaction) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var order models.Order
+	if err := s.db.Preload("Buyer").Preload("Items").Preload("Items.Product").First(&order, orderID).Error; err != nil {
+		log.Printf("Failed to load order %s for notification: %v", orderID, err)
+	} else {
+		s.notificationService.SendOrderConfirmationNotification(&order)
+	}
+
+	s.sendSaleNotifications(transactionIDs, shares)
+}
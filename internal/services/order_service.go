@@ -0,0 +1,467 @@
+// internal/services/order_service.go
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// OrderService keeps buyers' carts and checks them out as orders. An order
+// is paid once and split into one product_sale transaction per seller.
+type OrderService struct {
+	db               *gorm.DB
+	productService   *ProductService
+	paymentService   *PaymentService
+	inventoryService *InventoryService
+}
+
+type AddToCartRequest struct {
+	ProductID uuid.UUID `json:"product_id" validate:"required"`
+	Quantity  int       `json:"quantity" validate:"required,min=1"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" validate:"required,min=1"`
+}
+
+type CheckoutRequest struct {
+	PaymentMethod string                 `json:"payment_method" validate:"required"`
+	ShippingInfo  map[string]interface{} `json:"shipping_info,omitempty"`
+	Notes         string                 `json:"notes,omitempty"`
+}
+
+// Cart is a buyer's cart with its running total. An order is paid in one
+// currency, so a cart mixing currencies has no subtotal and cannot be
+// checked out.
+type Cart struct {
+	Items     []models.CartItem `json:"items"`
+	ItemCount int               `json:"item_count"`
+	Subtotal  decimal.Decimal   `json:"subtotal"`
+	Currency  string            `json:"currency,omitempty"`
+}
+
+func (c Cart) MarshalJSON() ([]byte, error) {
+	type cart Cart
+	return json.Marshal(struct {
+		cart
+		Subtotal models.DecimalNumber `json:"subtotal"`
+	}{cart(c), models.DecimalNumber(c.Subtotal)})
+}
+
+// sellerCheckout is the part of an order sold by one seller
+type sellerCheckout struct {
+	sellerID uuid.UUID
+	items    []models.CartItem
+	amount   models.Money
+	fee      models.Money
+	shares   []map[string]interface{}
+}
+
+func NewOrderService(db *gorm.DB, productService *ProductService, paymentService *PaymentService, inventoryService *InventoryService) *OrderService {
+	return &OrderService{
+		db:               db,
+		productService:   productService,
+		paymentService:   paymentService,
+		inventoryService: inventoryService,
+	}
+}
+
+func (s *OrderService) GetCart(userID uuid.UUID) (*Cart, error) {
+	var items []models.CartItem
+	if err := s.db.Where("user_id = ?", userID).
+		Preload("Product").Preload("Product.Creator").
+		Order("created_at ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch cart: %w", err)
+	}
+
+	cart := &Cart{Items: items}
+	var subtotal *models.Money
+	mixed := false
+	for _, item := range items {
+		cart.ItemCount += item.Quantity
+		if item.Product == nil {
+			continue
+		}
+
+		amount := item.Product.PriceMoney().Mul(int64(item.Quantity))
+		if subtotal == nil {
+			subtotal = &amount
+		} else if sum, err := subtotal.Add(amount); err != nil {
+			mixed = true
+		} else {
+			subtotal = &sum
+		}
+	}
+
+	if subtotal != nil && !mixed {
+		cart.Subtotal = subtotal.Amount
+		cart.Currency = subtotal.Currency
+	}
+
+	return cart, nil
+}
+
+// AddToCart adds units of a product to the cart, on top of any already there
+func (s *OrderService) AddToCart(userID uuid.UUID, req *AddToCartRequest) (*Cart, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var item models.CartItem
+	err := s.db.Where("user_id = ? AND product_id = ?", userID, req.ProductID).First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	quantity := item.Quantity + req.Quantity
+	if err := s.checkAvailable(req.ProductID, quantity); err != nil {
+		return nil, err
+	}
+
+	if item.ID == uuid.Nil {
+		item = models.CartItem{UserID: userID, ProductID: req.ProductID, Quantity: quantity}
+		if err := s.db.Create(&item).Error; err != nil {
+			return nil, fmt.Errorf("failed to add to cart: %w", err)
+		}
+	} else if err := s.db.Model(&item).Update("quantity", quantity).Error; err != nil {
+		return nil, fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *OrderService) UpdateCartItem(userID, productID uuid.UUID, req *UpdateCartItemRequest) (*Cart, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var item models.CartItem
+	if err := s.db.Where("user_id = ? AND product_id = ?", userID, productID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("cart item not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := s.checkAvailable(productID, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(&item).Update("quantity", req.Quantity).Error; err != nil {
+		return nil, fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *OrderService) RemoveFromCart(userID, productID uuid.UUID) (*Cart, error) {
+	if err := s.db.Unscoped().Where("user_id = ? AND product_id = ?", userID, productID).
+		Delete(&models.CartItem{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove from cart: %w", err)
+	}
+
+	return s.GetCart(userID)
+}
+
+func (s *OrderService) ClearCart(userID uuid.UUID) error {
+	if err := s.db.Unscoped().Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+	return nil
+}
+
+// Checkout turns the cart into an order: every item's units are reserved,
+// each seller's items become one transaction with its own revenue shares,
+// and a single payment is opened for the order total. The cart is emptied
+// once the order exists.
+func (s *OrderService) Checkout(userID uuid.UUID, req *CheckoutRequest) (*models.Order, *PaymentIntentResponse, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if s.paymentService == nil || s.inventoryService == nil {
+		return nil, nil, errors.New("payments are not configured")
+	}
+
+	var order *models.Order
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var buyer models.User
+		if err := tx.First(&buyer, userID).Error; err != nil {
+			return fmt.Errorf("buyer not found: %w", err)
+		}
+
+		if buyer.Status != models.UserStatusActive {
+			return errors.New("buyer account is not active")
+		}
+
+		var items []models.CartItem
+		if err := tx.Where("user_id = ?", userID).
+			Preload("Product").Preload("Product.License").Preload("Product.License.IPAsset").
+			Preload("Product.License.LicenseTerms").
+			Order("created_at ASC").
+			Find(&items).Error; err != nil {
+			return fmt.Errorf("failed to fetch cart: %w", err)
+		}
+
+		if len(items) == 0 {
+			return errors.New("cart is empty")
+		}
+
+		for _, item := range items {
+			if item.Product == nil {
+				continue
+			}
+			if err := s.productService.checkShippingTerritory(item.Product, req.ShippingInfo); err != nil {
+				return err
+			}
+		}
+
+		sellers, err := s.splitBySeller(items)
+		if err != nil {
+			return err
+		}
+
+		currency := sellers[0].amount.Currency
+		order = &models.Order{
+			BuyerID:       userID,
+			Currency:      currency,
+			PaymentMethod: req.PaymentMethod,
+			Status:        models.TransactionStatusPending,
+			ShippingInfo:  models.JSONB(req.ShippingInfo),
+			Notes:         req.Notes,
+		}
+		for _, seller := range sellers {
+			order.Amount = order.Amount.Add(seller.amount.Amount)
+			order.PlatformFee = order.PlatformFee.Add(seller.fee.Amount)
+		}
+
+		if err := tx.Create(order).Error; err != nil {
+			return fmt.Errorf("failed to create order: %w", err)
+		}
+
+		for _, seller := range sellers {
+			if err := s.createSellerTransaction(tx, order, seller); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
+			return fmt.Errorf("failed to clear cart: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Open one payment for the whole order
+	payment, err := s.paymentService.CreateOrderIntent(order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loaded, err := s.loadOrder(order.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return loaded, payment, nil
+}
+
+func (s *OrderService) GetOrders(userID uuid.UUID, params utils.PaginationParams) ([]models.Order, int64, error) {
+	query := s.db.Model(&models.Order{}).Where("buyer_id = ?", userID).
+		Preload("Items").Preload("Items.Product")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	allowedSortFields := []string{"created_at", "amount", "status"}
+	query = utils.ApplySort(query, params, allowedSortFields)
+	query = utils.ApplyPagination(query, params)
+
+	var orders []models.Order
+	if err := query.Find(&orders).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch orders: %w", err)
+	}
+
+	return orders, total, nil
+}
+
+func (s *OrderService) GetOrder(orderID, userID uuid.UUID) (*models.Order, error) {
+	order, err := s.loadOrder(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.BuyerID != userID {
+		return nil, errors.New("order not found")
+	}
+
+	return order, nil
+}
+
+// Helper methods
+
+func (s *OrderService) loadOrder(orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	if err := s.db.Preload("Items").Preload("Items.Product").
+		Preload("Transactions").Preload("Transactions.Seller").
+		First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("order not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &order, nil
+}
+
+func (s *OrderService) checkAvailable(productID uuid.UUID, quantity int) error {
+	var product models.Product
+	if err := s.db.First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("product not found")
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if product.Status != models.ProductStatusActive {
+		return errors.New("product is not available for purchase")
+	}
+
+	if product.InventoryCount < quantity {
+		return fmt.Errorf("%w: %s", ErrInsufficientInventory, product.Title)
+	}
+
+	return nil
+}
+
+// splitBySeller groups cart items by seller, in the order the buyer added
+// them, and prices each seller's part. Every item must be priced in the same
+// currency, since the order is paid at once.
+func (s *OrderService) splitBySeller(items []models.CartItem) ([]*sellerCheckout, error) {
+	var sellers []*sellerCheckout
+	bySeller := make(map[uuid.UUID]*sellerCheckout)
+
+	for _, item := range items {
+		product := item.Product
+		if product == nil || product.Status != models.ProductStatusActive {
+			return nil, errors.New("product is not available for purchase")
+		}
+		if product.InventoryCount < item.Quantity {
+			return nil, fmt.Errorf("%w: %s", ErrInsufficientInventory, product.Title)
+		}
+
+		if len(sellers) > 0 && sellers[0].amount.Currency != product.PriceMoney().Currency {
+			return nil, fmt.Errorf("%w: the cart mixes %s and %s prices",
+				models.ErrCurrencyMismatch, sellers[0].amount.Currency, product.PriceMoney().Currency)
+		}
+
+		seller, ok := bySeller[product.CreatorID]
+		if !ok {
+			seller = &sellerCheckout{
+				sellerID: product.CreatorID,
+				amount:   models.ZeroMoney(product.Currency),
+				fee:      models.ZeroMoney(product.Currency),
+			}
+			bySeller[product.CreatorID] = seller
+			sellers = append(sellers, seller)
+		}
+
+		amount := product.PriceMoney().Mul(int64(item.Quantity))
+		fee := platformFee(amount)
+		shares, err := s.productService.calculateRevenueShares(amount, fee, product)
+		if err != nil {
+			return nil, err
+		}
+		shares["product_id"] = product.ID
+		shares["quantity"] = item.Quantity
+
+		seller.items = append(seller.items, item)
+		seller.amount, _ = seller.amount.Add(amount)
+		seller.fee, _ = seller.fee.Add(fee)
+		seller.shares = append(seller.shares, shares)
+	}
+
+	return sellers, nil
+}
+
+// createSellerTransaction records one seller's part of an order and reserves
+// its units. The licensor shares of every product are paid from it.
+func (s *OrderService) createSellerTransaction(tx *gorm.DB, order *models.Order, seller *sellerCheckout) error {
+	var licensorShares []RevenueShare
+	quantity := 0
+	secondaryCreatorShare := decimal.Zero
+	for i, item := range seller.items {
+		quantity += item.Quantity
+		licensorShares = append(licensorShares, seller.shares[i]["shares"].([]RevenueShare)...)
+		secondaryCreatorShare = secondaryCreatorShare.Add(seller.shares[i]["secondary_creator_share"].(decimal.Decimal))
+	}
+	netAmount, _ := seller.amount.Sub(seller.fee)
+
+	transaction := &models.Transaction{
+		TransactionType: models.TransactionTypeProductSale,
+		BuyerID:         &order.BuyerID,
+		SellerID:        seller.sellerID,
+		OrderID:         &order.ID,
+		Quantity:        quantity,
+		Amount:          seller.amount.Amount,
+		PlatformFee:     seller.fee.Amount,
+		Currency:        seller.amount.Currency,
+		RevenueShares: models.JSONB{
+			"total_amount":            seller.amount.Amount,
+			"platform_fee":            seller.fee.Amount,
+			"net_amount":              netAmount.Amount,
+			"currency":                seller.amount.Currency,
+			"secondary_creator_share": secondaryCreatorShare,
+			"secondary_creator_id":    seller.sellerID,
+			"shares":                  licensorShares,
+			"items":                   seller.shares,
+		},
+		PaymentMethod: order.PaymentMethod,
+		Status:        models.TransactionStatusPending,
+	}
+
+	// Sales of a single product keep pointing at it
+	if len(seller.items) == 1 {
+		transaction.ProductID = &seller.items[0].ProductID
+	}
+
+	if err := tx.Create(transaction).Error; err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	for _, item := range seller.items {
+		orderItem := &models.OrderItem{
+			OrderID:       order.ID,
+			TransactionID: transaction.ID,
+			ProductID:     item.ProductID,
+			Quantity:      item.Quantity,
+			UnitPrice:     item.Product.Price,
+			Amount:        item.Product.PriceMoney().Mul(int64(item.Quantity)).Amount,
+		}
+		if err := tx.Create(orderItem).Error; err != nil {
+			return fmt.Errorf("failed to create order item: %w", err)
+		}
+
+		if _, err := s.inventoryService.Hold(tx, item.ProductID, transaction.ID, item.Quantity); err != nil {
+			if errors.Is(err, ErrInsufficientInventory) {
+				return fmt.Errorf("%w: %s", err, item.Product.Title)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
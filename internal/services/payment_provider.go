@@ -0,0 +1,276 @@
+// internal/services/payment_provider.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/paymentintent"
+	"github.com/stripe/stripe-go/v74/refund"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// PaymentProvider takes payments from buyers, refunds them and pays out to
+// sellers. Name is the payment method that selects the provider.
+type PaymentProvider interface {
+	PayoutProvider
+	CreateIntent(req *IntentRequest) (*ProviderIntent, error)
+	ConfirmIntent(id string) (*ProviderIntent, error)
+	Refund(req *ProviderRefundRequest) (*ProviderRefund, error)
+}
+
+// IntentRequest asks a provider to collect an amount from the buyer.
+// Metadata travels with the payment and comes back in provider webhooks.
+type IntentRequest struct {
+	Amount         models.Money
+	Metadata       map[string]string
+	IdempotencyKey string
+}
+
+// ProviderIntent is a payment as seen by its provider. Status is the status
+// the paid transaction should take; ProviderStatus is the provider's own.
+type ProviderIntent struct {
+	ID             string
+	ClientSecret   string // Stripe: completes the payment in the browser
+	ApprovalURL    string // PayPal: where the buyer approves the payment
+	Status         models.TransactionStatus
+	ProviderStatus string
+	Amount         models.Money
+	Metadata       map[string]string
+}
+
+// ProviderRefundRequest refunds part or all of the payment behind a
+// transaction's payment reference
+type ProviderRefundRequest struct {
+	PaymentReference string
+	Amount           models.Money
+	Reason           string
+	IdempotencyKey   string
+}
+
+type ProviderRefund struct {
+	ID     string
+	Amount models.Money
+	Status string
+}
+
+// StripePaymentProvider takes payments with Stripe payment intents and pays
+// out through Stripe Connect
+type StripePaymentProvider struct {
+	*StripePayoutProvider
+}
+
+func NewStripePaymentProvider(secretKey string) *StripePaymentProvider {
+	stripe.Key = secretKey
+	return &StripePaymentProvider{StripePayoutProvider: NewStripePayoutProvider()}
+}
+
+func (p *StripePaymentProvider) CreateIntent(req *IntentRequest) (*ProviderIntent, error) {
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(req.Amount.MinorUnits()),
+		Currency: stripe.String(strings.ToLower(req.Amount.Currency)),
+	}
+	for k, v := range req.Metadata {
+		params.AddMetadata(k, v)
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	pi, err := paymentintent.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+	}
+
+	return stripeIntent(pi), nil
+}
+
+// ConfirmIntent reads the payment intent; buyers confirm Stripe payments
+// in the browser with the client secret
+func (p *StripePaymentProvider) ConfirmIntent(id string) (*ProviderIntent, error) {
+	pi, err := paymentintent.Get(id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment intent: %w", err)
+	}
+
+	return stripeIntent(pi), nil
+}
+
+func (p *StripePaymentProvider) Refund(req *ProviderRefundRequest) (*ProviderRefund, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(req.PaymentReference),
+		Amount:        stripe.Int64(req.Amount.MinorUnits()),
+		Reason:        stripe.String("requested_by_customer"),
+	}
+	if req.IdempotencyKey != "" {
+		params.SetIdempotencyKey(req.IdempotencyKey)
+	}
+
+	r, err := refund.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process refund: %w", err)
+	}
+
+	return &ProviderRefund{
+		ID:     r.ID,
+		Amount: models.MoneyFromMinorUnits(r.Amount, string(r.Currency)),
+		Status: string(r.Status),
+	}, nil
+}
+
+func stripeIntent(pi *stripe.PaymentIntent) *ProviderIntent {
+	return &ProviderIntent{
+		ID:             pi.ID,
+		ClientSecret:   pi.ClientSecret,
+		Status:         paymentIntentTransactionStatus(pi.Status),
+		ProviderStatus: string(pi.Status),
+		Amount:         models.MoneyFromMinorUnits(pi.Amount, string(pi.Currency)),
+		Metadata:       pi.Metadata,
+	}
+}
+
+// paymentIntentTransactionStatus maps a Stripe payment intent status onto
+// the status of the transaction it pays for
+func paymentIntentTransactionStatus(status stripe.PaymentIntentStatus) models.TransactionStatus {
+	switch status {
+	case stripe.PaymentIntentStatusSucceeded:
+		return models.TransactionStatusCompleted
+	case stripe.PaymentIntentStatusRequiresAction, stripe.PaymentIntentStatusRequiresConfirmation,
+		stripe.PaymentIntentStatusProcessing:
+		return models.TransactionStatusPending
+	default:
+		return models.TransactionStatusFailed
+	}
+}
+
+// FakePaymentProvider keeps payments in memory for development and tests.
+// Intents stay pending until SucceedIntent or FailIntent, unless AutoSucceed
+// completes them on confirmation. Set Decline to fail every new intent.
+type FakePaymentProvider struct {
+	*FakePayoutProvider
+	AutoSucceed bool
+	Decline     bool
+
+	intentsMu sync.Mutex
+	intents   map[string]*ProviderIntent
+	refunded  map[string]models.Money
+}
+
+func NewFakePaymentProvider() *FakePaymentProvider {
+	return &FakePaymentProvider{
+		FakePayoutProvider: NewFakePayoutProvider(),
+		intents:            make(map[string]*ProviderIntent),
+		refunded:           make(map[string]models.Money),
+	}
+}
+
+func (p *FakePaymentProvider) CreateIntent(req *IntentRequest) (*ProviderIntent, error) {
+	if !req.Amount.IsPositive() {
+		return nil, errors.New("amount must be positive")
+	}
+
+	p.intentsMu.Lock()
+	defer p.intentsMu.Unlock()
+
+	id := "fake_pi_" + uuid.NewString()
+	intent := &ProviderIntent{
+		ID:             id,
+		ClientSecret:   id + "_secret",
+		Status:         models.TransactionStatusPending,
+		ProviderStatus: "requires_confirmation",
+		Amount:         models.NewMoney(req.Amount.Amount, req.Amount.Currency),
+		Metadata:       req.Metadata,
+	}
+	if p.Decline {
+		intent.Status = models.TransactionStatusFailed
+		intent.ProviderStatus = "declined"
+	}
+	p.intents[id] = intent
+
+	copied := *intent
+	return &copied, nil
+}
+
+func (p *FakePaymentProvider) ConfirmIntent(id string) (*ProviderIntent, error) {
+	p.intentsMu.Lock()
+	defer p.intentsMu.Unlock()
+
+	intent, ok := p.intents[id]
+	if !ok {
+		return nil, fmt.Errorf("payment intent %s not found", id)
+	}
+	if p.AutoSucceed && intent.Status == models.TransactionStatusPending {
+		intent.Status = models.TransactionStatusCompleted
+		intent.ProviderStatus = "succeeded"
+	}
+
+	copied := *intent
+	return &copied, nil
+}
+
+// SucceedIntent completes a pending intent, as a buyer paying would
+func (p *FakePaymentProvider) SucceedIntent(id string) error {
+	return p.settleIntent(id, models.TransactionStatusCompleted, "succeeded")
+}
+
+// FailIntent fails a pending intent, as a declined card would
+func (p *FakePaymentProvider) FailIntent(id string) error {
+	return p.settleIntent(id, models.TransactionStatusFailed, "declined")
+}
+
+func (p *FakePaymentProvider) settleIntent(id string, status models.TransactionStatus, providerStatus string) error {
+	p.intentsMu.Lock()
+	defer p.intentsMu.Unlock()
+
+	intent, ok := p.intents[id]
+	if !ok {
+		return fmt.Errorf("payment intent %s not found", id)
+	}
+	if intent.Status != models.TransactionStatusPending {
+		return fmt.Errorf("payment intent %s is %s", id, intent.ProviderStatus)
+	}
+
+	intent.Status = status
+	intent.ProviderStatus = providerStatus
+	return nil
+}
+
+func (p *FakePaymentProvider) Refund(req *ProviderRefundRequest) (*ProviderRefund, error) {
+	p.intentsMu.Lock()
+	defer p.intentsMu.Unlock()
+
+	intent, ok := p.intents[req.PaymentReference]
+	if !ok {
+		return nil, fmt.Errorf("payment intent %s not found", req.PaymentReference)
+	}
+	if intent.Status != models.TransactionStatusCompleted {
+		return nil, fmt.Errorf("payment intent %s has not succeeded", req.PaymentReference)
+	}
+
+	refunded, ok := p.refunded[intent.ID]
+	if !ok {
+		refunded = models.ZeroMoney(intent.Amount.Currency)
+	}
+	refunded, err := refunded.Add(models.NewMoney(req.Amount.Amount, req.Amount.Currency))
+	if err != nil {
+		return nil, err
+	}
+	if !req.Amount.IsPositive() || refunded.Amount.GreaterThan(intent.Amount.Amount) {
+		return nil, errors.New("refund exceeds the captured amount")
+	}
+	p.refunded[intent.ID] = refunded
+
+	return &ProviderRefund{ID: "fake_re_" + uuid.NewString(), Amount: req.Amount, Status: "succeeded"}, nil
+}
+
+// Refunded returns the total refunded on an intent
+func (p *FakePaymentProvider) Refunded(id string) models.Money {
+	p.intentsMu.Lock()
+	defer p.intentsMu.Unlock()
+	return p.refunded[id]
+}
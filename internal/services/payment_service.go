@@ -2,16 +2,17 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/stripe/stripe-go/v74"
-	"github.com/stripe/stripe-go/v74/paymentintent"
-	"github.com/stripe/stripe-go/v74/refund"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/javajoker/imi-backend/internal/config"
 	"github.com/javajoker/imi-backend/internal/models"
@@ -19,97 +20,200 @@ import (
 )
 
 type PaymentService struct {
-	db     *gorm.DB
-	config *config.Config
+	db                  *gorm.DB
+	config              *config.Config
+	accountingService   *AccountingService
+	notificationService *NotificationService
+	inventoryService    *InventoryService
+	licenseService      *LicenseService
+	providers           map[string]PaymentProvider
 }
 
+// CreatePaymentIntentRequest reopens the payment of a pending transaction or
+// order, such as when the buyer left checkout before paying. PaymentMethod
+// switches the payment to another provider.
 type CreatePaymentIntentRequest struct {
-	Amount        float64                `json:"amount" validate:"required,min=0.01"`
-	Currency      string                 `json:"currency,omitempty"`
-	PaymentMethod string                 `json:"payment_method" validate:"required"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	TransactionID uuid.UUID  `json:"transaction_id,omitempty"`
+	OrderID       *uuid.UUID `json:"order_id,omitempty"`
+	PaymentMethod string     `json:"payment_method,omitempty"`
 }
 
 type PaymentIntentResponse struct {
-	ClientSecret string `json:"client_secret"`
-	PaymentID    string `json:"payment_id"`
-	Status       string `json:"status"`
+	TransactionID *uuid.UUID      `json:"transaction_id,omitempty"`
+	OrderID       *uuid.UUID      `json:"order_id,omitempty"`
+	ClientSecret  string          `json:"client_secret"`
+	PaymentID     string          `json:"payment_id"`
+	Status        string          `json:"status"`
+	Provider      string          `json:"provider"`
+	ApprovalURL   string          `json:"approval_url,omitempty"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
 }
 
+func (r PaymentIntentResponse) MarshalJSON() ([]byte, error) {
+	type paymentIntentResponse PaymentIntentResponse
+	return json.Marshal(struct {
+		paymentIntentResponse
+		Amount models.DecimalNumber `json:"amount"`
+	}{paymentIntentResponse(r), models.DecimalNumber(r.Amount)})
+}
+
+// ConfirmPaymentRequest names the transaction, or the order, that a payment
+// was made for
 type ConfirmPaymentRequest struct {
-	PaymentIntentID string    `json:"payment_intent_id" validate:"required"`
-	TransactionID   uuid.UUID `json:"transaction_id" validate:"required"`
+	PaymentIntentID string     `json:"payment_intent_id" validate:"required"`
+	TransactionID   uuid.UUID  `json:"transaction_id,omitempty"`
+	OrderID         *uuid.UUID `json:"order_id,omitempty"`
 }
 
-type RefundRequest struct {
-	TransactionID uuid.UUID `json:"transaction_id" validate:"required"`
-	Amount        float64   `json:"amount,omitempty"`
-	Reason        string    `json:"reason" validate:"required"`
+func NewPaymentService(db *gorm.DB, config *config.Config, accountingService *AccountingService, notificationService *NotificationService, inventoryService *InventoryService) *PaymentService {
+	return &PaymentService{
+		db:                  db,
+		config:              config,
+		accountingService:   accountingService,
+		notificationService: notificationService,
+		inventoryService:    inventoryService,
+		providers:           make(map[string]PaymentProvider),
+	}
 }
 
-type PayoutRequest struct {
-	Amount      float64                `json:"amount" validate:"required,min=10"`
-	Method      string                 `json:"method" validate:"required"`
-	AccountInfo map[string]interface{} `json:"account_info,omitempty"`
+// RegisterProvider makes a provider available as a payment method
+func (s *PaymentService) RegisterProvider(provider PaymentProvider) {
+	s.providers[provider.Name()] = provider
 }
 
-func NewPaymentService(db *gorm.DB, config *config.Config) *PaymentService {
-	// Initialize Stripe
-	stripe.Key = config.Payment.StripeSecretKey
+// SetLicenseService lets paid license fees grant their licenses. The license
+// service opens those payments, so it is created after this service.
+func (s *PaymentService) SetLicenseService(licenseService *LicenseService) {
+	s.licenseService = licenseService
+}
 
-	return &PaymentService{
-		db:     db,
-		config: config,
+// Provider returns the provider for a payment method. Methods that do not
+// name a provider, such as "card", use the configured default provider.
+func (s *PaymentService) Provider(method string) (PaymentProvider, error) {
+	if provider, ok := s.providers[method]; ok {
+		return provider, nil
+	}
+	if provider, ok := s.providers[s.config.Payment.DefaultProvider]; ok {
+		return provider, nil
 	}
+	return nil, fmt.Errorf("unsupported payment method: %s", method)
 }
 
 func (s *PaymentService) CreatePaymentIntent(userID uuid.UUID, req *CreatePaymentIntentRequest) (*PaymentIntentResponse, error) {
-	// Set default currency
-	currency := req.Currency
-	if currency == "" {
-		currency = "usd"
+	if req.OrderID != nil {
+		return s.reopenOrderIntent(userID, *req.OrderID, req.PaymentMethod)
+	}
+	if req.TransactionID == uuid.Nil {
+		return nil, errors.New("transaction_id or order_id is required")
 	}
 
-	// Convert amount to cents for Stripe
-	amountInCents := int64(req.Amount * 100)
+	var transaction models.Transaction
+	if err := s.db.First(&transaction, req.TransactionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("transaction not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if transaction.BuyerID == nil || *transaction.BuyerID != userID {
+		return nil, errors.New("unauthorized to pay for this transaction")
+	}
 
-	// Prepare metadata
-	metadata := make(map[string]string)
-	metadata["user_id"] = userID.String()
-	for k, v := range req.Metadata {
-		if str, ok := v.(string); ok {
-			metadata[k] = str
+	if transaction.Status != models.TransactionStatusPending {
+		return nil, fmt.Errorf("cannot pay for a %s transaction", transaction.Status)
+	}
+
+	// Transactions of an order are paid together
+	if transaction.OrderID != nil {
+		return s.reopenOrderIntent(userID, *transaction.OrderID, req.PaymentMethod)
+	}
+
+	if req.PaymentMethod != "" && req.PaymentMethod != transaction.PaymentMethod {
+		if _, err := s.Provider(req.PaymentMethod); err != nil {
+			return nil, err
 		}
+		if err := s.db.Model(&transaction).UpdateColumn("payment_method", req.PaymentMethod).Error; err != nil {
+			return nil, fmt.Errorf("failed to update payment method: %w", err)
+		}
+		transaction.PaymentMethod = req.PaymentMethod
 	}
 
-	// Create Stripe PaymentIntent
-	params := &stripe.PaymentIntentParams{
-		Amount:   stripe.Int64(amountInCents),
-		Currency: stripe.String(currency),
+	return s.CreateTransactionIntent(&transaction)
+}
+
+// CreateTransactionIntent opens a payment for the amount of a pending
+// transaction and stores the intent ID on it. The provider is asked with a
+// key derived from the transaction, so retries return the same payment. A
+// payment that cannot be opened fails the transaction and releases what it
+// held.
+func (s *PaymentService) CreateTransactionIntent(transaction *models.Transaction) (*PaymentIntentResponse, error) {
+	provider, err := s.Provider(transaction.PaymentMethod)
+	if err != nil {
+		s.failTransaction(transaction.ID)
+		return nil, err
 	}
 
-	// Add metadata
-	for k, v := range metadata {
-		params.AddMetadata(k, v)
+	metadata := map[string]string{
+		"transaction_id":   transaction.ID.String(),
+		"transaction_type": string(transaction.TransactionType),
+		"user_id":          transaction.BuyerID.String(),
+	}
+	if transaction.ProductID != nil {
+		metadata["product_id"] = transaction.ProductID.String()
+	}
+	if transaction.LicenseID != nil {
+		metadata["license_id"] = transaction.LicenseID.String()
 	}
 
-	pi, err := paymentintent.New(params)
+	intent, err := provider.CreateIntent(&IntentRequest{
+		Amount:         transaction.Total(),
+		Metadata:       metadata,
+		IdempotencyKey: "intent_" + transaction.ID.String(),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create payment intent: %w", err)
+		s.failTransaction(transaction.ID)
+		return nil, err
+	}
+
+	if err := s.db.Model(&models.Transaction{}).Where("id = ?", transaction.ID).
+		UpdateColumn("payment_intent_id", intent.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to store payment intent: %w", err)
+	}
+	transaction.PaymentIntentID = intent.ID
+
+	if intent.Status == models.TransactionStatusFailed {
+		if err := s.applyPaymentResult(transaction.ID, intent.ID, intent.Status); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("payment was declined")
 	}
 
 	return &PaymentIntentResponse{
-		ClientSecret: pi.ClientSecret,
-		PaymentID:    pi.ID,
-		Status:       string(pi.Status),
+		TransactionID: &transaction.ID,
+		ClientSecret:  intent.ClientSecret,
+		PaymentID:     intent.ID,
+		Status:        intent.ProviderStatus,
+		Provider:      provider.Name(),
+		ApprovalURL:   intent.ApprovalURL,
+		Amount:        transaction.Amount,
+		Currency:      transaction.Total().Currency,
 	}, nil
 }
 
+// failTransaction fails a transaction whose payment could not be opened
+func (s *PaymentService) failTransaction(transactionID uuid.UUID) {
+	if err := s.applyPaymentResult(transactionID, "", models.TransactionStatusFailed); err != nil {
+		log.Printf("Failed to fail transaction %s: %v", transactionID, err)
+	}
+}
+
 func (s *PaymentService) ConfirmPayment(req *ConfirmPaymentRequest) error {
-	// Get payment intent from Stripe
-	pi, err := paymentintent.Get(req.PaymentIntentID, nil)
-	if err != nil {
-		return fmt.Errorf("failed to get payment intent: %w", err)
+	if req.OrderID != nil {
+		return s.confirmOrderPayment(*req.OrderID, req.PaymentIntentID)
+	}
+	if req.TransactionID == uuid.Nil {
+		return errors.New("transaction_id or order_id is required")
 	}
 
 	// Find transaction
@@ -118,84 +222,153 @@ func (s *PaymentService) ConfirmPayment(req *ConfirmPaymentRequest) error {
 		return fmt.Errorf("transaction not found: %w", err)
 	}
 
-	// Update transaction based on payment status
-	switch pi.Status {
-	case stripe.PaymentIntentStatusSucceeded:
-		now := time.Now()
-		transaction.Status = models.TransactionStatusCompleted
-		transaction.ProcessedAt = &now
-		transaction.PaymentReference = pi.ID
+	if transaction.OrderID != nil {
+		return s.confirmOrderPayment(*transaction.OrderID, req.PaymentIntentID)
+	}
 
-		// Distribute revenue
-		if err := s.distributeRevenue(&transaction); err != nil {
-			// Log error but don't fail the payment confirmation
-			fmt.Printf("Revenue distribution failed: %v\n", err)
-		}
+	provider, err := s.Provider(transaction.PaymentMethod)
+	if err != nil {
+		return err
+	}
 
-	case stripe.PaymentIntentStatusRequiresAction, stripe.PaymentIntentStatusRequiresConfirmation:
-		transaction.Status = models.TransactionStatusPending
+	// Get the payment from its provider
+	intent, err := provider.ConfirmIntent(req.PaymentIntentID)
+	if err != nil {
+		return err
+	}
 
-	default:
-		transaction.Status = models.TransactionStatusFailed
+	// The payment must be the one made for this transaction
+	if transaction.PaymentIntentID != "" && intent.ID != transaction.PaymentIntentID {
+		return errors.New("payment does not belong to this transaction")
+	}
+	if id := intent.Metadata["transaction_id"]; id != "" && id != transaction.ID.String() {
+		return errors.New("payment does not belong to this transaction")
+	}
+	if intent.Status == models.TransactionStatusCompleted && !intent.Amount.Equal(transaction.Total().Round()) {
+		return errors.New("payment amount does not match the transaction")
 	}
 
-	if err := s.db.Save(&transaction).Error; err != nil {
-		return fmt.Errorf("failed to update transaction: %w", err)
+	return s.applyPaymentResult(transaction.ID, intent.ID, intent.Status)
+}
+
+// applyPaymentResult moves a transaction to the outcome of its payment.
+// Completing a transaction distributes its revenue in the same database
+// transaction; completed and refunded transactions are never moved back, so
+// the client confirmation and the provider webhook may both report a payment.
+// A failed payment returns the inventory held for the transaction to stock,
+// and a paid license fee grants its license. Transactions of an order share
+// its payment, so the whole order moves.
+func (s *PaymentService) applyPaymentResult(transactionID uuid.UUID, reference string, status models.TransactionStatus) error {
+	var owner models.Transaction
+	if err := s.db.Select("id", "order_id").First(&owner, transactionID).Error; err == nil && owner.OrderID != nil {
+		return s.applyOrderPaymentResult(*owner.OrderID, reference, status)
+	}
+
+	var completed bool
+	var shares []models.Transaction
+	var transaction models.Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transaction, transactionID).Error; err != nil {
+			return fmt.Errorf("transaction not found: %w", err)
+		}
+
+		var err error
+		completed, shares, err = s.settleTransaction(tx, &transaction, reference, status)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if completed {
+		go s.sendSaleNotifications([]uuid.UUID{transactionID}, shares)
+		if transaction.TransactionType == models.TransactionTypeLicenseFee && s.licenseService != nil {
+			go s.licenseService.licenseFeePaid(&transaction)
+		}
 	}
 
 	return nil
 }
 
-func (s *PaymentService) ProcessRefund(req *RefundRequest, adminID *uuid.UUID) error {
-	// Find transaction
-	var transaction models.Transaction
-	if err := s.db.Preload("Buyer").Preload("Seller").
-		First(&transaction, req.TransactionID).Error; err != nil {
-		return fmt.Errorf("transaction not found: %w", err)
+// settleTransaction applies a payment outcome to a locked transaction. It
+// reports whether the transaction completed, with the revenue shares paid.
+func (s *PaymentService) settleTransaction(tx *gorm.DB, transaction *models.Transaction, reference string, status models.TransactionStatus) (bool, []models.Transaction, error) {
+	if transaction.Status == models.TransactionStatusCompleted || transaction.Status == models.TransactionStatusRefunded {
+		return false, nil, nil
+	}
+	if transaction.Status == status {
+		return false, nil, nil
 	}
 
-	if transaction.Status != models.TransactionStatusCompleted {
-		return errors.New("can only refund completed transactions")
+	if err := s.settleInventory(tx, transaction, status); err != nil {
+		return false, nil, err
 	}
 
-	// Calculate refund amount
-	refundAmount := req.Amount
-	if refundAmount <= 0 || refundAmount > transaction.Amount {
-		refundAmount = transaction.Amount
+	transaction.Status = status
+	if status == models.TransactionStatusCompleted {
+		now := time.Now()
+		transaction.ProcessedAt = &now
+		transaction.PaymentReference = reference
 	}
 
-	// Process refund through Stripe if we have a payment reference
-	if transaction.PaymentReference != "" {
-		refundAmountCents := int64(refundAmount * 100)
-		params := &stripe.RefundParams{
-			PaymentIntent: stripe.String(transaction.PaymentReference),
-			Amount:        stripe.Int64(refundAmountCents),
-			Reason:        stripe.String("requested_by_customer"),
-		}
+	if err := tx.Save(transaction).Error; err != nil {
+		return false, nil, fmt.Errorf("failed to update transaction: %w", err)
+	}
 
-		_, err := refund.New(params)
-		if err != nil {
-			return fmt.Errorf("failed to process refund: %w", err)
+	if status != models.TransactionStatusCompleted {
+		return false, nil, nil
+	}
+
+	// Distribute revenue together with the status change
+	shares, err := s.distributeRevenue(tx, transaction)
+	if err != nil {
+		return false, nil, fmt.Errorf("revenue distribution failed: %w", err)
+	}
+
+	// A paid license fee grants its license
+	if transaction.TransactionType == models.TransactionTypeLicenseFee {
+		if s.licenseService == nil {
+			return false, nil, errors.New("licensing is not configured")
+		}
+		if err := s.licenseService.activatePaidLicense(tx, transaction); err != nil {
+			return false, nil, err
 		}
 	}
 
-	// Update transaction
-	now := time.Now()
-	transaction.Status = models.TransactionStatusRefunded
-	transaction.RefundedAt = &now
-	transaction.RefundReason = req.Reason
+	return true, shares, nil
+}
 
-	if err := s.db.Save(&transaction).Error; err != nil {
-		return fmt.Errorf("failed to update transaction: %w", err)
+// sendSaleNotifications tells buyers and sellers about completed sales and
+// recipients about their revenue shares
+func (s *PaymentService) sendSaleNotifications(transactionIDs []uuid.UUID, shares []models.Transaction) {
+	if s.notificationService == nil {
+		return
 	}
 
-	return nil
+	var transactions []models.Transaction
+	if err := s.db.Preload("Buyer").Preload("Seller").Preload("Product").
+		Where("id IN ? AND transaction_type = ?", transactionIDs, models.TransactionTypeProductSale).
+		Find(&transactions).Error; err != nil {
+		log.Printf("Failed to load sales for notification: %v", err)
+	}
+
+	for i := range transactions {
+		// Buyers of an order get one confirmation for the whole order
+		if transactions[i].OrderID == nil {
+			s.notificationService.SendPurchaseConfirmationNotification(&transactions[i])
+		}
+		s.notificationService.SendSaleNotification(&transactions[i])
+	}
+
+	s.notificationService.SendRevenueShareNotifications(shares)
 }
 
+// GetPaymentHistory lists what a user bought and what they were paid. Revenue
+// shares only show to their recipient, never to the buyer of the sale.
 func (s *PaymentService) GetPaymentHistory(userID uuid.UUID, params utils.PaginationParams) ([]models.Transaction, int64, error) {
 	query := s.db.Model(&models.Transaction{}).
-		Where("buyer_id = ? OR seller_id = ?", userID, userID).
-		Preload("Product")
+		Where("(buyer_id = ? AND transaction_type <> ?) OR seller_id = ?", userID, models.TransactionTypeRevenueShare, userID).
+		Preload("Product").Preload("Refunds")
 
 	// Get total count
 	var total int64
@@ -218,66 +391,146 @@ func (s *PaymentService) GetPaymentHistory(userID uuid.UUID, params utils.Pagina
 }
 
 func (s *PaymentService) GetUserBalance(userID uuid.UUID) (map[string]interface{}, error) {
-	var totalEarnings, pendingPayouts, availableBalance float64
-
-	// Calculate total earnings (as seller)
-	s.db.Model(&models.Transaction{}).
-		Where("seller_id = ? AND status = ?", userID, models.TransactionStatusCompleted).
-		Select("COALESCE(SUM(amount - platform_fee), 0)").Scan(&totalEarnings)
-
-	// Calculate pending payouts (placeholder - would be from a payouts table)
-	pendingPayouts = 0
-
-	// Available balance is total earnings minus pending payouts
-	availableBalance = totalEarnings - pendingPayouts
+	// Balances are derived from the double-entry ledger
+	balance, err := s.accountingService.GetUserBalance(userID)
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
-		"total_earnings":    totalEarnings,
-		"pending_payouts":   pendingPayouts,
-		"available_balance": availableBalance,
-		"currency":          "USD",
+		"total_earnings":    models.DecimalNumber(balance.TotalEarnings),
+		"pending_balance":   models.DecimalNumber(balance.Pending),
+		"pending_payouts":   models.DecimalNumber(balance.Reserved),
+		"available_balance": models.DecimalNumber(balance.Available),
+		"paid_out":          models.DecimalNumber(balance.PaidOut),
+		"currency":          balance.Currency,
+		"currencies":        balance.Currencies,
 	}, nil
 }
 
-func (s *PaymentService) RequestPayout(userID uuid.UUID, req *PayoutRequest) error {
-	// Verify user balance
-	balance, err := s.GetUserBalance(userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user balance: %w", err)
+func (s *PaymentService) GetStatement(userID uuid.UUID, params utils.PaginationParams) ([]models.JournalLine, int64, error) {
+	return s.accountingService.GetStatement(userID, params)
+}
+
+// settleInventory keeps the inventory reserved by a product sale in line
+// with its payment: a failed payment releases the reservations, a successful
+// one commits them, and a payment that succeeds after failing reserves the
+// units again.
+func (s *PaymentService) settleInventory(tx *gorm.DB, transaction *models.Transaction, status models.TransactionStatus) error {
+	if transaction.TransactionType != models.TransactionTypeProductSale {
+		return nil
 	}
+	if s.inventoryService == nil {
+		return errors.New("inventory is not configured")
+	}
+
+	switch status {
+	case models.TransactionStatusFailed:
+		return s.inventoryService.Release(tx, transaction.ID)
+
+	case models.TransactionStatusCompleted:
+		if transaction.Status == models.TransactionStatusFailed {
+			// The buyer has paid, so the sale stands even if the stock is
+			// gone; admins restock or refund it
+			soldOut, err := s.inventoryService.Reclaim(tx, transaction.ID)
+			if err != nil {
+				return err
+			}
+			if len(soldOut) > 0 {
+				if s.notificationService == nil {
+					log.Printf("Transaction %s was paid after products %v sold out", transaction.ID, soldOut)
+				} else if err := s.notificationService.SendOversoldNotification(tx, transaction, soldOut); err != nil {
+					return err
+				}
+			}
+		}
 
-	availableBalance := balance["available_balance"].(float64)
-	if req.Amount > availableBalance {
-		return errors.New("insufficient balance for payout")
+		return s.inventoryService.Commit(tx, transaction.ID)
 	}
 
-	if req.Amount < s.config.Payment.MinimumPayout {
-		return fmt.Errorf("minimum payout amount is $%.2f", s.config.Payment.MinimumPayout)
+	return nil
+}
+
+// ReleaseExpiredReservations fails pending purchases that were not paid
+// before their inventory reservation expired, returning their units to
+// stock. Reservations of transactions that settled without releasing them
+// are closed as well. It returns the number of reservations released.
+func (s *PaymentService) ReleaseExpiredReservations() (int, error) {
+	reservations, err := s.inventoryService.ExpiredReservations(500)
+	if err != nil {
+		return 0, err
 	}
 
-	// TODO: Create payout record (would be in a separate payouts table)
-	// For now, we'll just log it
-	fmt.Printf("Payout request: User %s, Amount: $%.2f, Method: %s\n",
-		userID, req.Amount, req.Method)
+	released := 0
+	for _, reservation := range reservations {
+		var transaction models.Transaction
+		if err := s.db.Select("id", "status").First(&transaction, reservation.TransactionID).Error; err != nil &&
+			!errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to load transaction %s: %v", reservation.TransactionID, err)
+			continue
+		}
 
-	return nil
+		switch transaction.Status {
+		case models.TransactionStatusCompleted, models.TransactionStatusRefunded:
+			// Paid units stay sold
+			if err := s.db.Transaction(func(tx *gorm.DB) error {
+				return s.inventoryService.Commit(tx, reservation.TransactionID)
+			}); err != nil {
+				log.Printf("Failed to commit reservation of transaction %s: %v", reservation.TransactionID, err)
+			}
+			continue
+		case models.TransactionStatusPending:
+			err = s.applyPaymentResult(transaction.ID, "", models.TransactionStatusFailed)
+		default:
+			err = s.db.Transaction(func(tx *gorm.DB) error {
+				return s.inventoryService.Release(tx, reservation.TransactionID)
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to release reservation of transaction %s: %v", reservation.TransactionID, err)
+			continue
+		}
+		released++
+	}
+
+	return released, nil
 }
 
-func (s *PaymentService) distributeRevenue(transaction *models.Transaction) error {
-	// Parse revenue shares
-	var revenueShares map[string]interface{}
-	if err := json.Unmarshal([]byte(fmt.Sprintf("%v", transaction.RevenueShares)), &revenueShares); err != nil {
-		return fmt.Errorf("failed to parse revenue shares: %w", err)
+// StartReservationReaper releases expired reservations every minute until
+// ctx is done, keeps products' sold_out status in line with their stock and
+// finishes refunds left pending
+func (s *PaymentService) StartReservationReaper(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ReleaseExpiredReservations(); err != nil {
+				log.Printf("Reservation reaper run failed: %v", err)
+			}
+			if _, err := s.inventoryService.SyncAvailability(); err != nil {
+				log.Printf("Product availability sync failed: %v", err)
+			}
+			if _, err := s.FinalizePendingRefunds(); err != nil {
+				log.Printf("Pending refund run failed: %v", err)
+			}
+		}
 	}
+}
 
-	// In a real implementation, this would:
-	// 1. Update user balances
-	// 2. Create individual transaction records for each share
-	// 3. Handle escrow for disputed transactions
-	// 4. Send notifications to recipients
+// distributeRevenue posts a completed sale to the ledger and pays every
+// recipient their share as a revenue_share transaction
+func (s *PaymentService) distributeRevenue(tx *gorm.DB, transaction *models.Transaction) ([]models.Transaction, error) {
+	if s.accountingService == nil {
+		return nil, errors.New("accounting is not configured")
+	}
 
-	fmt.Printf("Distributing revenue for transaction %s: %+v\n",
-		transaction.ID, revenueShares)
+	if err := s.accountingService.RecordSale(tx, transaction); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return s.accountingService.DistributeRevenue(tx, transaction)
 }
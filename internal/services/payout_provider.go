@@ -0,0 +1,153 @@
+// internal/services/payout_provider.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/transfer"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// PayoutProvider sends a payout to the user's external account. Name is the
+// payout method users choose when requesting a payout. PayoutStatus looks
+// up a payout that was sent, so processing payouts can be settled later.
+type PayoutProvider interface {
+	Name() string
+	Send(payout *models.Payout) (*PayoutResult, error)
+	PayoutStatus(payout *models.Payout) (*PayoutResult, error)
+}
+
+// PayoutResult is the provider's answer to a payout. Status is paid when the
+// money has left, processing when the provider confirms it later, or failed
+// with a Reason when the money will not be sent.
+type PayoutResult struct {
+	Reference string
+	Status    models.PayoutStatus
+	Reason    string
+}
+
+// StripePayoutProvider pays out through Stripe Connect transfers to the
+// connected account in AccountInfo["stripe_account_id"]
+type StripePayoutProvider struct{}
+
+func NewStripePayoutProvider() *StripePayoutProvider {
+	return &StripePayoutProvider{}
+}
+
+func (p *StripePayoutProvider) Name() string {
+	return "stripe"
+}
+
+func (p *StripePayoutProvider) Send(payout *models.Payout) (*PayoutResult, error) {
+	destination, _ := payout.AccountInfo["stripe_account_id"].(string)
+	if destination == "" {
+		return nil, errors.New("stripe_account_id is required for Stripe payouts")
+	}
+
+	params := &stripe.TransferParams{
+		Amount:        stripe.Int64(payout.Total().MinorUnits()),
+		Currency:      stripe.String(strings.ToLower(payout.Total().Currency)),
+		Destination:   stripe.String(destination),
+		TransferGroup: stripe.String("payout_" + payout.ID.String()),
+	}
+	params.SetIdempotencyKey(fmt.Sprintf("payout_%s_%d", payout.ID, payout.Attempts))
+
+	tr, err := transfer.New(params)
+	if err != nil {
+		return nil, fmt.Errorf("stripe transfer failed: %w", err)
+	}
+
+	return &PayoutResult{Reference: tr.ID, Status: models.PayoutStatusPaid}, nil
+}
+
+// PayoutStatus finds the payout's transfer by its transfer group, so a
+// transfer whose reference was never saved is still found
+func (p *StripePayoutProvider) PayoutStatus(payout *models.Payout) (*PayoutResult, error) {
+	params := &stripe.TransferListParams{TransferGroup: stripe.String("payout_" + payout.ID.String())}
+	iter := transfer.List(params)
+	for iter.Next() {
+		tr := iter.Transfer()
+		if tr.Reversed {
+			return &PayoutResult{Reference: tr.ID, Status: models.PayoutStatusFailed, Reason: "stripe transfer was reversed"}, nil
+		}
+		return &PayoutResult{Reference: tr.ID, Status: models.PayoutStatusPaid}, nil
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stripe transfers: %w", err)
+	}
+
+	return &PayoutResult{Status: models.PayoutStatusFailed, Reason: "no stripe transfer was made"}, nil
+}
+
+// FakePayoutProvider records payouts in memory. Set Err to make payouts
+// fail, or Pending to leave them processing.
+type FakePayoutProvider struct {
+	Err     error
+	Pending bool
+
+	mu         sync.Mutex
+	sent       []models.Payout
+	references map[uuid.UUID]string
+}
+
+func NewFakePayoutProvider() *FakePayoutProvider {
+	return &FakePayoutProvider{references: make(map[uuid.UUID]string)}
+}
+
+func (p *FakePayoutProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePayoutProvider) Send(payout *models.Payout) (*PayoutResult, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+
+	reference := "fake_" + uuid.NewString()
+
+	p.mu.Lock()
+	p.sent = append(p.sent, *payout)
+	p.references[payout.ID] = reference
+	p.mu.Unlock()
+
+	status := models.PayoutStatusPaid
+	if p.Pending {
+		status = models.PayoutStatusProcessing
+	}
+
+	return &PayoutResult{Reference: reference, Status: status}, nil
+}
+
+// PayoutStatus reports sent payouts paid once Pending is cleared, and
+// payouts it never accepted as failed
+func (p *FakePayoutProvider) PayoutStatus(payout *models.Payout) (*PayoutResult, error) {
+	if p.Err != nil {
+		return nil, p.Err
+	}
+
+	p.mu.Lock()
+	reference, ok := p.references[payout.ID]
+	p.mu.Unlock()
+
+	if !ok {
+		return &PayoutResult{Status: models.PayoutStatusFailed, Reason: "payout was never sent"}, nil
+	}
+	if p.Pending {
+		return &PayoutResult{Reference: reference, Status: models.PayoutStatusProcessing}, nil
+	}
+
+	return &PayoutResult{Reference: reference, Status: models.PayoutStatusPaid}, nil
+}
+
+// Sent returns the payouts the provider has accepted
+func (p *FakePayoutProvider) Sent() []models.Payout {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]models.Payout(nil), p.sent...)
+}
@@ -0,0 +1,487 @@
+// internal/services/payout_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// PayoutService handles payout requests, admin review and settlement through
+// the registered payout providers
+type PayoutService struct {
+	db                  *gorm.DB
+	config              *config.Config
+	accountingService   *AccountingService
+	notificationService *NotificationService
+	providers           map[string]PayoutProvider
+}
+
+type PayoutRequest struct {
+	Amount      decimal.Decimal        `json:"amount" validate:"required"`
+	Currency    string                 `json:"currency,omitempty" validate:"omitempty,iso4217"`
+	Method      string                 `json:"method" validate:"required"`
+	AccountInfo map[string]interface{} `json:"account_info,omitempty"`
+}
+
+type PayoutReviewRequest struct {
+	Notes string `json:"notes,omitempty"`
+}
+
+type PayoutRejectRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type PayoutCompleteRequest struct {
+	Reference string `json:"reference,omitempty"`
+}
+
+type PayoutFailRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// payoutReconcileDelay keeps reconciliation away from payouts whose
+// provider call may still be in flight
+const payoutReconcileDelay = 10 * time.Minute
+
+// payoutTransitions lists the states each payout state may move to
+var payoutTransitions = map[models.PayoutStatus][]models.PayoutStatus{
+	models.PayoutStatusRequested:  {models.PayoutStatusApproved, models.PayoutStatusRejected},
+	models.PayoutStatusApproved:   {models.PayoutStatusProcessing},
+	models.PayoutStatusProcessing: {models.PayoutStatusPaid, models.PayoutStatusFailed},
+}
+
+// CanTransitionPayout reports whether a payout may move from one state to another
+func CanTransitionPayout(from, to models.PayoutStatus) bool {
+	for _, next := range payoutTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+func NewPayoutService(db *gorm.DB, config *config.Config, accountingService *AccountingService, notificationService *NotificationService) *PayoutService {
+	return &PayoutService{
+		db:                  db,
+		config:              config,
+		accountingService:   accountingService,
+		notificationService: notificationService,
+		providers:           make(map[string]PayoutProvider),
+	}
+}
+
+// RegisterProvider makes a provider available as a payout method
+func (s *PayoutService) RegisterProvider(provider PayoutProvider) {
+	s.providers[provider.Name()] = provider
+}
+
+// Methods lists the registered payout methods
+func (s *PayoutService) Methods() []string {
+	methods := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		methods = append(methods, name)
+	}
+	return methods
+}
+
+// RequestPayout creates a payout for review and reserves its amount
+func (s *PayoutService) RequestPayout(userID uuid.UUID, req *PayoutRequest) (*models.Payout, error) {
+	// Validate request
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if _, ok := s.providers[req.Method]; !ok {
+		return nil, fmt.Errorf("unsupported payout method: %s", req.Method)
+	}
+
+	// Funds are paid out in the currency they were earned in
+	amount := models.NewMoney(req.Amount, req.Currency)
+	if !amount.IsPositive() {
+		return nil, errors.New("amount must be positive")
+	}
+	if !amount.Amount.Equal(amount.Round().Amount) {
+		return nil, fmt.Errorf("amount has more decimal places than %s allows", amount.Currency)
+	}
+
+	// The minimum is set in the reporting currency
+	exchange := s.accountingService.exchange()
+	converted, err := exchange.ToReporting(amount)
+	if err != nil {
+		return nil, fmt.Errorf("payouts in %s are not supported: %w", amount.Currency, err)
+	}
+	minimum := decimal.NewFromFloat(s.config.Payment.MinimumPayout)
+	if converted.Amount.LessThan(minimum) {
+		return nil, fmt.Errorf("minimum payout amount is %s %s", minimum.StringFixed(2), exchange.ReportingCurrency())
+	}
+
+	payout := &models.Payout{
+		UserID:      userID,
+		Amount:      amount.Amount,
+		Currency:    amount.Currency,
+		Method:      req.Method,
+		AccountInfo: models.JSONB(req.AccountInfo),
+		Status:      models.PayoutStatusRequested,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payout).Error; err != nil {
+			return fmt.Errorf("failed to create payout: %w", err)
+		}
+		return s.accountingService.ReserveFunds(tx, userID, payout.Total(), payout.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payout, nil
+}
+
+func (s *PayoutService) GetUserPayouts(userID uuid.UUID, params utils.PaginationParams) ([]models.Payout, int64, error) {
+	query := s.db.Model(&models.Payout{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count payouts: %w", err)
+	}
+
+	var payouts []models.Payout
+	if err := utils.ApplyPagination(query.Order("created_at DESC"), params).Find(&payouts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch payouts: %w", err)
+	}
+
+	return payouts, total, nil
+}
+
+func (s *PayoutService) GetPayout(id, userID uuid.UUID) (*models.Payout, error) {
+	var payout models.Payout
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&payout).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("payout not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &payout, nil
+}
+
+// GetPayoutQueue lists payouts for admin review, oldest first
+func (s *PayoutService) GetPayoutQueue(status models.PayoutStatus, params utils.PaginationParams) ([]models.Payout, int64, error) {
+	if status == "" {
+		status = models.PayoutStatusRequested
+	}
+
+	query := s.db.Model(&models.Payout{}).Where("status = ?", status)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count payouts: %w", err)
+	}
+
+	var payouts []models.Payout
+	if err := utils.ApplyPagination(query.Preload("User").Order("created_at ASC"), params).
+		Find(&payouts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch payouts: %w", err)
+	}
+
+	return payouts, total, nil
+}
+
+// ApprovePayout approves a requested payout and sends it to its provider
+func (s *PayoutService) ApprovePayout(id, adminID uuid.UUID, notes string) (*models.Payout, error) {
+	now := time.Now()
+	if err := s.transition(s.db, id, models.PayoutStatusRequested, models.PayoutStatusApproved, map[string]interface{}{
+		"reviewed_by":  adminID,
+		"reviewed_at":  now,
+		"review_notes": notes,
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.ProcessPayout(id)
+}
+
+// RejectPayout rejects a requested payout and returns the reserved funds
+func (s *PayoutService) RejectPayout(id, adminID uuid.UUID, reason string) (*models.Payout, error) {
+	var payout models.Payout
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := s.transition(tx, id, models.PayoutStatusRequested, models.PayoutStatusRejected, map[string]interface{}{
+			"reviewed_by":    adminID,
+			"reviewed_at":    now,
+			"review_notes":   reason,
+			"failure_reason": reason,
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.First(&payout, id).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		return s.accountingService.ReleaseFunds(tx, payout.UserID, payout.Total(), payout.ID, "rejected")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.sendStatusNotification(payout.ID)
+
+	return &payout, nil
+}
+
+// ProcessPayout sends an approved payout to its provider. The provider is
+// called outside any database transaction; its answer settles the payout.
+func (s *PayoutService) ProcessPayout(id uuid.UUID) (*models.Payout, error) {
+	if err := s.transition(s.db, id, models.PayoutStatusApproved, models.PayoutStatusProcessing, map[string]interface{}{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"processed_at": time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	var payout models.Payout
+	if err := s.db.First(&payout, id).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	provider, ok := s.providers[payout.Method]
+	if !ok {
+		return s.FailPayout(id, fmt.Sprintf("unsupported payout method: %s", payout.Method))
+	}
+
+	result, err := provider.Send(&payout)
+	if err != nil {
+		return s.FailPayout(id, err.Error())
+	}
+
+	// Keep the reference before settling, so a payout whose settlement
+	// fails can still be reconciled with its provider
+	if err := s.db.Model(&models.Payout{}).Where("id = ?", id).
+		Update("provider_reference", result.Reference).Error; err != nil {
+		return nil, fmt.Errorf("failed to update payout: %w", err)
+	}
+
+	switch result.Status {
+	case models.PayoutStatusPaid:
+		return s.CompletePayout(id, result.Reference)
+	case models.PayoutStatusFailed:
+		return s.FailPayout(id, result.Reason)
+	}
+
+	// The provider settles later; ReconcilePayouts picks up its answer
+	payout.ProviderReference = result.Reference
+	return &payout, nil
+}
+
+// ReconcilePayouts asks providers about payouts that are still processing
+// and settles the ones they have paid or failed. A payout is only failed
+// when its provider says so: one that cannot be looked up may still have
+// been sent, so it stays processing, and past the stale limit it is
+// flagged to admins along with payouts the provider still reports pending.
+func (s *PayoutService) ReconcilePayouts() (int, error) {
+	now := time.Now()
+	var payouts []models.Payout
+	if err := s.db.Where("status = ? AND processed_at < ?", models.PayoutStatusProcessing, now.Add(-payoutReconcileDelay)).
+		Order("processed_at ASC").Find(&payouts).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch processing payouts: %w", err)
+	}
+
+	staleBefore := now.Add(-time.Duration(s.config.Payment.PayoutStaleHours) * time.Hour)
+	settled := 0
+	for i := range payouts {
+		payout := &payouts[i]
+		stale := payout.ProcessedAt != nil && payout.ProcessedAt.Before(staleBefore)
+
+		result, err := s.providerStatus(payout)
+		switch {
+		case err != nil:
+			log.Printf("Failed to check payout %s with its provider: %v", payout.ID, err)
+			if stale {
+				s.flagStalePayout(payout, fmt.Sprintf("could not be checked with %s: %v", payout.Method, err))
+			}
+			continue
+		case result.Status == models.PayoutStatusPaid:
+			_, err = s.CompletePayout(payout.ID, result.Reference)
+		case result.Status == models.PayoutStatusFailed:
+			_, err = s.FailPayout(payout.ID, result.Reason)
+		default:
+			if stale {
+				s.flagStalePayout(payout, fmt.Sprintf("is still processing with %s", payout.Method))
+			}
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Failed to settle payout %s: %v", payout.ID, err)
+			continue
+		}
+		settled++
+	}
+
+	return settled, nil
+}
+
+// flagStalePayout raises an admin notification for a payout that has not
+// settled by the stale limit, once per payout
+func (s *PayoutService) flagStalePayout(payout *models.Payout, problem string) {
+	log.Printf("Payout %s %s after %d hours and needs review", payout.ID, problem, s.config.Payment.PayoutStaleHours)
+	if s.notificationService == nil {
+		return
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "stale_payout:"+payout.ID.String()).Error; err != nil {
+			return fmt.Errorf("failed to lock payout: %w", err)
+		}
+
+		var flagged int64
+		if err := tx.Model(&models.AdminNotification{}).
+			Where("type = ? AND related_resource_id = ?", models.AdminNotificationStalePayout, payout.ID).
+			Count(&flagged).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if flagged > 0 {
+			return nil
+		}
+
+		return s.notificationService.SendStalePayoutNotification(tx, payout, problem, s.config.Payment.PayoutStaleHours)
+	})
+	if err != nil {
+		log.Printf("Failed to flag stale payout %s: %v", payout.ID, err)
+	}
+}
+
+// StartPayoutReconciler reconciles processing payouts every hour until ctx is done
+func (s *PayoutService) StartPayoutReconciler(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ReconcilePayouts(); err != nil {
+				log.Printf("Payout reconciliation failed: %v", err)
+			}
+		}
+	}
+}
+
+// providerStatus looks a payout up with the provider it was sent through
+func (s *PayoutService) providerStatus(payout *models.Payout) (*PayoutResult, error) {
+	provider, ok := s.providers[payout.Method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payout method: %s", payout.Method)
+	}
+	return provider.PayoutStatus(payout)
+}
+
+// CompletePayout marks a processing payout paid and takes the reserved
+// funds off the platform's books
+func (s *PayoutService) CompletePayout(id uuid.UUID, reference string) (*models.Payout, error) {
+	var payout models.Payout
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		updates := map[string]interface{}{"paid_at": now}
+		if reference != "" {
+			updates["provider_reference"] = reference
+		}
+		if err := s.transition(tx, id, models.PayoutStatusProcessing, models.PayoutStatusPaid, updates); err != nil {
+			return err
+		}
+
+		if err := tx.First(&payout, id).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		return s.accountingService.CompletePayout(tx, payout.UserID, payout.Total(), payout.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.sendStatusNotification(payout.ID)
+
+	return &payout, nil
+}
+
+// FailPayout marks a processing payout failed and returns the reserved funds
+func (s *PayoutService) FailPayout(id uuid.UUID, reason string) (*models.Payout, error) {
+	var payout models.Payout
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.transition(tx, id, models.PayoutStatusProcessing, models.PayoutStatusFailed, map[string]interface{}{
+			"failure_reason": reason,
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.First(&payout, id).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		return s.accountingService.ReleaseFunds(tx, payout.UserID, payout.Total(), payout.ID,
+			"attempt-"+strconv.Itoa(payout.Attempts))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Payout %s failed: %s", id, reason)
+	go s.sendStatusNotification(payout.ID)
+
+	return &payout, nil
+}
+
+// transition moves a payout between states only if it is still in from, so
+// concurrent reviews cannot both succeed
+func (s *PayoutService) transition(tx *gorm.DB, id uuid.UUID, from, to models.PayoutStatus, updates map[string]interface{}) error {
+	if !CanTransitionPayout(from, to) {
+		return fmt.Errorf("payout cannot move from %s to %s", from, to)
+	}
+
+	updates["status"] = to
+	result := tx.Model(&models.Payout{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update payout: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		var payout models.Payout
+		if err := tx.First(&payout, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("payout not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+		return fmt.Errorf("payout is %s, expected %s", payout.Status, from)
+	}
+
+	return nil
+}
+
+func (s *PayoutService) sendStatusNotification(id uuid.UUID) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var payout models.Payout
+	if err := s.db.Preload("User").First(&payout, id).Error; err != nil {
+		return
+	}
+
+	s.notificationService.SendPayoutStatusNotification(&payout)
+}
@@ -0,0 +1,395 @@
+// internal/services/paypal_provider.go
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// PayPalPaymentProvider takes payments with PayPal checkout orders, which
+// the buyer approves on PayPal before they are captured, and pays out with
+// PayPal Payouts to AccountInfo["paypal_email"]
+type PayPalPaymentProvider struct {
+	baseURL      string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+func NewPayPalPaymentProvider(baseURL, clientID, clientSecret string) *PayPalPaymentProvider {
+	return &PayPalPaymentProvider{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *PayPalPaymentProvider) Name() string {
+	return "paypal"
+}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code,omitempty"`
+	Currency     string `json:"currency,omitempty"`
+	Value        string `json:"value"`
+}
+
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		CustomID string       `json:"custom_id"`
+		Amount   paypalAmount `json:"amount"`
+		Payments struct {
+			Captures []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+	Links []struct {
+		Href string `json:"href"`
+		Rel  string `json:"rel"`
+	} `json:"links"`
+}
+
+func (p *PayPalPaymentProvider) CreateIntent(req *IntentRequest) (*ProviderIntent, error) {
+	value, err := formatPayPalValue(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// PayPal keeps one custom_id per purchase unit; the transaction ID is the
+	// metadata webhooks and reconciliation need back
+	body := map[string]interface{}{
+		"intent": "CAPTURE",
+		"purchase_units": []map[string]interface{}{{
+			"custom_id": req.Metadata["transaction_id"],
+			"amount": paypalAmount{
+				CurrencyCode: req.Amount.Currency,
+				Value:        value,
+			},
+		}},
+	}
+
+	var order paypalOrder
+	if err := p.do(http.MethodPost, "/v2/checkout/orders", body, req.IdempotencyKey, &order); err != nil {
+		return nil, fmt.Errorf("failed to create paypal order: %w", err)
+	}
+
+	return paypalIntent(&order, req.Metadata), nil
+}
+
+// ConfirmIntent captures an order once the buyer has approved it
+func (p *PayPalPaymentProvider) ConfirmIntent(id string) (*ProviderIntent, error) {
+	var order paypalOrder
+	if err := p.do(http.MethodGet, "/v2/checkout/orders/"+url.PathEscape(id), nil, "", &order); err != nil {
+		return nil, fmt.Errorf("failed to get paypal order: %w", err)
+	}
+
+	if order.Status == "APPROVED" {
+		if err := p.do(http.MethodPost, "/v2/checkout/orders/"+url.PathEscape(id)+"/capture",
+			map[string]interface{}{}, "capture_"+id, &order); err != nil {
+			return nil, fmt.Errorf("failed to capture paypal order: %w", err)
+		}
+	}
+
+	return paypalIntent(&order, nil), nil
+}
+
+// Refund refunds the capture of the order in the payment reference
+func (p *PayPalPaymentProvider) Refund(req *ProviderRefundRequest) (*ProviderRefund, error) {
+	var order paypalOrder
+	if err := p.do(http.MethodGet, "/v2/checkout/orders/"+url.PathEscape(req.PaymentReference), nil, "", &order); err != nil {
+		return nil, fmt.Errorf("failed to get paypal order: %w", err)
+	}
+
+	captureID := ""
+	for _, unit := range order.PurchaseUnits {
+		for _, capture := range unit.Payments.Captures {
+			captureID = capture.ID
+		}
+	}
+	if captureID == "" {
+		return nil, errors.New("paypal order has not been captured")
+	}
+
+	value, err := formatPayPalValue(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"amount": paypalAmount{
+			CurrencyCode: req.Amount.Currency,
+			Value:        value,
+		},
+		"note_to_payer": req.Reason,
+	}
+
+	var result struct {
+		ID     string       `json:"id"`
+		Status string       `json:"status"`
+		Amount paypalAmount `json:"amount"`
+	}
+	if err := p.do(http.MethodPost, "/v2/payments/captures/"+url.PathEscape(captureID)+"/refund",
+		body, req.IdempotencyKey, &result); err != nil {
+		return nil, fmt.Errorf("failed to process refund: %w", err)
+	}
+
+	return &ProviderRefund{ID: result.ID, Amount: req.Amount, Status: strings.ToLower(result.Status)}, nil
+}
+
+// Send pays out with a single-item PayPal payout batch. PayPal settles
+// batches asynchronously, so the payout stays processing.
+func (p *PayPalPaymentProvider) Send(payout *models.Payout) (*PayoutResult, error) {
+	receiver, _ := payout.AccountInfo["paypal_email"].(string)
+	if receiver == "" {
+		return nil, errors.New("paypal_email is required for PayPal payouts")
+	}
+
+	value, err := formatPayPalValue(payout.Total())
+	if err != nil {
+		return nil, err
+	}
+
+	batchID := fmt.Sprintf("payout_%s_%d", payout.ID, payout.Attempts)
+	body := map[string]interface{}{
+		"sender_batch_header": map[string]string{
+			"sender_batch_id": batchID,
+			"email_subject":   "You have a payout from IP Marketplace",
+		},
+		"items": []map[string]interface{}{{
+			"recipient_type": "EMAIL",
+			"receiver":       receiver,
+			"sender_item_id": payout.ID.String(),
+			"amount": paypalAmount{
+				Currency: models.NormalizeCurrency(payout.Currency),
+				Value:    value,
+			},
+		}},
+	}
+
+	var result paypalPayoutBatch
+	if err := p.do(http.MethodPost, "/v1/payments/payouts", body, batchID, &result); err != nil {
+		return nil, fmt.Errorf("paypal payout failed: %w", err)
+	}
+
+	return result.payoutResult(), nil
+}
+
+// PayoutStatus looks up the payout's batch. A batch is only found by the
+// ID PayPal returned, so payouts without a reference cannot be looked up.
+func (p *PayPalPaymentProvider) PayoutStatus(payout *models.Payout) (*PayoutResult, error) {
+	if payout.ProviderReference == "" {
+		return nil, errors.New("payout has no paypal batch reference")
+	}
+
+	var result paypalPayoutBatch
+	if err := p.do(http.MethodGet, "/v1/payments/payouts/"+url.PathEscape(payout.ProviderReference),
+		nil, "", &result); err != nil {
+		return nil, fmt.Errorf("failed to get paypal payout: %w", err)
+	}
+
+	return result.payoutResult(), nil
+}
+
+// paypalPayoutBatch is a PayPal payout batch with its items
+type paypalPayoutBatch struct {
+	BatchHeader struct {
+		PayoutBatchID string `json:"payout_batch_id"`
+		BatchStatus   string `json:"batch_status"`
+	} `json:"batch_header"`
+	Items []struct {
+		TransactionStatus string `json:"transaction_status"`
+	} `json:"items"`
+}
+
+// payoutResult maps the batch onto the payout it sends. A processed batch
+// only means PayPal accepted it, so the payout follows the status of its
+// single item; unclaimed items stay processing, as PayPal returns them to
+// the sender if they are never claimed.
+func (b *paypalPayoutBatch) payoutResult() *PayoutResult {
+	result := &PayoutResult{Reference: b.BatchHeader.PayoutBatchID, Status: models.PayoutStatusProcessing}
+
+	switch b.BatchHeader.BatchStatus {
+	case "DENIED", "CANCELED":
+		result.Status = models.PayoutStatusFailed
+		result.Reason = "paypal payout batch " + strings.ToLower(b.BatchHeader.BatchStatus)
+		return result
+	}
+	if len(b.Items) == 0 {
+		return result
+	}
+
+	switch status := b.Items[0].TransactionStatus; status {
+	case "SUCCESS":
+		result.Status = models.PayoutStatusPaid
+	case "FAILED", "RETURNED", "BLOCKED", "REFUNDED", "REVERSED", "DENIED":
+		result.Status = models.PayoutStatusFailed
+		result.Reason = "paypal payout item " + strings.ToLower(status)
+	}
+
+	return result
+}
+
+func paypalIntent(order *paypalOrder, metadata map[string]string) *ProviderIntent {
+	intent := &ProviderIntent{
+		ID:             order.ID,
+		Status:         paypalOrderTransactionStatus(order.Status),
+		ProviderStatus: order.Status,
+		Metadata:       metadata,
+	}
+
+	for _, link := range order.Links {
+		if link.Rel == "approve" || link.Rel == "payer-action" {
+			intent.ApprovalURL = link.Href
+		}
+	}
+
+	if len(order.PurchaseUnits) > 0 {
+		unit := order.PurchaseUnits[0]
+		amount, _ := decimal.NewFromString(unit.Amount.Value)
+		intent.Amount = models.NewMoney(amount, unit.Amount.CurrencyCode)
+		if unit.CustomID != "" && intent.Metadata == nil {
+			intent.Metadata = map[string]string{"transaction_id": unit.CustomID}
+		}
+	}
+
+	return intent
+}
+
+// paypalOrderTransactionStatus maps a PayPal order status onto the status
+// of the transaction it pays for
+func paypalOrderTransactionStatus(status string) models.TransactionStatus {
+	switch status {
+	case "COMPLETED":
+		return models.TransactionStatusCompleted
+	case "VOIDED":
+		return models.TransactionStatusFailed
+	default:
+		return models.TransactionStatusPending
+	}
+}
+
+// paypalWholeUnitCurrencies are currencies PayPal only accepts without
+// decimals, although they have minor units
+var paypalWholeUnitCurrencies = map[string]bool{"HUF": true, "TWD": true}
+
+func formatPayPalValue(amount models.Money) (string, error) {
+	amount = amount.Round()
+	if paypalWholeUnitCurrencies[amount.Currency] {
+		if !amount.Amount.Equal(amount.Amount.Truncate(0)) {
+			return "", fmt.Errorf("paypal only accepts whole %s amounts", amount.Currency)
+		}
+		return amount.Amount.StringFixed(0), nil
+	}
+	return amount.StringFixed(), nil
+}
+
+// do sends an authenticated JSON request; requestID makes POSTs idempotent
+func (p *PayPalPaymentProvider) do(method, path string, body interface{}, requestID string, out interface{}) error {
+	token, err := p.accessToken()
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Prefer", "return=representation")
+	if requestID != "" {
+		req.Header.Set("PayPal-Request-Id", requestID)
+	}
+
+	return p.send(req, out)
+}
+
+// accessToken returns a cached OAuth token, fetching a new one shortly
+// before the old one expires
+func (p *PayPalPaymentProvider) accessToken() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.baseURL+"/v1/oauth2/token",
+		strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.clientID, p.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := p.send(req, &result); err != nil {
+		return "", fmt.Errorf("paypal authentication failed: %w", err)
+	}
+
+	p.token = result.AccessToken
+	p.tokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return p.token, nil
+}
+
+func (p *PayPalPaymentProvider) send(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Name    string `json:"name"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(payload, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("paypal %s: %s", apiErr.Name, apiErr.Message)
+		}
+		return fmt.Errorf("paypal returned status %d", resp.StatusCode)
+	}
+
+	if out == nil || len(payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(payload, out)
+}
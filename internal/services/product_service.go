@@ -4,10 +4,12 @@ package services
 import (
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 
 	"github.com/javajoker/imi-backend/internal/models"
@@ -18,6 +20,9 @@ type ProductService struct {
 	db                   *gorm.DB
 	authorizationService *AuthorizationService
 	notificationService  *NotificationService
+	accountingService    *AccountingService
+	paymentService       *PaymentService
+	inventoryService     *InventoryService
 }
 
 type CreateProductRequest struct {
@@ -25,7 +30,8 @@ type CreateProductRequest struct {
 	Title          string                 `json:"title" validate:"required,min=3,max=255"`
 	Description    string                 `json:"description" validate:"required,min=10"`
 	Category       string                 `json:"category" validate:"required"`
-	Price          float64                `json:"price" validate:"required,min=0.01"`
+	Price          decimal.Decimal        `json:"price" validate:"required,min=0.01"`
+	Currency       string                 `json:"currency,omitempty" validate:"omitempty,iso4217"`
 	InventoryCount int                    `json:"inventory_count" validate:"min=0"`
 	Images         []string               `json:"images,omitempty"`
 	Specifications map[string]interface{} `json:"specifications,omitempty"`
@@ -36,7 +42,8 @@ type UpdateProductRequest struct {
 	Title          string                 `json:"title,omitempty" validate:"omitempty,min=3,max=255"`
 	Description    string                 `json:"description,omitempty" validate:"omitempty,min=10"`
 	Category       string                 `json:"category,omitempty"`
-	Price          float64                `json:"price,omitempty" validate:"omitempty,min=0.01"`
+	Price          decimal.Decimal        `json:"price,omitempty" validate:"omitempty,min=0.01"`
+	Currency       string                 `json:"currency,omitempty" validate:"omitempty,iso4217"`
 	InventoryCount int                    `json:"inventory_count,omitempty" validate:"omitempty,min=0"`
 	Images         []string               `json:"images,omitempty"`
 	Specifications map[string]interface{} `json:"specifications,omitempty"`
@@ -55,6 +62,13 @@ type ProductSearchParams struct {
 	InStock   *bool                 `json:"in_stock,omitempty"`
 }
 
+// ErrOutsideTerritory is returned when a purchase ships outside the territory
+// a product is licensed for
+var ErrOutsideTerritory = errors.New("outside the licensed territory")
+
+// PurchaseProductRequest buys a product. ShippingInfo carries the address; its
+// "country" must be in the product's licensed territory unless that is
+// worldwide.
 type PurchaseProductRequest struct {
 	Quantity      int                    `json:"quantity" validate:"required,min=1"`
 	PaymentMethod string                 `json:"payment_method" validate:"required"`
@@ -62,11 +76,14 @@ type PurchaseProductRequest struct {
 	Notes         string                 `json:"notes,omitempty"`
 }
 
-func NewProductService(db *gorm.DB, authorizationService *AuthorizationService, notificationService *NotificationService) *ProductService {
+func NewProductService(db *gorm.DB, authorizationService *AuthorizationService, notificationService *NotificationService, accountingService *AccountingService, paymentService *PaymentService, inventoryService *InventoryService) *ProductService {
 	return &ProductService{
 		db:                   db,
 		authorizationService: authorizationService,
 		notificationService:  notificationService,
+		accountingService:    accountingService,
+		paymentService:       paymentService,
+		inventoryService:     inventoryService,
 	}
 }
 
@@ -76,6 +93,10 @@ func (s *ProductService) CreateProduct(creatorID uuid.UUID, req *CreateProductRe
 		return nil, fmt.Errorf("validation failed: %w", err)
 	}
 
+	if err := validatePrice(models.NewMoney(req.Price, req.Currency)); err != nil {
+		return nil, err
+	}
+
 	// Verify creator exists and is active
 	var creator models.User
 	if err := s.db.First(&creator, creatorID).Error; err != nil {
@@ -115,7 +136,17 @@ func (s *ProductService) CreateProduct(creatorID uuid.UUID, req *CreateProductRe
 		return nil, errors.New("license has expired")
 	}
 
-	// Create product
+	if err := requireSignedAgreement(s.db, &license); err != nil {
+		return nil, err
+	}
+
+	// Derivative IP assets also depend on every license above them
+	if s.authorizationService != nil {
+		if err := s.authorizationService.ValidateLicenseLineage(license.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	product := &models.Product{
 		CreatorID:            creatorID,
 		LicenseID:            req.LicenseID,
@@ -123,6 +154,7 @@ func (s *ProductService) CreateProduct(creatorID uuid.UUID, req *CreateProductRe
 		Description:          req.Description,
 		Category:             req.Category,
 		Price:                req.Price,
+		Currency:             models.NormalizeCurrency(req.Currency),
 		InventoryCount:       req.InventoryCount,
 		Images:               req.Images,
 		Specifications:       models.JSONB(req.Specifications),
@@ -131,6 +163,10 @@ func (s *ProductService) CreateProduct(creatorID uuid.UUID, req *CreateProductRe
 		AuthenticityVerified: true, // Always true for licensed products
 	}
 
+	if err := s.checkLicensePolicy(product); err != nil {
+		return nil, err
+	}
+
 	// Save product
 	if err := s.db.Create(product).Error; err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
@@ -209,8 +245,19 @@ func (s *ProductService) UpdateProduct(id uuid.UUID, creatorID uuid.UUID, req *U
 	if req.Category != "" {
 		updates["category"] = req.Category
 	}
-	if req.Price > 0 {
-		updates["price"] = req.Price
+	if req.Price.IsPositive() || req.Currency != "" {
+		price := product.PriceMoney()
+		if req.Price.IsPositive() {
+			price.Amount = req.Price
+			updates["price"] = req.Price
+		}
+		if req.Currency != "" {
+			price.Currency = models.NormalizeCurrency(req.Currency)
+			updates["currency"] = price.Currency
+		}
+		if err := validatePrice(price); err != nil {
+			return nil, err
+		}
 	}
 	if req.InventoryCount >= 0 {
 		updates["inventory_count"] = req.InventoryCount
@@ -228,11 +275,48 @@ func (s *ProductService) UpdateProduct(id uuid.UUID, creatorID uuid.UUID, req *U
 		updates["status"] = req.Status
 	}
 
+	// Check the product as it will be against its license policy
+	updated := product
+	if req.Title != "" {
+		updated.Title = req.Title
+	}
+	if req.Description != "" {
+		updated.Description = req.Description
+	}
+	if req.Category != "" {
+		updated.Category = req.Category
+	}
+	if price, ok := updates["price"].(decimal.Decimal); ok {
+		updated.Price = price
+	}
+	if currency, ok := updates["currency"].(string); ok {
+		updated.Currency = currency
+	}
+	if req.InventoryCount >= 0 {
+		updated.InventoryCount = req.InventoryCount
+	}
+	if req.Tags != nil {
+		updated.Tags = req.Tags
+	}
+	if err := s.checkLicensePolicy(&updated); err != nil {
+		return nil, err
+	}
+
 	// Apply updates
 	if err := s.db.Model(&product).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
 	}
 
+	// Keep serialized units and availability in line with the new inventory
+	if _, ok := updates["inventory_count"]; ok {
+		s.syncProductUnits(id)
+		if req.Status == "" {
+			if err := syncProductAvailability(s.db, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Reload with relationships
 	s.db.Preload("Creator").Preload("License").Preload("License.IPAsset").First(&product, id)
 
@@ -340,14 +424,35 @@ func (s *ProductService) SearchProducts(params ProductSearchParams) ([]models.Pr
 	return products, total, nil
 }
 
-func (s *ProductService) PurchaseProduct(productID uuid.UUID, buyerID uuid.UUID, req *PurchaseProductRequest) (*models.Transaction, error) {
+// PurchaseProduct reserves the requested units for the buyer and opens a
+// payment for the transaction. The transaction completes when the payment
+// succeeds; if the payment fails or is abandoned the units return to stock.
+func (s *ProductService) PurchaseProduct(productID uuid.UUID, buyerID uuid.UUID, req *PurchaseProductRequest) (*models.Transaction, *PaymentIntentResponse, error) {
 	// Validate request
 	if err := utils.ValidateStruct(req); err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+		return nil, nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if s.paymentService == nil || s.inventoryService == nil {
+		return nil, nil, errors.New("payments are not configured")
 	}
 
 	// Start transaction
-	return s.purchaseProductTransaction(productID, buyerID, req)
+	transaction, err := s.purchaseProductTransaction(productID, buyerID, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Open the payment for the transaction amount
+	payment, err := s.paymentService.CreateTransactionIntent(transaction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Load full transaction data
+	s.db.Preload("Buyer").Preload("Seller").Preload("Product").First(transaction, transaction.ID)
+
+	return transaction, payment, nil
 }
 
 func (s *ProductService) purchaseProductTransaction(productID uuid.UUID, buyerID uuid.UUID, req *PurchaseProductRequest) (*models.Transaction, error) {
@@ -370,8 +475,12 @@ func (s *ProductService) purchaseProductTransaction(productID uuid.UUID, buyerID
 			return errors.New("product is not available for purchase")
 		}
 
+		if err := s.checkShippingTerritory(&product, req.ShippingInfo); err != nil {
+			return err
+		}
+
 		if product.InventoryCount < req.Quantity {
-			return errors.New("insufficient inventory")
+			return ErrInsufficientInventory
 		}
 
 		// Verify buyer exists and is active
@@ -385,21 +494,25 @@ func (s *ProductService) purchaseProductTransaction(productID uuid.UUID, buyerID
 		}
 
 		// Calculate amounts
-		totalAmount := product.Price * float64(req.Quantity)
-		platformFeePercent := 5.0 // This should come from settings
-		platformFee := totalAmount * (platformFeePercent / 100)
+		totalAmount := product.PriceMoney().Mul(int64(req.Quantity))
+		fee := platformFee(totalAmount)
 
 		// Calculate revenue shares
-		revenueShares := s.calculateRevenueShares(totalAmount, platformFee, &product)
+		revenueShares, err := s.calculateRevenueShares(totalAmount, fee, &product)
+		if err != nil {
+			return err
+		}
 
 		// Create transaction
 		transaction = &models.Transaction{
 			TransactionType: models.TransactionTypeProductSale,
-			BuyerID:         buyerID,
+			BuyerID:         &buyerID,
 			SellerID:        product.CreatorID,
 			ProductID:       &productID,
-			Amount:          totalAmount,
-			PlatformFee:     platformFee,
+			Quantity:        req.Quantity,
+			Amount:          totalAmount.Amount,
+			PlatformFee:     fee.Amount,
+			Currency:        totalAmount.Currency,
 			RevenueShares:   models.JSONB(revenueShares),
 			PaymentMethod:   req.PaymentMethod,
 			Status:          models.TransactionStatusPending,
@@ -422,16 +535,10 @@ func (s *ProductService) purchaseProductTransaction(productID uuid.UUID, buyerID
 			return fmt.Errorf("failed to create transaction: %w", err)
 		}
 
-		// Update product inventory
-		if err := tx.Model(&product).UpdateColumn("inventory_count",
-			gorm.Expr("inventory_count - ?", req.Quantity)).Error; err != nil {
-			return fmt.Errorf("failed to update inventory: %w", err)
-		}
-
-		// Update sales count
-		if err := tx.Model(&product).UpdateColumn("sales_count",
-			gorm.Expr("sales_count + ?", req.Quantity)).Error; err != nil {
-			return fmt.Errorf("failed to update sales count: %w", err)
+		// Reserve the units and their serials until the payment settles or
+		// the reservation expires
+		if _, err := s.inventoryService.Hold(tx, productID, transaction.ID, req.Quantity); err != nil {
+			return err
 		}
 
 		return nil
@@ -441,53 +548,162 @@ func (s *ProductService) purchaseProductTransaction(productID uuid.UUID, buyerID
 		return nil, err
 	}
 
-	// Process payment asynchronously
-	go s.processPayment(transaction)
+	return transaction, nil
+}
 
-	// Load full transaction data
-	s.db.Preload("Buyer").Preload("Seller").Preload("Product").First(transaction, transaction.ID)
+// checkShippingTerritory rejects shipping a product to a country outside the
+// territory its licenses cover. Products licensed worldwide need no shipping
+// country.
+func (s *ProductService) checkShippingTerritory(product *models.Product, shippingInfo map[string]interface{}) error {
+	territory, err := s.AuthorizedTerritory(product.LicenseID)
+	if err != nil {
+		return err
+	}
+	if territory.IsGlobal() {
+		return nil
+	}
 
-	return transaction, nil
+	country := ShippingCountry(shippingInfo)
+	if country == "" {
+		return fmt.Errorf("shipping_info.country is required: %s is only licensed for sale in some countries", product.Title)
+	}
+	if !territory.Covers(country) {
+		return fmt.Errorf("%w: %s cannot be sold in %s", ErrOutsideTerritory, product.Title, country)
+	}
+	return nil
 }
 
-func (s *ProductService) calculateRevenueShares(totalAmount, platformFee float64, product *models.Product) map[string]interface{} {
-	netAmount := totalAmount - platformFee
+// checkLicensePolicy checks a product against the policy of its license and
+// of every license that license derives from, returning the
+// *models.PolicyViolation of the first rule broken. Unit limits count the
+// products made under the license itself.
+func (s *ProductService) checkLicensePolicy(product *models.Product) error {
+	var lineage []models.LicenseApplication
+	if s.authorizationService != nil {
+		var err error
+		if lineage, err = s.authorizationService.GetLicenseLineage(product.LicenseID); err != nil {
+			return err
+		}
+	} else {
+		var license models.LicenseApplication
+		if err := s.db.Preload("IPAsset").Preload("LicenseTerms").First(&license, product.LicenseID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		lineage = []models.LicenseApplication{license}
+	}
+
+	for i, license := range lineage {
+		policy := license.LicenseTerms.Policy
+		err := policy.CheckProduct(product)
+		if err == nil && i == 0 && policy.MaxUnits > 0 {
+			units, unitsErr := s.licensedUnits(license.ID, product)
+			if unitsErr != nil {
+				return unitsErr
+			}
+			err = policy.CheckUnits(units)
+		}
+
+		var violation *models.PolicyViolation
+		if errors.As(err, &violation) {
+			violation.LicenseID = license.ID
+			if i > 0 {
+				violation.Message += fmt.Sprintf(" (upstream license for %s)", license.IPAsset.Title)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// licensedUnits counts the units stocked or sold under a license, with
+// product as given rather than as stored
+func (s *ProductService) licensedUnits(licenseID uuid.UUID, product *models.Product) (int, error) {
+	var units int64
+	if err := s.db.Model(&models.Product{}).
+		Where("license_id = ? AND id <> ?", licenseID, product.ID).
+		Select("COALESCE(SUM(inventory_count + sales_count), 0)").
+		Scan(&units).Error; err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return int(units) + product.InventoryCount + int(product.SalesCount), nil
+}
+
+// ShippingCountry reads the ISO country code a purchase ships to from its
+// shipping info
+func ShippingCountry(shippingInfo map[string]interface{}) string {
+	for _, key := range []string{"country", "country_code"} {
+		if country, ok := shippingInfo[key].(string); ok && strings.TrimSpace(country) != "" {
+			return strings.ToUpper(strings.TrimSpace(country))
+		}
+	}
+	return ""
+}
+
+// platformFee is the platform's cut of a sale amount, rounded to the
+// currency's minor unit
+func platformFee(amount models.Money) models.Money {
+	platformFeePercent := decimal.NewFromInt(5) // This should come from settings
+	return amount.Percent(platformFeePercent)
+}
+
+// validatePrice rejects prices finer than the currency's minor unit, which
+// no payment processor could charge
+func validatePrice(price models.Money) error {
+	if !price.Amount.Equal(price.Round().Amount) {
+		return fmt.Errorf("price has more decimal places than %s allows", price.Currency)
+	}
+	return nil
+}
+
+func (s *ProductService) calculateRevenueShares(totalAmount, platformFee models.Money, product *models.Product) (map[string]interface{}, error) {
+	netAmount, err := totalAmount.Sub(platformFee)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get revenue share percentage from license terms
 	revenueSharePercent := product.License.LicenseTerms.RevenueSharePercentage
 
+	// Cascade shares up the license lineage of derivative IP assets
+	var shares []RevenueShare
+	if s.authorizationService != nil {
+		lineage, err := s.authorizationService.GetLicenseLineage(product.LicenseID)
+		if err != nil {
+			return nil, err
+		}
+		shares = s.authorizationService.CalculateRevenueCascade(netAmount, lineage)
+	} else {
+		shares = []RevenueShare{{
+			RecipientID: product.License.IPAsset.CreatorID,
+			IPAssetID:   product.License.IPAssetID,
+			LicenseID:   product.LicenseID,
+			Percent:     revenueSharePercent,
+			Amount:      netAmount.Percent(revenueSharePercent).Amount,
+		}}
+	}
+
 	// Calculate shares
-	ipCreatorShare := netAmount * (revenueSharePercent / 100)
-	secondaryCreatorShare := netAmount - ipCreatorShare
+	licensorsTotal := decimal.Zero
+	for _, share := range shares {
+		licensorsTotal = licensorsTotal.Add(share.Amount)
+	}
+	ipCreatorShare := shares[0].Amount
+	secondaryCreatorShare := netAmount.Amount.Sub(licensorsTotal)
 
 	return map[string]interface{}{
-		"total_amount":            totalAmount,
-		"platform_fee":            platformFee,
-		"net_amount":              netAmount,
+		"total_amount":            totalAmount.Amount,
+		"platform_fee":            platformFee.Amount,
+		"net_amount":              netAmount.Amount,
+		"currency":                totalAmount.Currency,
 		"ip_creator_share":        ipCreatorShare,
 		"secondary_creator_share": secondaryCreatorShare,
 		"ip_creator_id":           product.License.IPAsset.CreatorID,
 		"secondary_creator_id":    product.CreatorID,
 		"revenue_share_percent":   revenueSharePercent,
-	}
-}
-
-func (s *ProductService) processPayment(transaction *models.Transaction) {
-	// TODO: This would integrate with actual payment processors
-	// For now, we'll simulate successful payment
-	time.Sleep(2 * time.Second)
-
-	now := time.Now()
-	transaction.Status = models.TransactionStatusCompleted
-	transaction.ProcessedAt = &now
-
-	s.db.Save(transaction)
-
-	// Send notifications
-	if s.notificationService != nil {
-		s.notificationService.SendPurchaseConfirmationNotification(transaction)
-		s.notificationService.SendSaleNotification(transaction)
-	}
+		"shares":                  shares,
+	}, nil
 }
 
 func (s *ProductService) GetCreatorProducts(creatorID uuid.UUID, params utils.PaginationParams) ([]models.Product, int64, error) {
@@ -549,7 +765,7 @@ func (s *ProductService) GetFeaturedProducts(limit int) ([]models.Product, error
 
 func (s *ProductService) VerifyProductAuthenticity(productID uuid.UUID) (*models.AuthorizationChain, error) {
 	var authChain models.AuthorizationChain
-	if err := s.db.Where("product_id = ? AND is_active = ?", productID, true).
+	if err := s.db.Where("product_id = ? AND depth = 0 AND is_active = ?", productID, true).
 		Preload("Product").Preload("IPAsset").Preload("License").
 		First(&authChain).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -568,6 +784,14 @@ func (s *ProductService) VerifyProductAuthenticity(productID uuid.UUID) (*models
 	return &authChain, nil
 }
 
+// AuthorizedTerritory is where products under a license may be sold
+func (s *ProductService) AuthorizedTerritory(licenseID uuid.UUID) (models.TerritorySet, error) {
+	if s.authorizationService == nil {
+		return models.TerritorySet{}, errors.New("authorization is not configured")
+	}
+	return s.authorizationService.AuthorizedTerritory(licenseID)
+}
+
 func (s *ProductService) GetProductStatistics(productID uuid.UUID, creatorID uuid.UUID) (map[string]interface{}, error) {
 	// Verify ownership
 	var product models.Product
@@ -581,21 +805,28 @@ func (s *ProductService) GetProductStatistics(productID uuid.UUID, creatorID uui
 
 	// Get sales statistics
 	var salesStats struct {
-		TotalSales    int64   `json:"total_sales"`
-		TotalRevenue  float64 `json:"total_revenue"`
-		AvgOrderValue float64 `json:"avg_order_value"`
+		TotalSales    int64                `json:"total_sales"`
+		TotalRevenue  models.DecimalNumber `json:"total_revenue"`
+		AvgOrderValue models.DecimalNumber `json:"avg_order_value"`
+		Currency      string               `json:"currency"`
 	}
+	salesStats.Currency = models.NormalizeCurrency(product.Currency)
 
 	s.db.Model(&models.Transaction{}).
-		Where("product_id = ? AND status = ?", productID, models.TransactionStatusCompleted).
+		Where("product_id = ? AND transaction_type = ? AND status = ?",
+			productID, models.TransactionTypeProductSale, models.TransactionStatusCompleted).
 		Count(&salesStats.TotalSales)
 
+	var totalRevenue decimal.Decimal
 	s.db.Model(&models.Transaction{}).
-		Where("product_id = ? AND status = ?", productID, models.TransactionStatusCompleted).
-		Select("COALESCE(SUM(amount), 0)").Scan(&salesStats.TotalRevenue)
+		Where("product_id = ? AND transaction_type = ? AND status = ?",
+			productID, models.TransactionTypeProductSale, models.TransactionStatusCompleted).
+		Select("COALESCE(SUM(amount), 0)").Row().Scan(&totalRevenue)
+	salesStats.TotalRevenue = models.DecimalNumber(totalRevenue)
 
 	if salesStats.TotalSales > 0 {
-		salesStats.AvgOrderValue = salesStats.TotalRevenue / float64(salesStats.TotalSales)
+		salesStats.AvgOrderValue = models.DecimalNumber(models.NewMoney(
+			totalRevenue.Div(decimal.NewFromInt(salesStats.TotalSales)), salesStats.Currency).Round().Amount)
 	}
 
 	return map[string]interface{}{
@@ -610,6 +841,14 @@ func (s *ProductService) GetProductStatistics(productID uuid.UUID, creatorID uui
 	}, nil
 }
 
+// GetProductUnits lists the serialized units of a creator's product
+func (s *ProductService) GetProductUnits(productID, creatorID uuid.UUID, status string, params utils.PaginationParams) ([]models.ProductUnit, int64, error) {
+	if s.authorizationService == nil {
+		return nil, 0, errors.New("product units are not available")
+	}
+	return s.authorizationService.GetProductUnits(productID, creatorID, status, params)
+}
+
 // Helper methods
 
 func (s *ProductService) incrementViewCount(productID uuid.UUID) {
@@ -619,6 +858,17 @@ func (s *ProductService) incrementViewCount(productID uuid.UUID) {
 
 func (s *ProductService) createAuthorizationChain(product *models.Product) {
 	if s.authorizationService != nil {
-		s.authorizationService.CreateProductAuthChain(product)
+		if _, err := s.authorizationService.CreateProductAuthChain(product); err != nil {
+			return
+		}
+		s.syncProductUnits(product.ID)
+	}
+}
+
+func (s *ProductService) syncProductUnits(productID uuid.UUID) {
+	if s.authorizationService != nil {
+		if err := s.authorizationService.SyncProductUnits(productID); err != nil {
+			log.Printf("Failed to sync units for product %s: %v", productID, err)
+		}
 	}
 }
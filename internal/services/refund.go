@@ -0,0 +1,399 @@
+// internal/services/refund.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// RefundSourceMarketplace marks refunds made through the marketplace rather
+// than reported by a payment provider
+const RefundSourceMarketplace = "marketplace"
+
+// RefundRequest refunds all or part of a completed transaction. Amount
+// defaults to whatever is left to refund. Restock returns the sold units to
+// stock: RestockQuantity of them, or all that are not yet back when zero.
+type RefundRequest struct {
+	TransactionID   uuid.UUID       `json:"transaction_id" validate:"required"`
+	Amount          decimal.Decimal `json:"amount,omitempty"`
+	Reason          string          `json:"reason" validate:"required"`
+	Restock         bool            `json:"restock,omitempty"`
+	RestockQuantity int             `json:"restock_quantity,omitempty" validate:"min=0"`
+}
+
+// refundRetryDelay keeps FinalizePendingRefunds away from refunds whose
+// provider call may still be in flight, and refundRetryWindow stops it
+// before the provider forgets the idempotency key
+const (
+	refundRetryDelay  = 10 * time.Minute
+	refundRetryWindow = 24 * time.Hour
+)
+
+// ProcessRefund refunds a transaction, in full or in part. Each refund claws
+// back the platform fee and every revenue share in proportion, taking
+// settled shares from available balances even if that leaves them negative.
+// The transaction is marked refunded once its whole amount has been returned.
+//
+// The refund is stored as pending before the payment provider is called, and
+// recorded in a second database transaction once the provider has refunded.
+func (s *PaymentService) ProcessRefund(req *RefundRequest, adminID *uuid.UUID) (*models.Refund, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	if s.accountingService == nil {
+		return nil, errors.New("accounting is not configured")
+	}
+
+	refund, transaction, err := s.openRefund(req, adminID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finishRefund(transaction, refund)
+}
+
+// RefundAmount works out what a refund of a transaction returns: the
+// requested amount, or else everything left once posted and pending refunds
+// are taken off. It fails for transactions that cannot be refunded and for
+// amounts over what is left.
+func RefundAmount(transaction *models.Transaction, pending, requested decimal.Decimal) (models.Money, error) {
+	if transaction.TransactionType == models.TransactionTypeRevenueShare {
+		return models.Money{}, errors.New("revenue shares are refunded through their sale")
+	}
+	if transaction.Status == models.TransactionStatusRefunded {
+		return models.Money{}, errors.New("transaction has already been fully refunded")
+	}
+	if transaction.Status != models.TransactionStatusCompleted {
+		return models.Money{}, errors.New("can only refund completed transactions")
+	}
+
+	left := transaction.Refundable()
+	left.Amount = left.Amount.Sub(pending)
+	if !left.IsPositive() {
+		return models.Money{}, errors.New("the rest of the transaction is already being refunded")
+	}
+
+	if !requested.IsPositive() {
+		return left, nil
+	}
+
+	amount := models.NewMoney(requested, transaction.Currency)
+	if !amount.Amount.Equal(amount.Round().Amount) {
+		return models.Money{}, fmt.Errorf("amount has more decimal places than %s allows", amount.Currency)
+	}
+	if amount.Amount.GreaterThan(left.Amount) {
+		return models.Money{}, fmt.Errorf("refund exceeds the %s left to refund", left)
+	}
+
+	return amount, nil
+}
+
+// openRefund stores a refund as pending, so it counts against what is left
+// to refund while the payment provider handles it
+func (s *PaymentService) openRefund(req *RefundRequest, adminID *uuid.UUID) (*models.Refund, *models.Transaction, error) {
+	var transaction models.Transaction
+	var refund *models.Refund
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Serialise with other refunds and the charge.refunded webhook, which
+		// counts pending refunds as already refunded
+		if err := s.accountingService.LockRefunds(tx, req.TransactionID); err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&transaction, req.TransactionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("transaction not found")
+			}
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		pending, err := s.pendingRefundAmount(tx, transaction.ID)
+		if err != nil {
+			return err
+		}
+
+		amount, err := RefundAmount(&transaction, pending, req.Amount)
+		if err != nil {
+			return err
+		}
+
+		refund = &models.Refund{
+			TransactionID:   transaction.ID,
+			Amount:          amount.Amount,
+			Currency:        amount.Currency,
+			Reason:          req.Reason,
+			Source:          RefundSourceMarketplace,
+			Status:          models.RefundStatusPending,
+			Restock:         req.Restock && transaction.TransactionType == models.TransactionTypeProductSale,
+			RestockQuantity: req.RestockQuantity,
+			ProcessedBy:     adminID,
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			return fmt.Errorf("failed to create refund: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return refund, &transaction, nil
+}
+
+// finishRefund sends a pending refund to the payment provider, outside any
+// database transaction, then records it or marks it failed. The refund's ID
+// keys the provider request, so sending it again cannot refund twice.
+func (s *PaymentService) finishRefund(transaction *models.Transaction, refund *models.Refund) (*models.Refund, error) {
+	providerRefundID := ""
+	if transaction.PaymentReference != "" {
+		provider, err := s.Provider(transaction.PaymentMethod)
+		if err == nil {
+			var result *ProviderRefund
+			result, err = provider.Refund(&ProviderRefundRequest{
+				PaymentReference: transaction.PaymentReference,
+				Amount:           refund.Total(),
+				Reason:           refund.Reason,
+				IdempotencyKey:   "refund_" + refund.ID.String(),
+			})
+			if err == nil {
+				providerRefundID = result.ID
+			}
+		}
+		if err != nil {
+			if failErr := s.failRefund(refund.ID, err.Error()); failErr != nil {
+				log.Printf("Failed to mark refund %s failed: %v", refund.ID, failErr)
+			}
+			return nil, err
+		}
+	}
+
+	// If recording fails the refund stays pending for FinalizePendingRefunds
+	completed, err := s.completeRefund(refund.ID, providerRefundID)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.sendRefundNotification(transaction.ID, completed)
+
+	return completed, nil
+}
+
+// completeRefund records a pending refund the provider has made: it returns
+// the units to stock and posts the refund to the ledger
+func (s *PaymentService) completeRefund(id uuid.UUID, providerRefundID string) (*models.Refund, error) {
+	var refund models.Refund
+	if err := s.db.First(&refund, id).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.accountingService.LockRefunds(tx, refund.TransactionID); err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, id).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if refund.Status != models.RefundStatusPending {
+			return fmt.Errorf("refund is %s, expected %s", refund.Status, models.RefundStatusPending)
+		}
+
+		var transaction models.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&transaction, refund.TransactionID).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+
+		if refund.Restock && s.inventoryService != nil {
+			restocked, err := s.inventoryService.Restock(tx, transaction.ID, refund.RestockQuantity)
+			if err != nil {
+				return err
+			}
+			refund.RestockedUnits = restocked
+		}
+
+		if providerRefundID != "" {
+			refund.ProviderRefundID = providerRefundID
+		}
+
+		return s.applyRefund(tx, &transaction, &refund, refund.ID.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// failRefund marks a pending refund the provider refused as failed; nothing
+// was posted for it, so it no longer counts against the transaction
+func (s *PaymentService) failRefund(id uuid.UUID, reason string) error {
+	if err := s.db.Model(&models.Refund{}).
+		Where("id = ? AND status = ?", id, models.RefundStatusPending).
+		Updates(map[string]interface{}{
+			"status":         models.RefundStatusFailed,
+			"failure_reason": reason,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+	return nil
+}
+
+// FinalizePendingRefunds finishes marketplace refunds left pending because
+// recording them failed or the server stopped mid-way, and sends refunds
+// queued by queueRefund. The provider request is sent under the refund's
+// idempotency key, so refunds older than the provider keeps keys for are
+// left for review instead.
+func (s *PaymentService) FinalizePendingRefunds() (int, error) {
+	now := time.Now()
+	var refunds []models.Refund
+	if err := s.db.Where("status = ? AND source = ? AND created_at BETWEEN ? AND ?",
+		models.RefundStatusPending, RefundSourceMarketplace, now.Add(-refundRetryWindow), now.Add(-refundRetryDelay)).
+		Order("created_at ASC").Limit(100).Find(&refunds).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch pending refunds: %w", err)
+	}
+
+	finalized := 0
+	for i := range refunds {
+		var transaction models.Transaction
+		if err := s.db.First(&transaction, refunds[i].TransactionID).Error; err != nil {
+			log.Printf("Failed to load transaction for refund %s: %v", refunds[i].ID, err)
+			continue
+		}
+
+		if _, err := s.finishRefund(&transaction, &refunds[i]); err != nil {
+			log.Printf("Failed to finish refund %s: %v", refunds[i].ID, err)
+			continue
+		}
+		finalized++
+	}
+
+	return finalized, nil
+}
+
+// queueRefund opens a full refund of a transaction the platform cannot
+// honour, such as a license fee paid after the license was cancelled. It is
+// stored pending in tx and sent to the provider by FinalizePendingRefunds.
+func (s *PaymentService) queueRefund(tx *gorm.DB, transaction *models.Transaction, reason string) error {
+	pending, err := s.pendingRefundAmount(tx, transaction.ID)
+	if err != nil {
+		return err
+	}
+
+	amount, err := RefundAmount(transaction, pending, decimal.Zero)
+	if err != nil {
+		return err
+	}
+
+	refund := &models.Refund{
+		TransactionID: transaction.ID,
+		Amount:        amount.Amount,
+		Currency:      amount.Currency,
+		Reason:        reason,
+		Source:        RefundSourceMarketplace,
+		Status:        models.RefundStatusPending,
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	log.Printf("Refunding transaction %s: %s", transaction.ID, reason)
+	return nil
+}
+
+// pendingRefundAmount is the total of a transaction's refunds that are with
+// the payment provider but not yet posted
+func (s *PaymentService) pendingRefundAmount(tx *gorm.DB, transactionID uuid.UUID) (decimal.Decimal, error) {
+	var pending struct {
+		Amount decimal.Decimal
+	}
+	if err := tx.Model(&models.Refund{}).
+		Select("COALESCE(SUM(amount), 0) AS amount").
+		Where("transaction_id = ? AND status = ?", transactionID, models.RefundStatusPending).
+		Scan(&pending).Error; err != nil {
+		return decimal.Zero, fmt.Errorf("failed to calculate pending refunds: %w", err)
+	}
+	return pending.Amount, nil
+}
+
+// applyRefund records a refund of a locked transaction: it claws the amount
+// back in the ledger, stores the refund with its clawbacks and, once nothing
+// is left to refund, marks the transaction, its revenue shares and, when
+// every part of it is refunded, its order as refunded. key identifies the
+// refund in the ledger.
+func (s *PaymentService) applyRefund(tx *gorm.DB, transaction *models.Transaction, refund *models.Refund, key string) error {
+	postings, err := s.accountingService.RecordRefund(tx, transaction, refund.Amount, key)
+	if err != nil {
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+
+	refund.Clawbacks = models.JSONB{"postings": postings}
+	refund.Status = models.RefundStatusCompleted
+	if err := tx.Save(refund).Error; err != nil {
+		return fmt.Errorf("failed to save refund: %w", err)
+	}
+
+	now := time.Now()
+	fullyRefunded := transaction.AddRefund(refund.Amount, refund.Reason, now)
+
+	if err := tx.Save(transaction).Error; err != nil {
+		return fmt.Errorf("failed to update transaction: %w", err)
+	}
+
+	if !fullyRefunded {
+		return nil
+	}
+
+	if err := tx.Model(&models.Transaction{}).
+		Where("parent_transaction_id = ? AND transaction_type = ?", transaction.ID, models.TransactionTypeRevenueShare).
+		Updates(map[string]interface{}{
+			"status":      models.TransactionStatusRefunded,
+			"refunded_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to update revenue shares: %w", err)
+	}
+
+	if transaction.OrderID != nil {
+		var open int64
+		if err := tx.Model(&models.Transaction{}).
+			Where("order_id = ? AND status <> ?", *transaction.OrderID, models.TransactionStatusRefunded).
+			Count(&open).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if open == 0 {
+			if err := tx.Model(&models.Order{}).Where("id = ?", *transaction.OrderID).
+				UpdateColumn("status", models.TransactionStatusRefunded).Error; err != nil {
+				return fmt.Errorf("failed to update order: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *PaymentService) sendRefundNotification(transactionID uuid.UUID, refund *models.Refund) {
+	if s.notificationService == nil {
+		return
+	}
+
+	var transaction models.Transaction
+	if err := s.db.Preload("Buyer").Preload("Product").First(&transaction, transactionID).Error; err != nil {
+		log.Printf("Failed to load transaction %s for refund notification: %v", transactionID, err)
+		return
+	}
+
+	s.notificationService.SendRefundNotification(&transaction, refund)
+}
@@ -0,0 +1,225 @@
+// internal/services/scan_service.go
+package services
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+// ScanService records verification scans and flags codes whose scan pattern
+// suggests the code has been copied onto counterfeit goods.
+type ScanService struct {
+	db                  *gorm.DB
+	config              *config.Config
+	notificationService *NotificationService
+	trustedProxies      []*net.IPNet // peers allowed to set the region header
+}
+
+// ScanEvent describes one verification request
+type ScanEvent struct {
+	VerificationCode string
+	ProductID        *uuid.UUID
+	UnitID           *uuid.UUID
+	Result           models.ScanResult
+	FailureReason    string
+	IPAddress        string
+	Country          string // from the CDN region header, may be empty
+	UserAgent        string
+	UnsoldUnit       bool // a unit code scanned before the unit was sold
+}
+
+// ScanWindowStats summarises the scans of one code within the anomaly window
+type ScanWindowStats struct {
+	Scans   int64 `json:"scans"`
+	Regions int64 `json:"regions"`
+}
+
+// ScanAnomaly is a code whose recent scans crossed a detection threshold
+type ScanAnomaly struct {
+	VerificationCode string          `json:"verification_code"`
+	ProductID        uuid.UUID       `json:"product_id"`
+	UnitID           *uuid.UUID      `json:"unit_id,omitempty"`
+	Window           time.Duration   `json:"window"`
+	Stats            ScanWindowStats `json:"stats"`
+	Reasons          []string        `json:"reasons"`
+}
+
+func NewScanService(db *gorm.DB, config *config.Config, notificationService *NotificationService) *ScanService {
+	var trustedProxies []*net.IPNet
+	if config != nil {
+		// Validated with the rest of the configuration
+		trustedProxies, _ = utils.ParseNetworks(config.Scan.TrustedProxies)
+	}
+
+	return &ScanService{
+		db:                  db,
+		config:              config,
+		notificationService: notificationService,
+		trustedProxies:      trustedProxies,
+	}
+}
+
+// RecordScan stores a scan and, for verified codes, runs anomaly detection
+func (s *ScanService) RecordScan(event *ScanEvent) error {
+	scan := &models.VerificationScan{
+		VerificationCode: event.VerificationCode,
+		ProductID:        event.ProductID,
+		UnitID:           event.UnitID,
+		Result:           event.Result,
+		FailureReason:    event.FailureReason,
+		IPAddress:        event.IPAddress,
+		Region:           utils.ScanRegion(event.IPAddress, event.Country),
+		UserAgent:        event.UserAgent,
+		ScannedAt:        time.Now(),
+	}
+
+	if err := s.db.Create(scan).Error; err != nil {
+		return fmt.Errorf("failed to record verification scan: %w", err)
+	}
+
+	// Unknown codes are not tied to a product, so there is nothing to protect
+	if event.Result != models.ScanResultVerified || event.ProductID == nil {
+		return nil
+	}
+
+	anomaly, err := s.DetectAnomaly(event.VerificationCode, *event.ProductID, event.UnitID)
+	if err != nil {
+		return err
+	}
+
+	// Genuine units reach buyers through a sale, so an unsold unit's code
+	// in circulation has likely been copied
+	if event.UnsoldUnit {
+		if anomaly == nil {
+			anomaly = &ScanAnomaly{
+				VerificationCode: event.VerificationCode,
+				ProductID:        *event.ProductID,
+				UnitID:           event.UnitID,
+				Window:           s.anomalyWindow(),
+			}
+		}
+		anomaly.Reasons = append(anomaly.Reasons, "scanned while unsold")
+	}
+
+	if anomaly != nil {
+		return s.raiseAlert(anomaly)
+	}
+
+	return nil
+}
+
+// DetectAnomaly checks the recent scans of a code against the thresholds
+func (s *ScanService) DetectAnomaly(verificationCode string, productID uuid.UUID, unitID *uuid.UUID) (*ScanAnomaly, error) {
+	window := s.anomalyWindow()
+
+	var stats ScanWindowStats
+	if err := s.db.Model(&models.VerificationScan{}).
+		Select("COUNT(*) AS scans, COUNT(DISTINCT region) AS regions").
+		Where("verification_code = ? AND result = ? AND scanned_at > ?",
+			verificationCode, models.ScanResultVerified, time.Now().Add(-window)).
+		Scan(&stats).Error; err != nil {
+		return nil, fmt.Errorf("failed to summarise verification scans: %w", err)
+	}
+
+	reasons := s.EvaluateScanWindow(stats)
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+
+	return &ScanAnomaly{
+		VerificationCode: verificationCode,
+		ProductID:        productID,
+		UnitID:           unitID,
+		Window:           window,
+		Stats:            stats,
+		Reasons:          reasons,
+	}, nil
+}
+
+// EvaluateScanWindow returns the thresholds a code's scans crossed
+func (s *ScanService) EvaluateScanWindow(stats ScanWindowStats) []string {
+	var reasons []string
+
+	maxRegions, maxScans := 5, 100
+	if s.config != nil {
+		if s.config.Scan.MaxRegions > 0 {
+			maxRegions = s.config.Scan.MaxRegions
+		}
+		if s.config.Scan.MaxScans > 0 {
+			maxScans = s.config.Scan.MaxScans
+		}
+	}
+
+	if stats.Regions > int64(maxRegions) {
+		reasons = append(reasons, fmt.Sprintf("scanned from %d regions (limit %d)", stats.Regions, maxRegions))
+	}
+	if stats.Scans > int64(maxScans) {
+		reasons = append(reasons, fmt.Sprintf("scanned %d times (limit %d)", stats.Scans, maxScans))
+	}
+
+	return reasons
+}
+
+// raiseAlert notifies admins unless the same code was flagged recently
+func (s *ScanService) raiseAlert(anomaly *ScanAnomaly) error {
+	resourceType, resourceID := "product", anomaly.ProductID
+	if anomaly.UnitID != nil {
+		resourceType, resourceID = "product_unit", *anomaly.UnitID
+	}
+
+	cooldown := 24 * time.Hour
+	if s.config != nil && s.config.Scan.AlertCooldownHours > 0 {
+		cooldown = time.Duration(s.config.Scan.AlertCooldownHours) * time.Hour
+	}
+
+	// Serialize alerts per resource so concurrent scans raise one alert
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "scan_alert:"+resourceType+":"+resourceID.String()).Error; err != nil {
+			return fmt.Errorf("failed to lock alerts: %w", err)
+		}
+
+		var recent int64
+		if err := tx.Model(&models.AdminNotification{}).
+			Where("type = ? AND related_resource_type = ? AND related_resource_id = ? AND created_at > ?",
+				models.AdminNotificationSuspectedCounterfeit, resourceType, resourceID, time.Now().Add(-cooldown)).
+			Count(&recent).Error; err != nil {
+			return fmt.Errorf("failed to check recent alerts: %w", err)
+		}
+		if recent > 0 {
+			return nil
+		}
+
+		if s.notificationService == nil {
+			log.Printf("Suspected counterfeit: code %s %v", anomaly.VerificationCode, anomaly.Reasons)
+			return nil
+		}
+
+		return s.notificationService.SendSuspectedCounterfeitNotification(tx, anomaly, resourceType, resourceID)
+	})
+}
+
+// RegionHeader is the request header carrying the client country, if any.
+// The header is only honoured on requests arriving from a trusted proxy,
+// since any other client can set it.
+func (s *ScanService) RegionHeader(remoteIP string) string {
+	if s.config == nil || !utils.IPInNetworks(remoteIP, s.trustedProxies) {
+		return ""
+	}
+	return s.config.Scan.RegionHeader
+}
+
+func (s *ScanService) anomalyWindow() time.Duration {
+	if s.config == nil || s.config.Scan.AnomalyWindow <= 0 {
+		return time.Hour
+	}
+	return time.Duration(s.config.Scan.AnomalyWindow) * time.Minute
+}
@@ -101,6 +101,21 @@ func (s *StorageService) UploadFile(file multipart.File, header *multipart.FileH
 	return s.uploadToLocal(fileBytes, filename, header.Header.Get("Content-Type"))
 }
 
+// UploadBytes stores a file generated by the platform rather than uploaded
+func (s *StorageService) UploadBytes(data []byte, name, contentType string, options UploadOptions) (*UploadResult, error) {
+	if options.MaxSize > 0 && int64(len(data)) > options.MaxSize {
+		return nil, fmt.Errorf("file size %d bytes exceeds maximum allowed size %d bytes", len(data), options.MaxSize)
+	}
+
+	filename := s.generateFileName(name, options.Folder)
+
+	if s.s3Client != nil {
+		return s.uploadToS3(data, filename, contentType, options.IsPublic)
+	}
+
+	return s.uploadToLocal(data, filename, contentType)
+}
+
 func (s *StorageService) uploadToS3(fileBytes []byte, key, contentType string, isPublic bool) (*UploadResult, error) {
 	// Prepare S3 upload parameters
 	params := &s3.PutObjectInput{
@@ -206,6 +221,13 @@ func (s *StorageService) GetDefaultUploadOptions(category string) UploadOptions
 			AllowedTypes: []string{".jpg", ".jpeg", ".png"},
 			IsPublic:     true,
 		}
+	case "agreements":
+		return UploadOptions{
+			Folder:       "agreements",
+			MaxSize:      10 * 1024 * 1024, // 10MB
+			AllowedTypes: []string{".pdf"},
+			IsPublic:     false,
+		}
 	default:
 		return UploadOptions{
 			Folder:       "general",
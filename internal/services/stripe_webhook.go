@@ -0,0 +1,286 @@
+// internal/services/stripe_webhook.go
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/webhook"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+// Stripe event types applied to transactions
+const (
+	StripeEventPaymentSucceeded = "payment_intent.succeeded"
+	StripeEventPaymentFailed    = "payment_intent.payment_failed"
+	StripeEventPaymentCanceled  = "payment_intent.canceled"
+	StripeEventChargeRefunded   = "charge.refunded"
+)
+
+// ErrInvalidWebhookSignature is returned for payloads that were not signed
+// with the configured webhook secret
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// StripeWebhookEvent is the part of a Stripe event needed to update a
+// transaction. TransactionID and OrderID are taken from the transaction_id
+// and order_id metadata when the payment intent carries them.
+type StripeWebhookEvent struct {
+	ID              string
+	Type            string
+	PaymentIntentID string
+	TransactionID   *uuid.UUID
+	OrderID         *uuid.UUID
+	ChargeID        string
+	AmountRefunded  models.Money
+	FailureMessage  string
+}
+
+// ConstructStripeEvent verifies the Stripe-Signature header of a webhook
+// payload and decodes the event
+func (s *PaymentService) ConstructStripeEvent(payload []byte, signature string) (*StripeWebhookEvent, error) {
+	if s.config.Payment.StripeWebhookSecret == "" {
+		return nil, errors.New("stripe webhook secret is not configured")
+	}
+
+	event, err := webhook.ConstructEventWithOptions(payload, signature, s.config.Payment.StripeWebhookSecret,
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookSignature, err)
+	}
+
+	return ParseStripeWebhookEvent(event)
+}
+
+// ParseStripeWebhookEvent extracts the payment details of a verified event.
+// Event types that do not affect transactions are returned without them.
+func ParseStripeWebhookEvent(event stripe.Event) (*StripeWebhookEvent, error) {
+	parsed := &StripeWebhookEvent{ID: event.ID, Type: string(event.Type)}
+	if event.Data == nil {
+		return parsed, nil
+	}
+
+	var metadata map[string]string
+	switch parsed.Type {
+	case StripeEventPaymentSucceeded, StripeEventPaymentFailed, StripeEventPaymentCanceled:
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return nil, fmt.Errorf("invalid payment intent in event %s: %w", event.ID, err)
+		}
+		parsed.PaymentIntentID = pi.ID
+		metadata = pi.Metadata
+		if pi.LastPaymentError != nil {
+			parsed.FailureMessage = pi.LastPaymentError.Msg
+		}
+		if pi.CancellationReason != "" {
+			parsed.FailureMessage = "canceled: " + string(pi.CancellationReason)
+		}
+
+	case StripeEventChargeRefunded:
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return nil, fmt.Errorf("invalid charge in event %s: %w", event.ID, err)
+		}
+		parsed.ChargeID = charge.ID
+		parsed.AmountRefunded = models.MoneyFromMinorUnits(charge.AmountRefunded, string(charge.Currency))
+		metadata = charge.Metadata
+		if charge.PaymentIntent != nil {
+			parsed.PaymentIntentID = charge.PaymentIntent.ID
+		}
+
+	default:
+		return parsed, nil
+	}
+
+	if id, err := uuid.Parse(metadata["transaction_id"]); err == nil {
+		parsed.TransactionID = &id
+	}
+	if id, err := uuid.Parse(metadata["order_id"]); err == nil {
+		parsed.OrderID = &id
+	}
+
+	return parsed, nil
+}
+
+// HandleStripeWebhook applies a verified Stripe event to its transaction.
+// Each event is applied at most once; redeliveries are acknowledged without
+// effect. An error leaves the event unrecorded so Stripe retries it.
+func (s *PaymentService) HandleStripeWebhook(event *StripeWebhookEvent) error {
+	switch event.Type {
+	case StripeEventPaymentSucceeded, StripeEventPaymentFailed, StripeEventPaymentCanceled, StripeEventChargeRefunded:
+	default:
+		return s.recordWebhookEvent(s.db, event, "ignored", "unhandled event type")
+	}
+
+	if processed, err := s.webhookEventProcessed(event); err != nil || processed {
+		return err
+	}
+
+	// Order payments settle every transaction of the order
+	if event.OrderID != nil && event.Type != StripeEventChargeRefunded {
+		if err := s.applyOrderPaymentResult(*event.OrderID, event.PaymentIntentID, webhookPaymentStatus(event)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return s.recordWebhookEvent(s.db, event, "ignored", "no matching order")
+			}
+			return err
+		}
+		return s.recordWebhookEvent(s.db, event, "processed", event.FailureMessage)
+	}
+
+	transactionID, err := s.webhookTransactionID(event)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Payments made outside the marketplace have no transaction
+			return s.recordWebhookEvent(s.db, event, "ignored", "no matching transaction")
+		}
+		return err
+	}
+
+	switch event.Type {
+	case StripeEventPaymentSucceeded, StripeEventPaymentFailed, StripeEventPaymentCanceled:
+		if err := s.applyPaymentResult(transactionID, event.PaymentIntentID, webhookPaymentStatus(event)); err != nil {
+			return err
+		}
+		return s.recordWebhookEvent(s.db, event, "processed", event.FailureMessage)
+
+	default:
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := s.applyChargeRefund(tx, transactionID, event); err != nil {
+				return err
+			}
+			return s.recordWebhookEvent(tx, event, "processed", "")
+		})
+	}
+}
+
+// webhookPaymentStatus is the transaction status a payment event reports.
+// Failed and expired payments release the inventory they held.
+func webhookPaymentStatus(event *StripeWebhookEvent) models.TransactionStatus {
+	if event.Type == StripeEventPaymentSucceeded {
+		return models.TransactionStatusCompleted
+	}
+	return models.TransactionStatusFailed
+}
+
+// applyChargeRefund brings the ledger up to the amount Stripe reports as
+// refunded. Refunds we initiated are already posted or pending, so only the
+// difference is recorded and the same refund is never posted twice.
+func (s *PaymentService) applyChargeRefund(tx *gorm.DB, transactionID uuid.UUID, event *StripeWebhookEvent) error {
+	if s.accountingService == nil {
+		return errors.New("accounting is not configured")
+	}
+
+	if err := s.accountingService.LockRefunds(tx, transactionID); err != nil {
+		return err
+	}
+
+	var transaction models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&transaction, transactionID).Error; err != nil {
+		return fmt.Errorf("transaction not found: %w", err)
+	}
+
+	if transaction.Status != models.TransactionStatusCompleted && transaction.Status != models.TransactionStatusRefunded {
+		log.Printf("Ignoring refund of %s transaction %s", transaction.Status, transaction.ID)
+		return nil
+	}
+
+	// One charge pays every seller of an order, so a refund made in Stripe
+	// cannot be attributed to a seller. Order refunds go through the
+	// marketplace per transaction and are already in the ledger.
+	if transaction.OrderID != nil {
+		log.Printf("Ignoring Stripe refund of order %s; refund order transactions individually", *transaction.OrderID)
+		return nil
+	}
+
+	refunded, err := s.accountingService.RefundedAmount(tx, transaction.ID)
+	if err != nil {
+		return err
+	}
+
+	if event.AmountRefunded.Currency != transaction.Total().Currency {
+		return fmt.Errorf("%w: refund in %s of a %s transaction", models.ErrCurrencyMismatch,
+			event.AmountRefunded.Currency, transaction.Total().Currency)
+	}
+
+	amountRefunded := event.AmountRefunded.Amount
+	if amountRefunded.GreaterThan(transaction.Amount) {
+		amountRefunded = transaction.Amount
+	}
+
+	// Refunds we have sent but not yet recorded are part of Stripe's total
+	pending, err := s.pendingRefundAmount(tx, transaction.ID)
+	if err != nil {
+		return err
+	}
+
+	outstanding := amountRefunded.Sub(refunded).Sub(pending)
+	if !outstanding.IsPositive() {
+		return nil
+	}
+
+	// Record what the marketplace has not refunded itself
+	key := fmt.Sprintf("stripe:%s:%d", event.ChargeID, event.AmountRefunded.MinorUnits())
+	return s.applyRefund(tx, &transaction, &models.Refund{
+		TransactionID:    transaction.ID,
+		Amount:           outstanding,
+		Currency:         transaction.Total().Currency,
+		Reason:           "Refunded in Stripe",
+		Source:           "stripe",
+		ProviderRefundID: event.ChargeID,
+	}, key)
+}
+
+// webhookTransactionID finds the transaction an event is about, by its
+// metadata or else by the payment intent stored on the transaction
+func (s *PaymentService) webhookTransactionID(event *StripeWebhookEvent) (uuid.UUID, error) {
+	var transaction models.Transaction
+	query := s.db.Select("id")
+	if event.TransactionID != nil {
+		query = query.Where("id = ?", *event.TransactionID)
+	} else if event.PaymentIntentID != "" {
+		query = query.Where("(payment_intent_id = ? OR payment_reference = ?) AND transaction_type <> ?",
+			event.PaymentIntentID, event.PaymentIntentID, models.TransactionTypeRevenueShare)
+	} else {
+		return uuid.Nil, gorm.ErrRecordNotFound
+	}
+
+	if err := query.First(&transaction).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, err
+		}
+		return uuid.Nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return transaction.ID, nil
+}
+
+func (s *PaymentService) webhookEventProcessed(event *StripeWebhookEvent) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.WebhookEvent{}).
+		Where("provider = ? AND event_id = ?", "stripe", event.ID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *PaymentService) recordWebhookEvent(tx *gorm.DB, event *StripeWebhookEvent, status, message string) error {
+	record := &models.WebhookEvent{
+		Provider:  "stripe",
+		EventID:   event.ID,
+		EventType: event.Type,
+		Status:    status,
+		Message:   message,
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record).Error; err != nil {
+		return fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// internal/tests/accounting_test.go
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func testSaleTransaction(sellerID, originalID, derivativeID uuid.UUID) *models.Transaction {
+	return &models.Transaction{
+		BaseModel:   models.BaseModel{ID: uuid.New()},
+		SellerID:    sellerID,
+		Amount:      dec("100"),
+		PlatformFee: dec("5"),
+		Currency:    "USD",
+		RevenueShares: models.JSONB{
+			// As stored in the database: the shares come back as generic JSON
+			"shares": []interface{}{
+				map[string]interface{}{"recipient_id": derivativeID.String(), "depth": 0, "amount": 28.5},
+				map[string]interface{}{"recipient_id": originalID.String(), "depth": 1, "amount": 9.5},
+			},
+		},
+	}
+}
+
+func dec(value string) decimal.Decimal {
+	return decimal.RequireFromString(value)
+}
+
+func postingsFor(postings []services.Posting, ownerID uuid.UUID, kind models.AccountKind) (debit, credit string) {
+	debitTotal, creditTotal := decimal.Zero, decimal.Zero
+	for _, posting := range postings {
+		if posting.OwnerID == ownerID && posting.Kind == kind {
+			debitTotal = debitTotal.Add(posting.Debit)
+			creditTotal = creditTotal.Add(posting.Credit)
+		}
+	}
+	return debitTotal.StringFixed(2), creditTotal.StringFixed(2)
+}
+
+func TestSalePostingsSplitRevenue(t *testing.T) {
+	sellerID, originalID, derivativeID := uuid.New(), uuid.New(), uuid.New()
+	transaction := testSaleTransaction(sellerID, originalID, derivativeID)
+
+	postings, err := services.BuildSalePostings(transaction)
+	require.NoError(t, err)
+	require.NoError(t, services.ValidatePostings(postings))
+
+	cashDebit, _ := postingsFor(postings, uuid.Nil, models.AccountPlatformCash)
+	_, fee := postingsFor(postings, uuid.Nil, models.AccountPlatformRevenue)
+	_, derivative := postingsFor(postings, derivativeID, models.AccountUserPending)
+	_, original := postingsFor(postings, originalID, models.AccountUserPending)
+	_, seller := postingsFor(postings, sellerID, models.AccountUserPending)
+
+	assert.Equal(t, "100.00", cashDebit)
+	assert.Equal(t, "5.00", fee)
+	assert.Equal(t, "28.50", derivative)
+	assert.Equal(t, "9.50", original)
+	assert.Equal(t, "57.00", seller)
+}
+
+func TestRefundPostingsReverseProportionally(t *testing.T) {
+	sellerID, originalID, derivativeID := uuid.New(), uuid.New(), uuid.New()
+	transaction := testSaleTransaction(sellerID, originalID, derivativeID)
+
+	// A third of the sale, refunded after settlement
+	postings, err := services.BuildRefundPostings(transaction, dec("33.33"), decimal.Zero, true)
+	require.NoError(t, err)
+	require.NoError(t, services.ValidatePostings(postings))
+
+	_, cashCredit := postingsFor(postings, uuid.Nil, models.AccountPlatformCash)
+	assert.Equal(t, "33.33", cashCredit)
+
+	pendingDebit, _ := postingsFor(postings, sellerID, models.AccountUserPending)
+	assert.Equal(t, "0.00", pendingDebit)
+
+	fee, _ := postingsFor(postings, uuid.Nil, models.AccountPlatformRevenue)
+	original, _ := postingsFor(postings, originalID, models.AccountUserAvailable)
+	assert.Equal(t, "1.66", fee)
+	assert.Equal(t, "3.16", original)
+
+	_, err = services.BuildRefundPostings(transaction, dec("100.01"), decimal.Zero, false)
+	assert.Error(t, err)
+}
+
+func TestPartialRefundsAddUpToFullReversal(t *testing.T) {
+	sellerID, originalID, derivativeID := uuid.New(), uuid.New(), uuid.New()
+	transaction := testSaleTransaction(sellerID, originalID, derivativeID)
+
+	// Three partial refunds whose shares each round down
+	var all []services.Posting
+	refunded := decimal.Zero
+	for _, amount := range []string{"33.33", "33.33", "33.34"} {
+		postings, err := services.BuildRefundPostings(transaction, dec(amount), refunded, false)
+		require.NoError(t, err)
+		require.NoError(t, services.ValidatePostings(postings))
+		all = append(all, postings...)
+		refunded = refunded.Add(dec(amount))
+	}
+
+	// Together they reverse the sale to the cent
+	fee, _ := postingsFor(all, uuid.Nil, models.AccountPlatformRevenue)
+	derivative, _ := postingsFor(all, derivativeID, models.AccountUserPending)
+	original, _ := postingsFor(all, originalID, models.AccountUserPending)
+	seller, _ := postingsFor(all, sellerID, models.AccountUserPending)
+	assert.Equal(t, "5.00", fee)
+	assert.Equal(t, "28.50", derivative)
+	assert.Equal(t, "9.50", original)
+	assert.Equal(t, "57.00", seller)
+
+	// Nothing is left to refund
+	_, err := services.BuildRefundPostings(transaction, dec("0.01"), refunded, false)
+	assert.Error(t, err)
+}
+
+func TestUnbalancedPostingsAreRejected(t *testing.T) {
+	userID := uuid.New()
+
+	err := services.ValidatePostings([]services.Posting{
+		{OwnerID: uuid.Nil, Kind: models.AccountPlatformCash, Debit: dec("10")},
+		{OwnerID: userID, Kind: models.AccountUserPending, Credit: dec("9.99")},
+	})
+	assert.Error(t, err)
+
+	err = services.ValidatePostings([]services.Posting{
+		{OwnerID: uuid.Nil, Kind: models.AccountPlatformCash, Debit: dec("10"), Credit: dec("10")},
+		{OwnerID: userID, Kind: models.AccountUserPending},
+	})
+	assert.Error(t, err)
+}
+
+func TestRevenueSharesAreHiddenFromTheBuyer(t *testing.T) {
+	buyerID, sellerID, originalID, derivativeID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	sale := testSaleTransaction(sellerID, originalID, derivativeID)
+	sale.BuyerID = &buyerID
+
+	shares, err := services.BuildRevenueShareTransactions(sale)
+	require.NoError(t, err)
+	require.Len(t, shares, 3)
+
+	recipients := map[uuid.UUID]string{}
+	for _, share := range shares {
+		// Payment history lists a buyer's transactions by buyer_id, so shares
+		// must not carry the buyer of their sale
+		assert.Nil(t, share.BuyerID)
+		assert.Equal(t, models.TransactionTypeRevenueShare, share.TransactionType)
+		assert.Equal(t, sale.ID, *share.ParentTransactionID)
+		recipients[share.SellerID] = share.Amount.StringFixed(2)
+	}
+
+	assert.Equal(t, map[uuid.UUID]string{
+		derivativeID: "28.50",
+		originalID:   "9.50",
+		sellerID:     "57.00",
+	}, recipients)
+}
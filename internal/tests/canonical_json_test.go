@@ -0,0 +1,60 @@
+// internal/tests/canonical_json_test.go
+package tests
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+func TestCanonicalJSONSortsKeysByUTF16(t *testing.T) {
+	// Key ordering example from RFC 8785 section 3.2.3
+	input := `{
+		"\u20ac": "Euro Sign",
+		"\r": "Carriage Return",
+		"\ufb33": "Hebrew Letter Dalet With Dagesh",
+		"1": "One",
+		"\ud83d\ude00": "Emoji: Grinning Face",
+		"\u0080": "Control",
+		"\u00f6": "Latin Small Letter O With Diaeresis"
+	}`
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(input), &data))
+
+	output, err := utils.CanonicalJSON(data)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\","+
+			"\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\","+
+			"\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		string(output))
+}
+
+func TestCanonicalJSONFormatsNumbersAndStrings(t *testing.T) {
+	data := map[string]interface{}{
+		"numbers":  []interface{}{333333333.33333329, 1e30, 4.50, 2e-3, 0.000001, 1e-7, -0.0, 1700000000},
+		"string":   "€$\u000f\nA'B\"\\\\\"/<&>",
+		"literals": []interface{}{nil, true, false},
+	}
+
+	output, err := utils.CanonicalJSON(data)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		`{"literals":[null,true,false],`+
+			`"numbers":[333333333.3333333,1e+30,4.5,0.002,0.000001,1e-7,0,1700000000],`+
+			`"string":"€$\u000f\nA'B\"\\\\\"/<&>"}`,
+		string(output))
+}
+
+func TestCanonicalJSONRejectsNonFiniteNumbers(t *testing.T) {
+	_, err := utils.CanonicalJSON(map[string]interface{}{"value": math.Inf(1)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+// internal/tests/certificate_test.go
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+func testCertificateService(seed byte) *services.AuthorizationService {
+	key := make([]byte, ed25519.SeedSize)
+	for i := range key {
+		key[i] = seed
+	}
+
+	cfg := &config.Config{
+		Certificate: config.CertificateConfig{
+			SigningKey: base64.StdEncoding.EncodeToString(key),
+			TTLDays:    30,
+		},
+	}
+	return services.NewAuthorizationService(nil, cfg, nil, nil)
+}
+
+func testCertificateChain() *models.AuthorizationChain {
+	return &models.AuthorizationChain{
+		BaseModel:        models.BaseModel{ID: uuid.New()},
+		ProductID:        uuid.New(),
+		IPAssetID:        uuid.New(),
+		LicenseID:        uuid.New(),
+		VerificationCode: "AbCdEfGhIjKlMnOpQrStUvWxYz012345",
+		BlockchainHash:   testLedgerHash("product"),
+	}
+}
+
+func TestProductCertificateVerifiesOfflineWithJWKS(t *testing.T) {
+	authorizationService := testCertificateService(1)
+	authChain := testCertificateChain()
+
+	certificate, _, err := authorizationService.SignCertificate(authChain)
+	require.NoError(t, err)
+
+	// Verify the way a partner would: only the certificate and the published JWKS
+	jwks := authorizationService.GetJWKS()
+	require.Len(t, jwks.Keys, 1)
+
+	claims := &services.ProductCertificateClaims{}
+	token, err := jwt.ParseWithClaims(certificate, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, key := range jwks.Keys {
+			if key.Kid == token.Header["kid"] {
+				return key.PublicKey()
+			}
+		}
+		return nil, assert.AnError
+	})
+	require.NoError(t, err)
+	assert.True(t, token.Valid)
+	assert.Equal(t, "EdDSA", token.Header["alg"])
+
+	assert.Equal(t, authChain.ProductID.String(), claims.ProductID)
+	assert.Equal(t, authChain.IPAssetID.String(), claims.IPAssetID)
+	assert.Equal(t, authChain.LicenseID.String(), claims.LicenseID)
+	assert.Equal(t, authChain.VerificationCode, claims.VerificationCode)
+	assert.Equal(t, authChain.BlockchainHash, claims.ChainHash)
+}
+
+func TestProductCertificateRejectsOtherKeys(t *testing.T) {
+	certificate, _, err := testCertificateService(1).SignCertificate(testCertificateChain())
+	require.NoError(t, err)
+
+	_, err = testCertificateService(2).VerifyCertificate(certificate)
+	assert.Error(t, err)
+
+	claims, err := testCertificateService(1).VerifyCertificate(certificate)
+	require.NoError(t, err)
+	assert.Equal(t, "ip-marketplace", claims.Issuer)
+}
+
+func TestJWKThumbprintMatchesRFC8037(t *testing.T) {
+	// Example key from RFC 8037 appendix A.3
+	x := "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	publicKey, err := base64.RawURLEncoding.DecodeString(x)
+	require.NoError(t, err)
+
+	jwk := utils.NewEd25519JWK(ed25519.PublicKey(publicKey))
+	assert.Equal(t, x, jwk.X)
+	assert.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", jwk.Kid)
+}
+
+func TestConfigRejectsInvalidCertificateSigningKey(t *testing.T) {
+	cfg := &config.Config{Environment: "development"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Certificate.SigningKey = "not a key"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Certificate.SigningKey = base64.StdEncoding.EncodeToString([]byte("too short"))
+	assert.Error(t, cfg.Validate())
+
+	cfg.Certificate.SigningKey = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,150 @@
+// internal/tests/database_test.go
+package tests
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/javajoker/imi-backend/internal/database"
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+var (
+	testDBOnce sync.Once
+	testDB     *gorm.DB
+	testDBErr  error
+)
+
+// testDatabase connects to the Postgres database named by TEST_DATABASE_URL
+// and migrates it. Tests that need a database are skipped without one.
+func testDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		testDB, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logger.Default.LogMode(logger.Silent),
+		})
+		if testDBErr == nil {
+			testDBErr = database.RunMigrations(testDB)
+		}
+	})
+	require.NoError(t, testDBErr)
+
+	return testDB
+}
+
+// testUser creates a user with a unique name
+func testUser(t *testing.T, db *gorm.DB, userType models.UserType) *models.User {
+	t.Helper()
+
+	name := "test_" + uuid.NewString()[:12]
+	user := &models.User{
+		Username:     name,
+		Email:        name + "@example.com",
+		PasswordHash: "x",
+		UserType:     userType,
+	}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// testListedProduct creates a product of seller, licensed from a fresh
+// approved IP asset, with inventory units in stock and serials for the
+// first units of them
+func testListedProduct(t *testing.T, db *gorm.DB, seller *models.User, price, currency string, inventory, units int) *models.Product {
+	t.Helper()
+
+	creator := testUser(t, db, models.UserTypeCreator)
+	ipAsset := &models.IPAsset{
+		CreatorID:          creator.ID,
+		Title:              "Test Artwork",
+		VerificationStatus: models.VerificationStatusApproved,
+	}
+	require.NoError(t, db.Create(ipAsset).Error)
+
+	terms := &models.LicenseTerms{
+		IPAssetID:              ipAsset.ID,
+		LicenseType:            models.LicenseTypeStandard,
+		RevenueSharePercentage: dec("10"),
+		Currency:               currency,
+		Territory:              models.GlobalTerritory(),
+	}
+	require.NoError(t, db.Create(terms).Error)
+
+	license := &models.LicenseApplication{
+		IPAssetID:      ipAsset.ID,
+		ApplicantID:    seller.ID,
+		LicenseTermsID: terms.ID,
+		Status:         models.ApplicationStatusApproved,
+		IsActive:       true,
+	}
+	require.NoError(t, db.Create(license).Error)
+
+	product := &models.Product{
+		CreatorID:      seller.ID,
+		LicenseID:      license.ID,
+		Title:          "Test Product",
+		Price:          dec(price),
+		Currency:       currency,
+		InventoryCount: inventory,
+		Status:         models.ProductStatusActive,
+	}
+	require.NoError(t, db.Create(product).Error)
+
+	for serial := 1; serial <= units; serial++ {
+		require.NoError(t, db.Create(&models.ProductUnit{
+			ProductID:        product.ID,
+			SerialNumber:     serial,
+			VerificationCode: uuid.NewString()[:32],
+		}).Error)
+	}
+
+	return product
+}
+
+// reloadProduct reads a product back from db
+func reloadProduct(t *testing.T, db *gorm.DB, productID uuid.UUID) *models.Product {
+	t.Helper()
+
+	var product models.Product
+	require.NoError(t, db.First(&product, productID).Error)
+	return &product
+}
+
+func TestDataMigrationsRunOnce(t *testing.T) {
+	db := testDatabase(t)
+
+	var applied int64
+	require.NoError(t, db.Table("data_migrations").Where("name = ?", "detach_revenue_shares_from_buyers").Count(&applied).Error)
+	require.EqualValues(t, 1, applied)
+
+	// A later start leaves rows written since the repair alone
+	buyer := testUser(t, db, models.UserTypeBuyer)
+	seller := testUser(t, db, models.UserTypeCreator)
+	share := &models.Transaction{
+		TransactionType: models.TransactionTypeRevenueShare,
+		BuyerID:         &buyer.ID,
+		SellerID:        seller.ID,
+		Amount:          dec("1.00"),
+		Currency:        "USD",
+		Status:          models.TransactionStatusCompleted,
+	}
+	require.NoError(t, db.Create(share).Error)
+	require.NoError(t, database.RunMigrations(db))
+
+	var reloaded models.Transaction
+	require.NoError(t, db.First(&reloaded, "id = ?", share.ID).Error)
+	require.NotNil(t, reloaded.BuyerID)
+}
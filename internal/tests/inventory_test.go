@@ -0,0 +1,224 @@
+// internal/tests/inventory_test.go
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestInventoryReservationTTL(t *testing.T) {
+	cfg := &config.Config{}
+	service := services.NewInventoryService(nil, cfg)
+
+	// Unconfigured reservations last half an hour
+	assert.Equal(t, 30*time.Minute, service.ReservationTTL())
+
+	cfg.Payment.ReservationTTL = 15
+	assert.Equal(t, 15*time.Minute, service.ReservationTTL())
+}
+
+// inventoryTx runs a test against a transaction that is rolled back after it
+func inventoryTx(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	tx := testDatabase(t).Begin()
+	require.NoError(t, tx.Error)
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func reservationOf(t *testing.T, tx *gorm.DB, transactionID, productID uuid.UUID) *models.InventoryReservation {
+	t.Helper()
+
+	var reservation models.InventoryReservation
+	require.NoError(t, tx.Where("transaction_id = ? AND product_id = ?", transactionID, productID).
+		First(&reservation).Error)
+	return &reservation
+}
+
+func unitsOf(t *testing.T, tx *gorm.DB, transactionID uuid.UUID) []models.ProductUnit {
+	t.Helper()
+
+	var units []models.ProductUnit
+	require.NoError(t, tx.Where("transaction_id = ?", transactionID).Order("serial_number").Find(&units).Error)
+	return units
+}
+
+func TestInventoryHoldAndRelease(t *testing.T) {
+	tx := inventoryTx(t)
+	inventory := services.NewInventoryService(tx, &config.Config{})
+	product := testListedProduct(t, tx, testUser(t, tx, models.UserTypeCreator), "25.00", "USD", 2, 2)
+
+	transactionID := uuid.New()
+	reservation, err := inventory.Hold(tx, product.ID, transactionID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReservationStatusHeld, reservation.Status)
+	assert.True(t, reservation.ExpiresAt.After(time.Now()))
+
+	// The last units sell the product out and take the lowest serials
+	held := reloadProduct(t, tx, product.ID)
+	assert.Equal(t, 0, held.InventoryCount)
+	assert.Equal(t, models.ProductStatusSoldOut, held.Status)
+	units := unitsOf(t, tx, transactionID)
+	require.Len(t, units, 2)
+	assert.Equal(t, 1, units[0].SerialNumber)
+	assert.Equal(t, models.UnitStatusSold, units[0].Status)
+
+	_, err = inventory.Hold(tx, product.ID, uuid.New(), 1)
+	assert.ErrorIs(t, err, services.ErrInsufficientInventory)
+
+	// Releasing returns the stock and serials, and releasing again does nothing
+	require.NoError(t, inventory.Release(tx, transactionID))
+	require.NoError(t, inventory.Release(tx, transactionID))
+
+	released := reloadProduct(t, tx, product.ID)
+	assert.Equal(t, 2, released.InventoryCount)
+	assert.Equal(t, models.ProductStatusActive, released.Status)
+	assert.Empty(t, unitsOf(t, tx, transactionID))
+	assert.Equal(t, models.ReservationStatusReleased, reservationOf(t, tx, transactionID, product.ID).Status)
+}
+
+func TestInventoryCommitCountsSales(t *testing.T) {
+	tx := inventoryTx(t)
+	inventory := services.NewInventoryService(tx, &config.Config{})
+	product := testListedProduct(t, tx, testUser(t, tx, models.UserTypeCreator), "25.00", "USD", 5, 5)
+
+	transactionID := uuid.New()
+	_, err := inventory.Hold(tx, product.ID, transactionID, 3)
+	require.NoError(t, err)
+	require.NoError(t, inventory.Commit(tx, transactionID))
+
+	reservation := reservationOf(t, tx, transactionID, product.ID)
+	assert.Equal(t, models.ReservationStatusCommitted, reservation.Status)
+	assert.NotNil(t, reservation.CommittedAt)
+
+	committed := reloadProduct(t, tx, product.ID)
+	assert.Equal(t, 2, committed.InventoryCount)
+	assert.Equal(t, int64(3), committed.SalesCount)
+
+	// Committed units stay sold
+	require.NoError(t, inventory.Release(tx, transactionID))
+	assert.Equal(t, 2, reloadProduct(t, tx, product.ID).InventoryCount)
+	assert.Len(t, unitsOf(t, tx, transactionID), 3)
+}
+
+func TestInventoryReclaimAfterLatePayment(t *testing.T) {
+	tx := inventoryTx(t)
+	inventory := services.NewInventoryService(tx, &config.Config{})
+	product := testListedProduct(t, tx, testUser(t, tx, models.UserTypeCreator), "25.00", "USD", 1, 1)
+
+	transactionID := uuid.New()
+	_, err := inventory.Hold(tx, product.ID, transactionID, 1)
+	require.NoError(t, err)
+	require.NoError(t, inventory.Release(tx, transactionID))
+
+	// A payment arriving after the release takes the unit again
+	soldOut, err := inventory.Reclaim(tx, transactionID)
+	require.NoError(t, err)
+	assert.Empty(t, soldOut)
+	assert.Equal(t, models.ReservationStatusHeld, reservationOf(t, tx, transactionID, product.ID).Status)
+
+	reclaimed := reloadProduct(t, tx, product.ID)
+	assert.Equal(t, 0, reclaimed.InventoryCount)
+	assert.Equal(t, models.ProductStatusSoldOut, reclaimed.Status)
+	assert.Len(t, unitsOf(t, tx, transactionID), 1)
+}
+
+func TestInventoryReclaimReportsSoldOutProducts(t *testing.T) {
+	tx := inventoryTx(t)
+	inventory := services.NewInventoryService(tx, &config.Config{})
+	product := testListedProduct(t, tx, testUser(t, tx, models.UserTypeCreator), "25.00", "USD", 1, 1)
+
+	lateID, otherID := uuid.New(), uuid.New()
+	_, err := inventory.Hold(tx, product.ID, lateID, 1)
+	require.NoError(t, err)
+	require.NoError(t, inventory.Release(tx, lateID))
+
+	// Another buyer takes the last unit before the late payment arrives
+	_, err = inventory.Hold(tx, product.ID, otherID, 1)
+	require.NoError(t, err)
+
+	soldOut, err := inventory.Reclaim(tx, lateID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{product.ID}, soldOut)
+	assert.Equal(t, models.ReservationStatusReleased, reservationOf(t, tx, lateID, product.ID).Status)
+	assert.Equal(t, 0, reloadProduct(t, tx, product.ID).InventoryCount)
+}
+
+func TestInventorySyncAvailabilityFlipsStatus(t *testing.T) {
+	db := testDatabase(t)
+	inventory := services.NewInventoryService(db, &config.Config{})
+	seller := testUser(t, db, models.UserTypeCreator)
+
+	empty := testListedProduct(t, db, seller, "25.00", "USD", 0, 0)
+	restocked := testListedProduct(t, db, seller, "25.00", "USD", 3, 0)
+	require.NoError(t, db.Model(restocked).Update("status", models.ProductStatusSoldOut).Error)
+	draft := testListedProduct(t, db, seller, "25.00", "USD", 0, 0)
+	require.NoError(t, db.Model(draft).Update("status", models.ProductStatusDraft).Error)
+
+	changed, err := inventory.SyncAvailability()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, changed, int64(2))
+
+	assert.Equal(t, models.ProductStatusSoldOut, reloadProduct(t, db, empty.ID).Status)
+	assert.Equal(t, models.ProductStatusActive, reloadProduct(t, db, restocked.ID).Status)
+	assert.Equal(t, models.ProductStatusDraft, reloadProduct(t, db, draft.ID).Status)
+}
+
+func TestReservationReaperFailsExpiredPurchases(t *testing.T) {
+	db := testDatabase(t)
+	cfg := &config.Config{}
+	inventory := services.NewInventoryService(db, cfg)
+	paymentService := services.NewPaymentService(db, cfg, nil, nil, inventory)
+
+	seller := testUser(t, db, models.UserTypeCreator)
+	buyer := testUser(t, db, models.UserTypeBuyer)
+	product := testListedProduct(t, db, seller, "25.00", "USD", 1, 1)
+
+	transaction := &models.Transaction{
+		TransactionType: models.TransactionTypeProductSale,
+		BuyerID:         &buyer.ID,
+		SellerID:        seller.ID,
+		ProductID:       &product.ID,
+		Quantity:        1,
+		Amount:          dec("25.00"),
+		PlatformFee:     dec("1.25"),
+		Currency:        "USD",
+		Status:          models.TransactionStatusPending,
+	}
+	require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(transaction).Error; err != nil {
+			return err
+		}
+		_, err := inventory.Hold(tx, product.ID, transaction.ID, 1)
+		return err
+	}))
+	assert.Equal(t, models.ProductStatusSoldOut, reloadProduct(t, db, product.ID).Status)
+
+	// The buyer never pays and the reservation runs out
+	require.NoError(t, db.Model(&models.InventoryReservation{}).
+		Where("transaction_id = ?", transaction.ID).
+		UpdateColumn("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	released, err := paymentService.ReleaseExpiredReservations()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, released, 1)
+
+	var failed models.Transaction
+	require.NoError(t, db.First(&failed, transaction.ID).Error)
+	assert.Equal(t, models.TransactionStatusFailed, failed.Status)
+
+	restocked := reloadProduct(t, db, product.ID)
+	assert.Equal(t, 1, restocked.InventoryCount)
+	assert.Equal(t, models.ProductStatusActive, restocked.Status)
+	assert.Equal(t, models.ReservationStatusReleased, reservationOf(t, db, transaction.ID, product.ID).Status)
+}
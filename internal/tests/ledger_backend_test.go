@@ -0,0 +1,155 @@
+// internal/tests/ledger_backend_test.go
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+type EthereumLedgerBackendTestSuite struct {
+	suite.Suite
+	sim     *simulated.Backend
+	key     *ecdsa.PrivateKey
+	backend *services.EthereumLedgerBackend
+}
+
+func (suite *EthereumLedgerBackendTestSuite) SetupTest() {
+	key, err := crypto.GenerateKey()
+	require.NoError(suite.T(), err)
+	suite.key = key
+
+	funds, _ := new(big.Int).SetString("1000000000000000000000", 10)
+	suite.sim = simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: funds},
+	})
+
+	contract := suite.deployAnchorContract()
+	suite.backend, err = services.NewEthereumLedgerBackend("simulated", suite.sim.Client(), key, contract)
+	require.NoError(suite.T(), err)
+}
+
+func (suite *EthereumLedgerBackendTestSuite) TearDownTest() {
+	suite.sim.Close()
+}
+
+func (suite *EthereumLedgerBackendTestSuite) TestAnchorAndLookup() {
+	ctx := context.Background()
+	hash := testLedgerHash("ip_creation")
+
+	receipt, err := suite.backend.Anchor(ctx, hash)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), models.AnchorStatusSubmitted, receipt.Status)
+	assert.NotEmpty(suite.T(), receipt.Reference)
+
+	suite.sim.Commit()
+
+	found, err := suite.backend.Lookup(ctx, hash)
+	require.NoError(suite.T(), err)
+	assert.Equal(suite.T(), models.AnchorStatusConfirmed, found.Status)
+	require.NotNil(suite.T(), found.BlockNumber)
+	assert.Greater(suite.T(), *found.BlockNumber, uint64(0))
+	assert.NotNil(suite.T(), found.AnchoredAt)
+}
+
+func (suite *EthereumLedgerBackendTestSuite) TestLookupUnanchoredHash() {
+	_, err := suite.backend.Lookup(context.Background(), testLedgerHash("never anchored"))
+	assert.ErrorIs(suite.T(), err, services.ErrNotAnchored)
+}
+
+func (suite *EthereumLedgerBackendTestSuite) TestAnchorRejectsDuplicates() {
+	ctx := context.Background()
+	hash := testLedgerHash("license_grant")
+
+	_, err := suite.backend.Anchor(ctx, hash)
+	require.NoError(suite.T(), err)
+	suite.sim.Commit()
+
+	_, err = suite.backend.Anchor(ctx, hash)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *EthereumLedgerBackendTestSuite) TestAnchorRejectsMalformedHash() {
+	_, err := suite.backend.Anchor(context.Background(), "not-a-hash")
+	assert.Error(suite.T(), err)
+}
+
+// deployAnchorContract deploys hand-assembled bytecode equivalent to the
+// ProvenanceAnchor contract documented in services.ProvenanceAnchorABI.
+func (suite *EthereumLedgerBackendTestSuite) deployAnchorContract() common.Address {
+	parsed, err := abi.JSON(strings.NewReader(services.ProvenanceAnchorABI))
+	require.NoError(suite.T(), err)
+
+	anchorID := parsed.Methods["anchor"].ID
+	lookupID := parsed.Methods["anchoredBlock"].ID
+
+	runtime := []byte{
+		0x60, 0x04, 0x35, // PUSH1 4 CALLDATALOAD          -> hash
+		0x60, 0x00, 0x35, 0x60, 0xe0, 0x1c, // selector
+		0x80, 0x63, anchorID[0], anchorID[1], anchorID[2], anchorID[3], 0x14, // DUP1 PUSH4 EQ
+		0x60, 0x20, 0x57, // PUSH1 anchor JUMPI
+		0x63, lookupID[0], lookupID[1], lookupID[2], lookupID[3], 0x14, // PUSH4 EQ
+		0x60, 0x31, 0x57, // PUSH1 lookup JUMPI
+		0x60, 0x00, 0x80, 0xfd, // REVERT
+		// anchor(bytes32): require(slot[hash] == 0); slot[hash] = block.number
+		0x5b, 0x50, 0x80, 0x54, 0x15, 0x60, 0x2c, 0x57, 0x60, 0x00, 0x80, 0xfd,
+		0x5b, 0x43, 0x90, 0x55, 0x00,
+		// anchoredBlock(bytes32): return slot[hash]
+		0x5b, 0x54, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3,
+	}
+
+	size := byte(len(runtime))
+	initCode := append([]byte{0x60, size, 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, runtime...)
+
+	ctx := context.Background()
+	client := suite.sim.Client()
+	from := crypto.PubkeyToAddress(suite.key.PublicKey)
+
+	chainID, err := client.ChainID(ctx)
+	require.NoError(suite.T(), err)
+	nonce, err := client.PendingNonceAt(ctx, from)
+	require.NoError(suite.T(), err)
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	require.NoError(suite.T(), err)
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: gasPrice,
+		Gas:      200000,
+		Data:     initCode,
+	}), types.LatestSignerForChainID(chainID), suite.key)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), client.SendTransaction(ctx, tx))
+	suite.sim.Commit()
+
+	receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), types.ReceiptStatusSuccessful, receipt.Status)
+
+	return receipt.ContractAddress
+}
+
+func testLedgerHash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestEthereumLedgerBackendSuite(t *testing.T) {
+	suite.Run(t, new(EthereumLedgerBackendTestSuite))
+}
@@ -0,0 +1,140 @@
+// internal/tests/license_agreement_test.go
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func agreementApplication() *models.LicenseApplication {
+	creatorID, applicantID := uuid.New(), uuid.New()
+	territory, _ := models.ParseTerritorySet("EU,US,-HU")
+	return &models.LicenseApplication{
+		BaseModel:   models.BaseModel{ID: uuid.New(), CreatedAt: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)},
+		ApplicantID: applicantID,
+		IPAsset: models.IPAsset{
+			BaseModel: models.BaseModel{ID: uuid.New()},
+			CreatorID: creatorID,
+			Title:     "Sunset <Waves>",
+			Category:  "artwork",
+			Creator:   models.User{Username: "jane"},
+		},
+		Applicant: models.User{Username: "maker"},
+		LicenseTerms: models.LicenseTerms{
+			LicenseType:            models.LicenseTypeStandard,
+			RevenueSharePercentage: dec("20"),
+			BaseFee:                dec("50"),
+			Currency:               "EUR",
+			Territory:              territory,
+			Duration:               "1y",
+			Restrictions:           "No adult content",
+			Policy:                 models.LicensePolicy{MaxUnits: 500},
+		},
+	}
+}
+
+func TestLicenseAgreementCoversTermsAndParties(t *testing.T) {
+	html, err := services.BuildLicenseAgreement(agreementApplication()).HTML()
+	require.NoError(t, err)
+
+	for _, expected := range []string{
+		"Licensor: jane", "Licensee: maker",
+		"Sunset &lt;Waves&gt;",
+		"EU, US, except HU",
+		"runs for 1y",
+		"50.00 EUR", "20.00%",
+		"No adult content",
+		"No more than 500 units",
+		"Dated 15 January 2024",
+	} {
+		assert.Contains(t, string(html), expected)
+	}
+	assert.NotContains(t, string(html), "<Waves>")
+}
+
+func TestLicenseAgreementHashIsStableAndTracksTerms(t *testing.T) {
+	application := agreementApplication()
+	first, err := services.BuildLicenseAgreement(application).Hash()
+	require.NoError(t, err)
+	again, err := services.BuildLicenseAgreement(application).Hash()
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+	assert.Len(t, first, 64)
+
+	application.LicenseTerms.RevenueSharePercentage = dec("25")
+	changed, err := services.BuildLicenseAgreement(application).Hash()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+}
+
+func TestLicenseAgreementRendersSignedPDF(t *testing.T) {
+	document := services.BuildLicenseAgreement(agreementApplication())
+	hash, err := document.Hash()
+	require.NoError(t, err)
+
+	unsigned, err := document.PDF(nil)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(unsigned, []byte("%PDF-")))
+
+	signature := &models.LicenseAgreement{
+		SignerID:     uuid.New(),
+		DocumentHash: hash,
+		SignedAt:     time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC),
+		SignerIP:     "203.0.113.7",
+	}
+	signed, err := document.PDF(signature)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(signed, []byte("%PDF-")))
+
+	// Stamped with the signing time, the signed PDF renders the same again
+	again, err := document.PDF(signature)
+	require.NoError(t, err)
+	assert.Equal(t, signed, again)
+}
+
+func TestProductsRequireSignedAgreementUnderNewLicenses(t *testing.T) {
+	db := testDatabase(t)
+
+	cfg := &config.Config{}
+	productService := services.NewProductService(db, services.NewAuthorizationService(db, cfg, nil, nil), nil, nil, nil, nil)
+
+	seller := testUser(t, db, models.UserTypeSecondaryCreator)
+	existing := testListedProduct(t, db, seller, "20", "USD", 5, 0)
+	request := func(licenseID uuid.UUID) *services.CreateProductRequest {
+		return &services.CreateProductRequest{
+			LicenseID:   licenseID,
+			Title:       "Agreement Test Product",
+			Description: "A product made under a license",
+			Category:    "apparel",
+			Price:       dec("20"),
+			Currency:    "USD",
+		}
+	}
+
+	// Licenses from before agreements were introduced need none
+	_, err := productService.CreateProduct(seller.ID, request(existing.LicenseID))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Model(&models.LicenseApplication{}).Where("id = ?", existing.LicenseID).
+		Update("agreement_required", true).Error)
+	_, err = productService.CreateProduct(seller.ID, request(existing.LicenseID))
+	assert.ErrorIs(t, err, services.ErrAgreementNotSigned)
+
+	require.NoError(t, db.Create(&models.LicenseAgreement{
+		LicenseApplicationID: existing.LicenseID,
+		SignerID:             seller.ID,
+		DocumentHash:         "hash",
+		SignedAt:             time.Now(),
+	}).Error)
+	_, err = productService.CreateProduct(seller.ID, request(existing.LicenseID))
+	assert.NoError(t, err)
+}
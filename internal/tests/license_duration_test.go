@@ -0,0 +1,115 @@
+// internal/tests/license_duration_test.go
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestParseLicenseDuration(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"1y":        time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC),
+		"6m":        time.Date(2024, time.July, 31, 12, 0, 0, 0, time.UTC),
+		"2w":        time.Date(2024, time.February, 14, 12, 0, 0, 0, time.UTC),
+		"90d":       time.Date(2024, time.April, 30, 12, 0, 0, 0, time.UTC),
+		"1y6m":      time.Date(2025, time.July, 31, 12, 0, 0, 0, time.UTC),
+		"18 months": time.Date(2025, time.July, 31, 12, 0, 0, 0, time.UTC),
+		"1 Year":    time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC),
+	}
+	for spec, want := range cases {
+		duration, err := models.ParseLicenseDuration(spec)
+		require.NoError(t, err, spec)
+		expiresAt := duration.ExpiresAt(start)
+		require.NotNil(t, expiresAt, spec)
+		assert.True(t, want.Equal(*expiresAt), "%s: got %s", spec, expiresAt)
+	}
+}
+
+func TestPerpetualLicensesNeverExpire(t *testing.T) {
+	for _, spec := range []string{"", "perpetual", "Perpetual"} {
+		duration, err := models.ParseLicenseDuration(spec)
+		require.NoError(t, err)
+		assert.True(t, duration.IsPerpetual())
+		assert.Nil(t, duration.ExpiresAt(time.Now()))
+	}
+}
+
+func TestParseLicenseDurationRejectsInvalidDurations(t *testing.T) {
+	for _, spec := range []string{"forever", "1", "y", "0d", "3 fortnights", "-1y"} {
+		_, err := models.ParseLicenseDuration(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestExpiredLicensesRenewWithinGracePeriod(t *testing.T) {
+	now := time.Now()
+	expiredAt := now.Add(-24 * time.Hour)
+	license := &models.LicenseApplication{Status: models.ApplicationStatusExpired, ExpiresAt: &expiredAt}
+	assert.True(t, license.InRenewalGrace(now))
+	assert.False(t, license.InRenewalGrace(expiredAt.Add(models.LicenseRenewalGracePeriod)))
+
+	license.Status = models.ApplicationStatusRevoked
+	assert.False(t, license.InRenewalGrace(now))
+}
+
+func TestRenewingExpiredLicenseRestoresItsChains(t *testing.T) {
+	db := testDatabase(t)
+
+	cfg := &config.Config{}
+	authorizationService := services.NewAuthorizationService(db, cfg, nil, nil)
+	licenseService := services.NewLicenseService(db, nil, nil, authorizationService, nil, nil)
+
+	seller := testUser(t, db, models.UserTypeSecondaryCreator)
+	product := testListedProduct(t, db, seller, "20", "USD", 5, 0)
+
+	var license models.LicenseApplication
+	require.NoError(t, db.First(&license, product.LicenseID).Error)
+	require.NoError(t, db.Model(&models.LicenseTerms{}).Where("id = ?", license.LicenseTermsID).
+		Update("duration", "1y").Error)
+	require.NoError(t, db.Model(&license).Update("expires_at", time.Now().Add(-time.Hour)).Error)
+
+	chain := &models.AuthorizationChain{
+		ProductID:        product.ID,
+		IPAssetID:        license.IPAssetID,
+		LicenseID:        license.ID,
+		VerificationCode: uuid.NewString()[:32],
+		IsActive:         true,
+	}
+	require.NoError(t, db.Create(chain).Error)
+
+	_, err := licenseService.ExpireLicenses()
+	require.NoError(t, err)
+	require.NoError(t, db.First(chain, chain.ID).Error)
+	assert.False(t, chain.IsActive)
+	assert.Equal(t, models.ProductStatusSuspended, reloadProduct(t, db, product.ID).Status)
+
+	renewed, payment, err := licenseService.RenewLicense(license.ID, seller.ID, &services.RenewLicenseRequest{})
+	require.NoError(t, err)
+	assert.Nil(t, payment)
+	assert.Equal(t, models.ApplicationStatusApproved, renewed.Status)
+	assert.True(t, renewed.IsActive)
+	assert.True(t, renewed.ExpiresAt.After(time.Now().AddDate(0, 11, 0)))
+
+	require.NoError(t, db.First(chain, chain.ID).Error)
+	assert.True(t, chain.IsActive)
+	assert.Empty(t, chain.RevocationReason)
+	assert.Equal(t, models.ProductStatusActive, reloadProduct(t, db, product.ID).Status)
+
+	// Past the grace period the licensee applies again
+	require.NoError(t, db.Model(&models.LicenseApplication{}).Where("id = ?", license.ID).Updates(map[string]interface{}{
+		"status":     models.ApplicationStatusExpired,
+		"expires_at": time.Now().Add(-models.LicenseRenewalGracePeriod - time.Hour),
+	}).Error)
+	_, _, err = licenseService.RenewLicense(license.ID, seller.ID, &services.RenewLicenseRequest{})
+	assert.ErrorContains(t, err, "apply again")
+}
@@ -0,0 +1,148 @@
+// internal/tests/license_fee_test.go
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestLicenseFeeCreditsCreatorNetOfPlatformFee(t *testing.T) {
+	creatorID, applicantID := uuid.New(), uuid.New()
+	application := &models.LicenseApplication{
+		BaseModel:   models.BaseModel{ID: uuid.New()},
+		IPAssetID:   uuid.New(),
+		ApplicantID: applicantID,
+	}
+	terms := &models.LicenseTerms{BaseFee: dec("200"), Currency: "eur"}
+
+	transaction := services.NewLicenseFeeTransaction(application, terms, creatorID, "card")
+	assert.Equal(t, models.TransactionTypeLicenseFee, transaction.TransactionType)
+	assert.Equal(t, models.TransactionStatusPending, transaction.Status)
+	require.NotNil(t, transaction.BuyerID)
+	assert.Equal(t, applicantID, *transaction.BuyerID)
+	assert.Equal(t, creatorID, transaction.SellerID)
+	require.NotNil(t, transaction.LicenseID)
+	assert.Equal(t, application.ID, *transaction.LicenseID)
+	assert.Equal(t, "200.00 EUR", transaction.Total().String())
+	assert.Equal(t, "10.00 EUR", transaction.Fee().String())
+
+	postings, err := services.BuildSalePostings(transaction)
+	require.NoError(t, err)
+	require.NoError(t, services.ValidatePostings(postings))
+
+	_, fee := postingsFor(postings, uuid.Nil, models.AccountPlatformRevenue)
+	_, creator := postingsFor(postings, creatorID, models.AccountUserPending)
+	assert.Equal(t, "10.00", fee)
+	assert.Equal(t, "190.00", creator)
+}
+
+func TestPayLicenseFeeRequiresPayments(t *testing.T) {
+	service := services.NewLicenseService(nil, nil, nil, nil, nil, nil)
+
+	_, err := service.PayLicenseFee(uuid.New(), uuid.New(), &services.PayLicenseFeeRequest{})
+	assert.ErrorContains(t, err, "payments are not configured")
+}
+
+func TestUnpaidLicensesAreDueWithinThePaymentWindow(t *testing.T) {
+	approvedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	application := &models.LicenseApplication{
+		Status:     models.ApplicationStatusAwaitingPayment,
+		ApprovedAt: &approvedAt,
+	}
+
+	due := application.PaymentDueBy()
+	require.NotNil(t, due)
+	assert.Equal(t, time.Date(2024, 3, 8, 12, 0, 0, 0, time.UTC), *due)
+
+	// Paid and cancelled licenses owe nothing
+	application.Status = models.ApplicationStatusApproved
+	assert.Nil(t, application.PaymentDueBy())
+	application.Status = models.ApplicationStatusCancelled
+	assert.Nil(t, application.PaymentDueBy())
+}
+
+func TestLateLicenseFeeIsRefundedInFull(t *testing.T) {
+	application := &models.LicenseApplication{BaseModel: models.BaseModel{ID: uuid.New()}, ApplicantID: uuid.New()}
+	terms := &models.LicenseTerms{BaseFee: dec("200"), Currency: "EUR"}
+
+	transaction := services.NewLicenseFeeTransaction(application, terms, uuid.New(), "card")
+	transaction.Status = models.TransactionStatusCompleted
+
+	amount, err := services.RefundAmount(transaction, decimal.Zero, decimal.Zero)
+	require.NoError(t, err)
+	assert.Equal(t, "200.00 EUR", amount.String())
+}
+
+// testLicenseTerms creates perpetual, fee-free terms on a fresh approved IP
+// asset and returns them with the asset's creator
+func testLicenseTerms(t *testing.T, db *gorm.DB) (*models.LicenseTerms, *models.User) {
+	t.Helper()
+
+	creator := testUser(t, db, models.UserTypeCreator)
+	ipAsset := &models.IPAsset{
+		CreatorID:          creator.ID,
+		Title:              "Test Artwork",
+		VerificationStatus: models.VerificationStatusApproved,
+	}
+	require.NoError(t, db.Create(ipAsset).Error)
+
+	terms := &models.LicenseTerms{
+		IPAssetID:              ipAsset.ID,
+		LicenseType:            models.LicenseTypeStandard,
+		RevenueSharePercentage: dec("10"),
+		Currency:               "USD",
+		Territory:              models.GlobalTerritory(),
+		Duration:               models.PerpetualDuration,
+	}
+	require.NoError(t, db.Create(terms).Error)
+	return terms, creator
+}
+
+func TestUpdateLicenseTermsRejectsUnchargeableFees(t *testing.T) {
+	db := testDatabase(t)
+	ipService := services.NewIPService(db, nil, nil, nil, nil)
+	terms, creator := testLicenseTerms(t, db)
+
+	req := &services.CreateLicenseTermsRequest{
+		LicenseType:            models.LicenseTypeStandard,
+		RevenueSharePercentage: dec("10"),
+		BaseFee:                dec("49.999"),
+		Currency:               "USD",
+	}
+	_, err := ipService.UpdateLicenseTerms(terms.ID, creator.ID, req)
+	assert.ErrorContains(t, err, "more decimal places")
+
+	req.BaseFee = dec("50")
+	updated, err := ipService.UpdateLicenseTerms(terms.ID, creator.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "50", updated.BaseFee.String())
+}
+
+func TestUpdateLicenseTermsDefaultsToPerpetual(t *testing.T) {
+	db := testDatabase(t)
+	ipService := services.NewIPService(db, nil, nil, nil, nil)
+	terms, creator := testLicenseTerms(t, db)
+
+	req := &services.CreateLicenseTermsRequest{
+		LicenseType:            models.LicenseTypeStandard,
+		RevenueSharePercentage: dec("10"),
+		Duration:               "1y",
+	}
+	updated, err := ipService.UpdateLicenseTerms(terms.ID, creator.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "1y", updated.Duration)
+
+	req.Duration = ""
+	updated, err = ipService.UpdateLicenseTerms(terms.ID, creator.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, models.PerpetualDuration, updated.Duration)
+}
@@ -0,0 +1,105 @@
+// internal/tests/license_policy_test.go
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/models"
+)
+
+func policyProduct() *models.Product {
+	return &models.Product{
+		Title:       "Abstract Art T-Shirt",
+		Description: "Cotton tee. Artwork by Jane Doe.",
+		Category:    "Apparel",
+		Price:       dec("25.00"),
+		Currency:    "USD",
+		Tags:        []string{"art", "cotton"},
+	}
+}
+
+func testPolicy() models.LicensePolicy {
+	floor := models.NewMoney(dec("15"), "usd")
+	return models.LicensePolicy{
+		AllowedCategories:   []string{" apparel ", "prints"},
+		MaxUnits:            100,
+		PriceFloor:          &floor,
+		RequiredAttribution: "artwork by jane doe",
+		ForbiddenTags:       []string{"Adult", "adult"},
+	}.Normalize()
+}
+
+func assertViolates(t *testing.T, err error, rule string) {
+	t.Helper()
+	var violation *models.PolicyViolation
+	require.True(t, errors.As(err, &violation), "expected a policy violation, got %v", err)
+	assert.Equal(t, rule, violation.Rule)
+}
+
+func TestLicensePolicyAcceptsCompliantProduct(t *testing.T) {
+	policy := testPolicy()
+	require.NoError(t, policy.Validate())
+	assert.Equal(t, []string{"adult"}, policy.ForbiddenTags)
+	assert.NoError(t, policy.CheckProduct(policyProduct()))
+	assert.NoError(t, models.LicensePolicy{}.CheckProduct(policyProduct()))
+}
+
+func TestLicensePolicyNamesTheRuleBroken(t *testing.T) {
+	policy := testPolicy()
+
+	product := policyProduct()
+	product.Category = "Mugs"
+	assertViolates(t, policy.CheckProduct(product), models.PolicyRuleAllowedCategories)
+
+	product = policyProduct()
+	product.Price = dec("9.99")
+	assertViolates(t, policy.CheckProduct(product), models.PolicyRulePriceFloor)
+
+	product = policyProduct()
+	product.Currency = "EUR"
+	assertViolates(t, policy.CheckProduct(product), models.PolicyRulePriceFloor)
+
+	product = policyProduct()
+	product.Description = "Cotton tee."
+	assertViolates(t, policy.CheckProduct(product), models.PolicyRuleRequiredAttribution)
+
+	product = policyProduct()
+	product.Tags = []string{"art", "ADULT"}
+	assertViolates(t, policy.CheckProduct(product), models.PolicyRuleForbiddenTags)
+
+	assert.NoError(t, policy.CheckUnits(100))
+	assertViolates(t, policy.CheckUnits(101), models.PolicyRuleMaxUnits)
+}
+
+func TestLicensePolicyRejectsInvalidPolicies(t *testing.T) {
+	assert.Error(t, models.LicensePolicy{MaxUnits: -1}.Validate())
+
+	zero := models.NewMoney(dec("0"), "USD")
+	assert.Error(t, models.LicensePolicy{PriceFloor: &zero}.Validate())
+
+	fine := models.NewMoney(dec("10.001"), "USD")
+	assert.Error(t, models.LicensePolicy{PriceFloor: &fine}.Validate())
+}
+
+func TestLicensePolicyRoundTripsThroughDatabase(t *testing.T) {
+	policy := testPolicy()
+	value, err := policy.Value()
+	require.NoError(t, err)
+
+	var scanned models.LicensePolicy
+	require.NoError(t, scanned.Scan(value))
+	assert.Equal(t, policy.AllowedCategories, scanned.AllowedCategories)
+	assert.True(t, policy.PriceFloor.Equal(*scanned.PriceFloor))
+
+	require.NoError(t, scanned.Scan(nil))
+	assert.True(t, scanned.IsEmpty())
+
+	payload, err := json.Marshal(models.LicensePolicy{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(payload))
+}
@@ -0,0 +1,54 @@
+// internal/tests/merkle_test.go
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+func TestMerkleTreeProofsVerify(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 5, 8, 13} {
+		leaves := make([]string, count)
+		for i := range leaves {
+			leaves[i] = testLedgerHash(string(rune('a' + i)))
+		}
+
+		root, proofs, err := utils.BuildMerkleTree(leaves)
+		require.NoError(t, err)
+		require.Len(t, proofs, count)
+
+		for i, leaf := range leaves {
+			assert.True(t, utils.VerifyMerkleProof(leaf, proofs[i], root), "leaf %d of %d", i, count)
+		}
+	}
+}
+
+func TestMerkleTreeRejectsTamperedProof(t *testing.T) {
+	leaves := []string{testLedgerHash("a"), testLedgerHash("b"), testLedgerHash("c")}
+
+	root, proofs, err := utils.BuildMerkleTree(leaves)
+	require.NoError(t, err)
+
+	// Wrong leaf
+	assert.False(t, utils.VerifyMerkleProof(testLedgerHash("d"), proofs[0], root))
+
+	// Proof for another leaf
+	assert.False(t, utils.VerifyMerkleProof(leaves[0], proofs[1], root))
+
+	// Swapped sibling side
+	tampered := append([]utils.MerkleProofStep(nil), proofs[0]...)
+	tampered[0].Position = utils.MerkleSiblingLeft
+	assert.False(t, utils.VerifyMerkleProof(leaves[0], tampered, root))
+}
+
+func TestMerkleTreeRequiresHexLeaves(t *testing.T) {
+	_, _, err := utils.BuildMerkleTree(nil)
+	assert.Error(t, err)
+
+	_, _, err = utils.BuildMerkleTree([]string{"not-hex"})
+	assert.Error(t, err)
+}
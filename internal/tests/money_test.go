@@ -0,0 +1,94 @@
+// internal/tests/money_test.go
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestMoneyMinorUnits(t *testing.T) {
+	assert.Equal(t, "19.99 USD", models.MoneyFromMinorUnits(1999, "usd").String())
+	assert.Equal(t, "1999 JPY", models.MoneyFromMinorUnits(1999, "JPY").String())
+	assert.Equal(t, "1.999 KWD", models.MoneyFromMinorUnits(1999, "KWD").String())
+
+	assert.Equal(t, int64(1999), models.NewMoney(dec("19.99"), "EUR").MinorUnits())
+	assert.Equal(t, int64(500), models.NewMoney(dec("500"), "JPY").MinorUnits())
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := models.NewMoney(dec("0.10"), "USD")
+
+	// Exact where floats drift: 0.1 * 3 is 0.3
+	assert.True(t, price.Mul(3).Equal(models.NewMoney(dec("0.3"), "USD")))
+	assert.Equal(t, "0.50 USD", models.NewMoney(dec("9.99"), "USD").Percent(dec("5")).String())
+
+	_, err := price.Add(models.NewMoney(dec("1"), "EUR"))
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+}
+
+func TestMoneyMarshalsAsNumber(t *testing.T) {
+	payload, err := json.Marshal(models.NewMoney(dec("12.50"), "EUR"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 12.5, "currency": "EUR"}`, string(payload))
+
+	// Models and JSONB columns write their amounts as numbers too
+	payload, err = json.Marshal(models.Payout{Amount: dec("25.50"), Currency: "USD", Method: "fake"})
+	require.NoError(t, err)
+	var payout map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &payout))
+	assert.Equal(t, 25.5, payout["amount"])
+	assert.Equal(t, "fake", payout["method"])
+
+	payload, err = json.Marshal(models.JSONB{"total_amount": dec("9.99"), "shares": []map[string]interface{}{{"amount": dec("1")}}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"total_amount": 9.99, "shares": [{"amount": 1}]}`, string(payload))
+
+	// Decimals elsewhere keep the decimal package's own format
+	payload, err = json.Marshal(dec("12.50"))
+	require.NoError(t, err)
+	assert.Equal(t, `"12.5"`, string(payload))
+}
+
+func TestExchangeServiceConvertsThroughReportingCurrency(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Currency.Reporting = "USD"
+	cfg.Currency.Rates = "EUR=1.10, JPY=0.0067"
+	exchange := services.NewExchangeService(cfg)
+
+	converted, err := exchange.ToReporting(models.NewMoney(dec("100"), "EUR"))
+	require.NoError(t, err)
+	assert.Equal(t, "110.00 USD", converted.String())
+
+	converted, err = exchange.Convert(models.NewMoney(dec("10"), "EUR"), "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "1642 JPY", converted.String())
+
+	total, err := exchange.TotalInReporting([]services.CurrencyAmount{
+		{Currency: "USD", Amount: dec("5")},
+		{Currency: "EUR", Amount: dec("10")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "16.00 USD", total.String())
+
+	_, err = exchange.ToReporting(models.NewMoney(dec("1"), "GBP"))
+	assert.ErrorIs(t, err, services.ErrNoExchangeRate)
+}
+
+func TestParseExchangeRatesRejectsInvalidRates(t *testing.T) {
+	_, err := services.ParseExchangeRates("EUR")
+	assert.Error(t, err)
+
+	_, err = services.ParseExchangeRates("EUR=-1")
+	assert.Error(t, err)
+
+	rates, err := services.ParseExchangeRates("")
+	require.NoError(t, err)
+	assert.Empty(t, rates)
+}
@@ -0,0 +1,217 @@
+// internal/tests/order_test.go
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestCheckoutRequiresPaymentMethod(t *testing.T) {
+	service := services.NewOrderService(nil, nil, nil, nil)
+
+	_, _, err := service.Checkout(uuid.New(), &services.CheckoutRequest{})
+	assert.ErrorContains(t, err, "validation failed")
+}
+
+func TestAddToCartRequiresQuantity(t *testing.T) {
+	service := services.NewOrderService(nil, nil, nil, nil)
+
+	_, err := service.AddToCart(uuid.New(), &services.AddToCartRequest{ProductID: uuid.New()})
+	assert.ErrorContains(t, err, "validation failed")
+
+	_, err = service.UpdateCartItem(uuid.New(), uuid.New(), &services.UpdateCartItemRequest{Quantity: 0})
+	assert.ErrorContains(t, err, "validation failed")
+}
+
+// testOrderServices wires the services a checkout runs through, paying with
+// the in-memory provider
+func testOrderServices(db *gorm.DB) (*services.OrderService, *services.PaymentService, *services.FakePaymentProvider) {
+	cfg := &config.Config{}
+	cfg.Payment.DefaultProvider = "fake"
+
+	inventoryService := services.NewInventoryService(db, cfg)
+	accountingService := services.NewAccountingService(db, cfg, nil)
+	paymentService := services.NewPaymentService(db, cfg, accountingService, nil, inventoryService)
+	provider := services.NewFakePaymentProvider()
+	paymentService.RegisterProvider(provider)
+
+	authorizationService := services.NewAuthorizationService(db, cfg, nil, nil)
+	productService := services.NewProductService(db, authorizationService, nil, accountingService, paymentService, inventoryService)
+
+	return services.NewOrderService(db, productService, paymentService, inventoryService), paymentService, provider
+}
+
+func addToCart(t *testing.T, orderService *services.OrderService, buyerID uuid.UUID, product *models.Product, quantity int) *services.Cart {
+	t.Helper()
+
+	cart, err := orderService.AddToCart(buyerID, &services.AddToCartRequest{ProductID: product.ID, Quantity: quantity})
+	require.NoError(t, err)
+	return cart
+}
+
+func orderTransactionOf(t *testing.T, order *models.Order, sellerID uuid.UUID) *models.Transaction {
+	t.Helper()
+
+	for i := range order.Transactions {
+		if order.Transactions[i].SellerID == sellerID {
+			return &order.Transactions[i]
+		}
+	}
+	require.Failf(t, "no transaction for seller", "seller %s", sellerID)
+	return nil
+}
+
+func revenueSharesOf(t *testing.T, db *gorm.DB, saleID uuid.UUID) ([]models.Transaction, decimal.Decimal) {
+	t.Helper()
+
+	var shares []models.Transaction
+	require.NoError(t, db.Where("parent_transaction_id = ? AND transaction_type = ?", saleID, models.TransactionTypeRevenueShare).
+		Find(&shares).Error)
+
+	total := decimal.Zero
+	for _, share := range shares {
+		total = total.Add(share.Amount)
+	}
+	return shares, total
+}
+
+func TestCheckoutSplitsOrderBySeller(t *testing.T) {
+	db := testDatabase(t)
+	orderService, _, _ := testOrderServices(db)
+
+	sellerA := testUser(t, db, models.UserTypeSecondaryCreator)
+	sellerB := testUser(t, db, models.UserTypeSecondaryCreator)
+	buyer := testUser(t, db, models.UserTypeBuyer)
+	shirt := testListedProduct(t, db, sellerA, "20.00", "USD", 5, 5)
+	mug := testListedProduct(t, db, sellerA, "10.00", "USD", 5, 5)
+	poster := testListedProduct(t, db, sellerB, "30.00", "USD", 5, 5)
+
+	addToCart(t, orderService, buyer.ID, shirt, 2)
+	addToCart(t, orderService, buyer.ID, poster, 1)
+	cart := addToCart(t, orderService, buyer.ID, mug, 1)
+	assert.Equal(t, "80", cart.Subtotal.String())
+	assert.Equal(t, "USD", cart.Currency)
+
+	order, payment, err := orderService.Checkout(buyer.ID, &services.CheckoutRequest{PaymentMethod: "fake"})
+	require.NoError(t, err)
+
+	// One payment for the order total, platform fee included in it
+	assert.Equal(t, models.TransactionStatusPending, order.Status)
+	assert.Equal(t, "80", order.Amount.String())
+	assert.Equal(t, "4", order.PlatformFee.String())
+	assert.Equal(t, order.ID, *payment.OrderID)
+	assert.Len(t, order.Items, 3)
+
+	// One transaction per seller, carrying its own part and fee
+	require.Len(t, order.Transactions, 2)
+	saleA := orderTransactionOf(t, order, sellerA.ID)
+	assert.Equal(t, "50", saleA.Amount.String())
+	assert.Equal(t, "2.5", saleA.PlatformFee.String())
+	assert.Equal(t, 3, saleA.Quantity)
+	assert.Nil(t, saleA.ProductID)
+	assert.Equal(t, payment.PaymentID, saleA.PaymentIntentID)
+
+	saleB := orderTransactionOf(t, order, sellerB.ID)
+	assert.Equal(t, "30", saleB.Amount.String())
+	assert.Equal(t, "1.5", saleB.PlatformFee.String())
+	assert.Equal(t, poster.ID, *saleB.ProductID)
+	assert.Equal(t, payment.PaymentID, saleB.PaymentIntentID)
+
+	// The units are held for the order and the cart is emptied
+	assert.Equal(t, 3, reloadProduct(t, db, shirt.ID).InventoryCount)
+	assert.Equal(t, 4, reloadProduct(t, db, poster.ID).InventoryCount)
+	emptied, err := orderService.GetCart(buyer.ID)
+	require.NoError(t, err)
+	assert.Empty(t, emptied.Items)
+}
+
+func TestCheckoutRejectsMixedCurrencyCart(t *testing.T) {
+	db := testDatabase(t)
+	orderService, _, _ := testOrderServices(db)
+
+	seller := testUser(t, db, models.UserTypeSecondaryCreator)
+	buyer := testUser(t, db, models.UserTypeBuyer)
+	dollars := testListedProduct(t, db, seller, "20.00", "USD", 5, 0)
+	euros := testListedProduct(t, db, seller, "20.00", "EUR", 5, 0)
+
+	addToCart(t, orderService, buyer.ID, dollars, 1)
+	cart := addToCart(t, orderService, buyer.ID, euros, 1)
+
+	// A mixed cart has no subtotal
+	assert.Equal(t, 2, cart.ItemCount)
+	assert.Empty(t, cart.Currency)
+	assert.True(t, cart.Subtotal.IsZero())
+
+	_, _, err := orderService.Checkout(buyer.ID, &services.CheckoutRequest{PaymentMethod: "fake"})
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+
+	// Nothing was ordered or held, and the cart is kept
+	var orders int64
+	require.NoError(t, db.Model(&models.Order{}).Where("buyer_id = ?", buyer.ID).Count(&orders).Error)
+	assert.Zero(t, orders)
+	assert.Equal(t, 5, reloadProduct(t, db, dollars.ID).InventoryCount)
+	kept, err := orderService.GetCart(buyer.ID)
+	require.NoError(t, err)
+	assert.Len(t, kept.Items, 2)
+}
+
+func TestOrderPaymentConfirmationCompletesEverySale(t *testing.T) {
+	db := testDatabase(t)
+	orderService, paymentService, provider := testOrderServices(db)
+
+	sellerA := testUser(t, db, models.UserTypeSecondaryCreator)
+	sellerB := testUser(t, db, models.UserTypeSecondaryCreator)
+	buyer := testUser(t, db, models.UserTypeBuyer)
+	shirt := testListedProduct(t, db, sellerA, "20.00", "USD", 5, 5)
+	mug := testListedProduct(t, db, sellerA, "10.00", "USD", 5, 5)
+	poster := testListedProduct(t, db, sellerB, "30.00", "USD", 5, 5)
+
+	addToCart(t, orderService, buyer.ID, shirt, 2)
+	addToCart(t, orderService, buyer.ID, mug, 1)
+	addToCart(t, orderService, buyer.ID, poster, 1)
+
+	order, payment, err := orderService.Checkout(buyer.ID, &services.CheckoutRequest{PaymentMethod: "fake"})
+	require.NoError(t, err)
+
+	require.NoError(t, provider.SucceedIntent(payment.PaymentID))
+	confirm := &services.ConfirmPaymentRequest{PaymentIntentID: payment.PaymentID, OrderID: &order.ID}
+	require.NoError(t, paymentService.ConfirmPayment(confirm))
+
+	paid, err := orderService.GetOrder(order.ID, buyer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusCompleted, paid.Status)
+	assert.NotNil(t, paid.PaidAt)
+	assert.Equal(t, payment.PaymentID, paid.PaymentReference)
+	for _, sale := range paid.Transactions {
+		assert.Equal(t, models.TransactionStatusCompleted, sale.Status)
+	}
+
+	// Each sale pays its own licensors and seller from its net amount
+	saleA := orderTransactionOf(t, paid, sellerA.ID)
+	sharesA, totalA := revenueSharesOf(t, db, saleA.ID)
+	assert.Len(t, sharesA, 3)
+	assert.Equal(t, "47.5", totalA.String())
+
+	saleB := orderTransactionOf(t, paid, sellerB.ID)
+	sharesB, totalB := revenueSharesOf(t, db, saleB.ID)
+	assert.Len(t, sharesB, 2)
+	assert.Equal(t, "28.5", totalB.String())
+
+	// The held units are sold
+	assert.Equal(t, int64(2), reloadProduct(t, db, shirt.ID).SalesCount)
+	assert.Equal(t, int64(1), reloadProduct(t, db, poster.ID).SalesCount)
+
+	// Confirming again changes nothing
+	require.NoError(t, paymentService.ConfirmPayment(confirm))
+	sharesA, _ = revenueSharesOf(t, db, saleA.ID)
+	assert.Len(t, sharesA, 3)
+}
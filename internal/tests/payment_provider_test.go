@@ -0,0 +1,229 @@
+// internal/tests/payment_provider_test.go
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+var (
+	_ services.PaymentProvider = (*services.StripePaymentProvider)(nil)
+	_ services.PaymentProvider = (*services.PayPalPaymentProvider)(nil)
+	_ services.PaymentProvider = (*services.FakePaymentProvider)(nil)
+)
+
+func TestFakePaymentProviderLifecycle(t *testing.T) {
+	provider := services.NewFakePaymentProvider()
+
+	intent, err := provider.CreateIntent(&services.IntentRequest{
+		Amount:   models.NewMoney(dec("59.98"), "USD"),
+		Metadata: map[string]string{"transaction_id": "tx-1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusPending, intent.Status)
+	assert.NotEmpty(t, intent.ClientSecret)
+
+	// Nothing can be refunded before the buyer pays
+	_, err = provider.Refund(&services.ProviderRefundRequest{PaymentReference: intent.ID, Amount: models.NewMoney(dec("10"), "USD")})
+	assert.Error(t, err)
+
+	require.NoError(t, provider.SucceedIntent(intent.ID))
+	confirmed, err := provider.ConfirmIntent(intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusCompleted, confirmed.Status)
+	assert.Equal(t, "tx-1", confirmed.Metadata["transaction_id"])
+
+	// Partial refunds add up to at most the captured amount
+	_, err = provider.Refund(&services.ProviderRefundRequest{PaymentReference: intent.ID, Amount: models.NewMoney(dec("40"), "USD")})
+	require.NoError(t, err)
+	_, err = provider.Refund(&services.ProviderRefundRequest{PaymentReference: intent.ID, Amount: models.NewMoney(dec("19.98"), "USD")})
+	require.NoError(t, err)
+	_, err = provider.Refund(&services.ProviderRefundRequest{PaymentReference: intent.ID, Amount: models.NewMoney(dec("0.01"), "USD")})
+	assert.Error(t, err)
+	assert.Equal(t, "59.98 USD", provider.Refunded(intent.ID).String())
+}
+
+func TestFakePaymentProviderDeclines(t *testing.T) {
+	provider := services.NewFakePaymentProvider()
+
+	intent, err := provider.CreateIntent(&services.IntentRequest{Amount: models.NewMoney(dec("10"), "USD")})
+	require.NoError(t, err)
+	require.NoError(t, provider.FailIntent(intent.ID))
+	assert.Error(t, provider.SucceedIntent(intent.ID))
+
+	provider.Decline = true
+	declined, err := provider.CreateIntent(&services.IntentRequest{Amount: models.NewMoney(dec("10"), "USD")})
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusFailed, declined.Status)
+
+	// The same provider pays out
+	provider.Decline = false
+	result, err := provider.Send(&models.Payout{BaseModel: models.BaseModel{ID: uuid.New()}, Amount: dec("25")})
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusPaid, result.Status)
+}
+
+func TestPaymentServiceProviderSelection(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Payment.DefaultProvider = "fake"
+	service := services.NewPaymentService(nil, cfg, nil, nil, nil)
+
+	_, err := service.Provider("card")
+	assert.Error(t, err)
+
+	service.RegisterProvider(services.NewFakePaymentProvider())
+
+	provider, err := service.Provider("fake")
+	require.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name())
+
+	// Methods that do not name a provider use the default
+	provider, err = service.Provider("card")
+	require.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name())
+}
+
+// newPayPalSandbox serves the parts of the PayPal API the provider uses
+func newPayPalSandbox(t *testing.T, payoutItemStatus *string) *httptest.Server {
+	orderStatus := "CREATED"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "client", user)
+		assert.Equal(t, "secret", pass)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token", "expires_in": 3600})
+	})
+	order := func(w http.ResponseWriter) {
+		captures := []map[string]string{}
+		if orderStatus == "COMPLETED" {
+			captures = append(captures, map[string]string{"id": "CAPTURE-1", "status": "COMPLETED"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "ORDER-1",
+			"status": orderStatus,
+			"purchase_units": []map[string]interface{}{{
+				"custom_id": "tx-1",
+				"amount":    map[string]string{"currency_code": "USD", "value": "59.98"},
+				"payments":  map[string]interface{}{"captures": captures},
+			}},
+			"links": []map[string]string{{"rel": "approve", "href": "https://paypal.test/approve/ORDER-1"}},
+		})
+	}
+	mux.HandleFunc("/v2/checkout/orders", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "intent_tx-1", r.Header.Get("PayPal-Request-Id"))
+		order(w)
+	})
+	mux.HandleFunc("/v2/checkout/orders/ORDER-1", func(w http.ResponseWriter, r *http.Request) {
+		order(w)
+	})
+	mux.HandleFunc("/v2/checkout/orders/ORDER-1/capture", func(w http.ResponseWriter, r *http.Request) {
+		orderStatus = "COMPLETED"
+		order(w)
+	})
+	mux.HandleFunc("/v2/payments/captures/CAPTURE-1/refund", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id": "REFUND-1", "status": "COMPLETED"})
+	})
+	mux.HandleFunc("/v1/payments/payouts", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"batch_header": map[string]string{"payout_batch_id": "BATCH-1", "batch_status": "PENDING"},
+		})
+	})
+	mux.HandleFunc("/v1/payments/payouts/BATCH-1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"batch_header": map[string]string{"payout_batch_id": "BATCH-1", "batch_status": "SUCCESS"},
+			"items":        []map[string]string{{"transaction_status": *payoutItemStatus}},
+		})
+	})
+
+	// The buyer approves the order on PayPal
+	mux.HandleFunc("/approve", func(w http.ResponseWriter, r *http.Request) {
+		orderStatus = "APPROVED"
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestPayPalPaymentProvider(t *testing.T) {
+	payoutItemStatus := "UNCLAIMED"
+	server := newPayPalSandbox(t, &payoutItemStatus)
+	defer server.Close()
+
+	provider := services.NewPayPalPaymentProvider(server.URL, "client", "secret")
+
+	intent, err := provider.CreateIntent(&services.IntentRequest{
+		Amount:         models.NewMoney(dec("59.98"), "USD"),
+		Metadata:       map[string]string{"transaction_id": "tx-1"},
+		IdempotencyKey: "intent_tx-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER-1", intent.ID)
+	assert.Equal(t, models.TransactionStatusPending, intent.Status)
+	assert.Equal(t, "https://paypal.test/approve/ORDER-1", intent.ApprovalURL)
+
+	// Unapproved orders are not captured
+	confirmed, err := provider.ConfirmIntent(intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusPending, confirmed.Status)
+
+	_, err = http.Get(server.URL + "/approve")
+	require.NoError(t, err)
+
+	confirmed, err = provider.ConfirmIntent(intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TransactionStatusCompleted, confirmed.Status)
+	assert.Equal(t, "59.98 USD", confirmed.Amount.String())
+	assert.Equal(t, "tx-1", confirmed.Metadata["transaction_id"])
+
+	refund, err := provider.Refund(&services.ProviderRefundRequest{PaymentReference: intent.ID, Amount: models.NewMoney(dec("20"), "USD")})
+	require.NoError(t, err)
+	assert.Equal(t, "REFUND-1", refund.ID)
+
+	payout := &models.Payout{
+		BaseModel:   models.BaseModel{ID: uuid.New()},
+		Amount:      dec("25"),
+		Currency:    "USD",
+		AccountInfo: models.JSONB{"paypal_email": "seller@example.com"},
+	}
+	result, err := provider.Send(payout)
+	require.NoError(t, err)
+	assert.Equal(t, "BATCH-1", result.Reference)
+	assert.Equal(t, models.PayoutStatusProcessing, result.Status)
+
+	// The batch settles later and is found by its reference
+	_, err = provider.PayoutStatus(payout)
+	assert.Error(t, err)
+	payout.ProviderReference = result.Reference
+
+	// A processed batch is settled by the status of its item
+	result, err = provider.PayoutStatus(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusProcessing, result.Status)
+
+	payoutItemStatus = "RETURNED"
+	result, err = provider.PayoutStatus(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusFailed, result.Status)
+	assert.Equal(t, "paypal payout item returned", result.Reason)
+
+	payoutItemStatus = "SUCCESS"
+	result, err = provider.PayoutStatus(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusPaid, result.Status)
+
+	_, err = provider.Send(&models.Payout{BaseModel: models.BaseModel{ID: uuid.New()}, Amount: dec("25")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+// internal/tests/payout_test.go
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestPayoutTransitions(t *testing.T) {
+	assert.True(t, services.CanTransitionPayout(models.PayoutStatusRequested, models.PayoutStatusApproved))
+	assert.True(t, services.CanTransitionPayout(models.PayoutStatusRequested, models.PayoutStatusRejected))
+	assert.True(t, services.CanTransitionPayout(models.PayoutStatusApproved, models.PayoutStatusProcessing))
+	assert.True(t, services.CanTransitionPayout(models.PayoutStatusProcessing, models.PayoutStatusPaid))
+	assert.True(t, services.CanTransitionPayout(models.PayoutStatusProcessing, models.PayoutStatusFailed))
+
+	// Payouts are reviewed before they are sent, and settled ones are final
+	assert.False(t, services.CanTransitionPayout(models.PayoutStatusRequested, models.PayoutStatusProcessing))
+	assert.False(t, services.CanTransitionPayout(models.PayoutStatusPaid, models.PayoutStatusFailed))
+	assert.False(t, services.CanTransitionPayout(models.PayoutStatusRejected, models.PayoutStatusApproved))
+}
+
+func TestPayoutRequestRequiresPositiveAmount(t *testing.T) {
+	payoutService := services.NewPayoutService(nil, nil, nil, nil)
+	payoutService.RegisterProvider(services.NewFakePayoutProvider())
+
+	_, err := payoutService.RequestPayout(uuid.New(), &services.PayoutRequest{
+		Amount:   dec("-25.00"),
+		Currency: "USD",
+		Method:   "fake",
+	})
+	assert.EqualError(t, err, "amount must be positive")
+
+	_, err = payoutService.RequestPayout(uuid.New(), &services.PayoutRequest{Currency: "USD", Method: "fake"})
+	assert.Error(t, err)
+}
+
+func TestFakePayoutProvider(t *testing.T) {
+	var provider services.PayoutProvider = services.NewFakePayoutProvider()
+	payout := &models.Payout{BaseModel: models.BaseModel{ID: uuid.New()}, Amount: dec("25"), Currency: "USD"}
+
+	result, err := provider.Send(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusPaid, result.Status)
+	assert.NotEmpty(t, result.Reference)
+
+	fake := provider.(*services.FakePayoutProvider)
+	require.Len(t, fake.Sent(), 1)
+	assert.Equal(t, payout.ID, fake.Sent()[0].ID)
+
+	fake.Pending = true
+	result, err = fake.Send(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusProcessing, result.Status)
+
+	fake.Err = errors.New("account closed")
+	_, err = fake.Send(payout)
+	assert.EqualError(t, err, "account closed")
+	assert.Len(t, fake.Sent(), 2)
+}
+
+func TestFakePayoutProviderSettlesPendingPayouts(t *testing.T) {
+	provider := services.NewFakePayoutProvider()
+	provider.Pending = true
+	payout := &models.Payout{BaseModel: models.BaseModel{ID: uuid.New()}, Amount: dec("25"), Currency: "USD"}
+
+	sent, err := provider.Send(payout)
+	require.NoError(t, err)
+
+	status, err := provider.PayoutStatus(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusProcessing, status.Status)
+
+	provider.Pending = false
+	status, err = provider.PayoutStatus(payout)
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusPaid, status.Status)
+	assert.Equal(t, sent.Reference, status.Reference)
+
+	// A payout the provider never accepted can be failed safely
+	status, err = provider.PayoutStatus(&models.Payout{BaseModel: models.BaseModel{ID: uuid.New()}})
+	require.NoError(t, err)
+	assert.Equal(t, models.PayoutStatusFailed, status.Status)
+	assert.NotEmpty(t, status.Reason)
+}
+
+func TestReconcileKeepsUncheckablePayoutsProcessing(t *testing.T) {
+	db := testDatabase(t)
+
+	cfg := &config.Config{}
+	cfg.Payment.PayoutStaleHours = 72
+	payoutService := services.NewPayoutService(db, cfg, services.NewAccountingService(db, cfg, nil), services.NewNotificationService(db, cfg))
+	provider := services.NewFakePayoutProvider()
+	payoutService.RegisterProvider(provider)
+
+	processedAt := time.Now().Add(-100 * time.Hour)
+	payout := &models.Payout{
+		UserID:      testUser(t, db, models.UserTypeCreator).ID,
+		Amount:      dec("25"),
+		Currency:    "USD",
+		Method:      provider.Name(),
+		Status:      models.PayoutStatusProcessing,
+		ProcessedAt: &processedAt,
+	}
+	require.NoError(t, db.Create(payout).Error)
+
+	// The provider cannot be reached, so the money may have left
+	provider.Err = errors.New("provider unavailable")
+	for i := 0; i < 2; i++ {
+		_, err := payoutService.ReconcilePayouts()
+		require.NoError(t, err)
+	}
+
+	var reloaded models.Payout
+	require.NoError(t, db.First(&reloaded, payout.ID).Error)
+	assert.Equal(t, models.PayoutStatusProcessing, reloaded.Status)
+
+	var flagged int64
+	require.NoError(t, db.Model(&models.AdminNotification{}).
+		Where("type = ? AND related_resource_id = ?", models.AdminNotificationStalePayout, payout.ID).
+		Count(&flagged).Error)
+	assert.Equal(t, int64(1), flagged)
+}
@@ -0,0 +1,42 @@
+// internal/tests/qrcode_test.go
+package tests
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+const testVerifyURL = "https://example.com/verify/AbCdEfGhIjKlMnOpQrStUvWxYz012345"
+
+func TestQRCodePNG(t *testing.T) {
+	image, err := utils.QRCodePNG(testVerifyURL, 256)
+	require.NoError(t, err)
+
+	decoded, err := png.Decode(bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, 256, decoded.Bounds().Dx())
+	assert.Equal(t, 256, decoded.Bounds().Dy())
+}
+
+func TestQRCodeSVG(t *testing.T) {
+	image, err := utils.QRCodeSVG(testVerifyURL, 300)
+	require.NoError(t, err)
+
+	var svg struct {
+		XMLName xml.Name `xml:"svg"`
+		Width   string   `xml:"width,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	require.NoError(t, xml.Unmarshal(image, &svg))
+	assert.Equal(t, "300", svg.Width)
+	assert.NotEmpty(t, svg.Path.D)
+}
@@ -0,0 +1,104 @@
+// internal/tests/refund_test.go
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestRefundRequiresReason(t *testing.T) {
+	service := services.NewPaymentService(nil, nil, nil, nil, nil)
+
+	_, err := service.ProcessRefund(&services.RefundRequest{TransactionID: uuid.New()}, nil)
+	assert.ErrorContains(t, err, "validation failed")
+
+	_, err = service.ProcessRefund(&services.RefundRequest{
+		TransactionID:   uuid.New(),
+		Reason:          "Damaged in transit",
+		Restock:         true,
+		RestockQuantity: -1,
+	}, nil)
+	assert.ErrorContains(t, err, "validation failed")
+}
+
+func TestPartialRefundsMarkTransactionRefunded(t *testing.T) {
+	transaction := &models.Transaction{
+		TransactionType: models.TransactionTypeProductSale,
+		Amount:          dec("100.00"),
+		Currency:        "USD",
+		Status:          models.TransactionStatusCompleted,
+	}
+	now := time.Now()
+
+	first, err := services.RefundAmount(transaction, decimal.Zero, dec("30"))
+	require.NoError(t, err)
+	assert.False(t, transaction.AddRefund(first.Amount, "Damaged", now))
+
+	// A refund still with the provider counts against what is left
+	_, err = services.RefundAmount(transaction, dec("50"), dec("30"))
+	assert.ErrorContains(t, err, "exceeds the 20.00 USD left to refund")
+
+	second, err := services.RefundAmount(transaction, decimal.Zero, dec("45.50"))
+	require.NoError(t, err)
+	assert.False(t, transaction.AddRefund(second.Amount, "", now))
+	assert.Equal(t, models.TransactionStatusCompleted, transaction.Status)
+	assert.Equal(t, "Damaged", transaction.RefundReason)
+
+	// Without an amount, the rest is refunded
+	rest, err := services.RefundAmount(transaction, decimal.Zero, decimal.Zero)
+	require.NoError(t, err)
+	assert.Equal(t, "24.50 USD", rest.String())
+	assert.True(t, transaction.AddRefund(rest.Amount, "Returned", now))
+	assert.Equal(t, models.TransactionStatusRefunded, transaction.Status)
+	assert.True(t, transaction.RefundedAmount.Equal(dec("100")))
+
+	_, err = services.RefundAmount(transaction, decimal.Zero, decimal.Zero)
+	assert.ErrorContains(t, err, "already been fully refunded")
+}
+
+func TestRefundAmountRejectsInvalidRefunds(t *testing.T) {
+	transaction := &models.Transaction{
+		TransactionType: models.TransactionTypeProductSale,
+		Amount:          dec("10.00"),
+		Currency:        "USD",
+		Status:          models.TransactionStatusCompleted,
+	}
+
+	_, err := services.RefundAmount(transaction, decimal.Zero, dec("1.005"))
+	assert.ErrorContains(t, err, "decimal places")
+
+	_, err = services.RefundAmount(transaction, dec("10"), decimal.Zero)
+	assert.ErrorContains(t, err, "already being refunded")
+
+	transaction.Status = models.TransactionStatusPending
+	_, err = services.RefundAmount(transaction, decimal.Zero, decimal.Zero)
+	assert.ErrorContains(t, err, "completed transactions")
+
+	transaction.TransactionType = models.TransactionTypeRevenueShare
+	_, err = services.RefundAmount(transaction, decimal.Zero, decimal.Zero)
+	assert.ErrorContains(t, err, "refunded through their sale")
+}
+
+func TestRestockSplitReturnsUnitsProductByProduct(t *testing.T) {
+	reservations := []models.InventoryReservation{
+		{Quantity: 3, RestockedQuantity: 1},
+		{Quantity: 2},
+		{Quantity: 4, RestockedQuantity: 4},
+		{Quantity: 5},
+	}
+
+	assert.Equal(t, []int{2, 2, 0, 5}, services.RestockSplit(reservations, 0))
+	assert.Equal(t, []int{2, 1, 0, 0}, services.RestockSplit(reservations, 3))
+	assert.Equal(t, []int{2, 2, 0, 3}, services.RestockSplit(reservations, 7))
+
+	// Asking for more than is out returns what is left
+	assert.Equal(t, []int{2, 2, 0, 5}, services.RestockSplit(reservations, 20))
+}
@@ -0,0 +1,94 @@
+// internal/tests/revenue_cascade_test.go
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func testLineageLicense(creatorID uuid.UUID, percent string) models.LicenseApplication {
+	ipAssetID := uuid.New()
+	return models.LicenseApplication{
+		BaseModel:    models.BaseModel{ID: uuid.New()},
+		IPAssetID:    ipAssetID,
+		IPAsset:      models.IPAsset{BaseModel: models.BaseModel{ID: ipAssetID}, CreatorID: creatorID},
+		LicenseTerms: models.LicenseTerms{RevenueSharePercentage: dec(percent)},
+	}
+}
+
+func TestRevenueCascadeSingleLevel(t *testing.T) {
+	authorizationService := services.NewAuthorizationService(nil, nil, nil, nil)
+	creatorID := uuid.New()
+
+	shares := authorizationService.CalculateRevenueCascade(models.NewMoney(dec("100"), "USD"), []models.LicenseApplication{
+		testLineageLicense(creatorID, "20"),
+	})
+
+	require.Len(t, shares, 1)
+	assert.Equal(t, creatorID, shares[0].RecipientID)
+	assert.Equal(t, "20.00", shares[0].Amount.StringFixed(2))
+}
+
+func TestRevenueCascadeDerivativeLevels(t *testing.T) {
+	authorizationService := services.NewAuthorizationService(nil, nil, nil, nil)
+	derivativeCreatorID := uuid.New()
+	originalCreatorID := uuid.New()
+
+	// Product under a derivative licensed at 40%, derived from an original licensed at 25%
+	shares := authorizationService.CalculateRevenueCascade(models.NewMoney(dec("200"), "USD"), []models.LicenseApplication{
+		testLineageLicense(derivativeCreatorID, "40"),
+		testLineageLicense(originalCreatorID, "25"),
+	})
+
+	require.Len(t, shares, 2)
+
+	// The derivative creator receives 80 and passes 25% of it upstream
+	assert.Equal(t, derivativeCreatorID, shares[0].RecipientID)
+	assert.Equal(t, 0, shares[0].Depth)
+	assert.Equal(t, "60.00", shares[0].Amount.StringFixed(2))
+
+	assert.Equal(t, originalCreatorID, shares[1].RecipientID)
+	assert.Equal(t, 1, shares[1].Depth)
+	assert.Equal(t, "20.00", shares[1].Amount.StringFixed(2))
+
+	// Licensors never receive more than the product creator's net revenue
+	assert.Equal(t, "80.00", shares[0].Amount.Add(shares[1].Amount).StringFixed(2))
+}
+
+func TestChainNodeRequiresApprovedLineage(t *testing.T) {
+	node := func() *models.AuthorizationChain {
+		return &models.AuthorizationChain{
+			IsActive: true,
+			IPAsset:  models.IPAsset{VerificationStatus: models.VerificationStatusApproved},
+			License:  models.LicenseApplication{Status: models.ApplicationStatusApproved, IsActive: true},
+		}
+	}
+	assert.NoError(t, services.CheckChainNode(node()))
+
+	inactive := node()
+	inactive.IsActive = false
+	assert.Error(t, services.CheckChainNode(inactive))
+
+	unapprovedAsset := node()
+	unapprovedAsset.IPAsset.VerificationStatus = models.VerificationStatusRejected
+	assert.Error(t, services.CheckChainNode(unapprovedAsset))
+
+	revoked := node()
+	revoked.License.Status = models.ApplicationStatusRevoked
+	assert.Error(t, services.CheckChainNode(revoked))
+
+	// A derivative asset must hang off the license it was derived under
+	parentLicenseID := uuid.New()
+	derivative := node()
+	derivative.IPAsset.ParentLicenseID = &parentLicenseID
+	assert.Error(t, services.CheckChainNode(derivative))
+
+	derivative.ParentChain = &models.AuthorizationChain{LicenseID: parentLicenseID}
+	assert.NoError(t, services.CheckChainNode(derivative))
+}
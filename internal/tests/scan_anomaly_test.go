@@ -0,0 +1,119 @@
+// internal/tests/scan_anomaly_test.go
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+	"github.com/javajoker/imi-backend/internal/utils"
+)
+
+func TestScanRegion(t *testing.T) {
+	// The CDN country header wins over the address
+	assert.Equal(t, "DE", utils.ScanRegion("203.0.113.7", "de"))
+
+	// Unknown countries fall back to the client network
+	assert.Equal(t, "net:203.0.0.0/16", utils.ScanRegion("203.0.113.7", "XX"))
+	assert.Equal(t, "net:203.0.0.0/16", utils.ScanRegion("203.0.55.1", ""))
+	assert.Equal(t, "net:2001:db8::/32", utils.ScanRegion("2001:db8:1234::1", ""))
+
+	assert.Equal(t, "local", utils.ScanRegion("192.168.1.10", ""))
+	assert.Equal(t, "unknown", utils.ScanRegion("not-an-ip", ""))
+}
+
+func TestScanAnomalyThresholds(t *testing.T) {
+	scanService := services.NewScanService(nil, &config.Config{
+		Scan: config.ScanConfig{MaxRegions: 3, MaxScans: 20},
+	}, nil)
+
+	assert.Empty(t, scanService.EvaluateScanWindow(services.ScanWindowStats{Scans: 20, Regions: 3}))
+
+	reasons := scanService.EvaluateScanWindow(services.ScanWindowStats{Scans: 4, Regions: 4})
+	require.Len(t, reasons, 1)
+	assert.Contains(t, reasons[0], "4 regions")
+
+	reasons = scanService.EvaluateScanWindow(services.ScanWindowStats{Scans: 21, Regions: 9})
+	assert.Len(t, reasons, 2)
+}
+
+func TestScanRegionHeaderOnlyTrustedFromProxies(t *testing.T) {
+	scanService := services.NewScanService(nil, &config.Config{
+		Scan: config.ScanConfig{RegionHeader: "CF-IPCountry", TrustedProxies: "173.245.48.0/20, 2400:cb00::/32,10.0.0.5"},
+	}, nil)
+
+	assert.Equal(t, "CF-IPCountry", scanService.RegionHeader("173.245.50.1"))
+	assert.Equal(t, "CF-IPCountry", scanService.RegionHeader("2400:cb00::1"))
+	assert.Equal(t, "CF-IPCountry", scanService.RegionHeader("10.0.0.5"))
+	assert.Empty(t, scanService.RegionHeader("10.0.0.6"))
+	assert.Empty(t, scanService.RegionHeader("203.0.113.7"))
+
+	// Without trusted proxies the header is never honoured
+	untrusting := services.NewScanService(nil, &config.Config{
+		Scan: config.ScanConfig{RegionHeader: "CF-IPCountry"},
+	}, nil)
+	assert.Empty(t, untrusting.RegionHeader("173.245.50.1"))
+
+	_, err := utils.ParseNetworks("10.0.0.0/8,not-an-ip")
+	assert.Error(t, err)
+}
+
+func TestScanOfUnsoldUnitIsFlagged(t *testing.T) {
+	db := testDatabase(t)
+	cfg := &config.Config{}
+	authorizationService := services.NewAuthorizationService(db, cfg, nil, nil)
+	scanService := services.NewScanService(db, cfg, services.NewNotificationService(db, cfg))
+
+	seller := testUser(t, db, models.UserTypeSecondaryCreator)
+	product := testListedProduct(t, db, seller, "25.00", "USD", 2, 2)
+	_, err := authorizationService.CreateProductAuthChain(product)
+	require.NoError(t, err)
+
+	var units []models.ProductUnit
+	require.NoError(t, db.Where("product_id = ?", product.ID).Order("serial_number").Find(&units).Error)
+	require.Len(t, units, 2)
+
+	// Selling one unit claims the lowest serial
+	_, err = services.NewInventoryService(db, cfg).Hold(db, product.ID, uuid.New(), 1)
+	require.NoError(t, err)
+
+	authChain, sold, err := authorizationService.ScanProductCode(units[0].VerificationCode)
+	require.NoError(t, err)
+	assert.False(t, sold.Unsold)
+	assert.Equal(t, models.UnitStatusScanned, sold.Unit.Status)
+
+	// The product is genuine, but the unsold unit is reported as such
+	_, unsold, err := authorizationService.ScanProductCode(units[1].VerificationCode)
+	require.NoError(t, err)
+	assert.True(t, unsold.Unsold)
+	assert.Equal(t, models.UnitStatusUnclaimed, unsold.Unit.Status)
+
+	require.NoError(t, scanService.RecordScan(&services.ScanEvent{
+		VerificationCode: units[1].VerificationCode,
+		ProductID:        &authChain.ProductID,
+		UnitID:           &unsold.Unit.ID,
+		Result:           models.ScanResultVerified,
+		IPAddress:        "203.0.113.7",
+		UnsoldUnit:       true,
+	}))
+
+	var alerts int64
+	require.NoError(t, db.Model(&models.AdminNotification{}).
+		Where("type = ? AND related_resource_id = ?", models.AdminNotificationSuspectedCounterfeit, unsold.Unit.ID).
+		Count(&alerts).Error)
+	assert.Equal(t, int64(1), alerts)
+}
+
+func TestConfigRejectsInvalidTrustedProxies(t *testing.T) {
+	cfg := &config.Config{Environment: "development"}
+	cfg.Server.TrustedProxies = "10.0.0.0/8, 192.168.1.10"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.TrustedProxies = "10.0.0.0/8,proxy.internal"
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,106 @@
+// internal/tests/stripe_webhook_test.go
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v74/webhook"
+
+	"github.com/javajoker/imi-backend/internal/config"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+const testWebhookSecret = "whsec_test_secret"
+
+func newWebhookPaymentService() *services.PaymentService {
+	cfg := &config.Config{}
+	cfg.Payment.StripeWebhookSecret = testWebhookSecret
+	return services.NewPaymentService(nil, cfg, nil, nil, nil)
+}
+
+// signedFixture loads a Stripe event fixture and signs it as Stripe would
+func signedFixture(t *testing.T, name, secret string) ([]byte, string) {
+	payload, err := os.ReadFile(filepath.Join("testdata", "stripe", name))
+	require.NoError(t, err)
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload:   payload,
+		Secret:    secret,
+		Timestamp: time.Now(),
+	})
+	return signed.Payload, signed.Header
+}
+
+func TestStripeWebhookPaymentSucceeded(t *testing.T) {
+	payload, header := signedFixture(t, "payment_intent_succeeded.json", testWebhookSecret)
+
+	event, err := newWebhookPaymentService().ConstructStripeEvent(payload, header)
+	require.NoError(t, err)
+
+	assert.Equal(t, "evt_3PaymentSucceeded", event.ID)
+	assert.Equal(t, services.StripeEventPaymentSucceeded, event.Type)
+	assert.Equal(t, "pi_3Succeeded", event.PaymentIntentID)
+	require.NotNil(t, event.TransactionID)
+	assert.Equal(t, "7a1c2f0e-4b5d-4e6f-9a8b-1c2d3e4f5a6b", event.TransactionID.String())
+}
+
+func TestStripeWebhookPaymentFailed(t *testing.T) {
+	payload, header := signedFixture(t, "payment_intent_payment_failed.json", testWebhookSecret)
+
+	event, err := newWebhookPaymentService().ConstructStripeEvent(payload, header)
+	require.NoError(t, err)
+
+	assert.Equal(t, services.StripeEventPaymentFailed, event.Type)
+	assert.Equal(t, "pi_3Failed", event.PaymentIntentID)
+	assert.Nil(t, event.TransactionID)
+	assert.Equal(t, "Your card was declined.", event.FailureMessage)
+}
+
+func TestStripeWebhookPaymentCanceled(t *testing.T) {
+	payload, header := signedFixture(t, "payment_intent_canceled.json", testWebhookSecret)
+
+	event, err := newWebhookPaymentService().ConstructStripeEvent(payload, header)
+	require.NoError(t, err)
+
+	// Expired intents release the transaction like failed ones
+	assert.Equal(t, services.StripeEventPaymentCanceled, event.Type)
+	assert.Equal(t, "pi_3Canceled", event.PaymentIntentID)
+	require.NotNil(t, event.TransactionID)
+	assert.Equal(t, "canceled: abandoned", event.FailureMessage)
+}
+
+func TestStripeWebhookChargeRefunded(t *testing.T) {
+	payload, header := signedFixture(t, "charge_refunded.json", testWebhookSecret)
+
+	event, err := newWebhookPaymentService().ConstructStripeEvent(payload, header)
+	require.NoError(t, err)
+
+	assert.Equal(t, services.StripeEventChargeRefunded, event.Type)
+	assert.Equal(t, "ch_3Refunded", event.ChargeID)
+	assert.Equal(t, "pi_3Succeeded", event.PaymentIntentID)
+	assert.Equal(t, "25.00 USD", event.AmountRefunded.String())
+}
+
+func TestStripeWebhookRejectsBadSignatures(t *testing.T) {
+	service := newWebhookPaymentService()
+
+	// Signed with another endpoint's secret
+	payload, header := signedFixture(t, "payment_intent_succeeded.json", "whsec_other_secret")
+	_, err := service.ConstructStripeEvent(payload, header)
+	assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature)
+
+	// Payload changed after signing
+	payload, header = signedFixture(t, "charge_refunded.json", testWebhookSecret)
+	tampered := []byte(string(payload[:len(payload)-2]) + " }")
+	_, err = service.ConstructStripeEvent(tampered, header)
+	assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature)
+
+	// Missing header
+	_, err = service.ConstructStripeEvent(payload, "")
+	assert.ErrorIs(t, err, services.ErrInvalidWebhookSignature)
+}
@@ -0,0 +1,70 @@
+// internal/tests/territory_test.go
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javajoker/imi-backend/internal/models"
+	"github.com/javajoker/imi-backend/internal/services"
+)
+
+func TestTerritorySetCoversRegionsLessExclusions(t *testing.T) {
+	territory, err := models.ParseTerritorySet("eu, us, -hu")
+	require.NoError(t, err)
+	assert.Equal(t, "EU,US,-HU", territory.String())
+
+	assert.True(t, territory.Covers("FR"))
+	assert.True(t, territory.Covers("us"))
+	assert.False(t, territory.Covers("HU"))
+	assert.False(t, territory.Covers("CA"))
+	assert.False(t, territory.Covers("XX"))
+	assert.False(t, territory.IsGlobal())
+}
+
+func TestTerritorySetDefaultsToWorldwide(t *testing.T) {
+	for _, spec := range []string{"", "global", "Worldwide"} {
+		territory, err := models.ParseTerritorySet(spec)
+		require.NoError(t, err)
+		assert.True(t, territory.IsGlobal(), spec)
+		assert.True(t, territory.Covers("JP"), spec)
+	}
+}
+
+func TestTerritorySetRejectsUnknownTerritories(t *testing.T) {
+	_, err := models.ParseTerritorySet("US,Atlantis")
+	assert.ErrorContains(t, err, "unknown territory")
+
+	_, err = models.ParseTerritorySet("DACH,-DE,-AT,-CH")
+	assert.ErrorContains(t, err, "covers no country")
+}
+
+func TestTerritorySetIntersect(t *testing.T) {
+	upstream, err := models.ParseTerritorySet("NORTH_AMERICA")
+	require.NoError(t, err)
+	own, err := models.ParseTerritorySet("US,GB")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"US"}, own.Intersect(upstream).Countries())
+	assert.Equal(t, own, own.Intersect(models.GlobalTerritory()))
+}
+
+func TestTerritorySetJSON(t *testing.T) {
+	var fromString, fromObject models.TerritorySet
+	require.NoError(t, json.Unmarshal([]byte(`"EU,-FR"`), &fromString))
+	require.NoError(t, json.Unmarshal([]byte(`{"include": ["eu"], "exclude": ["fr"]}`), &fromObject))
+	assert.Equal(t, fromString, fromObject)
+
+	payload, err := json.Marshal(fromString)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"include": ["EU"], "exclude": ["FR"]}`, string(payload))
+}
+
+func TestShippingCountry(t *testing.T) {
+	assert.Equal(t, "DE", services.ShippingCountry(map[string]interface{}{"country": " de "}))
+	assert.Equal(t, "US", services.ShippingCountry(map[string]interface{}{"country_code": "US"}))
+	assert.Equal(t, "", services.ShippingCountry(nil))
+}
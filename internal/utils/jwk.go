@@ -0,0 +1,79 @@
+// internal/utils/jwk.go
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JWK is a public JSON Web Key (RFC 7517) for an Ed25519 key (RFC 8037)
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewEd25519JWK describes a signing public key. The key ID is its RFC 7638
+// thumbprint, so verifiers can recompute it from the key alone.
+func NewEd25519JWK(publicKey ed25519.PublicKey) JWK {
+	x := base64.RawURLEncoding.EncodeToString(publicKey)
+
+	// Thumbprint input: required members in lexicographic order, no whitespace
+	thumbprint := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, x)))
+
+	return JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   x,
+		Kid: base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+		Use: "sig",
+		Alg: "EdDSA",
+	}
+}
+
+// PublicKey decodes the Ed25519 public key of the JWK
+func (k JWK) PublicKey() (ed25519.PublicKey, error) {
+	if k.Kty != "OKP" || k.Crv != "Ed25519" {
+		return nil, errors.New("unsupported key type")
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key")
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// ParseEd25519PrivateKey decodes a base64-encoded Ed25519 seed (32 bytes) or
+// private key (64 bytes)
+func ParseEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if raw, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, errors.New("signing key must be base64 encoded")
+		}
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("signing key must be a %d-byte Ed25519 seed", ed25519.SeedSize)
+	}
+}
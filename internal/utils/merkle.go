@@ -0,0 +1,119 @@
+// internal/utils/merkle.go
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// MerkleAlgorithm names the tree construction below so that proofs can be
+// checked offline: leaves are SHA-256(0x00 || leaf), interior nodes are
+// SHA-256(0x01 || left || right) as in RFC 6962, and an unpaired node at the
+// end of a level is promoted to the next level unchanged.
+const MerkleAlgorithm = "sha256-rfc6962"
+
+const (
+	MerkleSiblingLeft  = "left"
+	MerkleSiblingRight = "right"
+)
+
+type MerkleProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"` // side of the sibling relative to the running hash
+}
+
+// BuildMerkleTree returns the root over hex-encoded leaves and one inclusion
+// proof per leaf, in the same order as the input.
+func BuildMerkleTree(leaves []string) (string, [][]MerkleProofStep, error) {
+	if len(leaves) == 0 {
+		return "", nil, errors.New("merkle tree requires at least one leaf")
+	}
+
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		decoded, err := hex.DecodeString(leaf)
+		if err != nil {
+			return "", nil, errors.New("merkle leaves must be hex encoded")
+		}
+		level[i] = merkleLeafHash(decoded)
+	}
+
+	// positions[i] tracks the index of leaf i's ancestor within the current level
+	proofs := make([][]MerkleProofStep, len(leaves))
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNodeHash(level[i], level[i+1]))
+		}
+
+		for leaf, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				position := MerkleSiblingRight
+				if sibling < pos {
+					position = MerkleSiblingLeft
+				}
+				proofs[leaf] = append(proofs[leaf], MerkleProofStep{
+					Hash:     hex.EncodeToString(level[sibling]),
+					Position: position,
+				})
+			}
+			positions[leaf] = pos / 2
+		}
+
+		level = next
+	}
+
+	return hex.EncodeToString(level[0]), proofs, nil
+}
+
+// VerifyMerkleProof checks that a hex-encoded leaf is included under root
+func VerifyMerkleProof(leaf string, proof []MerkleProofStep, root string) bool {
+	decoded, err := hex.DecodeString(leaf)
+	if err != nil {
+		return false
+	}
+
+	current := merkleLeafHash(decoded)
+	for _, step := range proof {
+		sibling, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+
+		switch step.Position {
+		case MerkleSiblingLeft:
+			current = merkleNodeHash(sibling, current)
+		case MerkleSiblingRight:
+			current = merkleNodeHash(current, sibling)
+		default:
+			return false
+		}
+	}
+
+	return hex.EncodeToString(current) == root
+}
+
+func merkleLeafHash(leaf []byte) []byte {
+	hash := sha256.Sum256(append([]byte{0x00}, leaf...))
+	return hash[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	data := make([]byte, 0, 1+len(left)+len(right))
+	data = append(data, 0x01)
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
@@ -0,0 +1,46 @@
+// internal/utils/qrcode.go
+package utils
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// QRCodePNG renders content as a square PNG of size pixels
+func QRCodePNG(content string, size int) ([]byte, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return qr.PNG(size)
+}
+
+// QRCodeSVG renders content as a square SVG of size pixels. Dark modules are
+// drawn as one path so the output scales cleanly when printed.
+func QRCodeSVG(content string, size int) ([]byte, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	// The bitmap includes the quiet zone around the symbol
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/><path fill="#000000" d="`, modules, modules)
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,91 @@
+// internal/utils/region.go
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ScanRegion derives a coarse region for a client. A two-letter country code
+// set by the CDN wins; otherwise the client network (/16 for IPv4, /32 for
+// IPv6) stands in for the region, which is enough to tell distant scanners
+// apart without a GeoIP database.
+func ScanRegion(ip, country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	// XX and T1 are Cloudflare's unknown and Tor values
+	if len(country) == 2 && country != "XX" && country != "T1" && isASCIILetters(country) {
+		return country
+	}
+
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return "unknown"
+	}
+
+	if parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsLinkLocalUnicast() {
+		return "local"
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		network := v4.Mask(net.CIDRMask(16, 32))
+		return fmt.Sprintf("net:%s/16", network)
+	}
+
+	network := parsed.Mask(net.CIDRMask(32, 128))
+	return fmt.Sprintf("net:%s/32", network)
+}
+
+func isASCIILetters(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseNetworks parses a comma-separated list of IP addresses and CIDR ranges
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 128
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// IPInNetworks reports whether ip falls within any of networks
+func IPInNetworks(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,11 +2,13 @@
 package utils
 
 import (
+	"reflect"
 	"regexp"
 	"strings"
 	"unicode"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/shopspring/decimal"
 )
 
 var validate *validator.Validate
@@ -15,12 +17,23 @@ func init() {
 	validate = validator.New()
 	validate.RegisterValidation("strong_password", validateStrongPassword)
 	validate.RegisterValidation("username", validateUsername)
+
+	// Let min, max and required check decimal amounts by value
+	validate.RegisterCustomTypeFunc(decimalValue, decimal.Decimal{})
 }
 
 func ValidateStruct(s interface{}) error {
 	return validate.Struct(s)
 }
 
+func decimalValue(field reflect.Value) interface{} {
+	if value, ok := field.Interface().(decimal.Decimal); ok {
+		f, _ := value.Float64()
+		return f
+	}
+	return nil
+}
+
 func validateStrongPassword(fl validator.FieldLevel) bool {
 	password := fl.Field().String()
 